@@ -31,6 +31,11 @@ import (
 // @name Authorization
 // @description Type "Bearer" followed by a space and JWT token
 
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @description Personal API key created via /api/user/api-keys
+
 func main() {
 	// Создаем логгер
 	appLogger, err := logger.NewLogger("app.log")
@@ -41,6 +46,9 @@ func main() {
 
 	// Загружаем конфигурацию
 	cfg := internal.NewConfig()
+	if err := cfg.Validate(); err != nil {
+		appLogger.Fatal("Invalid configuration: %v", err)
+	}
 
 	appLogger.Info("Starting Obscura API server...")
 	appLogger.Info("Configuration loaded: ML service enabled: %v, URL: %s", cfg.MLServiceEnabled, cfg.MLServiceURL)
@@ -57,7 +65,10 @@ func main() {
 	}
 
 	// Создаем сервер
-	server := internal.NewServer(cfg, db, appLogger)
+	server, err := internal.NewServer(cfg, db, appLogger)
+	if err != nil {
+		appLogger.Fatal("Failed to create server: %v", err)
+	}
 
 	// Настраиваем роуты
 	server.SetupRoutes()
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"obscura.app/internal"
+	"obscura.app/pkg/logger"
+)
+
+// obscura-fsck проверяет согласованность записей File и файлов в UPLOAD_PATH.
+// Использует те же переменные окружения, что и основной сервер.
+//
+//	obscura-fsck                  # только отчет
+//	obscura-fsck -repair          # исправить найденные расхождения
+//	obscura-fsck -o report.json   # записать отчет в файл
+func main() {
+	repair := flag.Bool("repair", false, "Repair discrepancies: mark records failed, quarantine orphans, recompute user totals")
+	output := flag.String("o", "-", "Where to write the JSON report (- for stdout)")
+	logPath := flag.String("log", "fsck.log", "Log file path")
+	flag.Parse()
+
+	appLogger, err := logger.NewLogger(*logPath)
+	if err != nil {
+		log.Fatal("Failed to create logger:", err)
+	}
+	defer appLogger.Close()
+
+	cfg := internal.NewConfig()
+
+	db, err := internal.NewDatabase(cfg, appLogger)
+	if err != nil {
+		appLogger.Fatal("Failed to connect to database: %v", err)
+	}
+
+	checker := internal.NewStorageChecker(cfg.UploadPath, cfg.QuarantinePath, db, appLogger)
+
+	report, err := checker.Check(*repair)
+	if err != nil {
+		appLogger.Fatal("Storage check failed: %v", err)
+	}
+
+	out := os.Stdout
+	if *output != "-" {
+		out, err = os.Create(*output)
+		if err != nil {
+			appLogger.Fatal("Failed to create report file: %v", err)
+		}
+		defer out.Close()
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		appLogger.Fatal("Failed to write report: %v", err)
+	}
+
+	// Ненулевой код выхода, если остались неисправленные расхождения
+	for _, issue := range report.Issues {
+		if !issue.Repaired {
+			out.Close()
+			appLogger.Close()
+			os.Exit(2)
+		}
+	}
+}
@@ -41,41 +41,82 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/admin/stats": {
+        "/.well-known/jwks.json": {
             "get": {
-                "description": "Get administrative statistics about server, file system, ML service and rate limiter",
+                "description": "Public keys for verifying access tokens issued by this service (empty when tokens are signed with a shared HS256 secret)",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "admin"
+                    "auth"
                 ],
-                "summary": "Admin statistics",
+                "summary": "JSON Web Key Set",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/internal.SuccessResponse"
+                            "type": "object",
+                            "additionalProperties": true
                         }
                     }
                 }
             }
         },
-        "/api/files": {
+        "/api/admin/audit": {
             "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Get list of all files uploaded by the authenticated user with their processing status",
+                "description": "Security events (lockouts, unlocks and other alerts), newest first. Available to admins and auditors",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "files"
+                    "admin"
+                ],
+                "summary": "Audit log",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event type, e.g. login.lockout",
+                        "name": "action",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "info",
+                            "warning",
+                            "alert"
+                        ],
+                        "type": "string",
+                        "description": "Severity filter",
+                        "name": "severity",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Events initiated by or affecting this user",
+                        "name": "user_id",
+                        "in": "query"
+                    },
+                    {
+                        "maximum": 200,
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 0,
+                        "description": "Page offset",
+                        "name": "offset",
+                        "in": "query"
+                    }
                 ],
-                "summary": "Get user files",
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -88,18 +129,21 @@ const docTemplate = `{
                                     "type": "object",
                                     "properties": {
                                         "data": {
-                                            "type": "array",
-                                            "items": {
-                                                "$ref": "#/definitions/internal.File"
-                                            }
+                                            "$ref": "#/definitions/internal.AuditEventList"
                                         }
                                     }
                                 }
                             ]
                         }
                     },
-                    "401": {
-                        "description": "Unauthorized",
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
                             "$ref": "#/definitions/internal.ErrorResponse"
                         }
@@ -107,69 +151,134 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/files/{id}": {
-            "get": {
+        "/api/admin/capabilities/refresh": {
+            "post": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Handle file operations: GET for file info/download, DELETE for removal. Use ?type=original or ?type=processed query parameter for downloads",
+                "description": "Reload object types and blur types from the ML service. On failure the current catalog is kept and 502 is returned. Available to admins only",
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "files"
+                    "admin"
                 ],
-                "summary": "File operations",
-                "parameters": [
-                    {
-                        "type": "string",
-                        "description": "File ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                "summary": "Refresh processing capabilities",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.Capabilities"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
                     },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/admin/cleanup": {
+            "post": {
+                "security": [
                     {
-                        "enum": [
-                            "original",
-                            "processed"
-                        ],
-                        "type": "string",
-                        "description": "Download type",
-                        "name": "type",
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Delete anonymous files older than 24h and user files whose retention has expired. Also reports database records whose blobs are missing. Runs as dry run unless dry_run=false. Auditors may only run dry runs",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Run file cleanup",
+                "parameters": [
+                    {
+                        "type": "boolean",
+                        "default": true,
+                        "description": "Only report what would be deleted",
+                        "name": "dry_run",
                         "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "File deleted",
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/internal.SuccessResponse"
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.CleanupReport"
+                                        }
+                                    }
+                                }
+                            ]
                         }
                     },
-                    "403": {
-                        "description": "Forbidden",
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
                             "$ref": "#/definitions/internal.ErrorResponse"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/internal.ErrorResponse"
                         }
                     }
                 }
-            },
-            "delete": {
+            }
+        },
+        "/api/admin/files/{id}": {
+            "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Handle file operations: GET for file info/download, DELETE for removal. Use ?type=original or ?type=processed query parameter for downloads",
+                "description": "Get information about any user's file together with its owner, or download it with ?type=original or ?type=processed. Available to admins and auditors",
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "files"
+                    "admin"
                 ],
-                "summary": "File operations",
+                "summary": "Inspect any file",
                 "parameters": [
                     {
                         "type": "string",
@@ -191,9 +300,9 @@ const docTemplate = `{
                 ],
                 "responses": {
                     "200": {
-                        "description": "File deleted",
+                        "description": "File download (when type parameter is used)",
                         "schema": {
-                            "$ref": "#/definitions/internal.SuccessResponse"
+                            "type": "file"
                         }
                     },
                     "403": {
@@ -211,35 +320,38 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/login": {
-            "post": {
-                "description": "Authenticate user with email and password",
-                "consumes": [
-                    "application/json"
+        "/api/admin/fsck": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
                 ],
+                "description": "Compare File records with files on disk. GET only reports discrepancies; POST also repairs them (marks records failed, quarantines orphans and temp files, raises accumulated user totals that are below the stored files). Repair is available to admins only",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "auth"
-                ],
-                "summary": "User login",
-                "parameters": [
-                    {
-                        "description": "User login credentials",
-                        "name": "request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/internal.LoginRequest"
-                        }
-                    }
+                    "admin"
                 ],
+                "summary": "Storage consistency check",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/internal.AuthResponse"
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.ConsistencyReport"
+                                        }
+                                    }
+                                }
+                            ]
                         }
                     },
                     "401": {
@@ -247,49 +359,68 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/internal.ErrorResponse"
                         }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
                     }
                 }
-            }
-        },
-        "/api/register": {
+            },
             "post": {
-                "description": "Create a new user account with email, password and name",
-                "consumes": [
-                    "application/json"
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
                 ],
+                "description": "Compare File records with files on disk. GET only reports discrepancies; POST also repairs them (marks records failed, quarantines orphans and temp files, raises accumulated user totals that are below the stored files). Repair is available to admins only",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "auth"
-                ],
-                "summary": "Register new user",
-                "parameters": [
-                    {
-                        "description": "User registration data",
-                        "name": "request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/internal.RegisterRequest"
-                        }
-                    }
+                    "admin"
                 ],
+                "summary": "Storage consistency check",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/internal.AuthResponse"
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.ConsistencyReport"
+                                        }
+                                    }
+                                }
+                            ]
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "401": {
+                        "description": "Unauthorized",
                         "schema": {
                             "$ref": "#/definitions/internal.ErrorResponse"
                         }
                     },
-                    "409": {
-                        "description": "Conflict",
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/internal.ErrorResponse"
                         }
@@ -297,64 +428,91 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/upload": {
-            "post": {
+        "/api/admin/security": {
+            "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Upload a file (images and videos) and automatically send it for ML processing. Available for both authenticated and anonymous users with rate limiting",
+                "description": "GET returns whether 2FA is mandatory for all users (admins and auditors). PUT changes it (admins only). Users without 2FA will have to enroll at their next login",
                 "consumes": [
-                    "multipart/form-data"
+                    "application/json"
                 ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "files"
+                    "admin"
                 ],
-                "summary": "Upload and process file",
+                "summary": "Global security policy",
                 "parameters": [
                     {
-                        "type": "file",
-                        "description": "File to upload",
-                        "name": "file",
-                        "in": "formData",
-                        "required": true
-                    },
-                    {
-                        "enum": [
-                            "gaussian",
-                            "motion",
-                            "pixelate"
-                        ],
-                        "type": "string",
-                        "default": "gaussian",
-                        "description": "Type of blur to apply",
-                        "name": "blur_type",
-                        "in": "formData"
+                        "description": "New policy (PUT only)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.TwoFactorPolicyRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.TwoFactorPolicyRequest"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
                     {
-                        "maximum": 10,
-                        "minimum": 1,
-                        "type": "integer",
-                        "default": 5,
-                        "description": "Effect intensity (1-10)",
-                        "name": "intensity",
-                        "in": "formData"
-                    },
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "GET returns whether 2FA is mandatory for all users (admins and auditors). PUT changes it (admins only). Users without 2FA will have to enroll at their next login",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Global security policy",
+                "parameters": [
                     {
-                        "type": "string",
-                        "example": "\"face,person,car\"",
-                        "description": "Comma-separated list of objects to blur",
-                        "name": "object_types",
-                        "in": "formData"
+                        "description": "New policy (PUT only)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.TwoFactorPolicyRequest"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "File uploaded and processing started",
+                        "description": "OK",
                         "schema": {
                             "allOf": [
                                 {
@@ -364,21 +522,46 @@ const docTemplate = `{
                                     "type": "object",
                                     "properties": {
                                         "data": {
-                                            "$ref": "#/definitions/internal.File"
+                                            "$ref": "#/definitions/internal.TwoFactorPolicyRequest"
                                         }
                                     }
                                 }
                             ]
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
                             "$ref": "#/definitions/internal.ErrorResponse"
                         }
+                    }
+                }
+            }
+        },
+        "/api/admin/stats": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Get administrative statistics about server, file system, ML service and rate limiter. Available to admins and auditors",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Admin statistics",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/internal.SuccessResponse"
+                        }
                     },
-                    "429": {
-                        "description": "Too Many Requests",
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
                             "$ref": "#/definitions/internal.ErrorResponse"
                         }
@@ -386,21 +569,61 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/user/profile": {
+        "/api/admin/users": {
             "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Get current user profile information",
+                "description": "Search users by email or name with optional role and suspension filters. Available to admins and auditors",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "admin"
+                ],
+                "summary": "List users",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Substring of email or name",
+                        "name": "q",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "user",
+                            "admin",
+                            "auditor"
+                        ],
+                        "type": "string",
+                        "description": "Role filter",
+                        "name": "role",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Only suspended (true) or only active (false) users",
+                        "name": "suspended",
+                        "in": "query"
+                    },
+                    {
+                        "maximum": 200,
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 0,
+                        "description": "Page offset",
+                        "name": "offset",
+                        "in": "query"
+                    }
                 ],
-                "summary": "Get user profile",
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -413,15 +636,21 @@ const docTemplate = `{
                                     "type": "object",
                                     "properties": {
                                         "data": {
-                                            "$ref": "#/definitions/internal.User"
+                                            "$ref": "#/definitions/internal.AdminUserList"
                                         }
                                     }
                                 }
                             ]
                         }
                     },
-                    "401": {
-                        "description": "Unauthorized",
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
                             "$ref": "#/definitions/internal.ErrorResponse"
                         }
@@ -429,14 +658,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/user/profile/update": {
-            "put": {
+        "/api/admin/users/{id}": {
+            "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Update user profile information (name, email, password)",
+                "description": "GET returns a user (admins and auditors). DELETE removes the user with all files, sessions and API keys; files the user uploaded to organizations with other members stay there and pass to an owner (or the next admin or member). POST .../suspend blocks the account and revokes its sessions, POST .../unsuspend lifts the block, POST .../unlock clears a brute-force login lockout, PUT .../role changes the role. Changes are available to admins only and cannot target the caller's own account",
                 "consumes": [
                     "application/json"
                 ],
@@ -444,17 +673,31 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "admin"
                 ],
-                "summary": "Update user profile",
+                "summary": "User administration",
                 "parameters": [
                     {
-                        "description": "Profile update data",
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Suspension reason (suspend only)",
                         "name": "request",
                         "in": "body",
-                        "required": true,
                         "schema": {
-                            "$ref": "#/definitions/internal.UpdateProfileRequest"
+                            "$ref": "#/definitions/internal.SuspendUserRequest"
+                        }
+                    },
+                    {
+                        "description": "New role (role only)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.UpdateRoleRequest"
                         }
                     }
                 ],
@@ -477,30 +720,68 @@ const docTemplate = `{
                             ]
                         }
                     },
-                    "401": {
-                        "description": "Unauthorized",
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
                             "$ref": "#/definitions/internal.ErrorResponse"
                         }
                     }
                 }
-            }
-        },
-        "/api/user/stats": {
-            "get": {
+            },
+            "delete": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Get detailed statistics about user's files, uploads and processing status",
+                "description": "GET returns a user (admins and auditors). DELETE removes the user with all files, sessions and API keys; files the user uploaded to organizations with other members stay there and pass to an owner (or the next admin or member). POST .../suspend blocks the account and revokes its sessions, POST .../unsuspend lifts the block, POST .../unlock clears a brute-force login lockout, PUT .../role changes the role. Changes are available to admins only and cannot target the caller's own account",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "admin"
+                ],
+                "summary": "User administration",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Suspension reason (suspend only)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.SuspendUserRequest"
+                        }
+                    },
+                    {
+                        "description": "New role (role only)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.UpdateRoleRequest"
+                        }
+                    }
                 ],
-                "summary": "Get user statistics",
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -513,42 +794,4401 @@ const docTemplate = `{
                                     "type": "object",
                                     "properties": {
                                         "data": {
-                                            "$ref": "#/definitions/internal.UserStats"
+                                            "$ref": "#/definitions/internal.User"
                                         }
                                     }
                                 }
                             ]
                         }
                     },
-                    "401": {
-                        "description": "Unauthorized",
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
                             "$ref": "#/definitions/internal.ErrorResponse"
                         }
-                    }
-                }
-            }
-        },
-        "/health": {
-            "get": {
-                "description": "Check system health including database connection, ML service and file system stats",
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "system"
-                ],
-                "summary": "Health check",
-                "responses": {
-                    "200": {
-                        "description": "OK",
+                    },
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/internal.ErrorResponse"
                         }
                     },
-                    "503": {
-                        "description": "Service Unavailable",
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/admin/users/{id}/role": {
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "GET returns a user (admins and auditors). DELETE removes the user with all files, sessions and API keys; files the user uploaded to organizations with other members stay there and pass to an owner (or the next admin or member). POST .../suspend blocks the account and revokes its sessions, POST .../unsuspend lifts the block, POST .../unlock clears a brute-force login lockout, PUT .../role changes the role. Changes are available to admins only and cannot target the caller's own account",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "User administration",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Suspension reason (suspend only)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.SuspendUserRequest"
+                        }
+                    },
+                    {
+                        "description": "New role (role only)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.UpdateRoleRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.User"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/admin/users/{id}/suspend": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "GET returns a user (admins and auditors). DELETE removes the user with all files, sessions and API keys; files the user uploaded to organizations with other members stay there and pass to an owner (or the next admin or member). POST .../suspend blocks the account and revokes its sessions, POST .../unsuspend lifts the block, POST .../unlock clears a brute-force login lockout, PUT .../role changes the role. Changes are available to admins only and cannot target the caller's own account",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "User administration",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Suspension reason (suspend only)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.SuspendUserRequest"
+                        }
+                    },
+                    {
+                        "description": "New role (role only)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.UpdateRoleRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.User"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/admin/users/{id}/unlock": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "GET returns a user (admins and auditors). DELETE removes the user with all files, sessions and API keys; files the user uploaded to organizations with other members stay there and pass to an owner (or the next admin or member). POST .../suspend blocks the account and revokes its sessions, POST .../unsuspend lifts the block, POST .../unlock clears a brute-force login lockout, PUT .../role changes the role. Changes are available to admins only and cannot target the caller's own account",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "User administration",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Suspension reason (suspend only)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.SuspendUserRequest"
+                        }
+                    },
+                    {
+                        "description": "New role (role only)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.UpdateRoleRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.User"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/admin/users/{id}/unsuspend": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "GET returns a user (admins and auditors). DELETE removes the user with all files, sessions and API keys; files the user uploaded to organizations with other members stay there and pass to an owner (or the next admin or member). POST .../suspend blocks the account and revokes its sessions, POST .../unsuspend lifts the block, POST .../unlock clears a brute-force login lockout, PUT .../role changes the role. Changes are available to admins only and cannot target the caller's own account",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "User administration",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Suspension reason (suspend only)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.SuspendUserRequest"
+                        }
+                    },
+                    {
+                        "description": "New role (role only)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.UpdateRoleRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.User"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/auth/oidc/providers": {
+            "get": {
+                "description": "List configured OpenID Connect providers available for single sign-on",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "List SSO providers",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/internal.OIDCProviderInfo"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        },
+        "/api/auth/oidc/{provider}/callback": {
+            "get": {
+                "description": "GET .../login redirects the browser to the identity provider (authorization code flow with PKCE). The provider redirects back to .../callback, which validates the ID token, signs the user in (creating or linking the account by verified email) and returns the tokens, or redirects to the configured post-login page with tokens in the URL fragment. When the account needs a second factor (enabled 2FA, REQUIRE_2FA or an organization policy), a login challenge is returned the same way instead of tokens; complete it via /api/login/2fa (or /api/login/2fa/setup when enrollment is required). Providers configured with OIDC_\u003cNAME\u003e_REQUIRED_MFA must prove MFA with the amr or acr claim, and then no local second factor is asked",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "SSO login",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Provider name",
+                        "name": "provider",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Authorization code (callback only)",
+                        "name": "code",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Login state (callback only)",
+                        "name": "state",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Second factor required",
+                        "schema": {
+                            "$ref": "#/definitions/internal.LoginChallengeResponse"
+                        }
+                    },
+                    "302": {
+                        "description": "Redirect to the identity provider or post-login page"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/auth/oidc/{provider}/login": {
+            "get": {
+                "description": "GET .../login redirects the browser to the identity provider (authorization code flow with PKCE). The provider redirects back to .../callback, which validates the ID token, signs the user in (creating or linking the account by verified email) and returns the tokens, or redirects to the configured post-login page with tokens in the URL fragment. When the account needs a second factor (enabled 2FA, REQUIRE_2FA or an organization policy), a login challenge is returned the same way instead of tokens; complete it via /api/login/2fa (or /api/login/2fa/setup when enrollment is required). Providers configured with OIDC_\u003cNAME\u003e_REQUIRED_MFA must prove MFA with the amr or acr claim, and then no local second factor is asked",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "SSO login",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Provider name",
+                        "name": "provider",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Authorization code (callback only)",
+                        "name": "code",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Login state (callback only)",
+                        "name": "state",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Second factor required",
+                        "schema": {
+                            "$ref": "#/definitions/internal.LoginChallengeResponse"
+                        }
+                    },
+                    "302": {
+                        "description": "Redirect to the identity provider or post-login page"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/capabilities": {
+            "get": {
+                "description": "Object types and blur types accepted in processing options, with localized labels, and built-in object presets. The list follows the models loaded by the ML service and falls back to the built-in catalog when the service is unavailable",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Processing capabilities",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.Capabilities"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        },
+        "/api/email/verify/confirm": {
+            "post": {
+                "description": "Confirm an email address with the token from the verification link. A pending email change is applied at this point",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Confirm email",
+                "parameters": [
+                    {
+                        "description": "Verification token",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/internal.TokenRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.User"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/email/verify/request": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Send a verification link. Authenticated users get it for their pending or unverified email; anonymous callers pass the email in the body and always receive the same response. Limited per IP (RATE_LIMIT_EMAIL); a repeated request for the same address within a minute sends no new email, the previous link stays valid",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Request email verification",
+                "parameters": [
+                    {
+                        "description": "Email address (anonymous requests)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.EmailRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/internal.SuccessResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests from this IP, see Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/files": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Get list of all files uploaded by the authenticated user with their processing status. Files uploaded to organizations the user is no longer a member of are not listed",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Get user files",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/internal.File"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/files/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Handle file operations: GET for file info/download, DELETE for removal, POST .../reprocess to process the original again with new options (same form fields as upload). Files shared with an organization are available to its members according to their role. Use ?type=original or ?type=processed query parameter for downloads, ?type=thumbnail or ?type=preview for small WebP (or JPEG, see RENDITION_FORMAT) renditions. Downloads support Range, If-None-Match, If-Modified-Since and If-Range headers",
+                "tags": [
+                    "files"
+                ],
+                "summary": "File operations",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "File ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "original",
+                            "processed",
+                            "thumbnail",
+                            "preview"
+                        ],
+                        "type": "string",
+                        "description": "Download type",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "attachment",
+                            "inline"
+                        ],
+                        "type": "string",
+                        "default": "attachment",
+                        "description": "Content-Disposition for downloads; inline lets browsers play videos",
+                        "name": "disposition",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Byte range, e.g. bytes=0-1048575",
+                        "name": "Range",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "File deleted",
+                        "schema": {
+                            "$ref": "#/definitions/internal.SuccessResponse"
+                        }
+                    },
+                    "206": {
+                        "description": "Partial content for Range requests",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "304": {
+                        "description": "Not modified (ETag or Last-Modified matched)"
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Download or reprocess rate limit exceeded, see Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Handle file operations: GET for file info/download, DELETE for removal, POST .../reprocess to process the original again with new options (same form fields as upload). Files shared with an organization are available to its members according to their role. Use ?type=original or ?type=processed query parameter for downloads, ?type=thumbnail or ?type=preview for small WebP (or JPEG, see RENDITION_FORMAT) renditions. Downloads support Range, If-None-Match, If-Modified-Since and If-Range headers",
+                "tags": [
+                    "files"
+                ],
+                "summary": "File operations",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "File ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "original",
+                            "processed",
+                            "thumbnail",
+                            "preview"
+                        ],
+                        "type": "string",
+                        "description": "Download type",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "attachment",
+                            "inline"
+                        ],
+                        "type": "string",
+                        "default": "attachment",
+                        "description": "Content-Disposition for downloads; inline lets browsers play videos",
+                        "name": "disposition",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Byte range, e.g. bytes=0-1048575",
+                        "name": "Range",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "File deleted",
+                        "schema": {
+                            "$ref": "#/definitions/internal.SuccessResponse"
+                        }
+                    },
+                    "206": {
+                        "description": "Partial content for Range requests",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "304": {
+                        "description": "Not modified (ETag or Last-Modified matched)"
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Download or reprocess rate limit exceeded, see Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/files/{id}/reprocess": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Handle file operations: GET for file info/download, DELETE for removal, POST .../reprocess to process the original again with new options (same form fields as upload). Files shared with an organization are available to its members according to their role. Use ?type=original or ?type=processed query parameter for downloads, ?type=thumbnail or ?type=preview for small WebP (or JPEG, see RENDITION_FORMAT) renditions. Downloads support Range, If-None-Match, If-Modified-Since and If-Range headers",
+                "tags": [
+                    "files"
+                ],
+                "summary": "File operations",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "File ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "original",
+                            "processed",
+                            "thumbnail",
+                            "preview"
+                        ],
+                        "type": "string",
+                        "description": "Download type",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "attachment",
+                            "inline"
+                        ],
+                        "type": "string",
+                        "default": "attachment",
+                        "description": "Content-Disposition for downloads; inline lets browsers play videos",
+                        "name": "disposition",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Byte range, e.g. bytes=0-1048575",
+                        "name": "Range",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "File deleted",
+                        "schema": {
+                            "$ref": "#/definitions/internal.SuccessResponse"
+                        }
+                    },
+                    "206": {
+                        "description": "Partial content for Range requests",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "304": {
+                        "description": "Not modified (ETag or Last-Modified matched)"
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Download or reprocess rate limit exceeded, see Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/login": {
+            "post": {
+                "description": "Authenticate user with email and password. If two-factor authentication is enabled or required, a challenge token is returned instead of session tokens; complete login with /api/login/2fa (or enroll with /api/login/2fa/setup and /api/login/2fa/confirm)",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "User login",
+                "parameters": [
+                    {
+                        "description": "User login credentials",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/internal.LoginRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Second factor required",
+                        "schema": {
+                            "$ref": "#/definitions/internal.LoginChallengeResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Account suspended or email not verified",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many failed attempts for this email or IP, see Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/login/2fa": {
+            "post": {
+                "description": "Complete login with the challenge token returned by /api/login and a TOTP code or a recovery code",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Second login step",
+                "parameters": [
+                    {
+                        "description": "Challenge token and code",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/internal.TwoFactorLoginRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/internal.AuthResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/login/2fa/confirm": {
+            "post": {
+                "description": "When login returns enrollment_required, POST .../setup returns a new TOTP secret and POST .../confirm enables 2FA with a code from the authenticator, returning recovery codes together with the session tokens",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Mandatory 2FA enrollment during login",
+                "parameters": [
+                    {
+                        "description": "Challenge token (and code for confirm)",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/internal.TwoFactorLoginRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Confirm",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.RecoveryCodesResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/login/2fa/setup": {
+            "post": {
+                "description": "When login returns enrollment_required, POST .../setup returns a new TOTP secret and POST .../confirm enables 2FA with a code from the authenticator, returning recovery codes together with the session tokens",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Mandatory 2FA enrollment during login",
+                "parameters": [
+                    {
+                        "description": "Challenge token (and code for confirm)",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/internal.TwoFactorLoginRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Confirm",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.RecoveryCodesResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/logout": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Revoke the current session. Its refresh token and all access tokens issued for it stop working",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Logout",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/internal.SuccessResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/orgs": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "GET lists organizations the user belongs to together with the user's role. POST creates a new organization; the creator becomes its owner",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "organizations"
+                ],
+                "summary": "List or create organizations",
+                "parameters": [
+                    {
+                        "description": "Organization name (POST only)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.CreateOrganizationRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Organizations list",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/internal.UserOrganization"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "201": {
+                        "description": "Created organization",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.Organization"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "GET lists organizations the user belongs to together with the user's role. POST creates a new organization; the creator becomes its owner",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "organizations"
+                ],
+                "summary": "List or create organizations",
+                "parameters": [
+                    {
+                        "description": "Organization name (POST only)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.CreateOrganizationRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Organizations list",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/internal.UserOrganization"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "201": {
+                        "description": "Created organization",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.Organization"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/orgs/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "GET /api/orgs/{id} returns the organization, DELETE removes it (owner only, the organization must have no files). GET .../files lists shared files, GET .../stats returns aggregated statistics and quota usage. GET .../members lists members, POST .../members adds an existing user by email, PUT .../members/{user_id} changes a role and DELETE .../members/{user_id} removes a member (or leaves the organization). Members are managed by owners and admins; only owners can grant or revoke the owner role",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "organizations"
+                ],
+                "summary": "Organization operations",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Organization ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New member (POST .../members)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.AddMemberRequest"
+                        }
+                    },
+                    {
+                        "description": "New role (PUT .../members/{user_id})",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.UpdateMemberRequest"
+                        }
+                    },
+                    {
+                        "description": "Security policy (PUT .../security)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.TwoFactorPolicyRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Organization members",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/internal.Membership"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "GET /api/orgs/{id} returns the organization, DELETE removes it (owner only, the organization must have no files). GET .../files lists shared files, GET .../stats returns aggregated statistics and quota usage. GET .../members lists members, POST .../members adds an existing user by email, PUT .../members/{user_id} changes a role and DELETE .../members/{user_id} removes a member (or leaves the organization). Members are managed by owners and admins; only owners can grant or revoke the owner role",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "organizations"
+                ],
+                "summary": "Organization operations",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Organization ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New member (POST .../members)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.AddMemberRequest"
+                        }
+                    },
+                    {
+                        "description": "New role (PUT .../members/{user_id})",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.UpdateMemberRequest"
+                        }
+                    },
+                    {
+                        "description": "Security policy (PUT .../security)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.TwoFactorPolicyRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Organization members",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/internal.Membership"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/orgs/{id}/files": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "GET /api/orgs/{id} returns the organization, DELETE removes it (owner only, the organization must have no files). GET .../files lists shared files, GET .../stats returns aggregated statistics and quota usage. GET .../members lists members, POST .../members adds an existing user by email, PUT .../members/{user_id} changes a role and DELETE .../members/{user_id} removes a member (or leaves the organization). Members are managed by owners and admins; only owners can grant or revoke the owner role",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "organizations"
+                ],
+                "summary": "Organization operations",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Organization ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New member (POST .../members)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.AddMemberRequest"
+                        }
+                    },
+                    {
+                        "description": "New role (PUT .../members/{user_id})",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.UpdateMemberRequest"
+                        }
+                    },
+                    {
+                        "description": "Security policy (PUT .../security)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.TwoFactorPolicyRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Organization members",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/internal.Membership"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/orgs/{id}/members": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "GET /api/orgs/{id} returns the organization, DELETE removes it (owner only, the organization must have no files). GET .../files lists shared files, GET .../stats returns aggregated statistics and quota usage. GET .../members lists members, POST .../members adds an existing user by email, PUT .../members/{user_id} changes a role and DELETE .../members/{user_id} removes a member (or leaves the organization). Members are managed by owners and admins; only owners can grant or revoke the owner role",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "organizations"
+                ],
+                "summary": "Organization operations",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Organization ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New member (POST .../members)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.AddMemberRequest"
+                        }
+                    },
+                    {
+                        "description": "New role (PUT .../members/{user_id})",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.UpdateMemberRequest"
+                        }
+                    },
+                    {
+                        "description": "Security policy (PUT .../security)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.TwoFactorPolicyRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Organization members",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/internal.Membership"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "GET /api/orgs/{id} returns the organization, DELETE removes it (owner only, the organization must have no files). GET .../files lists shared files, GET .../stats returns aggregated statistics and quota usage. GET .../members lists members, POST .../members adds an existing user by email, PUT .../members/{user_id} changes a role and DELETE .../members/{user_id} removes a member (or leaves the organization). Members are managed by owners and admins; only owners can grant or revoke the owner role",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "organizations"
+                ],
+                "summary": "Organization operations",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Organization ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New member (POST .../members)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.AddMemberRequest"
+                        }
+                    },
+                    {
+                        "description": "New role (PUT .../members/{user_id})",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.UpdateMemberRequest"
+                        }
+                    },
+                    {
+                        "description": "Security policy (PUT .../security)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.TwoFactorPolicyRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Organization members",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/internal.Membership"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/orgs/{id}/members/{user_id}": {
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "GET /api/orgs/{id} returns the organization, DELETE removes it (owner only, the organization must have no files). GET .../files lists shared files, GET .../stats returns aggregated statistics and quota usage. GET .../members lists members, POST .../members adds an existing user by email, PUT .../members/{user_id} changes a role and DELETE .../members/{user_id} removes a member (or leaves the organization). Members are managed by owners and admins; only owners can grant or revoke the owner role",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "organizations"
+                ],
+                "summary": "Organization operations",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Organization ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Member user ID",
+                        "name": "user_id",
+                        "in": "path"
+                    },
+                    {
+                        "description": "New member (POST .../members)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.AddMemberRequest"
+                        }
+                    },
+                    {
+                        "description": "New role (PUT .../members/{user_id})",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.UpdateMemberRequest"
+                        }
+                    },
+                    {
+                        "description": "Security policy (PUT .../security)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.TwoFactorPolicyRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Organization members",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/internal.Membership"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "GET /api/orgs/{id} returns the organization, DELETE removes it (owner only, the organization must have no files). GET .../files lists shared files, GET .../stats returns aggregated statistics and quota usage. GET .../members lists members, POST .../members adds an existing user by email, PUT .../members/{user_id} changes a role and DELETE .../members/{user_id} removes a member (or leaves the organization). Members are managed by owners and admins; only owners can grant or revoke the owner role",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "organizations"
+                ],
+                "summary": "Organization operations",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Organization ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Member user ID",
+                        "name": "user_id",
+                        "in": "path"
+                    },
+                    {
+                        "description": "New member (POST .../members)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.AddMemberRequest"
+                        }
+                    },
+                    {
+                        "description": "New role (PUT .../members/{user_id})",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.UpdateMemberRequest"
+                        }
+                    },
+                    {
+                        "description": "Security policy (PUT .../security)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.TwoFactorPolicyRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Organization members",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/internal.Membership"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/orgs/{id}/security": {
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "GET /api/orgs/{id} returns the organization, DELETE removes it (owner only, the organization must have no files). GET .../files lists shared files, GET .../stats returns aggregated statistics and quota usage. GET .../members lists members, POST .../members adds an existing user by email, PUT .../members/{user_id} changes a role and DELETE .../members/{user_id} removes a member (or leaves the organization). Members are managed by owners and admins; only owners can grant or revoke the owner role",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "organizations"
+                ],
+                "summary": "Organization operations",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Organization ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New member (POST .../members)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.AddMemberRequest"
+                        }
+                    },
+                    {
+                        "description": "New role (PUT .../members/{user_id})",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.UpdateMemberRequest"
+                        }
+                    },
+                    {
+                        "description": "Security policy (PUT .../security)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.TwoFactorPolicyRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Organization members",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/internal.Membership"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/orgs/{id}/stats": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "GET /api/orgs/{id} returns the organization, DELETE removes it (owner only, the organization must have no files). GET .../files lists shared files, GET .../stats returns aggregated statistics and quota usage. GET .../members lists members, POST .../members adds an existing user by email, PUT .../members/{user_id} changes a role and DELETE .../members/{user_id} removes a member (or leaves the organization). Members are managed by owners and admins; only owners can grant or revoke the owner role",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "organizations"
+                ],
+                "summary": "Organization operations",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Organization ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New member (POST .../members)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.AddMemberRequest"
+                        }
+                    },
+                    {
+                        "description": "New role (PUT .../members/{user_id})",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.UpdateMemberRequest"
+                        }
+                    },
+                    {
+                        "description": "Security policy (PUT .../security)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.TwoFactorPolicyRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Organization members",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/internal.Membership"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/password/reset/confirm": {
+            "post": {
+                "description": "Set a new password with the token from the reset link. All sessions of the account are revoked",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Reset password",
+                "parameters": [
+                    {
+                        "description": "Reset token and new password",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/internal.ResetPasswordRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/internal.SuccessResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/password/reset/request": {
+            "post": {
+                "description": "Send a password reset link. The response is the same whether or not the account exists. Limited per IP (RATE_LIMIT_EMAIL); a repeated request for the same account within a minute sends no new email, the previous link stays valid",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Request password reset",
+                "parameters": [
+                    {
+                        "description": "Account email",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/internal.EmailRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/internal.SuccessResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests from this IP, see Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/presets": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "GET lists built-in presets, the user's own presets and presets of organizations the user belongs to. Types of a built-in preset that the current ML model cannot detect are listed in unavailable_types and skipped when the preset is applied (reported in skipped_types of the processing options). POST creates a personal preset, or an organization preset when organization_id is set (owners and admins only). A preset is applied with the preset field of upload and reprocess requests",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "presets"
+                ],
+                "summary": "List or create object presets",
+                "parameters": [
+                    {
+                        "description": "New preset (POST only)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ObjectPresetRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Presets list",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/internal.ObjectPreset"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "201": {
+                        "description": "Created preset",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.ObjectPreset"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "GET lists built-in presets, the user's own presets and presets of organizations the user belongs to. Types of a built-in preset that the current ML model cannot detect are listed in unavailable_types and skipped when the preset is applied (reported in skipped_types of the processing options). POST creates a personal preset, or an organization preset when organization_id is set (owners and admins only). A preset is applied with the preset field of upload and reprocess requests",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "presets"
+                ],
+                "summary": "List or create object presets",
+                "parameters": [
+                    {
+                        "description": "New preset (POST only)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ObjectPresetRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Presets list",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/internal.ObjectPreset"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "201": {
+                        "description": "Created preset",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.ObjectPreset"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/presets/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Personal presets are managed by their owner, organization presets are visible to all members and managed by owners and admins. Built-in presets cannot be changed",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "presets"
+                ],
+                "summary": "Get, update or delete an object preset",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Preset ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New name, label and object types (PUT only)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ObjectPresetRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.ObjectPreset"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Personal presets are managed by their owner, organization presets are visible to all members and managed by owners and admins. Built-in presets cannot be changed",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "presets"
+                ],
+                "summary": "Get, update or delete an object preset",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Preset ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New name, label and object types (PUT only)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ObjectPresetRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.ObjectPreset"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Personal presets are managed by their owner, organization presets are visible to all members and managed by owners and admins. Built-in presets cannot be changed",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "presets"
+                ],
+                "summary": "Get, update or delete an object preset",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Preset ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New name, label and object types (PUT only)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ObjectPresetRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.ObjectPreset"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/profiles": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "GET lists the user's saved processing profiles. POST creates a profile; a profile created with is_default=true replaces the previous default. The default profile supplies the options that an upload or reprocess request does not set, another profile is selected with the profile field",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "profiles"
+                ],
+                "summary": "List or create processing profiles",
+                "parameters": [
+                    {
+                        "description": "New profile (POST only)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ProcessingProfileRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Profiles list",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/internal.ProcessingProfile"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "201": {
+                        "description": "Created profile",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.ProcessingProfile"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "GET lists the user's saved processing profiles. POST creates a profile; a profile created with is_default=true replaces the previous default. The default profile supplies the options that an upload or reprocess request does not set, another profile is selected with the profile field",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "profiles"
+                ],
+                "summary": "List or create processing profiles",
+                "parameters": [
+                    {
+                        "description": "New profile (POST only)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ProcessingProfileRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Profiles list",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/internal.ProcessingProfile"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "201": {
+                        "description": "Created profile",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.ProcessingProfile"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/profiles/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "PUT replaces all fields of the profile. Setting is_default=true makes it the default instead of the previous one, is_default=false leaves the user without a default profile if this one was the default",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "profiles"
+                ],
+                "summary": "Get, update or delete a processing profile",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Profile ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New profile fields (PUT only)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ProcessingProfileRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.ProcessingProfile"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "PUT replaces all fields of the profile. Setting is_default=true makes it the default instead of the previous one, is_default=false leaves the user without a default profile if this one was the default",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "profiles"
+                ],
+                "summary": "Get, update or delete a processing profile",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Profile ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New profile fields (PUT only)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ProcessingProfileRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.ProcessingProfile"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "PUT replaces all fields of the profile. Setting is_default=true makes it the default instead of the previous one, is_default=false leaves the user without a default profile if this one was the default",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "profiles"
+                ],
+                "summary": "Get, update or delete a processing profile",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Profile ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New profile fields (PUT only)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ProcessingProfileRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.ProcessingProfile"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/register": {
+            "post": {
+                "description": "Create a new user account with email, password and name. A verification link is sent to the email; when email verification is required, no tokens are returned until the email is confirmed",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Register new user",
+                "parameters": [
+                    {
+                        "description": "User registration data",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/internal.RegisterRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/internal.AuthResponse"
+                        }
+                    },
+                    "201": {
+                        "description": "Email verification required",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.User"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/token/refresh": {
+            "post": {
+                "description": "Exchange a refresh token for a new access token. The refresh token is rotated on every use; presenting an already used refresh token revokes the whole session",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Refresh access token",
+                "parameters": [
+                    {
+                        "description": "Refresh token",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/internal.RefreshTokenRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/internal.AuthResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/upload": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Upload a file (images and videos) and automatically send it for ML processing. Available for both authenticated and anonymous users. Processing cost (megabytes plus megapixels of every frame) is debited from the user's, organization's or anonymous client's budget and reported in X-Budget-Cost, X-Budget-Limit, X-Budget-Remaining and X-Budget-Reset headers",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Upload and process file",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "File to upload",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "gaussian",
+                            "motion",
+                            "pixelate"
+                        ],
+                        "type": "string",
+                        "default": "gaussian",
+                        "description": "Type of blur to apply",
+                        "name": "blur_type",
+                        "in": "formData"
+                    },
+                    {
+                        "maximum": 10,
+                        "minimum": 1,
+                        "type": "integer",
+                        "default": 5,
+                        "description": "Effect intensity (1-10)",
+                        "name": "intensity",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "example": "\"face,person,car\"",
+                        "description": "Comma-separated list of objects to blur, see GET /api/capabilities",
+                        "name": "object_types",
+                        "in": "formData"
+                    },
+                    {
+                        "enum": [
+                            "original",
+                            "jpeg"
+                        ],
+                        "type": "string",
+                        "default": "original",
+                        "description": "Format of the processed image: same as the uploaded file or JPEG. HEIC/HEIF and AVIF are processed through a JPEG copy",
+                        "name": "output_format",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "example": "privacy",
+                        "description": "Object preset (built-in, organization or personal, see GET /api/presets) whose object types are added to object_types",
+                        "name": "preset",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "example": "[{\"x\":0.05,\"y\":0.8,\"width\":0.3,\"height\":0.15}]",
+                        "description": "JSON array of rectangles blurred on every frame, coordinates are fractions (0-1) of the frame size",
+                        "name": "regions",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Saved processing profile (see GET /api/profiles) used for the options not set in the request. Without it the user's default profile is used",
+                        "name": "profile",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Upload into an organization's shared library (requires owner, admin or member role)",
+                        "name": "organization_id",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "File uploaded and processing started, data.options holds the effective processing options",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.File"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid file: errors[].code is one of file_too_large, file_empty, unsupported_extension, unsupported_content, content_mismatch, corrupt_media, dimensions_too_large, too_many_megapixels, video_too_long (also when the video header has no duration: the length limit and the processing cost depend on it), conversion_unavailable, malware_detected (the file is quarantined)",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Storage or video duration quota exceeded, or file costs more than the whole budget",
+                        "schema": {
+                            "$ref": "#/definitions/internal.QuotaErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit, monthly file quota or processing budget exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/internal.QuotaErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Upload scanner is unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Request deletion of the current account. A confirmation link is sent to the account email; the deletion starts only after it is confirmed via /api/user/delete/confirm. Sole owners of organizations with other members must transfer ownership first. Files uploaded to organizations with other members are not deleted: they stay in the organization and pass to its owner",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Delete account",
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/internal.SuccessResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/2fa": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "GET returns 2FA status. POST .../setup starts enrollment, POST .../confirm enables 2FA and returns recovery codes, POST .../disable turns it off (requires password and code; not allowed when 2FA is mandatory), POST .../recovery-codes replaces recovery codes (requires code)",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Manage two-factor authentication",
+                "parameters": [
+                    {
+                        "description": "Authenticator code (and password for disable)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.TwoFactorCodeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Confirm or new recovery codes",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.RecoveryCodesResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/2fa/confirm": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "GET returns 2FA status. POST .../setup starts enrollment, POST .../confirm enables 2FA and returns recovery codes, POST .../disable turns it off (requires password and code; not allowed when 2FA is mandatory), POST .../recovery-codes replaces recovery codes (requires code)",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Manage two-factor authentication",
+                "parameters": [
+                    {
+                        "description": "Authenticator code (and password for disable)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.TwoFactorCodeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Confirm or new recovery codes",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.RecoveryCodesResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/2fa/disable": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "GET returns 2FA status. POST .../setup starts enrollment, POST .../confirm enables 2FA and returns recovery codes, POST .../disable turns it off (requires password and code; not allowed when 2FA is mandatory), POST .../recovery-codes replaces recovery codes (requires code)",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Manage two-factor authentication",
+                "parameters": [
+                    {
+                        "description": "Authenticator code (and password for disable)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.TwoFactorCodeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Confirm or new recovery codes",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.RecoveryCodesResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/2fa/recovery-codes": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "GET returns 2FA status. POST .../setup starts enrollment, POST .../confirm enables 2FA and returns recovery codes, POST .../disable turns it off (requires password and code; not allowed when 2FA is mandatory), POST .../recovery-codes replaces recovery codes (requires code)",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Manage two-factor authentication",
+                "parameters": [
+                    {
+                        "description": "Authenticator code (and password for disable)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.TwoFactorCodeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Confirm or new recovery codes",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.RecoveryCodesResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/2fa/setup": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "GET returns 2FA status. POST .../setup starts enrollment, POST .../confirm enables 2FA and returns recovery codes, POST .../disable turns it off (requires password and code; not allowed when 2FA is mandatory), POST .../recovery-codes replaces recovery codes (requires code)",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Manage two-factor authentication",
+                "parameters": [
+                    {
+                        "description": "Authenticator code (and password for disable)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.TwoFactorCodeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Confirm or new recovery codes",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.RecoveryCodesResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/api-keys": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "GET lists the user's API keys (secrets are never returned). POST creates a new key; the key itself is shown only once in the response",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "api-keys"
+                ],
+                "summary": "List or create API keys",
+                "parameters": [
+                    {
+                        "description": "New key name and scopes (POST only)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.CreateAPIKeyRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "API keys list",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/internal.APIKey"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "201": {
+                        "description": "Created API key",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.CreateAPIKeyResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "GET lists the user's API keys (secrets are never returned). POST creates a new key; the key itself is shown only once in the response",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "api-keys"
+                ],
+                "summary": "List or create API keys",
+                "parameters": [
+                    {
+                        "description": "New key name and scopes (POST only)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal.CreateAPIKeyRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "API keys list",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/internal.APIKey"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "201": {
+                        "description": "Created API key",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.CreateAPIKeyResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/api-keys/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Revoke an API key. Requests using it are rejected immediately",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "api-keys"
+                ],
+                "summary": "Revoke API key",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "API key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/internal.SuccessResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/delete/confirm": {
+            "post": {
+                "description": "Confirm account deletion with the token from the email. The account is blocked immediately, all sessions are revoked and the data is removed in the background. Track progress via the returned status URL",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Confirm account deletion",
+                "parameters": [
+                    {
+                        "description": "Deletion confirmation token",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/internal.TokenRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.AccountDeletion"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/deletions/{id}": {
+            "get": {
+                "description": "Progress of an account deletion job. The job ID acts as the access key, because the account no longer exists when the deletion completes",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Account deletion status",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Deletion job ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.AccountDeletion"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/export": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Download a ZIP archive with all personal data: profile.json (profile, organizations, SSO identities, API keys and sessions), files.json (file metadata), originals/ and processed/ with the stored files",
+                "produces": [
+                    "application/zip"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Export account data",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/profile": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Get current user profile information",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Get user profile",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.User"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/profile/update": {
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Update user profile information (name, email, password). A new email is stored as pending and applied only after it is confirmed via the link sent to it",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Update user profile",
+                "parameters": [
+                    {
+                        "description": "Profile update data",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/internal.UpdateProfileRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.User"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/stats": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Get accumulated user statistics (persists even after file deletion) together with plan limits, current quota usage and the remaining processing budget",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Get user statistics",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/internal.SuccessResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/internal.UserStats"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/internal.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/health": {
+            "get": {
+                "description": "Check system health including database connection, ML service and file system stats",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "system"
+                ],
+                "summary": "Health check",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
                         "schema": {
                             "$ref": "#/definitions/internal.ErrorResponse"
                         }
@@ -558,82 +5198,1433 @@ const docTemplate = `{
         }
     },
     "definitions": {
+        "internal.APIKey": {
+            "description": "Personal API key (the secret itself is shown only once at creation)",
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:00:00Z"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "last_used_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:30:00Z"
+                },
+                "last_used_ip": {
+                    "type": "string",
+                    "example": "203.0.113.10"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "CI uploader"
+                },
+                "prefix": {
+                    "type": "string",
+                    "example": "obs_Xk2f9aQp"
+                },
+                "revoked_at": {
+                    "type": "string",
+                    "example": "2025-01-20T09:00:00Z"
+                },
+                "scopes": {
+                    "type": "string",
+                    "example": "read,upload"
+                },
+                "user_id": {
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "internal.AccountDeletion": {
+            "description": "Account deletion job status",
+            "type": "object",
+            "properties": {
+                "completed_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:01:00Z"
+                },
+                "error_message": {
+                    "type": "string",
+                    "example": "failed to delete user records"
+                },
+                "files_deleted": {
+                    "type": "integer",
+                    "example": 17
+                },
+                "files_total": {
+                    "type": "integer",
+                    "example": 42
+                },
+                "id": {
+                    "type": "string",
+                    "example": "7c9e6679-7425-40de-944b-e07fc1f90ae7"
+                },
+                "requested_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:00:00Z"
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "pending",
+                        "running",
+                        "completed",
+                        "failed"
+                    ],
+                    "example": "running"
+                },
+                "user_id": {
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "internal.AddMemberRequest": {
+            "description": "Request to add an existing user to an organization",
+            "type": "object",
+            "required": [
+                "email"
+            ],
+            "properties": {
+                "email": {
+                    "type": "string",
+                    "example": "colleague@example.com"
+                },
+                "role": {
+                    "type": "string",
+                    "enum": [
+                        "admin",
+                        "member",
+                        "viewer"
+                    ],
+                    "example": "member"
+                }
+            }
+        },
+        "internal.AdminFileInfo": {
+            "description": "File information with its owner, as seen by administrators",
+            "type": "object",
+            "properties": {
+                "content_hash": {
+                    "type": "string",
+                    "example": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+                },
+                "error_message": {
+                    "type": "string",
+                    "example": "Processing failed: invalid format"
+                },
+                "file_name": {
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000.jpg"
+                },
+                "file_size": {
+                    "type": "integer",
+                    "example": 1048576
+                },
+                "id": {
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000"
+                },
+                "mime_type": {
+                    "type": "string",
+                    "example": "image/jpeg"
+                },
+                "options": {
+                    "description": "Опции, с которыми файл поставлен в обработку. Возвращаются только в ответе на загрузку\nи повторную обработку и не сохраняются",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/internal.ProcessingOptions"
+                        }
+                    ]
+                },
+                "organization_id": {
+                    "description": "Организация, которой принадлежит файл (nil - личный файл пользователя)",
+                    "type": "integer",
+                    "example": 3
+                },
+                "original_name": {
+                    "type": "string",
+                    "example": "photo.jpg"
+                },
+                "owner": {
+                    "$ref": "#/definitions/internal.User"
+                },
+                "preview_name": {
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000_preview.webp"
+                },
+                "processed_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:05:00Z"
+                },
+                "processed_hash": {
+                    "type": "string",
+                    "example": "60303ae22b998861bce3b28f33eec1be758a213c86c93c076dbe9f558c11c752"
+                },
+                "processed_name": {
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000_processed.jpg"
+                },
+                "processed_size": {
+                    "type": "integer",
+                    "example": 1048576
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "uploaded",
+                        "processing",
+                        "completed",
+                        "failed",
+                        "quarantined"
+                    ],
+                    "example": "uploaded"
+                },
+                "thumbnail_name": {
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000_thumb.webp"
+                },
+                "uploaded_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:00:00Z"
+                },
+                "user_id": {
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "internal.AdminUserList": {
+            "description": "Paginated list of users for administrators",
+            "type": "object",
+            "properties": {
+                "limit": {
+                    "type": "integer",
+                    "example": 50
+                },
+                "offset": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "total": {
+                    "type": "integer",
+                    "example": 120
+                },
+                "users": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/internal.User"
+                    }
+                }
+            }
+        },
+        "internal.AuditEvent": {
+            "description": "Security-relevant event recorded in the audit log",
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string",
+                    "example": "login.lockout"
+                },
+                "actor_id": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "created_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:00:00Z"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "ip": {
+                    "type": "string",
+                    "example": "203.0.113.10"
+                },
+                "message": {
+                    "type": "string",
+                    "example": "Account locked for 15m0s after 10 failed login attempts"
+                },
+                "severity": {
+                    "type": "string",
+                    "enum": [
+                        "info",
+                        "warning",
+                        "alert"
+                    ],
+                    "example": "alert"
+                },
+                "subject": {
+                    "type": "string",
+                    "example": "account:user@example.com"
+                },
+                "target_user_id": {
+                    "type": "integer",
+                    "example": 2
+                }
+            }
+        },
+        "internal.AuditEventList": {
+            "description": "Paginated audit log",
+            "type": "object",
+            "properties": {
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/internal.AuditEvent"
+                    }
+                },
+                "limit": {
+                    "type": "integer",
+                    "example": 50
+                },
+                "offset": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "total": {
+                    "type": "integer",
+                    "example": 42
+                }
+            }
+        },
         "internal.AuthResponse": {
-            "description": "Authentication response with JWT token",
+            "description": "Authentication response with JWT access token and rotating refresh token",
+            "type": "object",
+            "properties": {
+                "expires_in": {
+                    "type": "integer",
+                    "example": 1800
+                },
+                "refresh_token": {
+                    "type": "string",
+                    "example": "1b4e28ba-2fa1-11d2-883f-0016d3cca427.Vq3nS0d2..."
+                },
+                "token": {
+                    "type": "string",
+                    "example": "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."
+                },
+                "user": {
+                    "$ref": "#/definitions/internal.User"
+                }
+            }
+        },
+        "internal.BudgetStatus": {
+            "description": "Processing budget in cost units (megapixel-frames and megabytes) for the current window. Limit 0 means unlimited",
+            "type": "object",
+            "properties": {
+                "limit": {
+                    "type": "integer",
+                    "example": 2000
+                },
+                "plan": {
+                    "type": "string",
+                    "example": "free"
+                },
+                "remaining": {
+                    "type": "integer",
+                    "example": 1650
+                },
+                "reset_at": {
+                    "type": "string",
+                    "example": "2025-01-16T09:00:00Z"
+                },
+                "used": {
+                    "type": "integer",
+                    "example": 350
+                },
+                "window_hours": {
+                    "type": "number",
+                    "example": 24
+                }
+            }
+        },
+        "internal.Capabilities": {
+            "description": "Object types and blur types accepted in processing options. Source is ml_service when the list was fetched from the ML service and static when the built-in fallback is used",
+            "type": "object",
+            "properties": {
+                "blur_types": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/internal.CatalogEntry"
+                    }
+                },
+                "object_types": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/internal.CatalogEntry"
+                    }
+                },
+                "output_formats": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "original",
+                        "jpeg"
+                    ]
+                },
+                "presets": {
+                    "description": "встроенные наборы объектов",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/internal.ObjectPreset"
+                    }
+                },
+                "source": {
+                    "type": "string",
+                    "enum": [
+                        "ml_service",
+                        "static"
+                    ],
+                    "example": "ml_service"
+                },
+                "updated_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:00:00Z"
+                }
+            }
+        },
+        "internal.CatalogEntry": {
+            "description": "Supported value with a localized (Russian) label",
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string",
+                    "example": "face"
+                },
+                "label": {
+                    "type": "string",
+                    "example": "Лицо"
+                }
+            }
+        },
+        "internal.CleanupEntry": {
+            "description": "File affected by a cleanup run",
+            "type": "object",
+            "properties": {
+                "file_id": {
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000"
+                },
+                "path": {
+                    "type": "string",
+                    "example": "uploads/550e8400-e29b-41d4-a716-446655440000.jpg"
+                },
+                "reason": {
+                    "type": "string",
+                    "example": "anonymous"
+                },
+                "size": {
+                    "type": "integer",
+                    "example": 1048576
+                }
+            }
+        },
+        "internal.CleanupReport": {
+            "description": "Result of a single cleanup run",
+            "type": "object",
+            "properties": {
+                "deleted": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/internal.CleanupEntry"
+                    }
+                },
+                "deleted_bytes": {
+                    "type": "integer",
+                    "example": 10485760
+                },
+                "deleted_records": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "dry_run": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "duration_ms": {
+                    "type": "integer",
+                    "example": 120
+                },
+                "orphaned_records": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/internal.OrphanedRecord"
+                    }
+                },
+                "started_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:00:00Z"
+                }
+            }
+        },
+        "internal.ConsistencyReport": {
+            "description": "Storage consistency report",
+            "type": "object",
+            "properties": {
+                "duration_ms": {
+                    "type": "integer",
+                    "example": 250
+                },
+                "issues": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/internal.StorageIssue"
+                    }
+                },
+                "repair": {
+                    "type": "boolean",
+                    "example": false
+                },
+                "scanned_blobs": {
+                    "type": "integer",
+                    "example": 230
+                },
+                "scanned_records": {
+                    "type": "integer",
+                    "example": 120
+                },
+                "started_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:00:00Z"
+                },
+                "summary": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                }
+            }
+        },
+        "internal.CreateAPIKeyRequest": {
+            "description": "API key creation request",
+            "type": "object",
+            "required": [
+                "name",
+                "scopes"
+            ],
+            "properties": {
+                "name": {
+                    "type": "string",
+                    "maxLength": 100,
+                    "minLength": 1,
+                    "example": "CI uploader"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string",
+                        "enum": [
+                            "read",
+                            "upload",
+                            "delete"
+                        ]
+                    },
+                    "example": [
+                        "read",
+                        "upload"
+                    ]
+                }
+            }
+        },
+        "internal.CreateAPIKeyResponse": {
+            "description": "Created API key with the secret, shown only once",
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:00:00Z"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "key": {
+                    "type": "string",
+                    "example": "obs_Xk2f9aQpR3mZ..."
+                },
+                "last_used_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:30:00Z"
+                },
+                "last_used_ip": {
+                    "type": "string",
+                    "example": "203.0.113.10"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "CI uploader"
+                },
+                "prefix": {
+                    "type": "string",
+                    "example": "obs_Xk2f9aQp"
+                },
+                "revoked_at": {
+                    "type": "string",
+                    "example": "2025-01-20T09:00:00Z"
+                },
+                "scopes": {
+                    "type": "string",
+                    "example": "read,upload"
+                },
+                "user_id": {
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "internal.CreateOrganizationRequest": {
+            "description": "Organization creation request",
+            "type": "object",
+            "required": [
+                "name"
+            ],
+            "properties": {
+                "name": {
+                    "type": "string",
+                    "maxLength": 100,
+                    "minLength": 2,
+                    "example": "Acme Newsroom"
+                }
+            }
+        },
+        "internal.EmailRequest": {
+            "description": "Request carrying an email address (password reset, verification resend)",
+            "type": "object",
+            "required": [
+                "email"
+            ],
+            "properties": {
+                "email": {
+                    "type": "string",
+                    "example": "user@example.com"
+                }
+            }
+        },
+        "internal.ErrorResponse": {
+            "description": "Error response",
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string",
+                    "example": "Invalid credentials"
+                }
+            }
+        },
+        "internal.File": {
+            "description": "Uploaded file information with processing status",
+            "type": "object",
+            "properties": {
+                "content_hash": {
+                    "type": "string",
+                    "example": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+                },
+                "error_message": {
+                    "type": "string",
+                    "example": "Processing failed: invalid format"
+                },
+                "file_name": {
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000.jpg"
+                },
+                "file_size": {
+                    "type": "integer",
+                    "example": 1048576
+                },
+                "id": {
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000"
+                },
+                "mime_type": {
+                    "type": "string",
+                    "example": "image/jpeg"
+                },
+                "options": {
+                    "description": "Опции, с которыми файл поставлен в обработку. Возвращаются только в ответе на загрузку\nи повторную обработку и не сохраняются",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/internal.ProcessingOptions"
+                        }
+                    ]
+                },
+                "organization_id": {
+                    "description": "Организация, которой принадлежит файл (nil - личный файл пользователя)",
+                    "type": "integer",
+                    "example": 3
+                },
+                "original_name": {
+                    "type": "string",
+                    "example": "photo.jpg"
+                },
+                "preview_name": {
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000_preview.webp"
+                },
+                "processed_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:05:00Z"
+                },
+                "processed_hash": {
+                    "type": "string",
+                    "example": "60303ae22b998861bce3b28f33eec1be758a213c86c93c076dbe9f558c11c752"
+                },
+                "processed_name": {
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000_processed.jpg"
+                },
+                "processed_size": {
+                    "type": "integer",
+                    "example": 1048576
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "uploaded",
+                        "processing",
+                        "completed",
+                        "failed",
+                        "quarantined"
+                    ],
+                    "example": "uploaded"
+                },
+                "thumbnail_name": {
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000_thumb.webp"
+                },
+                "uploaded_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:00:00Z"
+                },
+                "user_id": {
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "internal.LoginChallengeResponse": {
+            "description": "Returned by login instead of tokens when a second factor is required. Exchange the challenge token at /api/login/2fa, or enroll first via /api/login/2fa/setup when enrollment_required is true",
+            "type": "object",
+            "properties": {
+                "challenge_token": {
+                    "type": "string",
+                    "example": "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."
+                },
+                "enrollment_required": {
+                    "type": "boolean",
+                    "example": false
+                },
+                "expires_in": {
+                    "type": "integer",
+                    "example": 300
+                },
+                "two_factor_required": {
+                    "type": "boolean",
+                    "example": true
+                }
+            }
+        },
+        "internal.LoginRequest": {
+            "description": "User login request",
+            "type": "object",
+            "required": [
+                "email",
+                "password"
+            ],
+            "properties": {
+                "email": {
+                    "type": "string",
+                    "example": "user@example.com"
+                },
+                "password": {
+                    "type": "string",
+                    "example": "securePassword123"
+                }
+            }
+        },
+        "internal.Membership": {
+            "description": "Organization membership with the member's role",
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:00:00Z"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 7
+                },
+                "organization_id": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "role": {
+                    "type": "string",
+                    "enum": [
+                        "owner",
+                        "admin",
+                        "member",
+                        "viewer"
+                    ],
+                    "example": "member"
+                },
+                "user": {
+                    "$ref": "#/definitions/internal.User"
+                },
+                "user_id": {
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "internal.OIDCProviderInfo": {
+            "description": "Configured SSO provider",
+            "type": "object",
+            "properties": {
+                "display_name": {
+                    "type": "string",
+                    "example": "Corporate SSO"
+                },
+                "login_url": {
+                    "type": "string",
+                    "example": "/api/auth/oidc/corp/login"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "corp"
+                }
+            }
+        },
+        "internal.ObjectPreset": {
+            "description": "Named set of object types. Built-in presets have no id, owner or timestamps and cannot be changed",
+            "type": "object",
+            "properties": {
+                "builtin": {
+                    "type": "boolean",
+                    "example": false
+                },
+                "created_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:00:00Z"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "label": {
+                    "type": "string",
+                    "example": "Приватность"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "privacy"
+                },
+                "object_types": {
+                    "type": "string",
+                    "example": "face,person,cell phone"
+                },
+                "organization_id": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "unavailable_types": {
+                    "description": "типы встроенного набора, которых нет в каталоге ML сервиса",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "license plate"
+                    ]
+                },
+                "updated_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:00:00Z"
+                },
+                "user_id": {
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "internal.ObjectPresetRequest": {
+            "description": "Object preset creation or update request. organization_id is only used on creation",
+            "type": "object",
+            "required": [
+                "name",
+                "object_types"
+            ],
+            "properties": {
+                "label": {
+                    "type": "string",
+                    "example": "Приватность"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "privacy"
+                },
+                "object_types": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "face",
+                        "person",
+                        "cell phone"
+                    ]
+                },
+                "organization_id": {
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "internal.Organization": {
+            "description": "Organization (team) sharing a file library",
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:00:00Z"
+                },
+                "created_by": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "name": {
+                    "type": "string",
+                    "example": "Acme Newsroom"
+                },
+                "plan": {
+                    "description": "Тарифный план и лимиты организации, общие для всех участников",
+                    "type": "string",
+                    "enum": [
+                        "free",
+                        "pro",
+                        "unlimited"
+                    ],
+                    "example": "pro"
+                },
+                "require_2fa": {
+                    "description": "Участники обязаны включить двухфакторную аутентификацию",
+                    "type": "boolean",
+                    "example": false
+                },
+                "updated_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:00:00Z"
+                }
+            }
+        },
+        "internal.OrganizationStats": {
+            "description": "Aggregated organization statistics with quota limits and usage",
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:00:00Z"
+                },
+                "created_by": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "members": {
+                    "type": "integer",
+                    "example": 5
+                },
+                "name": {
+                    "type": "string",
+                    "example": "Acme Newsroom"
+                },
+                "plan": {
+                    "description": "Тарифный план и лимиты организации, общие для всех участников",
+                    "type": "string",
+                    "enum": [
+                        "free",
+                        "pro",
+                        "unlimited"
+                    ],
+                    "example": "pro"
+                },
+                "quota": {
+                    "$ref": "#/definitions/internal.QuotaStatus"
+                },
+                "require_2fa": {
+                    "description": "Участники обязаны включить двухфакторную аутентификацию",
+                    "type": "boolean",
+                    "example": false
+                },
+                "total_failed": {
+                    "type": "integer",
+                    "example": 4
+                },
+                "total_files": {
+                    "type": "integer",
+                    "example": 120
+                },
+                "total_processed": {
+                    "type": "integer",
+                    "example": 110
+                },
+                "total_size": {
+                    "type": "integer",
+                    "example": 734003200
+                },
+                "updated_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:00:00Z"
+                }
+            }
+        },
+        "internal.OrphanedRecord": {
+            "description": "Database row whose blob is missing on disk",
             "type": "object",
             "properties": {
-                "token": {
+                "file_id": {
                     "type": "string",
-                    "example": "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."
+                    "example": "550e8400-e29b-41d4-a716-446655440000"
                 },
-                "user": {
-                    "$ref": "#/definitions/internal.User"
+                "missing_blob": {
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000_processed.jpg"
+                },
+                "user_id": {
+                    "type": "integer",
+                    "example": 1
                 }
             }
         },
-        "internal.ErrorResponse": {
-            "description": "Error response",
+        "internal.PlanLimits": {
+            "description": "Quota limits (0 means unlimited)",
+            "type": "object",
+            "properties": {
+                "max_files_per_month": {
+                    "type": "integer",
+                    "example": 100
+                },
+                "max_storage_bytes": {
+                    "type": "integer",
+                    "example": 1073741824
+                },
+                "max_video_duration_sec": {
+                    "type": "integer",
+                    "example": 300
+                }
+            }
+        },
+        "internal.ProcessingOptions": {
+            "description": "File processing options",
+            "type": "object",
+            "properties": {
+                "blur_type": {
+                    "type": "string",
+                    "enum": [
+                        "gaussian",
+                        "motion",
+                        "pixelate"
+                    ],
+                    "example": "gaussian"
+                },
+                "intensity": {
+                    "type": "integer",
+                    "example": 5
+                },
+                "object_types": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "face",
+                        "person",
+                        "car"
+                    ]
+                },
+                "output_format": {
+                    "description": "для изображений",
+                    "type": "string",
+                    "enum": [
+                        "original",
+                        "jpeg"
+                    ],
+                    "example": "original"
+                },
+                "preset": {
+                    "description": "набор, добавленный к object_types",
+                    "type": "string",
+                    "example": "privacy"
+                },
+                "profile": {
+                    "description": "профиль, из которого взяты опции",
+                    "type": "string",
+                    "example": "street"
+                },
+                "regions": {
+                    "description": "области, размываемые целиком",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/internal.Region"
+                    }
+                },
+                "skipped_types": {
+                    "description": "типы набора, которых нет в каталоге",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "license plate"
+                    ]
+                }
+            }
+        },
+        "internal.ProcessingProfile": {
+            "description": "Saved processing options. At most one profile of a user is the default",
+            "type": "object",
+            "properties": {
+                "blur_type": {
+                    "type": "string",
+                    "enum": [
+                        "gaussian",
+                        "motion",
+                        "pixelate"
+                    ],
+                    "example": "pixelate"
+                },
+                "created_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:00:00Z"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "intensity": {
+                    "type": "integer",
+                    "example": 7
+                },
+                "is_default": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "name": {
+                    "type": "string",
+                    "example": "street"
+                },
+                "object_types": {
+                    "type": "string",
+                    "example": "face,car"
+                },
+                "output_format": {
+                    "type": "string",
+                    "enum": [
+                        "original",
+                        "jpeg"
+                    ],
+                    "example": "original"
+                },
+                "regions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/internal.Region"
+                    }
+                },
+                "updated_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:00:00Z"
+                },
+                "user_id": {
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "internal.ProcessingProfileRequest": {
+            "description": "Processing profile creation or update request. Omitted blur_type, intensity and output_format get the server defaults",
+            "type": "object",
+            "required": [
+                "name"
+            ],
+            "properties": {
+                "blur_type": {
+                    "type": "string",
+                    "enum": [
+                        "gaussian",
+                        "motion",
+                        "pixelate"
+                    ],
+                    "example": "pixelate"
+                },
+                "intensity": {
+                    "type": "integer",
+                    "example": 7
+                },
+                "is_default": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "name": {
+                    "type": "string",
+                    "example": "street"
+                },
+                "object_types": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "face",
+                        "car"
+                    ]
+                },
+                "output_format": {
+                    "type": "string",
+                    "enum": [
+                        "original",
+                        "jpeg"
+                    ],
+                    "example": "original"
+                },
+                "regions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/internal.Region"
+                    }
+                }
+            }
+        },
+        "internal.QuotaErrorResponse": {
+            "description": "Quota exceeded response",
             "type": "object",
             "properties": {
                 "error": {
                     "type": "string",
-                    "example": "Invalid credentials"
+                    "example": "Storage quota exceeded"
+                },
+                "quota": {
+                    "$ref": "#/definitions/internal.QuotaViolation"
+                }
+            }
+        },
+        "internal.QuotaStatus": {
+            "description": "User plan, limits and current usage",
+            "type": "object",
+            "properties": {
+                "limits": {
+                    "$ref": "#/definitions/internal.PlanLimits"
+                },
+                "plan": {
+                    "type": "string",
+                    "example": "free"
+                },
+                "usage": {
+                    "$ref": "#/definitions/internal.QuotaUsage"
+                }
+            }
+        },
+        "internal.QuotaUsage": {
+            "description": "Current quota usage",
+            "type": "object",
+            "properties": {
+                "files_this_month": {
+                    "type": "integer",
+                    "example": 12
+                },
+                "period": {
+                    "type": "string",
+                    "example": "2025-01"
+                },
+                "stored_bytes": {
+                    "type": "integer",
+                    "example": 524288000
+                }
+            }
+        },
+        "internal.QuotaViolation": {
+            "description": "Machine-readable quota violation details",
+            "type": "object",
+            "properties": {
+                "limit": {
+                    "type": "integer",
+                    "example": 1073741824
+                },
+                "quota": {
+                    "type": "string",
+                    "enum": [
+                        "storage_bytes",
+                        "files_per_month",
+                        "video_duration_sec",
+                        "cost_budget"
+                    ],
+                    "example": "storage_bytes"
+                },
+                "requested": {
+                    "type": "integer",
+                    "example": 5242880
+                },
+                "reset_at": {
+                    "type": "string",
+                    "example": "2025-02-01T00:00:00Z"
+                },
+                "used": {
+                    "type": "integer",
+                    "example": 1070000000
+                }
+            }
+        },
+        "internal.RecoveryCodesResponse": {
+            "description": "One-time recovery codes, shown only once",
+            "type": "object",
+            "properties": {
+                "auth": {
+                    "$ref": "#/definitions/internal.AuthResponse"
+                },
+                "recovery_codes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "k7m2p-x9q4r",
+                        "a3b4c-d5e6f"
+                    ]
+                }
+            }
+        },
+        "internal.RefreshTokenRequest": {
+            "description": "Refresh token exchange request",
+            "type": "object",
+            "required": [
+                "refresh_token"
+            ],
+            "properties": {
+                "refresh_token": {
+                    "type": "string",
+                    "example": "1b4e28ba-2fa1-11d2-883f-0016d3cca427.Vq3nS0d2..."
+                }
+            }
+        },
+        "internal.Region": {
+            "description": "Rectangle blurred on every frame. Coordinates are fractions (0-1) of the frame size",
+            "type": "object",
+            "properties": {
+                "height": {
+                    "type": "number",
+                    "example": 0.15
+                },
+                "width": {
+                    "type": "number",
+                    "example": 0.3
+                },
+                "x": {
+                    "type": "number",
+                    "example": 0.05
+                },
+                "y": {
+                    "type": "number",
+                    "example": 0.8
+                }
+            }
+        },
+        "internal.RegisterRequest": {
+            "description": "User registration request",
+            "type": "object",
+            "required": [
+                "email",
+                "name",
+                "password"
+            ],
+            "properties": {
+                "email": {
+                    "type": "string",
+                    "example": "user@example.com"
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 100,
+                    "minLength": 2,
+                    "example": "John Doe"
+                },
+                "password": {
+                    "type": "string",
+                    "maxLength": 128,
+                    "minLength": 6,
+                    "example": "securePassword123"
+                }
+            }
+        },
+        "internal.ResetPasswordRequest": {
+            "description": "Password reset confirmation with the token from the email and a new password",
+            "type": "object",
+            "required": [
+                "password",
+                "token"
+            ],
+            "properties": {
+                "password": {
+                    "type": "string",
+                    "maxLength": 128,
+                    "minLength": 6,
+                    "example": "newSecurePassword456"
+                },
+                "token": {
+                    "type": "string",
+                    "example": "mJ1a0Vd3x0Xp8cE9q2bS7wRkZ4nT6yHf..."
                 }
             }
         },
-        "internal.File": {
-            "description": "Uploaded file information with processing status",
+        "internal.StorageIssue": {
+            "description": "Discrepancy between database records and files on disk",
             "type": "object",
             "properties": {
-                "error_message": {
-                    "type": "string",
-                    "example": "Processing failed: invalid format"
-                },
-                "file_name": {
+                "details": {
                     "type": "string",
-                    "example": "550e8400-e29b-41d4-a716-446655440000.jpg"
+                    "example": "Original file is missing on disk"
                 },
-                "file_size": {
-                    "type": "integer",
-                    "example": 1048576
-                },
-                "id": {
+                "file_id": {
                     "type": "string",
                     "example": "550e8400-e29b-41d4-a716-446655440000"
                 },
-                "mime_type": {
-                    "type": "string",
-                    "example": "image/jpeg"
-                },
-                "original_name": {
-                    "type": "string",
-                    "example": "photo.jpg"
-                },
-                "processed_at": {
+                "path": {
                     "type": "string",
-                    "example": "2024-01-15T09:05:00Z"
+                    "example": "uploads/550e8400-e29b-41d4-a716-446655440000.jpg"
                 },
-                "processed_name": {
+                "repair_error": {
                     "type": "string",
-                    "example": "550e8400-e29b-41d4-a716-446655440000_processed.jpg"
+                    "example": "permission denied"
                 },
-                "processed_size": {
-                    "type": "integer",
-                    "example": 1048576
+                "repaired": {
+                    "type": "boolean",
+                    "example": false
                 },
-                "status": {
+                "type": {
                     "type": "string",
                     "enum": [
-                        "uploaded",
-                        "processing",
-                        "completed",
-                        "failed"
+                        "missing_original",
+                        "missing_processed",
+                        "temp_file",
+                        "orphan_blob",
+                        "stats_mismatch"
                     ],
-                    "example": "uploaded"
-                },
-                "uploaded_at": {
-                    "type": "string",
-                    "example": "2024-01-15T09:00:00Z"
+                    "example": "missing_original"
                 },
                 "user_id": {
                     "type": "integer",
@@ -641,17 +6632,50 @@ const docTemplate = `{
                 }
             }
         },
-        "internal.LoginRequest": {
-            "description": "User login request",
+        "internal.SuccessResponse": {
+            "description": "Success response with optional data",
+            "type": "object",
+            "properties": {
+                "data": {},
+                "message": {
+                    "type": "string",
+                    "example": "Operation completed successfully"
+                }
+            }
+        },
+        "internal.SuspendUserRequest": {
+            "description": "User suspension request",
+            "type": "object",
+            "properties": {
+                "reason": {
+                    "type": "string",
+                    "example": "Terms of service violation"
+                }
+            }
+        },
+        "internal.TokenRequest": {
+            "description": "Request carrying a token from an email link",
             "type": "object",
             "required": [
-                "email",
-                "password"
+                "token"
             ],
             "properties": {
-                "email": {
+                "token": {
                     "type": "string",
-                    "example": "user@example.com"
+                    "example": "mJ1a0Vd3x0Xp8cE9q2bS7wRkZ4nT6yHf..."
+                }
+            }
+        },
+        "internal.TwoFactorCodeRequest": {
+            "description": "Request carrying a TOTP code (and the password when disabling 2FA)",
+            "type": "object",
+            "required": [
+                "code"
+            ],
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "example": "123456"
                 },
                 "password": {
                     "type": "string",
@@ -659,41 +6683,89 @@ const docTemplate = `{
                 }
             }
         },
-        "internal.RegisterRequest": {
-            "description": "User registration request",
+        "internal.TwoFactorLoginRequest": {
+            "description": "Second login step: a TOTP code or one of the recovery codes",
             "type": "object",
             "required": [
-                "email",
-                "name",
-                "password"
+                "challenge_token"
             ],
             "properties": {
-                "email": {
+                "challenge_token": {
                     "type": "string",
-                    "example": "user@example.com"
+                    "example": "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."
                 },
-                "name": {
+                "code": {
                     "type": "string",
-                    "maxLength": 100,
-                    "minLength": 2,
-                    "example": "John Doe"
+                    "example": "123456"
                 },
-                "password": {
+                "recovery_code": {
                     "type": "string",
-                    "maxLength": 128,
-                    "minLength": 6,
-                    "example": "securePassword123"
+                    "example": "k7m2p-x9q4r"
                 }
             }
         },
-        "internal.SuccessResponse": {
-            "description": "Success response with optional data",
+        "internal.TwoFactorPolicyRequest": {
+            "description": "Whether two-factor authentication is mandatory",
             "type": "object",
             "properties": {
-                "data": {},
-                "message": {
+                "require_2fa": {
+                    "type": "boolean",
+                    "example": true
+                }
+            }
+        },
+        "internal.TwoFactorSetupResponse": {
+            "description": "Secret and otpauth URI to add to an authenticator app (render the URI as a QR code)",
+            "type": "object",
+            "properties": {
+                "otpauth_uri": {
                     "type": "string",
-                    "example": "Operation completed successfully"
+                    "example": "otpauth://totp/Obscura:user@example.com?secret=JBSWY3DPEHPK3PXP\u0026issuer=Obscura"
+                },
+                "secret": {
+                    "type": "string",
+                    "example": "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+                }
+            }
+        },
+        "internal.TwoFactorStatus": {
+            "description": "Two-factor authentication status of the current user",
+            "type": "object",
+            "properties": {
+                "enabled": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "enabled_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:00:00Z"
+                },
+                "recovery_codes_remaining": {
+                    "type": "integer",
+                    "example": 8
+                },
+                "required": {
+                    "type": "boolean",
+                    "example": false
+                }
+            }
+        },
+        "internal.UpdateMemberRequest": {
+            "description": "Request to change a member's role",
+            "type": "object",
+            "required": [
+                "role"
+            ],
+            "properties": {
+                "role": {
+                    "type": "string",
+                    "enum": [
+                        "owner",
+                        "admin",
+                        "member",
+                        "viewer"
+                    ],
+                    "example": "viewer"
                 }
             }
         },
@@ -719,116 +6791,263 @@ const docTemplate = `{
                 }
             }
         },
+        "internal.UpdateRoleRequest": {
+            "description": "User role change request",
+            "type": "object",
+            "required": [
+                "role"
+            ],
+            "properties": {
+                "role": {
+                    "type": "string",
+                    "enum": [
+                        "user",
+                        "admin",
+                        "auditor"
+                    ],
+                    "example": "auditor"
+                }
+            }
+        },
         "internal.User": {
             "description": "User account information",
             "type": "object",
             "properties": {
                 "created_at": {
                     "type": "string",
-                    "example": "2024-01-15T09:00:00Z"
+                    "example": "2025-01-15T09:00:00Z"
                 },
                 "email": {
                     "type": "string",
                     "example": "user@example.com"
                 },
+                "email_verified_at": {
+                    "description": "Подтверждение email: новый адрес не применяется, пока не подтвержден по ссылке",
+                    "type": "string",
+                    "example": "2025-01-15T09:10:00Z"
+                },
                 "id": {
                     "type": "integer",
                     "example": 1
                 },
+                "last_stats_update": {
+                    "type": "string",
+                    "example": "2024-01-15T09:00:00Z"
+                },
                 "name": {
                     "type": "string",
                     "example": "John Doe"
                 },
+                "pending_email": {
+                    "type": "string",
+                    "example": "newemail@example.com"
+                },
+                "plan": {
+                    "description": "Тарифный план и персональные лимиты, переопределяющие лимиты плана (nil - как в плане)",
+                    "type": "string",
+                    "enum": [
+                        "free",
+                        "pro",
+                        "unlimited"
+                    ],
+                    "example": "free"
+                },
+                "role": {
+                    "description": "Роль и блокировка учетной записи",
+                    "type": "string",
+                    "enum": [
+                        "user",
+                        "admin",
+                        "auditor"
+                    ],
+                    "example": "user"
+                },
+                "suspend_reason": {
+                    "type": "string",
+                    "example": "Terms of service violation"
+                },
+                "suspended_at": {
+                    "type": "string",
+                    "example": "2025-01-20T09:00:00Z"
+                },
+                "total_failed": {
+                    "type": "integer",
+                    "example": 5
+                },
+                "total_files": {
+                    "type": "integer",
+                    "example": 50
+                },
+                "total_processed": {
+                    "type": "integer",
+                    "example": 45
+                },
+                "total_size": {
+                    "type": "integer",
+                    "example": 524288000
+                },
+                "totp_enabled_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:00:00Z"
+                },
                 "updated_at": {
                     "type": "string",
-                    "example": "2024-01-15T09:00:00Z"
+                    "example": "2025-01-15T09:00:00Z"
                 }
             }
         },
-        "internal.UserStats": {
-            "description": "User statistics and usage information",
+        "internal.UserOrganization": {
+            "description": "Organization the current user belongs to, with the user's role in it",
             "type": "object",
             "properties": {
-                "failed_files": {
+                "created_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:00:00Z"
+                },
+                "created_by": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "id": {
                     "type": "integer",
                     "example": 3
                 },
-                "files_by_status": {
-                    "type": "object",
-                    "additionalProperties": {
-                        "type": "integer"
-                    },
-                    "example": {
-                        "completed": 20,
-                        "failed": 1,
-                        "processing": 2,
-                        "uploaded": 2
-                    }
+                "name": {
+                    "type": "string",
+                    "example": "Acme Newsroom"
                 },
-                "files_by_type": {
-                    "type": "object",
-                    "additionalProperties": {
-                        "type": "integer"
-                    },
-                    "example": {
-                        "image": 15,
-                        "video": 10
-                    }
+                "plan": {
+                    "description": "Тарифный план и лимиты организации, общие для всех участников",
+                    "type": "string",
+                    "enum": [
+                        "free",
+                        "pro",
+                        "unlimited"
+                    ],
+                    "example": "pro"
                 },
-                "processed_files": {
-                    "type": "integer",
-                    "example": 20
+                "require_2fa": {
+                    "description": "Участники обязаны включить двухфакторную аутентификацию",
+                    "type": "boolean",
+                    "example": false
                 },
-                "processed_this_month": {
-                    "type": "integer",
-                    "example": 12
+                "role": {
+                    "type": "string",
+                    "enum": [
+                        "owner",
+                        "admin",
+                        "member",
+                        "viewer"
+                    ],
+                    "example": "owner"
                 },
-                "processed_this_week": {
-                    "type": "integer",
-                    "example": 7
+                "updated_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:00:00Z"
+                }
+            }
+        },
+        "internal.UserStats": {
+            "description": "User statistics with quota limits and usage",
+            "type": "object",
+            "properties": {
+                "budget": {
+                    "$ref": "#/definitions/internal.BudgetStatus"
                 },
-                "processed_today": {
-                    "type": "integer",
-                    "example": 2
+                "created_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:00:00Z"
                 },
-                "processing_files": {
-                    "type": "integer",
-                    "example": 2
+                "email": {
+                    "type": "string",
+                    "example": "user@example.com"
                 },
-                "recent_files": {
-                    "type": "array",
-                    "items": {
-                        "$ref": "#/definitions/internal.File"
-                    }
+                "email_verified_at": {
+                    "description": "Подтверждение email: новый адрес не применяется, пока не подтвержден по ссылке",
+                    "type": "string",
+                    "example": "2025-01-15T09:10:00Z"
                 },
-                "total_files": {
+                "id": {
                     "type": "integer",
-                    "example": 25
+                    "example": 1
                 },
-                "total_size": {
+                "last_stats_update": {
+                    "type": "string",
+                    "example": "2024-01-15T09:00:00Z"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "John Doe"
+                },
+                "pending_email": {
+                    "type": "string",
+                    "example": "newemail@example.com"
+                },
+                "plan": {
+                    "description": "Тарифный план и персональные лимиты, переопределяющие лимиты плана (nil - как в плане)",
+                    "type": "string",
+                    "enum": [
+                        "free",
+                        "pro",
+                        "unlimited"
+                    ],
+                    "example": "free"
+                },
+                "quota": {
+                    "$ref": "#/definitions/internal.QuotaStatus"
+                },
+                "role": {
+                    "description": "Роль и блокировка учетной записи",
+                    "type": "string",
+                    "enum": [
+                        "user",
+                        "admin",
+                        "auditor"
+                    ],
+                    "example": "user"
+                },
+                "suspend_reason": {
+                    "type": "string",
+                    "example": "Terms of service violation"
+                },
+                "suspended_at": {
+                    "type": "string",
+                    "example": "2025-01-20T09:00:00Z"
+                },
+                "total_failed": {
                     "type": "integer",
-                    "example": 52428800
+                    "example": 5
                 },
-                "total_size_mb": {
-                    "type": "number",
+                "total_files": {
+                    "type": "integer",
                     "example": 50
                 },
-                "uploaded_this_month": {
+                "total_processed": {
                     "type": "integer",
-                    "example": 15
+                    "example": 45
                 },
-                "uploaded_this_week": {
+                "total_size": {
                     "type": "integer",
-                    "example": 8
+                    "example": 524288000
                 },
-                "uploaded_today": {
-                    "type": "integer",
-                    "example": 3
+                "totp_enabled_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:00:00Z"
+                },
+                "updated_at": {
+                    "type": "string",
+                    "example": "2025-01-15T09:00:00Z"
                 }
             }
         }
     },
     "securityDefinitions": {
+        "ApiKeyAuth": {
+            "description": "Personal API key created via /api/user/api-keys",
+            "type": "apiKey",
+            "name": "X-API-Key",
+            "in": "header"
+        },
         "BearerAuth": {
             "description": "Type \"Bearer\" followed by a space and JWT token",
             "type": "apiKey",
@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+// Роли участников организации
+const (
+	MemberRoleOwner  = "owner"
+	MemberRoleAdmin  = "admin"
+	MemberRoleMember = "member"
+	MemberRoleViewer = "viewer"
+)
+
+// Действия с файлами, проверяемые политикой доступа
+const (
+	FileActionView      = "view"
+	FileActionDownload  = "download"
+	FileActionReprocess = "reprocess"
+	FileActionDelete    = "delete"
+)
+
+var allowedMemberRoles = []string{MemberRoleOwner, MemberRoleAdmin, MemberRoleMember, MemberRoleViewer}
+
+// memberFilePermissions действия, разрешенные роли с любым файлом организации.
+// Участник организации дополнительно может удалять загруженные им файлы, пока состоит в ней
+var memberFilePermissions = map[string][]string{
+	MemberRoleOwner:  {FileActionView, FileActionDownload, FileActionReprocess, FileActionDelete},
+	MemberRoleAdmin:  {FileActionView, FileActionDownload, FileActionReprocess, FileActionDelete},
+	MemberRoleMember: {FileActionView, FileActionDownload, FileActionReprocess},
+	MemberRoleViewer: {FileActionView, FileActionDownload},
+}
+
+// canUploadToOrganization проверяет, может ли роль загружать файлы в организацию
+func canUploadToOrganization(role string) bool {
+	return role == MemberRoleOwner || role == MemberRoleAdmin || role == MemberRoleMember
+}
+
+// canManageMembers проверяет, может ли роль управлять участниками организации
+func canManageMembers(role string) bool {
+	return role == MemberRoleOwner || role == MemberRoleAdmin
+}
+
+// canAccessFile единая политика доступа к файлам: личный файл доступен только загрузившему,
+// файл организации - только ее участникам. Загрузивший участник может все со своим файлом,
+// остальные - действия, разрешенные их ролью. После исключения из организации прав не остается
+func (s *Server) canAccessFile(file *File, userID uint, action string) (bool, error) {
+	if file.OrganizationID == nil {
+		return file.UserID == userID, nil
+	}
+
+	membership, err := s.db.GetMembership(*file.OrganizationID, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if file.UserID == userID {
+		return true, nil
+	}
+	return slices.Contains(memberFilePermissions[membership.Role], action), nil
+}
+
+// fileForAction загружает файл и проверяет право пользователя на действие.
+// При отказе отправляет ответ клиенту и возвращает false
+func (s *Server) fileForAction(w http.ResponseWriter, fileID string, userID int, action string) (*File, bool) {
+	file, err := s.db.GetFileByID(fileID)
+	if err != nil {
+		s.logger.Warning("File not found: %s for user %d", fileID, userID)
+		s.sendError(w, "File not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	allowed, err := s.canAccessFile(file, uint(userID), action)
+	if err != nil {
+		s.logger.Error("Failed to check access to file %s for user %d: %v", fileID, userID, err)
+		s.sendError(w, "Failed to check access", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if !allowed {
+		s.logger.Warning("Access denied: user %d tried to %s file %s owned by user %d", userID, action, fileID, file.UserID)
+		s.sendError(w, "Access denied", http.StatusForbidden)
+		return nil, false
+	}
+
+	// Зараженный файл можно только просмотреть в списке и удалить
+	if file.Status == StatusQuarantined && (action == FileActionDownload || action == FileActionReprocess) {
+		s.logger.Warning("User %d tried to %s quarantined file %s", userID, action, fileID)
+		s.sendError(w, "File is quarantined", http.StatusForbidden)
+		return nil, false
+	}
+
+	return file, true
+}
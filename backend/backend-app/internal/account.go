@@ -0,0 +1,477 @@
+package internal
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Статусы задачи удаления учетной записи
+const (
+	DeletionPending   = "pending"
+	DeletionRunning   = "running"
+	DeletionCompleted = "completed"
+	DeletionFailed    = "failed"
+)
+
+const (
+	TokenPurposeDeleteAccount  = "delete_account"
+	RevokeReasonAccountDeleted = "account_deleted"
+
+	accountDeletionTokenTTL = time.Hour
+	// Прогресс удаления сохраняется не чаще, чем раз в столько файлов
+	deletionProgressEvery = 20
+)
+
+// @Summary Delete account
+// @Description Request deletion of the current account. A confirmation link is sent to the account email; the deletion starts only after it is confirmed via /api/user/delete/confirm. Sole owners of organizations with other members must transfer ownership first. Files uploaded to organizations with other members are not deleted: they stay in the organization and pass to its owner
+// @Tags user
+// @Produce json
+// @Security BearerAuth
+// @Success 202 {object} SuccessResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/user [delete]
+func (s *Server) handleDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := strconv.Atoi(r.Header.Get("X-User-ID"))
+	if err != nil {
+		s.sendError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.db.GetUserByID(uint(userID))
+	if err != nil {
+		s.sendError(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if !s.checkAccountDeletable(w, user.ID) {
+		return
+	}
+
+	token, err := s.issueUserToken(user.ID, TokenPurposeDeleteAccount, user.Email, accountDeletionTokenTTL)
+	if err != nil {
+		s.logger.Error("Failed to issue account deletion token for user %d: %v", user.ID, err)
+		s.sendError(w, "Failed to request account deletion", http.StatusInternalServerError)
+		return
+	}
+
+	link := s.config.PublicURL + "/delete-account?token=" + url.QueryEscape(token)
+	s.sendMail(Message{
+		To:      user.Email,
+		Subject: "Confirm account deletion",
+		Body: fmt.Sprintf("Hello, %s!\n\nYou asked to delete your Obscura account together with all uploaded and processed files. "+
+			"Files you uploaded to organizations with other members stay in those organizations and pass to their owners. "+
+			"This cannot be undone. To confirm, open the link below:\n\n%s\n\n"+
+			"The link is valid for %d minutes. If you did not request this, ignore this email and consider changing your password.\n",
+			user.Name, link, int(accountDeletionTokenTTL.Minutes())),
+	})
+
+	s.logger.Info("Account deletion requested by user %d, confirmation sent", user.ID)
+	s.sendJSONStatus(w, SuccessResponse{
+		Message: "Confirm the deletion via the link sent to " + user.Email,
+	}, http.StatusAccepted)
+}
+
+// @Summary Confirm account deletion
+// @Description Confirm account deletion with the token from the email. The account is blocked immediately, all sessions are revoked and the data is removed in the background. Track progress via the returned status URL
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param request body TokenRequest true "Deletion confirmation token"
+// @Success 202 {object} SuccessResponse{data=AccountDeletion}
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/user/delete/confirm [post]
+func (s *Server) handleConfirmAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	_, user, err := s.consumeUserToken(req.Token, TokenPurposeDeleteAccount)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			s.logger.Error("Failed to check account deletion token: %v", err)
+		}
+		s.sendError(w, "Invalid or expired confirmation link", http.StatusBadRequest)
+		return
+	}
+
+	if !s.checkAccountDeletable(w, user.ID) {
+		return
+	}
+
+	job := &AccountDeletion{
+		ID:          uuid.New().String(),
+		UserID:      user.ID,
+		Status:      DeletionPending,
+		RequestedAt: time.Now(),
+	}
+	if err := s.db.CreateAccountDeletion(job); err != nil {
+		s.logger.Error("Failed to create deletion job for user %d: %v", user.ID, err)
+		s.sendError(w, "Failed to start account deletion", http.StatusInternalServerError)
+		return
+	}
+
+	// Блокировка сразу отключает вход и API ключи, пока данные удаляются
+	if err := s.db.SetUserSuspended(user.ID, true, "Account deletion in progress"); err != nil {
+		s.logger.Error("Failed to block user %d before deletion: %v", user.ID, err)
+	}
+	if err := s.db.RevokeUserSessions(user.ID, RevokeReasonAccountDeleted); err != nil {
+		s.logger.Error("Failed to revoke sessions of user %d before deletion: %v", user.ID, err)
+	}
+
+	s.audit(AuditEvent{
+		Action:       AuditAccountDeletion,
+		ActorID:      &user.ID,
+		TargetUserID: &user.ID,
+		IP:           getClientIP(r),
+		Message:      fmt.Sprintf("User %d confirmed account deletion (job %s)", user.ID, job.ID),
+	})
+
+	go s.runAccountDeletion(job)
+
+	w.Header().Set("Location", "/api/user/deletions/"+job.ID)
+	s.sendJSONStatus(w, SuccessResponse{
+		Message: "Account deletion started",
+		Data:    job,
+	}, http.StatusAccepted)
+}
+
+// @Summary Account deletion status
+// @Description Progress of an account deletion job. The job ID acts as the access key, because the account no longer exists when the deletion completes
+// @Tags user
+// @Produce json
+// @Param id path string true "Deletion job ID"
+// @Success 200 {object} SuccessResponse{data=AccountDeletion}
+// @Failure 404 {object} ErrorResponse
+// @Router /api/user/deletions/{id} [get]
+func (s *Server) handleAccountDeletionStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jobID := strings.TrimPrefix(r.URL.Path, "/api/user/deletions/")
+	if _, err := uuid.Parse(jobID); err != nil {
+		s.sendError(w, "Deletion job not found", http.StatusNotFound)
+		return
+	}
+
+	job, err := s.db.GetAccountDeletion(jobID)
+	if err != nil {
+		s.sendError(w, "Deletion job not found", http.StatusNotFound)
+		return
+	}
+
+	s.sendJSON(w, SuccessResponse{
+		Message: "Deletion status retrieved",
+		Data:    job,
+	})
+}
+
+// checkAccountDeletable отвечает 409, если удаление уже идет или пользователь -
+// единственный владелец организации, в которой есть другие участники
+func (s *Server) checkAccountDeletable(w http.ResponseWriter, userID uint) bool {
+	active, err := s.db.HasActiveAccountDeletion(userID)
+	if err != nil {
+		s.logger.Error("Failed to check deletion jobs of user %d: %v", userID, err)
+		s.sendError(w, "Failed to check account", http.StatusInternalServerError)
+		return false
+	}
+	if active {
+		s.sendError(w, "Account deletion is already in progress", http.StatusConflict)
+		return false
+	}
+
+	orgs, err := s.db.GetUserOrganizations(userID)
+	if err != nil {
+		s.logger.Error("Failed to get organizations of user %d: %v", userID, err)
+		s.sendError(w, "Failed to check account", http.StatusInternalServerError)
+		return false
+	}
+
+	var blocking []string
+	for _, org := range orgs {
+		if org.Role != MemberRoleOwner {
+			continue
+		}
+		owners, err := s.db.CountOrganizationOwners(org.ID)
+		if err != nil {
+			s.sendError(w, "Failed to check account", http.StatusInternalServerError)
+			return false
+		}
+		members, err := s.db.CountOrganizationMembers(org.ID)
+		if err != nil {
+			s.sendError(w, "Failed to check account", http.StatusInternalServerError)
+			return false
+		}
+		if owners == 1 && members > 1 {
+			blocking = append(blocking, org.Name)
+		}
+	}
+
+	if len(blocking) > 0 {
+		s.sendError(w, "Transfer ownership of these organizations before deleting the account: "+strings.Join(blocking, ", "), http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// runAccountDeletion удаляет файлы и записи пользователя, сохраняя прогресс в задаче
+func (s *Server) runAccountDeletion(job *AccountDeletion) {
+	s.logger.Info("Account deletion job %s started for user %d", job.ID, job.UserID)
+
+	job.Status = DeletionRunning
+	if err := s.db.UpdateAccountDeletion(job); err != nil {
+		s.logger.Error("Failed to update deletion job %s: %v", job.ID, err)
+	}
+
+	// Организации, где пользователь единственный участник, после удаления никому не нужны
+	var soloOrgs []uint
+	if orgs, err := s.db.GetUserOrganizations(job.UserID); err == nil {
+		for _, org := range orgs {
+			if members, err := s.db.CountOrganizationMembers(org.ID); err == nil && members == 1 {
+				soloOrgs = append(soloOrgs, org.ID)
+			}
+		}
+	}
+
+	err := s.purgeUser(job.UserID, func(done, total int) {
+		job.FilesTotal = total
+		job.FilesDeleted = done
+		if done == total || done%deletionProgressEvery == 0 {
+			if err := s.db.UpdateAccountDeletion(job); err != nil {
+				s.logger.Warning("Failed to save progress of deletion job %s: %v", job.ID, err)
+			}
+		}
+	})
+
+	if err == nil {
+		for _, orgID := range soloOrgs {
+			// Файлы, загруженные бывшими участниками, не удаляем вместе с организацией
+			if count, err := s.db.CountOrganizationFiles(orgID); err == nil && count == 0 {
+				if err := s.db.DeleteOrganization(orgID); err != nil {
+					s.logger.Warning("Failed to delete organization %d of deleted user %d: %v", orgID, job.UserID, err)
+				}
+			}
+		}
+	}
+
+	now := time.Now()
+	job.CompletedAt = &now
+	event := AuditEvent{
+		Action:       AuditAccountDeletion,
+		TargetUserID: &job.UserID,
+	}
+
+	if err != nil {
+		job.Status = DeletionFailed
+		job.ErrorMessage = "Failed to delete account data"
+		event.Severity = AuditAlert
+		event.Message = fmt.Sprintf("Deletion job %s for user %d failed: %v", job.ID, job.UserID, err)
+	} else {
+		job.Status = DeletionCompleted
+		event.Message = fmt.Sprintf("Deletion job %s completed: user %d and %d files removed", job.ID, job.UserID, job.FilesDeleted)
+	}
+
+	if err := s.db.UpdateAccountDeletion(job); err != nil {
+		s.logger.Error("Failed to update deletion job %s: %v", job.ID, err)
+	}
+	s.audit(event)
+}
+
+// resumeAccountDeletions перезапускает задачи удаления, прерванные остановкой сервера
+func (s *Server) resumeAccountDeletions() {
+	jobs, err := s.db.GetUnfinishedAccountDeletions()
+	if err != nil {
+		s.logger.Error("Failed to load unfinished account deletions: %v", err)
+		return
+	}
+
+	for i := range jobs {
+		s.logger.Info("Resuming account deletion job %s", jobs[i].ID)
+		go s.runAccountDeletion(&jobs[i])
+	}
+}
+
+// @Summary Export account data
+// @Description Download a ZIP archive with all personal data: profile.json (profile, organizations, SSO identities, API keys and sessions), files.json (file metadata), originals/ and processed/ with the stored files
+// @Tags user
+// @Produce application/zip
+// @Security BearerAuth
+// @Success 200 {file} binary
+// @Failure 401 {object} ErrorResponse
+// @Router /api/user/export [get]
+func (s *Server) handleExportAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := strconv.Atoi(r.Header.Get("X-User-ID"))
+	if err != nil {
+		s.sendError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	export, files, err := s.collectAccountExport(uint(userID))
+	if err != nil {
+		s.logger.Error("Failed to collect export data for user %d: %v", userID, err)
+		s.sendError(w, "Failed to export account data", http.StatusInternalServerError)
+		return
+	}
+
+	// Архив может собираться дольше общего таймаута записи сервера
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		s.logger.Debug("Failed to extend write deadline for export: %v", err)
+	}
+
+	filename := fmt.Sprintf("obscura-export-%d-%s.zip", userID, export.ExportedAt.Format("20060102"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	// После начала ответа ошибки можно только записать в лог
+	zw := zip.NewWriter(w)
+	if err := writeZipJSON(zw, "profile.json", export); err != nil {
+		s.logger.Error("Failed to write export for user %d: %v", userID, err)
+		return
+	}
+	if err := writeZipJSON(zw, "files.json", files); err != nil {
+		s.logger.Error("Failed to write export for user %d: %v", userID, err)
+		return
+	}
+
+	for _, file := range files {
+		// Зараженные файлы лежат в карантине и в архив не попадают
+		if file.Status == StatusQuarantined {
+			continue
+		}
+		s.addBlobToZip(zw, "originals/"+file.ID+"_"+exportFileName(file.OriginalName), file.FileName)
+		if file.ProcessedName != "" {
+			s.addBlobToZip(zw, "processed/"+exportFileName(file.ProcessedName), file.ProcessedName)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		s.logger.Error("Failed to finish export for user %d: %v", userID, err)
+		return
+	}
+
+	uid := uint(userID)
+	s.audit(AuditEvent{
+		Action:       AuditAccountExport,
+		ActorID:      &uid,
+		TargetUserID: &uid,
+		IP:           getClientIP(r),
+		Message:      fmt.Sprintf("User %d exported account data (%d files)", userID, len(files)),
+	})
+}
+
+// collectAccountExport собирает данные пользователя для экспорта
+func (s *Server) collectAccountExport(userID uint) (*UserExport, []File, error) {
+	user, err := s.db.GetUserByID(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	orgs, err := s.db.GetUserOrganizations(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	identities, err := s.db.GetUserIdentities(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys, err := s.db.GetUserAPIKeys(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	sessions, err := s.db.GetUserSessions(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	profiles, err := s.db.GetUserProcessingProfiles(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	files, err := s.db.GetUserFiles(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &UserExport{
+		ExportedAt:    time.Now(),
+		User:          *user,
+		Organizations: orgs,
+		Identities:    identities,
+		APIKeys:       keys,
+		Sessions:      sessions,
+		Profiles:      profiles,
+	}, files, nil
+}
+
+// addBlobToZip копирует файл из хранилища в архив. Отсутствующие файлы пропускаются
+func (s *Server) addBlobToZip(zw *zip.Writer, entry, blobName string) {
+	blob, err := s.blobs.Open(blobName)
+	if err != nil {
+		s.logger.Warning("Skipping %s in export: %v", blobName, err)
+		return
+	}
+	defer blob.Close()
+
+	header := &zip.FileHeader{
+		Name:     entry,
+		Method:   zip.Store, // изображения и видео уже сжаты
+		Modified: blob.ModTime(),
+	}
+	dst, err := zw.CreateHeader(header)
+	if err != nil {
+		s.logger.Error("Failed to add %s to export: %v", blobName, err)
+		return
+	}
+	if _, err := io.Copy(dst, blob); err != nil {
+		s.logger.Error("Failed to copy %s to export: %v", blobName, err)
+	}
+}
+
+func writeZipJSON(zw *zip.Writer, name string, data interface{}) error {
+	dst, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(dst)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
+
+// exportFileName оставляет от имени файла только последний элемент пути,
+// чтобы записи архива не выходили за пределы папки при распаковке
+func exportFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == ".." || name == "/" {
+		return "file"
+	}
+	return name
+}
@@ -0,0 +1,323 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	adminUsersDefaultLimit = 50
+	adminUsersMaxLimit     = 200
+)
+
+// @Summary List users
+// @Description Search users by email or name with optional role and suspension filters. Available to admins and auditors
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param q query string false "Substring of email or name"
+// @Param role query string false "Role filter" Enums(user, admin, auditor)
+// @Param suspended query bool false "Only suspended (true) or only active (false) users"
+// @Param limit query int false "Page size" default(50) maximum(200)
+// @Param offset query int false "Page offset" default(0)
+// @Success 200 {object} SuccessResponse{data=AdminUserList}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /api/admin/users [get]
+func (s *Server) handleAdminUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := UserFilter{
+		Query: strings.TrimSpace(query.Get("q")),
+		Role:  query.Get("role"),
+		Limit: adminUsersDefaultLimit,
+	}
+
+	if filter.Role != "" && !slices.Contains(allowedRoles, filter.Role) {
+		s.sendError(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	if value := query.Get("suspended"); value != "" {
+		suspended, err := strconv.ParseBool(value)
+		if err != nil {
+			s.sendError(w, "Invalid suspended value", http.StatusBadRequest)
+			return
+		}
+		filter.Suspended = &suspended
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > adminUsersMaxLimit {
+			s.sendError(w, "Invalid limit value", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			s.sendError(w, "Invalid offset value", http.StatusBadRequest)
+			return
+		}
+		filter.Offset = offset
+	}
+
+	users, total, err := s.db.SearchUsers(filter)
+	if err != nil {
+		s.logger.Error("Failed to search users: %v", err)
+		s.sendError(w, "Failed to get users", http.StatusInternalServerError)
+		return
+	}
+
+	s.sendJSON(w, SuccessResponse{
+		Message: "Users retrieved successfully",
+		Data: AdminUserList{
+			Users:  users,
+			Total:  total,
+			Limit:  filter.Limit,
+			Offset: filter.Offset,
+		},
+	})
+}
+
+// @Summary User administration
+// @Description GET returns a user (admins and auditors). DELETE removes the user with all files, sessions and API keys; files the user uploaded to organizations with other members stay there and pass to an owner (or the next admin or member). POST .../suspend blocks the account and revokes its sessions, POST .../unsuspend lifts the block, POST .../unlock clears a brute-force login lockout, PUT .../role changes the role. Changes are available to admins only and cannot target the caller's own account
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param request body SuspendUserRequest false "Suspension reason (suspend only)"
+// @Param request body UpdateRoleRequest false "New role (role only)"
+// @Success 200 {object} SuccessResponse{data=User}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/admin/users/{id} [get]
+// @Router /api/admin/users/{id} [delete]
+// @Router /api/admin/users/{id}/suspend [post]
+// @Router /api/admin/users/{id}/unsuspend [post]
+// @Router /api/admin/users/{id}/unlock [post]
+// @Router /api/admin/users/{id}/role [put]
+func (s *Server) handleAdminUserActions(w http.ResponseWriter, r *http.Request) {
+	idPart, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/admin/users/"), "/")
+
+	targetID, err := strconv.ParseUint(idPart, 10, 64)
+	if err != nil || targetID == 0 {
+		s.sendError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	target, err := s.db.GetUserByID(uint(targetID))
+	if err != nil {
+		s.sendError(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if action == "" && r.Method == http.MethodGet {
+		s.sendJSON(w, SuccessResponse{
+			Message: "User retrieved successfully",
+			Data:    target,
+		})
+		return
+	}
+
+	if !s.requireRole(w, r, RoleAdmin) {
+		return
+	}
+
+	adminID, _ := strconv.Atoi(r.Header.Get("X-User-ID"))
+	if uint(adminID) == target.ID {
+		s.sendError(w, "Administrators cannot modify their own account here", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodDelete:
+		s.handleAdminDeleteUser(w, target, adminID)
+	case action == "suspend" && r.Method == http.MethodPost:
+		s.handleAdminSuspendUser(w, r, target, adminID)
+	case action == "unsuspend" && r.Method == http.MethodPost:
+		if err := s.db.SetUserSuspended(target.ID, false, ""); err != nil {
+			s.logger.Error("Failed to unsuspend user %d: %v", target.ID, err)
+			s.sendError(w, "Failed to unsuspend user", http.StatusInternalServerError)
+			return
+		}
+		s.logger.Info("User %d unsuspended by admin %d", target.ID, adminID)
+		s.sendAdminUser(w, target.ID, "User unsuspended")
+	case action == "unlock" && r.Method == http.MethodPost:
+		s.handleAdminUnlockUser(w, r, target, adminID)
+	case action == "role" && r.Method == http.MethodPut:
+		s.handleAdminSetRole(w, r, target, adminID)
+	default:
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Блокировка пользователя: все сессии отзываются, API ключи перестают приниматься
+func (s *Server) handleAdminSuspendUser(w http.ResponseWriter, r *http.Request, target *User, adminID int) {
+	var req SuspendUserRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.sendError(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := s.db.SetUserSuspended(target.ID, true, strings.TrimSpace(req.Reason)); err != nil {
+		s.logger.Error("Failed to suspend user %d: %v", target.ID, err)
+		s.sendError(w, "Failed to suspend user", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.db.RevokeUserSessions(target.ID, RevokeReasonSuspended); err != nil {
+		s.logger.Error("Failed to revoke sessions of suspended user %d: %v", target.ID, err)
+	}
+
+	s.logger.Info("User %d suspended by admin %d (reason: %q)", target.ID, adminID, req.Reason)
+	s.sendAdminUser(w, target.ID, "User suspended")
+}
+
+// Смена роли пользователя
+func (s *Server) handleAdminSetRole(w http.ResponseWriter, r *http.Request, target *User, adminID int) {
+	var req UpdateRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if !slices.Contains(allowedRoles, req.Role) {
+		s.sendValidationErrors(w, []ValidationError{{
+			Field:   "role",
+			Message: "Role must be one of: " + strings.Join(allowedRoles, ", "),
+		}})
+		return
+	}
+
+	if err := s.db.SetUserRole(target.ID, req.Role); err != nil {
+		s.logger.Error("Failed to change role of user %d: %v", target.ID, err)
+		s.sendError(w, "Failed to change role", http.StatusInternalServerError)
+		return
+	}
+
+	s.logger.Info("Role of user %d changed from %s to %s by admin %d", target.ID, target.Role, req.Role, adminID)
+	s.sendAdminUser(w, target.ID, "Role updated")
+}
+
+// Удаление пользователя со всеми данными
+func (s *Server) handleAdminDeleteUser(w http.ResponseWriter, target *User, adminID int) {
+	if err := s.purgeUser(target.ID, nil); err != nil {
+		s.logger.Error("Failed to delete user %d: %v", target.ID, err)
+		s.sendError(w, "Failed to delete user", http.StatusInternalServerError)
+		return
+	}
+
+	s.logger.Info("User %d (%s) deleted by admin %d", target.ID, target.Email, adminID)
+	s.sendJSON(w, SuccessResponse{Message: "User deleted"})
+}
+
+// purgeUser удаляет файлы пользователя из хранилища и все его записи в БД.
+// Файлы, загруженные в организации с другими участниками, остаются в организации
+// и передаются ее владельцу (см. TransferOrganizationFiles).
+// progress, если задан, вызывается после каждого удаленного файла
+func (s *Server) purgeUser(userID uint, progress func(done, total int)) error {
+	transferred, err := s.db.TransferOrganizationFiles(userID)
+	if err != nil {
+		return err
+	}
+	if transferred > 0 {
+		s.logger.Info("Transferred %d organization files of user %d to other members", transferred, userID)
+	}
+
+	files, err := s.db.GetUserFiles(userID)
+	if err != nil {
+		return err
+	}
+
+	for i, file := range files {
+		for _, name := range file.BlobNames() {
+			path := filepath.Join(s.blobDir(&file), name)
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				s.logger.Warning("Failed to remove file from disk: %s - %v", path, err)
+			}
+		}
+		if progress != nil {
+			progress(i+1, len(files))
+		}
+	}
+
+	return s.db.DeleteUserRecords(userID)
+}
+
+// sendAdminUser отправляет актуальное состояние пользователя после изменения
+func (s *Server) sendAdminUser(w http.ResponseWriter, userID uint, message string) {
+	user, err := s.db.GetUserByID(userID)
+	if err != nil {
+		s.sendError(w, "User not found", http.StatusNotFound)
+		return
+	}
+	s.sendJSON(w, SuccessResponse{
+		Message: message,
+		Data:    user,
+	})
+}
+
+// @Summary Inspect any file
+// @Description Get information about any user's file together with its owner, or download it with ?type=original or ?type=processed. Available to admins and auditors
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "File ID"
+// @Param type query string false "Download type" Enums(original, processed)
+// @Success 200 {object} SuccessResponse{data=AdminFileInfo}
+// @Success 200 {file} binary "File download (when type parameter is used)"
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/admin/files/{id} [get]
+func (s *Server) handleAdminFileActions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fileID := strings.TrimPrefix(r.URL.Path, "/api/admin/files/")
+	if fileID == "" {
+		s.sendError(w, "File ID required", http.StatusBadRequest)
+		return
+	}
+
+	file, err := s.db.GetFileByID(fileID)
+	if err != nil {
+		s.sendError(w, "File not found", http.StatusNotFound)
+		return
+	}
+
+	switch downloadType := r.URL.Query().Get("type"); downloadType {
+	case "original", "processed":
+		s.logger.Info("Admin %s downloads %s file %s of user %d", r.Header.Get("X-User-ID"), downloadType, file.ID, file.UserID)
+		s.handleDownloadFile(w, r, file, downloadType == "processed")
+	case "":
+		info := AdminFileInfo{File: *file}
+		if owner, err := s.db.GetUserByID(file.UserID); err == nil {
+			info.Owner = owner
+		}
+		s.sendJSON(w, SuccessResponse{
+			Message: "File info retrieved",
+			Data:    info,
+		})
+	default:
+		s.sendError(w, "Invalid download type", http.StatusBadRequest)
+	}
+}
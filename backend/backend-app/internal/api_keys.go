@@ -0,0 +1,293 @@
+package internal
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Права API ключей
+const (
+	ScopeRead   = "read"
+	ScopeUpload = "upload"
+	ScopeDelete = "delete"
+)
+
+const (
+	apiKeyPrefix      = "obs_"
+	maxAPIKeysPerUser = 20
+	// Не чаще этого интервала обновляем время последнего использования ключа
+	apiKeyTouchInterval = time.Minute
+)
+
+var (
+	errInvalidAPIKey     = &authError{"Invalid API key"}
+	errAPIKeyNotAllowed  = &authError{"This endpoint requires a user session, API keys are not accepted"}
+	errInsufficientScope = &authError{"API key does not have the required scope"}
+)
+
+var allowedScopes = []string{ScopeRead, ScopeUpload, ScopeDelete}
+
+// apiKeyFromRequest извлекает API ключ из заголовков "Authorization: ApiKey ..." или "X-API-Key"
+func apiKeyFromRequest(r *http.Request) string {
+	if key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "ApiKey "); ok {
+		return strings.TrimSpace(key)
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+// authenticate проверяет учетные данные запроса: API ключ или Bearer токен
+func (s *Server) authenticate(r *http.Request) (*AccessClaims, error) {
+	if key := apiKeyFromRequest(r); key != "" {
+		return s.authenticateAPIKey(r, key)
+	}
+	return s.parseAccessToken(r)
+}
+
+// authenticateAPIKey находит активный ключ по хешу и отмечает его использование
+func (s *Server) authenticateAPIKey(r *http.Request, key string) (*AccessClaims, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, errInvalidAPIKey
+	}
+
+	apiKey, err := s.db.GetActiveAPIKeyByHash(hashToken(key))
+	if err != nil {
+		return nil, errInvalidAPIKey
+	}
+
+	if err := s.db.TouchAPIKey(apiKey.ID, getClientIP(r), apiKeyTouchInterval); err != nil {
+		s.logger.Warning("Failed to record API key usage %d: %v", apiKey.ID, err)
+	}
+
+	return &AccessClaims{
+		UserID:   int(apiKey.UserID),
+		APIKeyID: apiKey.ID,
+		Scopes:   apiKey.ScopeList(),
+	}, nil
+}
+
+// setAuthHeaders передает данные аутентификации обработчикам через заголовки запроса
+func setAuthHeaders(r *http.Request, claims *AccessClaims) {
+	r.Header.Del("X-Session-ID")
+	r.Header.Del("X-API-Key-ID")
+	r.Header.Del("X-Auth-Scopes")
+	r.Header.Del("X-User-Role")
+
+	if claims == nil {
+		r.Header.Set("X-User-ID", "0")
+		return
+	}
+
+	r.Header.Set("X-User-ID", strconv.Itoa(claims.UserID))
+	if claims.SessionID != "" {
+		r.Header.Set("X-Session-ID", claims.SessionID)
+	}
+	if claims.APIKeyID != 0 {
+		r.Header.Set("X-API-Key-ID", strconv.FormatUint(uint64(claims.APIKeyID), 10))
+		r.Header.Set("X-Auth-Scopes", strings.Join(claims.Scopes, ","))
+	}
+}
+
+// hasScope проверяет права запроса. Запросы с токеном сессии имеют полный доступ
+func hasScope(r *http.Request, scope string) bool {
+	if r.Header.Get("X-API-Key-ID") == "" {
+		return true
+	}
+	return slices.Contains(strings.Split(r.Header.Get("X-Auth-Scopes"), ","), scope)
+}
+
+// requireScope отвечает 403, если у API ключа нет нужного права
+func (s *Server) requireScope(w http.ResponseWriter, r *http.Request, scope string) bool {
+	if hasScope(r, scope) {
+		return true
+	}
+	s.logger.Warning("API key %s lacks scope %s for %s", r.Header.Get("X-API-Key-ID"), scope, r.URL.Path)
+	s.sendError(w, errInsufficientScope.Error(), http.StatusForbidden)
+	return false
+}
+
+// scopeMiddleware пропускает запросы по API ключу только с указанным правом
+func (s *Server) scopeMiddleware(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.requireScope(w, r, scope) {
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requireSession отвечает 403 для запросов по API ключу
+func (s *Server) requireSession(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("X-API-Key-ID") == "" {
+		return true
+	}
+	s.sendError(w, errAPIKeyNotAllowed.Error(), http.StatusForbidden)
+	return false
+}
+
+// sessionOnlyMiddleware запрещает доступ по API ключам (управление ключами, профиль, выход)
+func (s *Server) sessionOnlyMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.requireSession(w, r) {
+			return
+		}
+		next(w, r)
+	}
+}
+
+// @Summary List or create API keys
+// @Description GET lists the user's API keys (secrets are never returned). POST creates a new key; the key itself is shown only once in the response
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateAPIKeyRequest false "New key name and scopes (POST only)"
+// @Success 200 {object} SuccessResponse{data=[]APIKey} "API keys list"
+// @Success 201 {object} SuccessResponse{data=CreateAPIKeyResponse} "Created API key"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/user/api-keys [get]
+// @Router /api/user/api-keys [post]
+func (s *Server) handleAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.Header.Get("X-User-ID"))
+	if err != nil {
+		s.sendError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		keys, err := s.db.GetUserAPIKeys(uint(userID))
+		if err != nil {
+			s.logger.Error("Failed to get API keys for user %d: %v", userID, err)
+			s.sendError(w, "Failed to get API keys", http.StatusInternalServerError)
+			return
+		}
+
+		s.sendJSON(w, SuccessResponse{
+			Message: "API keys retrieved successfully",
+			Data:    keys,
+		})
+	case http.MethodPost:
+		s.handleCreateAPIKey(w, r, uint(userID))
+	default:
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Создание API ключа
+func (s *Server) handleCreateAPIKey(w http.ResponseWriter, r *http.Request, userID uint) {
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if validationErrors := s.validator.ValidateAPIKeyRequest(req); len(validationErrors) > 0 {
+		s.sendValidationErrors(w, validationErrors)
+		return
+	}
+
+	count, err := s.db.CountActiveAPIKeys(userID)
+	if err != nil {
+		s.logger.Error("Failed to count API keys for user %d: %v", userID, err)
+		s.sendError(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+	if count >= maxAPIKeysPerUser {
+		s.sendError(w, "API key limit reached, revoke an existing key first", http.StatusConflict)
+		return
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		s.logger.Error("Failed to generate API key: %v", err)
+		s.sendError(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+
+	apiKey := &APIKey{
+		UserID:  userID,
+		Name:    strings.TrimSpace(req.Name),
+		Prefix:  key[:len(apiKeyPrefix)+8],
+		KeyHash: hashToken(key),
+		Scopes:  strings.Join(normalizeScopes(req.Scopes), ","),
+	}
+
+	if err := s.db.CreateAPIKey(apiKey); err != nil {
+		s.logger.Error("Failed to create API key for user %d: %v", userID, err)
+		s.sendError(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+
+	s.logger.Info("API key %d (%s) created for user %d with scopes %s", apiKey.ID, apiKey.Name, userID, apiKey.Scopes)
+
+	s.sendJSONStatus(w, SuccessResponse{
+		Message: "API key created. Store it now, it will not be shown again",
+		Data: CreateAPIKeyResponse{
+			APIKey: *apiKey,
+			Key:    key,
+		},
+	}, http.StatusCreated)
+}
+
+// @Summary Revoke API key
+// @Description Revoke an API key. Requests using it are rejected immediately
+// @Tags api-keys
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "API key ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/user/api-keys/{id} [delete]
+func (s *Server) handleAPIKeyActions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := strconv.Atoi(r.Header.Get("X-User-ID"))
+	if err != nil {
+		s.sendError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	keyID, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/api/user/api-keys/"), 10, 64)
+	if err != nil {
+		s.sendError(w, "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	revoked, err := s.db.RevokeAPIKey(uint(keyID), uint(userID))
+	if err != nil {
+		s.logger.Error("Failed to revoke API key %d for user %d: %v", keyID, userID, err)
+		s.sendError(w, "Failed to revoke API key", http.StatusInternalServerError)
+		return
+	}
+	if !revoked {
+		s.sendError(w, "API key not found", http.StatusNotFound)
+		return
+	}
+
+	s.logger.Info("API key %d revoked by user %d", keyID, userID)
+	s.sendJSON(w, SuccessResponse{Message: "API key revoked"})
+}
+
+// normalizeScopes приводит список прав к нижнему регистру и убирает дубликаты
+func normalizeScopes(scopes []string) []string {
+	var result []string
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if scope != "" && !slices.Contains(result, scope) {
+			result = append(result, scope)
+		}
+	}
+	return result
+}
@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// Уровни важности событий аудита. События уровня alert требуют внимания администратора
+const (
+	AuditInfo    = "info"
+	AuditWarning = "warning"
+	AuditAlert   = "alert"
+)
+
+var auditSeverities = []string{AuditInfo, AuditWarning, AuditAlert}
+
+// События аудита
+const (
+	AuditLoginLockout = "login.lockout"
+	AuditLoginUnlock  = "login.unlock"
+
+	AuditAccountDeletion = "account.deletion"
+	AuditAccountExport   = "account.export"
+
+	AuditFileQuarantined = "file.quarantined"
+)
+
+// audit записывает событие в журнал аудита. Ошибка записи не прерывает обработку запроса
+func (s *Server) audit(event AuditEvent) {
+	if event.Severity == "" {
+		event.Severity = AuditInfo
+	}
+
+	if event.Severity == AuditAlert {
+		s.logger.Warning("AUDIT ALERT %s: %s", event.Action, event.Message)
+	} else {
+		s.logger.Info("Audit %s: %s", event.Action, event.Message)
+	}
+
+	if err := s.db.CreateAuditEvent(&event); err != nil {
+		s.logger.Error("Failed to write audit event %s: %v", event.Action, err)
+	}
+}
+
+// @Summary Audit log
+// @Description Security events (lockouts, unlocks and other alerts), newest first. Available to admins and auditors
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param action query string false "Event type, e.g. login.lockout"
+// @Param severity query string false "Severity filter" Enums(info, warning, alert)
+// @Param user_id query int false "Events initiated by or affecting this user"
+// @Param limit query int false "Page size" default(50) maximum(200)
+// @Param offset query int false "Page offset" default(0)
+// @Success 200 {object} SuccessResponse{data=AuditEventList}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /api/admin/audit [get]
+func (s *Server) handleAdminAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := AuditFilter{
+		Action:   query.Get("action"),
+		Severity: query.Get("severity"),
+		Limit:    adminUsersDefaultLimit,
+	}
+
+	if filter.Severity != "" && !slices.Contains(auditSeverities, filter.Severity) {
+		s.sendError(w, "Invalid severity", http.StatusBadRequest)
+		return
+	}
+
+	if value := query.Get("user_id"); value != "" {
+		userID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			s.sendError(w, "Invalid user_id value", http.StatusBadRequest)
+			return
+		}
+		filter.UserID = uint(userID)
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > adminUsersMaxLimit {
+			s.sendError(w, "Invalid limit value", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			s.sendError(w, "Invalid offset value", http.StatusBadRequest)
+			return
+		}
+		filter.Offset = offset
+	}
+
+	events, total, err := s.db.SearchAuditEvents(filter)
+	if err != nil {
+		s.logger.Error("Failed to search audit log: %v", err)
+		s.sendError(w, "Failed to get audit log", http.StatusInternalServerError)
+		return
+	}
+
+	s.sendJSON(w, SuccessResponse{
+		Message: "Audit log retrieved successfully",
+		Data: AuditEventList{
+			Events: events,
+			Total:  total,
+			Limit:  filter.Limit,
+			Offset: filter.Offset,
+		},
+	})
+}
@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Blob открытый для чтения файл из хранилища
+type Blob interface {
+	io.ReadSeekCloser
+	Size() int64
+	ModTime() time.Time
+}
+
+// BlobStore хранилище файлов. Обработчики читают файлы только через него,
+// чтобы хранилище можно было вынести с локального диска
+type BlobStore interface {
+	Open(name string) (Blob, error)
+}
+
+// LocalBlobStore хранилище файлов в локальной директории
+type LocalBlobStore struct {
+	root string
+}
+
+// NewLocalBlobStore создает хранилище в указанной директории
+func NewLocalBlobStore(root string) *LocalBlobStore {
+	return &LocalBlobStore{root: root}
+}
+
+// Open открывает файл по имени. Ошибка для отсутствующего файла удовлетворяет os.IsNotExist
+func (s *LocalBlobStore) Open(name string) (Blob, error) {
+	f, err := os.Open(filepath.Join(s.root, filepath.Base(name)))
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &localBlob{File: f, info: info}, nil
+}
+
+// localBlob файл на локальном диске
+type localBlob struct {
+	*os.File
+	info os.FileInfo
+}
+
+func (b *localBlob) Size() int64 {
+	return b.info.Size()
+}
+
+func (b *localBlob) ModTime() time.Time {
+	return b.info.ModTime()
+}
+
+// hashContent вычисляет SHA-256 содержимого в hex
+func hashContent(r io.Reader) (string, error) {
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// hashBlob вычисляет SHA-256 файла из хранилища
+func hashBlob(store BlobStore, name string) (string, error) {
+	blob, err := store.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer blob.Close()
+
+	return hashContent(blob)
+}
@@ -0,0 +1,354 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"obscura.app/pkg/logger"
+)
+
+// Источники каталога
+const (
+	CatalogSourceMLService = "ml_service"
+	CatalogSourceStatic    = "static"
+)
+
+// CatalogEntry тип объекта или размытия с подписью для интерфейса
+// @Description Supported value with a localized (Russian) label
+type CatalogEntry struct {
+	ID    string `json:"id" example:"face"`
+	Label string `json:"label" example:"Лицо"`
+}
+
+// Capabilities типы объектов и размытия, которые сейчас поддерживает обработка
+// @Description Object types and blur types accepted in processing options. Source is ml_service when the list was fetched from the ML service and static when the built-in fallback is used
+type Capabilities struct {
+	ObjectTypes   []CatalogEntry `json:"object_types"`
+	BlurTypes     []CatalogEntry `json:"blur_types"`
+	OutputFormats []string       `json:"output_formats" example:"original,jpeg"`
+	Presets       []ObjectPreset `json:"presets,omitempty"` // встроенные наборы объектов
+	Source        string         `json:"source" example:"ml_service" enums:"ml_service,static"`
+	UpdatedAt     time.Time      `json:"updated_at" example:"2025-01-15T09:00:00Z"`
+}
+
+// Встроенный каталог: классы COCO моделей по умолчанию и лица
+var defaultObjectTypes = []CatalogEntry{
+	{ID: "face", Label: "Лицо"},
+	{ID: "person", Label: "Человек"},
+	{ID: "bicycle", Label: "Велосипед"},
+	{ID: "car", Label: "Автомобиль"},
+	{ID: "motorcycle", Label: "Мотоцикл"},
+	{ID: "airplane", Label: "Самолет"},
+	{ID: "bus", Label: "Автобус"},
+	{ID: "train", Label: "Поезд"},
+	{ID: "truck", Label: "Грузовик"},
+	{ID: "boat", Label: "Лодка"},
+	{ID: "traffic light", Label: "Светофор"},
+	{ID: "fire hydrant", Label: "Пожарный гидрант"},
+	{ID: "stop sign", Label: "Знак стоп"},
+	{ID: "parking meter", Label: "Парковочный счетчик"},
+	{ID: "bench", Label: "Скамейка"},
+	{ID: "bird", Label: "Птица"},
+	{ID: "cat", Label: "Кот"},
+	{ID: "dog", Label: "Собака"},
+	{ID: "horse", Label: "Лошадь"},
+	{ID: "sheep", Label: "Овца"},
+	{ID: "cow", Label: "Корова"},
+	{ID: "elephant", Label: "Слон"},
+	{ID: "bear", Label: "Медведь"},
+	{ID: "zebra", Label: "Зебра"},
+	{ID: "giraffe", Label: "Жираф"},
+	{ID: "backpack", Label: "Рюкзак"},
+	{ID: "umbrella", Label: "Зонт"},
+	{ID: "handbag", Label: "Сумка"},
+	{ID: "tie", Label: "Галстук"},
+	{ID: "suitcase", Label: "Чемодан"},
+	{ID: "frisbee", Label: "Фрисби"},
+	{ID: "skis", Label: "Лыжи"},
+	{ID: "snowboard", Label: "Сноуборд"},
+	{ID: "sports ball", Label: "Спортивный мяч"},
+	{ID: "kite", Label: "Воздушный змей"},
+	{ID: "baseball bat", Label: "Бейсбольная бита"},
+	{ID: "baseball glove", Label: "Бейсбольная перчатка"},
+	{ID: "skateboard", Label: "Скейтборд"},
+	{ID: "surfboard", Label: "Доска для серфинга"},
+	{ID: "tennis racket", Label: "Теннисная ракетка"},
+	{ID: "bottle", Label: "Бутылка"},
+	{ID: "wine glass", Label: "Бокал для вина"},
+	{ID: "cup", Label: "Чашка"},
+	{ID: "fork", Label: "Вилка"},
+	{ID: "knife", Label: "Нож"},
+	{ID: "spoon", Label: "Ложка"},
+	{ID: "bowl", Label: "Миска"},
+	{ID: "banana", Label: "Банан"},
+	{ID: "apple", Label: "Яблоко"},
+	{ID: "sandwich", Label: "Бутерброд"},
+	{ID: "orange", Label: "Апельсин"},
+	{ID: "broccoli", Label: "Брокколи"},
+	{ID: "carrot", Label: "Морковь"},
+	{ID: "hot dog", Label: "Хот-дог"},
+	{ID: "pizza", Label: "Пицца"},
+	{ID: "donut", Label: "Пончик"},
+	{ID: "cake", Label: "Торт"},
+	{ID: "chair", Label: "Стул"},
+	{ID: "couch", Label: "Диван"},
+	{ID: "potted plant", Label: "Горшечное растение"},
+	{ID: "bed", Label: "Кровать"},
+	{ID: "dining table", Label: "Обеденный стол"},
+	{ID: "toilet", Label: "Туалет"},
+	{ID: "tv", Label: "Телевизор"},
+	{ID: "laptop", Label: "Ноутбук"},
+	{ID: "mouse", Label: "Мышь"},
+	{ID: "remote", Label: "Пульт"},
+	{ID: "keyboard", Label: "Клавиатура"},
+	{ID: "cell phone", Label: "Мобильный телефон"},
+	{ID: "microwave", Label: "Микроволновка"},
+	{ID: "oven", Label: "Духовка"},
+	{ID: "toaster", Label: "Тостер"},
+	{ID: "sink", Label: "Раковина"},
+	{ID: "refrigerator", Label: "Холодильник"},
+	{ID: "book", Label: "Книга"},
+	{ID: "clock", Label: "Часы"},
+	{ID: "vase", Label: "Ваза"},
+	{ID: "scissors", Label: "Ножницы"},
+	{ID: "teddy bear", Label: "Плюшевый мишка"},
+}
+
+var defaultBlurTypes = []CatalogEntry{
+	{ID: "gaussian", Label: "Размытие по Гауссу"},
+	{ID: "motion", Label: "Размытие в движении"},
+	{ID: "pixelate", Label: "Пикселизация"},
+}
+
+// capabilitiesResponse ответ ML сервиса на GET /api/capabilities
+type capabilitiesResponse struct {
+	ObjectTypes []string `json:"object_types"`
+	BlurTypes   []string `json:"blur_types"`
+}
+
+// ObjectCatalog каталог типов объектов и размытия. Загружается из ML сервиса при запуске
+// и периодически обновляется, пока сервис недоступен - используется встроенный список.
+// Последний полученный от сервиса список сохраняется при временных ошибках
+type ObjectCatalog struct {
+	mu       sync.RWMutex
+	current  Capabilities
+	mlURL    string // пусто - ML сервис отключен, всегда встроенный список
+	client   *http.Client
+	interval time.Duration
+	logger   *logger.Logger
+	stopChan chan struct{}
+}
+
+// NewObjectCatalog создает каталог со встроенным списком
+func NewObjectCatalog(config *Config, logger *logger.Logger) *ObjectCatalog {
+	catalog := &ObjectCatalog{
+		current:  staticCapabilities(),
+		client:   &http.Client{Timeout: 10 * time.Second},
+		interval: time.Duration(config.CapabilitiesRefreshMinutes) * time.Minute,
+		logger:   logger,
+		stopChan: make(chan struct{}),
+	}
+	if config.MLServiceEnabled {
+		catalog.mlURL = strings.TrimRight(config.MLServiceURL, "/") + "/api/capabilities"
+	}
+	return catalog
+}
+
+// staticCapabilities возвращает встроенный каталог
+func staticCapabilities() Capabilities {
+	return Capabilities{
+		ObjectTypes:   defaultObjectTypes,
+		BlurTypes:     defaultBlurTypes,
+		OutputFormats: []string{OutputFormatOriginal, OutputFormatJPEG},
+		Source:        CatalogSourceStatic,
+		UpdatedAt:     time.Now(),
+	}
+}
+
+// Start загружает каталог из ML сервиса и запускает периодическое обновление
+func (c *ObjectCatalog) Start() {
+	if c.mlURL == "" {
+		c.logger.Info("ML service is disabled, using built-in object catalog")
+		return
+	}
+
+	go func() {
+		c.refreshOnce()
+		if c.interval <= 0 {
+			return
+		}
+
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.refreshOnce()
+			case <-c.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop останавливает обновление каталога
+func (c *ObjectCatalog) Stop() {
+	close(c.stopChan)
+}
+
+// refreshOnce обновляет каталог, ошибки только записываются в лог
+func (c *ObjectCatalog) refreshOnce() {
+	if _, err := c.Refresh(context.Background()); err != nil {
+		c.logger.Warning("Failed to refresh object catalog, keeping %s list: %v", c.Get().Source, err)
+	}
+}
+
+// Refresh загружает каталог из ML сервиса. При ошибке текущий каталог не меняется
+func (c *ObjectCatalog) Refresh(ctx context.Context) (Capabilities, error) {
+	if c.mlURL == "" {
+		return c.Get(), errors.New("ML service is disabled")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.mlURL, nil)
+	if err != nil {
+		return c.Get(), err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return c.Get(), err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return c.Get(), fmt.Errorf("ML service returned status %d", resp.StatusCode)
+	}
+
+	var payload capabilitiesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return c.Get(), fmt.Errorf("invalid capabilities response: %w", err)
+	}
+	if len(payload.ObjectTypes) == 0 || len(payload.BlurTypes) == 0 {
+		return c.Get(), errors.New("ML service reported no object or blur types")
+	}
+
+	caps := Capabilities{
+		ObjectTypes:   labelEntries(payload.ObjectTypes, defaultObjectTypes),
+		BlurTypes:     labelEntries(payload.BlurTypes, defaultBlurTypes),
+		OutputFormats: []string{OutputFormatOriginal, OutputFormatJPEG},
+		Source:        CatalogSourceMLService,
+		UpdatedAt:     time.Now(),
+	}
+
+	c.mu.Lock()
+	c.current = caps
+	c.mu.Unlock()
+
+	c.logger.Info("Object catalog refreshed from ML service: %d object types, %d blur types", len(caps.ObjectTypes), len(caps.BlurTypes))
+	return caps, nil
+}
+
+// labelEntries подписывает значения из ML сервиса по встроенному каталогу.
+// Неизвестные значения подписываются своим идентификатором
+func labelEntries(ids []string, known []CatalogEntry) []CatalogEntry {
+	entries := make([]CatalogEntry, 0, len(ids))
+	for _, id := range ids {
+		id = strings.ToLower(strings.TrimSpace(id))
+		if id == "" || slices.ContainsFunc(entries, func(entry CatalogEntry) bool { return entry.ID == id }) {
+			continue
+		}
+
+		entry := CatalogEntry{ID: id, Label: id}
+		if i := slices.IndexFunc(known, func(k CatalogEntry) bool { return k.ID == id }); i >= 0 {
+			entry.Label = known[i].Label
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Get возвращает текущий каталог
+func (c *ObjectCatalog) Get() Capabilities {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.current
+}
+
+// HasObjectType проверяет, что тип объекта есть в каталоге
+func (c *ObjectCatalog) HasObjectType(id string) bool {
+	return slices.ContainsFunc(c.Get().ObjectTypes, func(entry CatalogEntry) bool { return entry.ID == id })
+}
+
+// HasBlurType проверяет, что тип размытия есть в каталоге
+func (c *ObjectCatalog) HasBlurType(id string) bool {
+	return slices.ContainsFunc(c.Get().BlurTypes, func(entry CatalogEntry) bool { return entry.ID == id })
+}
+
+// BlurTypeIDs возвращает идентификаторы типов размытия для сообщений об ошибках
+func (c *ObjectCatalog) BlurTypeIDs() []string {
+	blurTypes := c.Get().BlurTypes
+	ids := make([]string, len(blurTypes))
+	for i, entry := range blurTypes {
+		ids[i] = entry.ID
+	}
+	return ids
+}
+
+// @Summary Processing capabilities
+// @Description Object types and blur types accepted in processing options, with localized labels, and built-in object presets. The list follows the models loaded by the ML service and falls back to the built-in catalog when the service is unavailable
+// @Tags files
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=Capabilities}
+// @Router /api/capabilities [get]
+func (s *Server) handleCapabilities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	caps := s.catalog.Get()
+	caps.Presets = availableBuiltinPresets(s.catalog)
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	s.sendJSON(w, SuccessResponse{
+		Message: "Capabilities retrieved",
+		Data:    caps,
+	})
+}
+
+// @Summary Refresh processing capabilities
+// @Description Reload object types and blur types from the ML service. On failure the current catalog is kept and 502 is returned. Available to admins only
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} SuccessResponse{data=Capabilities}
+// @Failure 403 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /api/admin/capabilities/refresh [post]
+func (s *Server) handleAdminRefreshCapabilities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.requireRole(w, r, RoleAdmin) {
+		return
+	}
+
+	caps, err := s.catalog.Refresh(r.Context())
+	if err != nil {
+		s.logger.Warning("Admin capabilities refresh failed: %v", err)
+		s.sendError(w, "Failed to refresh capabilities: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	s.sendJSON(w, SuccessResponse{
+		Message: "Capabilities refreshed",
+		Data:    caps,
+	})
+}
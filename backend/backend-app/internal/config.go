@@ -1,17 +1,97 @@
 package internal
 
 import (
+	"errors"
 	"os"
 	"strconv"
+	"strings"
 )
 
+// defaultJWTSecret секрет по умолчанию, допустимый только в режиме разработки
+const defaultJWTSecret = "your-secret-key-change-in-production"
+
 type Config struct {
-	Port               string
-	UploadPath         string
-	MaxFileSize        int64
-	JWTSecret          string
-	MaxAttemptsHandled int
-	HandlerTimeout     int
+	Environment       string // development или production
+	Port              string
+	UploadPath        string
+	QuarantinePath    string
+	MaxFileSize       int64
+	JWTSecret         string
+	HandlerTimeout    int // окно бюджета анонимных пользователей, часов
+	FileRetentionDays int // Срок хранения файлов пользователей, 0 - бессрочно
+
+	// Ограничения содержимого загружаемых файлов по заголовкам (0 - без ограничения)
+	MediaMaxWidth        int
+	MediaMaxHeight       int
+	MediaMaxMegapixels   int
+	MediaMaxVideoSeconds int
+
+	// Хранилище счетчиков rate limiter'а: memory (одна реплика), redis или postgres
+	RateLimitStore string
+	RedisURL       string
+	// Политики ограничения частоты запросов по маршрутам: "алгоритм:лимит/окно" или "off"
+	RateLimits map[string]string
+	// Подсети доверенных прокси (CIDR): только от них принимаются Forwarded и X-Forwarded-For
+	TrustedProxies []string
+
+	// Стоимость обработки файла: единиц за мегабайт и за мегапиксель каждого кадра.
+	// Число кадров видео оценивается по длительности и CostVideoFPS
+	CostPerMegabyte       float64
+	CostPerMegapixelFrame float64
+	CostVideoFPS          float64
+	// Бюджеты обработки в единицах стоимости за окно (0 - без ограничений)
+	CostBudgetAnonymous   int
+	CostBudgetFree        int
+	CostBudgetPro         int
+	CostBudgetWindowHours int
+
+	// Квоты тарифных планов (0 - без ограничений)
+	FreeMaxStorageBytes  int64
+	FreeMaxFilesPerMonth int
+	FreeMaxVideoSeconds  int
+	ProMaxStorageBytes   int64
+	ProMaxFilesPerMonth  int
+	ProMaxVideoSeconds   int
+
+	// Токены
+	RefreshTokenTTLDays int
+	// Подпись access токенов: HS256 с JWTSecret или RS256/EdDSA с ключом из файла
+	JWTAlgorithm        string
+	JWTPrivateKeyFile   string
+	JWTKeyID            string   // kid текущего ключа, по умолчанию отпечаток ключа (RFC 7638)
+	JWTVerificationKeys []string // предыдущие открытые ключи: "путь" или "kid=путь"
+	JWTIssuer           string
+	JWTAudience         string
+
+	// Администрирование: email'ы, которые получают роль admin при запуске и регистрации
+	AdminEmails []string
+	// Обязательная 2FA для всех пользователей, пока администратор не изменит настройку через API
+	Require2FA bool
+
+	// Защита входа от перебора паролей
+	LoginFreeAttempts         int // неудачные попытки без задержки
+	LoginMaxAccountFailures   int
+	LoginMaxIPFailures        int
+	LoginLockoutMinutes       int
+	LoginFailureWindowMinutes int
+
+	// Провайдеры единого входа OpenID Connect
+	OIDCProviders []OIDCProviderConfig
+
+	// Почта: драйвер smtp, file (письма сохраняются в MailDir) или log
+	MailDriver   string
+	MailFrom     string
+	MailDir      string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	// Адрес веб-приложения для ссылок в письмах
+	PublicURL string
+	// Подтверждение email и сброс пароля
+	EmailVerificationTTLHours int
+	PasswordResetTTLMinutes   int
+	RequireEmailVerification  bool // вход запрещен до подтверждения email
 
 	// База данных
 	DBHost     string
@@ -24,16 +104,112 @@ type Config struct {
 	MLServiceURL     string
 	MLServiceTimeout int // в секундах
 	MLServiceEnabled bool
+
+	// Период обновления каталога типов объектов из ML сервиса, 0 - только при запуске
+	CapabilitiesRefreshMinutes int
+
+	// Конвертация HEIC/HEIF и AVIF внешней программой: шаблон команды с {input} и {output}.
+	// Пусто - такие файлы не принимаются
+	ImageConvertCommand string
+	ImageConvertTimeout int // в секундах
+
+	// Формат миниатюр и превью: webp (через конвертер изображений, без него - JPEG) или jpeg
+	RenditionFormat string
+
+	// Проверка загрузок на вредоносное содержимое
+	ScannerDriver  string // none или clamav
+	ClamAVAddress  string // адрес clamd, host:port
+	ScanTimeout    int    // в секундах
+	ScanFailClosed bool   // отклонять загрузки, если сканер недоступен
+}
+
+// OIDCProviderConfig настройки провайдера OpenID Connect.
+// Задаются переменными OIDC_<NAME>_*, где NAME - имя из списка OIDC_PROVIDERS
+type OIDCProviderConfig struct {
+	Name         string
+	DisplayName  string
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string // адрес /api/auth/oidc/<name>/callback, зарегистрированный у провайдера
+	Scopes       []string
+	// Считать email подтвержденным, даже если провайдер не передает email_verified
+	TrustEmail bool
+	// Значения amr или acr, подтверждающие вход провайдера со вторым фактором.
+	// Если заданы, ID токен без них отклоняется, а локальная 2FA не запрашивается
+	RequiredMFA []string
+	// Куда перенаправить браузер после входа (токены передаются во фрагменте URL).
+	// Пусто - callback отвечает JSON
+	PostLoginRedirect string
 }
 
 func NewConfig() *Config {
 	return &Config{
-		Port:               getEnv("PORT", "8080"),
-		UploadPath:         getEnv("UPLOAD_PATH", "./uploads"),
-		MaxFileSize:        getEnvAsInt64("MAX_FILE_SIZE", 52428800), // 50MB
-		JWTSecret:          getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
-		MaxAttemptsHandled: getEnvAsInt("MAX_ATTEMPTS_HANDLED", 3),
-		HandlerTimeout:     getEnvAsInt("HANDLER_TIMEOUT", 24),
+		Environment:       getEnv("APP_ENV", "production"),
+		Port:              getEnv("PORT", "8080"),
+		UploadPath:        getEnv("UPLOAD_PATH", "./uploads"),
+		QuarantinePath:    getEnv("QUARANTINE_PATH", "./quarantine"),
+		MaxFileSize:       getEnvAsInt64("MAX_FILE_SIZE", 52428800), // 50MB
+		JWTSecret:         getEnv("JWT_SECRET", defaultJWTSecret),
+		HandlerTimeout:    getEnvAsInt("HANDLER_TIMEOUT", 24),
+		FileRetentionDays: getEnvAsInt("FILE_RETENTION_DAYS", 0),
+
+		MediaMaxWidth:        getEnvAsInt("MEDIA_MAX_WIDTH", 16384),
+		MediaMaxHeight:       getEnvAsInt("MEDIA_MAX_HEIGHT", 16384),
+		MediaMaxMegapixels:   getEnvAsInt("MEDIA_MAX_MEGAPIXELS", 100),
+		MediaMaxVideoSeconds: getEnvAsInt("MEDIA_MAX_VIDEO_SECONDS", 7200), // 2 часа
+
+		RateLimitStore: getEnv("RATE_LIMIT_STORE", LimiterStoreMemory),
+		RedisURL:       getEnv("REDIS_URL", "redis://localhost:6379/0"),
+		RateLimits:     loadRateLimits(),
+		TrustedProxies: getEnvAsList("TRUSTED_PROXIES"),
+
+		CostPerMegabyte:       getEnvAsFloat("COST_PER_MEGABYTE", 1),
+		CostPerMegapixelFrame: getEnvAsFloat("COST_PER_MEGAPIXEL_FRAME", 0.1),
+		CostVideoFPS:          getEnvAsFloat("COST_VIDEO_FPS", 30),
+		CostBudgetAnonymous:   getEnvAsInt("COST_BUDGET_ANONYMOUS", 100),
+		CostBudgetFree:        getEnvAsInt("COST_BUDGET_FREE", 2000),
+		CostBudgetPro:         getEnvAsInt("COST_BUDGET_PRO", 20000),
+		CostBudgetWindowHours: getEnvAsInt("COST_BUDGET_WINDOW_HOURS", 24),
+
+		FreeMaxStorageBytes:  getEnvAsInt64("QUOTA_FREE_MAX_STORAGE_BYTES", 1073741824), // 1GB
+		FreeMaxFilesPerMonth: getEnvAsInt("QUOTA_FREE_MAX_FILES_PER_MONTH", 100),
+		FreeMaxVideoSeconds:  getEnvAsInt("QUOTA_FREE_MAX_VIDEO_SECONDS", 300),          // 5 минут
+		ProMaxStorageBytes:   getEnvAsInt64("QUOTA_PRO_MAX_STORAGE_BYTES", 21474836480), // 20GB
+		ProMaxFilesPerMonth:  getEnvAsInt("QUOTA_PRO_MAX_FILES_PER_MONTH", 2000),
+		ProMaxVideoSeconds:   getEnvAsInt("QUOTA_PRO_MAX_VIDEO_SECONDS", 3600), // 1 час
+
+		RefreshTokenTTLDays: getEnvAsInt("REFRESH_TOKEN_TTL_DAYS", 30),
+		JWTAlgorithm:        getEnv("JWT_ALGORITHM", JWTAlgorithmHS256),
+		JWTPrivateKeyFile:   getEnv("JWT_PRIVATE_KEY_FILE", ""),
+		JWTKeyID:            getEnv("JWT_KEY_ID", ""),
+		JWTVerificationKeys: getEnvAsList("JWT_VERIFICATION_KEYS"),
+		JWTIssuer:           getEnv("JWT_ISSUER", "obscura"),
+		JWTAudience:         getEnv("JWT_AUDIENCE", "obscura-api"),
+
+		AdminEmails: getEnvAsList("ADMIN_EMAILS"),
+		Require2FA:  getEnvAsBool("REQUIRE_2FA", false),
+
+		LoginFreeAttempts:         getEnvAsInt("LOGIN_FREE_ATTEMPTS", 3),
+		LoginMaxAccountFailures:   getEnvAsInt("LOGIN_MAX_ACCOUNT_FAILURES", 10),
+		LoginMaxIPFailures:        getEnvAsInt("LOGIN_MAX_IP_FAILURES", 50),
+		LoginLockoutMinutes:       getEnvAsInt("LOGIN_LOCKOUT_MINUTES", 15),
+		LoginFailureWindowMinutes: getEnvAsInt("LOGIN_FAILURE_WINDOW_MINUTES", 15),
+
+		OIDCProviders: loadOIDCProviders(),
+
+		MailDriver:   getEnv("MAIL_DRIVER", "log"),
+		MailFrom:     getEnv("MAIL_FROM", "Obscura <no-reply@obscura.app>"),
+		MailDir:      getEnv("MAIL_DIR", "./mail"),
+		SMTPHost:     getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:     getEnv("SMTP_PORT", "587"),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		PublicURL:    strings.TrimRight(getEnv("PUBLIC_URL", "http://localhost:3000"), "/"),
+
+		EmailVerificationTTLHours: getEnvAsInt("EMAIL_VERIFICATION_TTL_HOURS", 48),
+		PasswordResetTTLMinutes:   getEnvAsInt("PASSWORD_RESET_TTL_MINUTES", 30),
+		RequireEmailVerification:  getEnvAsBool("REQUIRE_EMAIL_VERIFICATION", false),
 
 		DBHost:     getEnv("DB_HOST", "localhost"),
 		DBPort:     getEnv("DB_PORT", "5432"),
@@ -44,7 +220,44 @@ func NewConfig() *Config {
 		MLServiceURL:     getEnv("ML_SERVICE_URL", "http://ml:5000"),
 		MLServiceTimeout: getEnvAsInt("ML_SERVICE_TIMEOUT", 300), // 5 минут
 		MLServiceEnabled: getEnvAsBool("ML_SERVICE_ENABLED", true),
+
+		CapabilitiesRefreshMinutes: getEnvAsInt("CAPABILITIES_REFRESH_MINUTES", 10),
+
+		ImageConvertCommand: getEnv("IMAGE_CONVERT_COMMAND", "magick {input} -quality 92 {output}"),
+		ImageConvertTimeout: getEnvAsInt("IMAGE_CONVERT_TIMEOUT", 60),
+
+		RenditionFormat: getEnv("RENDITION_FORMAT", RenditionFormatWebP),
+
+		ScannerDriver:  getEnv("SCANNER_DRIVER", ScannerNone),
+		ClamAVAddress:  getEnv("CLAMAV_ADDRESS", "clamav:3310"),
+		ScanTimeout:    getEnvAsInt("SCAN_TIMEOUT", 60),
+		ScanFailClosed: getEnvAsBool("SCAN_FAIL_CLOSED", true),
+	}
+}
+
+// IsDevelopment проверяет, запущен ли сервис в режиме разработки
+func (c *Config) IsDevelopment() bool {
+	return c.Environment == "development"
+}
+
+// Validate проверяет настройки, небезопасные для production
+func (c *Config) Validate() error {
+	if c.IsDevelopment() {
+		return nil
 	}
+	if c.JWTAlgorithm == JWTAlgorithmHS256 && (c.JWTSecret == "" || c.JWTSecret == defaultJWTSecret) {
+		return errors.New("JWT_SECRET must be changed from the default outside development mode (APP_ENV=development)")
+	}
+	return nil
+}
+
+// loadRateLimits читает политики маршрутов из переменных RATE_LIMIT_<МАРШРУТ>
+func loadRateLimits() map[string]string {
+	limits := make(map[string]string, len(defaultRateLimits))
+	for route, spec := range defaultRateLimits {
+		limits[route] = getEnv("RATE_LIMIT_"+strings.ToUpper(route), spec)
+	}
+	return limits
 }
 
 func getEnv(key, defaultValue string) string {
@@ -72,6 +285,15 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value, exists := os.LookupEnv(key); exists {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 func getEnvAsBool(key string, defaultValue bool) bool {
 	if value, exists := os.LookupEnv(key); exists {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
@@ -80,3 +302,41 @@ func getEnvAsBool(key string, defaultValue bool) bool {
 	}
 	return defaultValue
 }
+
+func getEnvAsList(key string) []string {
+	var result []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// loadOIDCProviders читает настройки провайдеров из OIDC_PROVIDERS и OIDC_<NAME>_*
+func loadOIDCProviders() []OIDCProviderConfig {
+	var providers []OIDCProviderConfig
+	for _, name := range getEnvAsList("OIDC_PROVIDERS") {
+		name = strings.ToLower(name)
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+
+		scopes := getEnvAsList(prefix + "SCOPES")
+		if len(scopes) == 0 {
+			scopes = []string{"openid", "email", "profile"}
+		}
+
+		providers = append(providers, OIDCProviderConfig{
+			Name:              name,
+			DisplayName:       getEnv(prefix+"DISPLAY_NAME", name),
+			IssuerURL:         strings.TrimRight(os.Getenv(prefix+"ISSUER"), "/"),
+			ClientID:          os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret:      os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:       os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:            scopes,
+			TrustEmail:        getEnvAsBool(prefix+"TRUST_EMAIL", false),
+			RequiredMFA:       getEnvAsList(prefix + "REQUIRED_MFA"),
+			PostLoginRedirect: os.Getenv(prefix + "POST_LOGIN_REDIRECT"),
+		})
+	}
+	return providers
+}
@@ -0,0 +1,301 @@
+package internal
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"obscura.app/pkg/logger"
+)
+
+// BudgetAnonymous бюджет анонимных пользователей (план без учетной записи)
+const BudgetAnonymous = "anonymous"
+
+// Оценки для файлов, размеры кадра которых не удалось прочитать из заголовков
+const (
+	fallbackImagePixels = 12_000_000  // фото современного смартфона
+	fallbackVideoPixels = 1920 * 1080 // Full HD
+	bytesPerMegabyte    = 1 << 20
+)
+
+// maxCostUnits предел стоимости файла. Он больше любого разумного бюджета, но его сумма
+// с расходом в хранилище лимитов не переполняет int
+const maxCostUnits = math.MaxInt32
+
+// errUnknownVideoDuration без длительности число кадров видео, а значит и стоимость, не оценить
+var errUnknownVideoDuration = ValidationError{
+	Field:   "file",
+	Message: "Video duration cannot be determined from its header, it is required to estimate the processing cost",
+	Code:    FileErrorDuration,
+}
+
+// CostModel модель стоимости обработки файла в условных единицах. Время ML обработки растет
+// с числом пикселей во всех кадрах, поэтому основная часть стоимости - мегапиксели × кадры,
+// к ней добавляется стоимость передачи и хранения байтов
+type CostModel struct {
+	PerMegabyte       float64
+	PerMegapixelFrame float64
+	VideoFPS          float64 // по ней оценивается число кадров видео
+}
+
+// FileCost стоимость обработки файла
+type FileCost struct {
+	Units      int
+	Bytes      int64
+	Megapixels float64
+	Frames     int64
+	Estimated  bool // размеры кадра заменены оценкой
+}
+
+// Cost вычисляет стоимость обработки файла. Стоимость любого файла не меньше 1 и не больше maxCostUnits.
+// Для видео без длительности возвращает errUnknownVideoDuration
+func (m CostModel) Cost(size int64, info MediaInfo, isVideo bool) (FileCost, error) {
+	cost := FileCost{Bytes: size, Frames: 1}
+
+	pixels := int64(info.Width) * int64(info.Height)
+	if pixels <= 0 {
+		cost.Estimated = true
+		pixels = fallbackImagePixels
+		if isVideo {
+			pixels = fallbackVideoPixels
+		}
+	}
+	cost.Megapixels = float64(pixels) / 1e6
+
+	if isVideo {
+		frames := math.Ceil(info.Duration.Seconds() * m.VideoFPS)
+		if info.Duration <= 0 || !(frames >= 1) {
+			return cost, errUnknownVideoDuration
+		}
+		cost.Frames = int64(min(frames, math.MaxInt64/2))
+	}
+
+	units := math.Ceil(float64(size)/bytesPerMegabyte*m.PerMegabyte + cost.Megapixels*float64(cost.Frames)*m.PerMegapixelFrame)
+	switch {
+	case math.IsNaN(units) || units > maxCostUnits:
+		cost.Units = maxCostUnits
+	default:
+		cost.Units = max(int(units), 1)
+	}
+	return cost, nil
+}
+
+// BudgetStatus бюджет обработки в текущем окне
+// @Description Processing budget in cost units (megapixel-frames and megabytes) for the current window. Limit 0 means unlimited
+type BudgetStatus struct {
+	Plan        string     `json:"plan" example:"free"`
+	Limit       int        `json:"limit" example:"2000"`
+	Used        int        `json:"used" example:"350"`
+	Remaining   int        `json:"remaining" example:"1650"`
+	WindowHours float64    `json:"window_hours" example:"24"`
+	ResetAt     *time.Time `json:"reset_at,omitempty" example:"2025-01-16T09:00:00Z"`
+}
+
+// BudgetLimiter списывает стоимость обработки файлов с бюджета пользователя, организации
+// или анонимного клиента. Состояние хранится в общем LimiterStore
+type BudgetLimiter struct {
+	store           LimiterStore
+	model           CostModel
+	budgets         map[string]int // план -> единиц за окно, 0 - без ограничения
+	window          time.Duration
+	anonymousWindow time.Duration
+	logger          *logger.Logger
+}
+
+// NewBudgetLimiter создает бюджеты по конфигурации
+func NewBudgetLimiter(store LimiterStore, config *Config, logger *logger.Logger) *BudgetLimiter {
+	return &BudgetLimiter{
+		store: store,
+		model: CostModel{
+			PerMegabyte:       config.CostPerMegabyte,
+			PerMegapixelFrame: config.CostPerMegapixelFrame,
+			VideoFPS:          config.CostVideoFPS,
+		},
+		budgets: map[string]int{
+			BudgetAnonymous: config.CostBudgetAnonymous,
+			PlanFree:        config.CostBudgetFree,
+			PlanPro:         config.CostBudgetPro,
+			PlanUnlimited:   0,
+		},
+		window:          time.Duration(config.CostBudgetWindowHours) * time.Hour,
+		anonymousWindow: time.Duration(config.HandlerTimeout) * time.Hour,
+		logger:          logger,
+	}
+}
+
+// limitFor возвращает бюджет и окно плана. Неизвестный план считается бесплатным, как и в квотах
+func (b *BudgetLimiter) limitFor(plan string) (string, int, time.Duration) {
+	if plan == BudgetAnonymous {
+		return plan, b.budgets[plan], b.anonymousWindow
+	}
+	if _, ok := b.budgets[plan]; !ok {
+		plan = PlanFree
+	}
+	return plan, b.budgets[plan], b.window
+}
+
+// Debit списывает стоимость с бюджета. Возвращает false, если бюджета не хватает
+func (b *BudgetLimiter) Debit(ctx context.Context, key, plan string, cost int) (BudgetStatus, bool, error) {
+	plan, limit, window := b.limitFor(plan)
+	status := BudgetStatus{Plan: plan, Limit: limit, WindowHours: window.Hours()}
+	if limit <= 0 {
+		return status, true, nil
+	}
+
+	// Файл дороже всего бюджета не пройдет ни в каком окне, в хранилище отправляется только запрос остатка
+	allowed := cost <= limit
+	if !allowed {
+		cost = 0
+	}
+
+	result, err := b.store.Consume(ctx, "budget:"+key, cost, limit, window)
+	if err != nil {
+		return status, true, err
+	}
+
+	status.Used = result.Count
+	status.Remaining = max(limit-result.Count, 0)
+	resetAt := time.Now().Add(result.Reset)
+	status.ResetAt = &resetAt
+	return status, allowed && result.Allowed, nil
+}
+
+// Refund возвращает списанную стоимость в бюджет
+func (b *BudgetLimiter) Refund(ctx context.Context, key, plan string, cost int) error {
+	_, limit, window := b.limitFor(plan)
+	if limit <= 0 || cost <= 0 {
+		return nil
+	}
+
+	_, err := b.store.Consume(ctx, "budget:"+key, -cost, limit, window)
+	return err
+}
+
+// Status возвращает остаток бюджета без списания
+func (b *BudgetLimiter) Status(ctx context.Context, key, plan string) (BudgetStatus, error) {
+	status, _, err := b.Debit(ctx, key, plan, 0)
+	return status, err
+}
+
+// GetStats возвращает настройки бюджетов и статистику хранилища
+func (b *BudgetLimiter) GetStats() map[string]interface{} {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	stats := b.store.Stats(ctx)
+	stats["budgets"] = b.budgets
+	stats["window_hours"] = b.window.Hours()
+	stats["anonymous_window_hours"] = b.anonymousWindow.Hours()
+	return stats
+}
+
+// anonymousBudgetKey ключ бюджета анонимного клиента по его IP адресу. User-Agent и другие
+// заголовки в ключ не входят: клиент меняет их произвольно и так обходил бы лимит
+func anonymousBudgetKey(r *http.Request) string {
+	hash := md5.Sum([]byte(getClientIP(r)))
+	return fmt.Sprintf("anon:%x", hash)
+}
+
+// budgetSubject возвращает ключ и план бюджета, с которого списывается обработка:
+// организации для файлов организации, иначе пользователя
+func budgetSubject(user *User, organization *Organization) (string, string) {
+	if organization != nil {
+		return fmt.Sprintf("org:%d", organization.ID), organization.Plan
+	}
+	return fmt.Sprintf("user:%d", user.ID), user.Plan
+}
+
+// chargeBudget списывает стоимость обработки файла и выставляет заголовки X-Budget-*.
+// При нехватке бюджета отвечает 429, а если файл дороже всего бюджета - 413
+func (s *Server) chargeBudget(w http.ResponseWriter, r *http.Request, key, plan string, cost FileCost) bool {
+	status, allowed, err := s.budgets.Debit(r.Context(), key, plan, cost.Units)
+	if err != nil {
+		// Отказ хранилища не должен останавливать сервис
+		s.logger.Error("Budget store failed for %s, upload allowed: %v", key, err)
+		return true
+	}
+
+	w.Header().Set("X-Budget-Cost", strconv.Itoa(cost.Units))
+	if status.Limit > 0 {
+		w.Header().Set("X-Budget-Limit", strconv.Itoa(status.Limit))
+		w.Header().Set("X-Budget-Remaining", strconv.Itoa(status.Remaining))
+		w.Header().Set("X-Budget-Reset", strconv.FormatInt(status.ResetAt.Unix(), 10))
+	}
+
+	if allowed {
+		s.logger.Debug("Charged %d units (%.1f MP x %d frames, %d bytes, estimated: %v) to %s, %d left",
+			cost.Units, cost.Megapixels, cost.Frames, cost.Bytes, cost.Estimated, key, status.Remaining)
+		return true
+	}
+
+	s.sendQuotaError(w, &QuotaViolation{
+		Quota:     QuotaCostBudget,
+		Limit:     int64(status.Limit),
+		Used:      int64(status.Used),
+		Requested: int64(cost.Units),
+		ResetAt:   status.ResetAt,
+	})
+	return false
+}
+
+// refundBudget возвращает стоимость загрузки, которая не дошла до обработки. Запрос к этому
+// моменту может быть уже отменен клиентом, поэтому его отмена на возврат не влияет
+func (s *Server) refundBudget(r *http.Request, key, plan string, cost FileCost) {
+	if err := s.budgets.Refund(context.WithoutCancel(r.Context()), key, plan, cost.Units); err != nil {
+		s.logger.Warning("Failed to refund %d budget units to %s: %v", cost.Units, key, err)
+		return
+	}
+	s.logger.Debug("Refunded %d budget units to %s", cost.Units, key)
+}
+
+// chargeStoredFile списывает стоимость повторной обработки сохраненного файла: с бюджета
+// организации, если файл лежит в ее библиотеке, иначе с бюджета пользователя
+func (s *Server) chargeStoredFile(w http.ResponseWriter, r *http.Request, file *File, userID int) bool {
+	blob, err := s.blobs.Open(file.FileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.logger.Error("File not found on disk: %s", file.FileName)
+			s.sendError(w, "File not found on disk", http.StatusNotFound)
+		} else {
+			s.logger.Error("Failed to open file %s: %v", file.FileName, err)
+			s.sendError(w, "Failed to read file", http.StatusInternalServerError)
+		}
+		return false
+	}
+	defer blob.Close()
+
+	// Файл уже проверен при загрузке, при ошибке чтения заголовков размеры кадра оцениваются
+	info, _ := probeMedia(blob)
+	cost, err := s.budgets.model.Cost(blob.Size(), info, strings.HasPrefix(file.MimeType, "video/"))
+	if err != nil {
+		s.logger.Warning("Cannot estimate reprocessing cost of file %s: %v", file.ID, err)
+		s.sendValidationErrors(w, []ValidationError{err.(ValidationError)})
+		return false
+	}
+
+	user, err := s.db.GetUserByID(uint(userID))
+	if err != nil {
+		s.logger.Error("Failed to get user %d for budget check: %v", userID, err)
+		s.sendError(w, "User not found", http.StatusUnauthorized)
+		return false
+	}
+
+	var organization *Organization
+	if file.OrganizationID != nil {
+		organization, err = s.db.GetOrganizationByID(*file.OrganizationID)
+		if err != nil {
+			s.logger.Error("Failed to get organization %d for budget check: %v", *file.OrganizationID, err)
+			s.sendError(w, "Failed to check budget", http.StatusInternalServerError)
+			return false
+		}
+	}
+
+	key, plan := budgetSubject(user, organization)
+	return s.chargeBudget(w, r, key, plan, cost)
+}
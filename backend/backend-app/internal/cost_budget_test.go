@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCostModel(t *testing.T) {
+	model := CostModel{PerMegabyte: 1, PerMegapixelFrame: 0.1, VideoFPS: 30}
+	fullHD := MediaInfo{Format: FormatMP4, Width: 1920, Height: 1080}
+
+	tests := []struct {
+		name    string
+		model   CostModel
+		size    int64
+		info    MediaInfo
+		units   int
+		wantErr error
+	}{
+		{name: "photo", model: model, size: 4 << 20, info: MediaInfo{Format: FormatJPEG, Width: 4000, Height: 3000}, units: 6},
+		{name: "minute of full hd", model: model, size: 60 << 20, info: MediaInfo{Format: FormatMP4, Width: 1920, Height: 1080, Duration: time.Minute}, units: 434},
+		{name: "video without duration", model: model, size: 60 << 20, info: fullHD, wantErr: errUnknownVideoDuration},
+		{name: "video with negative duration", model: model, size: 60 << 20, info: MediaInfo{Format: FormatMP4, Duration: -time.Second}, wantErr: errUnknownVideoDuration},
+		{name: "no frames", model: CostModel{PerMegapixelFrame: 0.1}, size: 1 << 20, info: MediaInfo{Format: FormatMP4, Duration: time.Minute}, wantErr: errUnknownVideoDuration},
+		{name: "huge frame saturates", model: model, size: 1 << 20, info: MediaInfo{Format: FormatMP4, Width: math.MaxInt32, Height: math.MaxInt32, Duration: maxMediaDuration}, units: maxCostUnits},
+		{name: "NaN saturates", model: CostModel{PerMegabyte: math.NaN()}, size: 1 << 20, info: MediaInfo{Format: FormatPNG, Width: 10, Height: 10}, units: maxCostUnits},
+		{name: "empty file costs 1", model: model, size: 0, info: MediaInfo{Format: FormatPNG, Width: 1, Height: 1}, units: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cost, err := tt.model.Cost(tt.size, tt.info, tt.info.IsVideo())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && cost.Units != tt.units {
+				t.Fatalf("units = %d, want %d (%+v)", cost.Units, tt.units, cost)
+			}
+		})
+	}
+}
+
+// Файл дороже всего бюджета отклоняется и не расходует его, даже если сумма с расходом переполнила бы int
+func TestBudgetDebitRejectsCostAboveLimit(t *testing.T) {
+	budgets := &BudgetLimiter{
+		store:   NewMemoryLimiterStore(time.Hour),
+		budgets: map[string]int{PlanFree: 100},
+		window:  time.Hour,
+	}
+	ctx := context.Background()
+
+	if _, allowed, err := budgets.Debit(ctx, "user:1", PlanFree, 10); err != nil || !allowed {
+		t.Fatalf("first debit: allowed=%v err=%v", allowed, err)
+	}
+
+	for _, cost := range []int{101, maxCostUnits, math.MaxInt} {
+		status, allowed, err := budgets.Debit(ctx, "user:1", PlanFree, cost)
+		if err != nil {
+			t.Fatalf("debit %d: %v", cost, err)
+		}
+		if allowed || status.Used != 10 {
+			t.Fatalf("debit %d: allowed=%v used=%d, want rejected with 10 used", cost, allowed, status.Used)
+		}
+	}
+}
@@ -1,11 +1,15 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"obscura.app/pkg/logger"
 )
 
@@ -24,7 +28,7 @@ func NewDatabase(cfg *Config, log *logger.Logger) (*Database, error) {
 	}
 
 	// Автомиграция
-	err = db.AutoMigrate(&User{}, &File{})
+	err = db.AutoMigrate(&User{}, &Organization{}, &Membership{}, &File{}, &Session{}, &APIKey{}, &UserIdentity{}, &RecoveryCode{}, &UserToken{}, &Setting{}, &AuditEvent{}, &AccountDeletion{}, &RateLimitCounter{}, &ObjectPreset{}, &ProcessingProfile{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
@@ -57,19 +61,827 @@ func (d *Database) UpdateUser(user *User) error {
 	return d.DB.Save(user).Error
 }
 
+// GetAllUsers возвращает всех пользователей
+func (d *Database) GetAllUsers() ([]User, error) {
+	var users []User
+	err := d.DB.Order("id ASC").Find(&users).Error
+	return users, err
+}
+
 func (d *Database) DeleteUser(id uint) error {
 	return d.DB.Delete(&User{}, id).Error
 }
 
+// UserFilter параметры поиска пользователей
+type UserFilter struct {
+	Query     string // подстрока email или имени
+	Role      string
+	Suspended *bool
+	Limit     int
+	Offset    int
+}
+
+// SearchUsers ищет пользователей по фильтру. Возвращает страницу и общее количество
+func (d *Database) SearchUsers(filter UserFilter) ([]User, int64, error) {
+	query := d.DB.Model(&User{})
+	if filter.Query != "" {
+		pattern := "%" + strings.ToLower(filter.Query) + "%"
+		query = query.Where("LOWER(email) LIKE ? OR LOWER(name) LIKE ?", pattern, pattern)
+	}
+	if filter.Role != "" {
+		query = query.Where("role = ?", filter.Role)
+	}
+	if filter.Suspended != nil {
+		if *filter.Suspended {
+			query = query.Where("suspended_at IS NOT NULL")
+		} else {
+			query = query.Where("suspended_at IS NULL")
+		}
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []User
+	err := query.Order("id ASC").Limit(filter.Limit).Offset(filter.Offset).Find(&users).Error
+	return users, total, err
+}
+
+// SetUserRole меняет роль пользователя
+func (d *Database) SetUserRole(id uint, role string) error {
+	return d.DB.Model(&User{}).Where("id = ?", id).Update("role", role).Error
+}
+
+// PromoteAdmins назначает роль admin пользователям с указанными email'ами
+func (d *Database) PromoteAdmins(emails []string) (int64, error) {
+	if len(emails) == 0 {
+		return 0, nil
+	}
+	result := d.DB.Model(&User{}).
+		Where("email IN ? AND role <> ?", emails, RoleAdmin).
+		Update("role", RoleAdmin)
+	return result.RowsAffected, result.Error
+}
+
+// SetUserSuspended блокирует пользователя (suspended=true) или снимает блокировку
+func (d *Database) SetUserSuspended(id uint, suspended bool, reason string) error {
+	updates := map[string]interface{}{
+		"suspended_at":   nil,
+		"suspend_reason": "",
+	}
+	if suspended {
+		updates["suspended_at"] = time.Now()
+		updates["suspend_reason"] = reason
+	}
+	return d.DB.Model(&User{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// DeleteUserRecords удаляет пользователя вместе с его файлами, сессиями, API ключами и наборами объектов
+func (d *Database) DeleteUserRecords(id uint) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", id).Delete(&APIKey{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&Session{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&Membership{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&UserIdentity{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&UserToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&ObjectPreset{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&ProcessingProfile{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&File{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&User{}, id).Error
+	})
+}
+
+// Методы для работы с двухфакторной аутентификацией
+
+// SetTOTPPendingSecret сохраняет секрет, ожидающий подтверждения кодом
+func (d *Database) SetTOTPPendingSecret(userID uint, secret string) error {
+	return d.DB.Model(&User{}).Where("id = ?", userID).Update("totp_pending_secret", secret).Error
+}
+
+// EnableTOTP активирует подтвержденный секрет и заменяет коды восстановления
+func (d *Database) EnableTOTP(userID uint, secret string, step int64, recoveryHashes []string) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"totp_secret":         secret,
+			"totp_pending_secret": "",
+			"totp_last_step":      step,
+			"totp_enabled_at":     time.Now(),
+		}).Error
+		if err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, userID, recoveryHashes)
+	})
+}
+
+// DisableTOTP отключает двухфакторную аутентификацию и удаляет коды восстановления
+func (d *Database) DisableTOTP(userID uint) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"totp_secret":         "",
+			"totp_pending_secret": "",
+			"totp_last_step":      0,
+			"totp_enabled_at":     nil,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error
+	})
+}
+
+// AdvanceTOTPStep запоминает использованный временной шаг.
+// Возвращает false, если код этого или более позднего шага уже использовался
+func (d *Database) AdvanceTOTPStep(userID uint, step int64) (bool, error) {
+	result := d.DB.Model(&User{}).
+		Where("id = ? AND totp_last_step < ?", userID, step).
+		Update("totp_last_step", step)
+	return result.RowsAffected == 1, result.Error
+}
+
+// ReplaceRecoveryCodes заменяет коды восстановления пользователя
+func (d *Database) ReplaceRecoveryCodes(userID uint, hashes []string) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, hashes)
+	})
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, hashes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	codes := make([]RecoveryCode, len(hashes))
+	for i, hash := range hashes {
+		codes[i] = RecoveryCode{UserID: userID, CodeHash: hash}
+	}
+	return tx.Create(&codes).Error
+}
+
+// UseRecoveryCode помечает код восстановления использованным. Возвращает false, если код не найден
+func (d *Database) UseRecoveryCode(userID uint, hash string) (bool, error) {
+	result := d.DB.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+// CountRecoveryCodes возвращает количество неиспользованных кодов восстановления
+func (d *Database) CountRecoveryCodes(userID uint) (int64, error) {
+	var count int64
+	err := d.DB.Model(&RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+// IsTwoFactorRequiredByOrganizations проверяет, состоит ли пользователь в организации, требующей 2FA
+func (d *Database) IsTwoFactorRequiredByOrganizations(userID uint) (bool, error) {
+	var count int64
+	err := d.DB.Model(&Membership{}).
+		Joins("JOIN organizations ON organizations.id = memberships.organization_id").
+		Where("memberships.user_id = ? AND organizations.require_2fa", userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// SetOrganizationRequire2FA включает или выключает обязательную 2FA для участников организации
+func (d *Database) SetOrganizationRequire2FA(orgID uint, required bool) error {
+	return d.DB.Model(&Organization{}).Where("id = ?", orgID).Update("require_2fa", required).Error
+}
+
+// Методы для работы с токенами из писем
+
+// CreateUserToken сохраняет токен, отменяя выданные ранее неиспользованные токены того же назначения
+func (d *Database) CreateUserToken(token *UserToken) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ? AND purpose = ? AND used_at IS NULL", token.UserID, token.Purpose).
+			Delete(&UserToken{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	})
+}
+
+// HasRecentUserToken проверяет, выдан ли после since действующий неиспользованный токен
+// того же назначения на тот же адрес
+func (d *Database) HasRecentUserToken(userID uint, purpose, email string, since time.Time) (bool, error) {
+	var count int64
+	err := d.DB.Model(&UserToken{}).
+		Where("user_id = ? AND purpose = ? AND email = ? AND used_at IS NULL AND created_at > ? AND expires_at > ?",
+			userID, purpose, email, since, time.Now()).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// ConsumeUserToken помечает действующий токен использованным и возвращает его.
+// Для неизвестного, просроченного или уже использованного токена возвращает gorm.ErrRecordNotFound
+func (d *Database) ConsumeUserToken(hash, purpose string) (*UserToken, error) {
+	var token UserToken
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", hash, purpose, time.Now()).
+			First(&token).Error
+		if err != nil {
+			return err
+		}
+
+		result := tx.Model(&UserToken{}).Where("id = ? AND used_at IS NULL", token.ID).Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// MarkEmailVerified применяет подтвержденный адрес и отмечает его подтвержденным
+func (d *Database) MarkEmailVerified(userID uint, email string) error {
+	return d.DB.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"email":             email,
+		"pending_email":     "",
+		"email_verified_at": time.Now(),
+	}).Error
+}
+
+// ResetPassword устанавливает новый пароль (хеш) и завершает все сессии пользователя
+func (d *Database) ResetPassword(userID uint, passwordHash string, emailVerified bool, reason string) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{"password": passwordHash}
+		if emailVerified {
+			updates["email_verified_at"] = gorm.Expr("COALESCE(email_verified_at, ?)", time.Now())
+		}
+		if err := tx.Model(&User{}).Where("id = ?", userID).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Session{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Updates(map[string]interface{}{
+				"revoked_at":    time.Now(),
+				"revoke_reason": reason,
+			}).Error
+	})
+}
+
+// Методы для работы с задачами удаления учетных записей
+func (d *Database) CreateAccountDeletion(job *AccountDeletion) error {
+	return d.DB.Create(job).Error
+}
+
+func (d *Database) GetAccountDeletion(id string) (*AccountDeletion, error) {
+	var job AccountDeletion
+	err := d.DB.First(&job, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (d *Database) UpdateAccountDeletion(job *AccountDeletion) error {
+	return d.DB.Save(job).Error
+}
+
+// GetUnfinishedAccountDeletions возвращает задачи, прерванные остановкой сервера
+func (d *Database) GetUnfinishedAccountDeletions() ([]AccountDeletion, error) {
+	var jobs []AccountDeletion
+	err := d.DB.Where("status IN ?", []string{DeletionPending, DeletionRunning}).Order("requested_at ASC").Find(&jobs).Error
+	return jobs, err
+}
+
+// HasActiveAccountDeletion проверяет, выполняется ли уже удаление учетной записи
+func (d *Database) HasActiveAccountDeletion(userID uint) (bool, error) {
+	var count int64
+	err := d.DB.Model(&AccountDeletion{}).
+		Where("user_id = ? AND status IN ?", userID, []string{DeletionPending, DeletionRunning}).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// lockRateLimitCounter создает строку счетчика, если ее нет, и блокирует ее до конца транзакции,
+// поэтому одновременные запросы с разных реплик не теряются
+func lockRateLimitCounter(tx *gorm.DB, initial *RateLimitCounter) (*RateLimitCounter, error) {
+	err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(initial).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var counter RateLimitCounter
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&counter, "key = ?", initial.Key).Error
+	if err != nil {
+		return nil, err
+	}
+	return &counter, nil
+}
+
+// rateLimitNow возвращает время сервера БД: часы реплик сервиса могут расходиться,
+// а счетчики у всех реплик общие
+func rateLimitNow(tx *gorm.DB) (time.Time, error) {
+	var now time.Time
+	err := tx.Raw("SELECT now()").Scan(&now).Error
+	return now, err
+}
+
+// ConsumeRateLimit расходует cost единиц лимита клиента в фиксированном окне
+func (d *Database) ConsumeRateLimit(key string, cost, limit int, window time.Duration) (LimitResult, error) {
+	var result LimitResult
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		now, err := rateLimitNow(tx)
+		if err != nil {
+			return err
+		}
+		counter, err := lockRateLimitCounter(tx, &RateLimitCounter{Key: key, WindowStart: now, LastSeen: now})
+		if err != nil {
+			return err
+		}
+
+		if counter.Count == 0 || now.Sub(counter.WindowStart) >= window {
+			counter.Count = 0
+			counter.WindowStart = now
+		}
+		counter.LastSeen = now
+
+		allowed := counter.Count+cost <= limit
+		if allowed {
+			counter.Count = max(counter.Count+cost, 0)
+		}
+		result = fixedWindowResult(allowed, counter.Count, limit, counter.WindowStart.Add(window).Sub(now))
+
+		return tx.Save(counter).Error
+	})
+	return result, err
+}
+
+// TakeRateLimitToken берет токен из корзины клиента
+func (d *Database) TakeRateLimitToken(key string, capacity int, window time.Duration) (LimitResult, error) {
+	var result LimitResult
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		now, err := rateLimitNow(tx)
+		if err != nil {
+			return err
+		}
+		counter, err := lockRateLimitCounter(tx, &RateLimitCounter{Key: key, WindowStart: now, LastSeen: now, Tokens: float64(capacity)})
+		if err != nil {
+			return err
+		}
+
+		counter.Tokens, result = takeToken(counter.Tokens, max(now.Sub(counter.LastSeen), 0), capacity, window)
+		counter.LastSeen = now
+
+		return tx.Save(counter).Error
+	})
+	return result, err
+}
+
+// LogRateLimitHit учитывает запрос в скользящем окне
+func (d *Database) LogRateLimitHit(key string, limit int, window time.Duration) (LimitResult, error) {
+	var result LimitResult
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		now, err := rateLimitNow(tx)
+		if err != nil {
+			return err
+		}
+		counter, err := lockRateLimitCounter(tx, &RateLimitCounter{Key: key, WindowStart: now, LastSeen: now})
+		if err != nil {
+			return err
+		}
+
+		var hits []time.Time
+		for _, value := range strings.Split(counter.Hits, ",") {
+			if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+				hits = append(hits, time.UnixMilli(ms))
+			}
+		}
+
+		hits, result = logHit(hits, now, limit, window)
+
+		values := make([]string, len(hits))
+		for i, hit := range hits {
+			values[i] = strconv.FormatInt(hit.UnixMilli(), 10)
+		}
+		counter.Hits = strings.Join(values, ",")
+		counter.Count = len(hits)
+		counter.LastSeen = now
+
+		return tx.Save(counter).Error
+	})
+	return result, err
+}
+
+// DeleteIdleRateLimits удаляет счетчики клиентов, не обращавшихся с указанного момента
+func (d *Database) DeleteIdleRateLimits(before time.Time) (int64, error) {
+	result := d.DB.Where("last_seen < ?", before).Delete(&RateLimitCounter{})
+	return result.RowsAffected, result.Error
+}
+
+func (d *Database) CountRateLimits() (int64, error) {
+	var count int64
+	err := d.DB.Model(&RateLimitCounter{}).Count(&count).Error
+	return count, err
+}
+
+// Методы для работы с журналом аудита
+func (d *Database) CreateAuditEvent(event *AuditEvent) error {
+	return d.DB.Create(event).Error
+}
+
+// AuditFilter параметры поиска по журналу аудита
+type AuditFilter struct {
+	Action   string
+	Severity string
+	UserID   uint // инициатор или затронутый пользователь
+	Limit    int
+	Offset   int
+}
+
+// SearchAuditEvents возвращает страницу журнала аудита (новые события первыми) и общее количество
+func (d *Database) SearchAuditEvents(filter AuditFilter) ([]AuditEvent, int64, error) {
+	query := d.DB.Model(&AuditEvent{})
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.Severity != "" {
+		query = query.Where("severity = ?", filter.Severity)
+	}
+	if filter.UserID != 0 {
+		query = query.Where("actor_id = ? OR target_user_id = ?", filter.UserID, filter.UserID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var events []AuditEvent
+	err := query.Order("created_at DESC, id DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&events).Error
+	return events, total, err
+}
+
+// Методы для работы с глобальными настройками
+func (d *Database) GetSetting(key string) (string, bool, error) {
+	var setting Setting
+	err := d.DB.First(&setting, "key = ?", key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", false, nil
+	}
+	return setting.Value, err == nil, err
+}
+
+func (d *Database) SetSetting(key, value string) error {
+	return d.DB.Save(&Setting{Key: key, Value: value}).Error
+}
+
+// Методы для работы с внешними учетными записями
+func (d *Database) GetUserIdentity(provider, subject string) (*UserIdentity, error) {
+	var identity UserIdentity
+	err := d.DB.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	return &identity, err
+}
+
+func (d *Database) GetUserIdentities(userID uint) ([]UserIdentity, error) {
+	var identities []UserIdentity
+	err := d.DB.Where("user_id = ?", userID).Order("created_at ASC").Find(&identities).Error
+	return identities, err
+}
+
+func (d *Database) CreateUserIdentity(identity *UserIdentity) error {
+	return d.DB.Create(identity).Error
+}
+
+// CreateUserWithIdentity создает пользователя вместе с внешней учетной записью
+func (d *Database) CreateUserWithIdentity(user *User, identity *UserIdentity) error {
+	if err := user.HashPassword(); err != nil {
+		return err
+	}
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		identity.UserID = user.ID
+		return tx.Create(identity).Error
+	})
+}
+
+// TouchUserIdentity обновляет email и время последнего входа через провайдера
+func (d *Database) TouchUserIdentity(id uint, email string) error {
+	return d.DB.Model(&UserIdentity{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"email":         email,
+		"last_login_at": time.Now(),
+	}).Error
+}
+
+// Методы для работы с сессиями
+func (d *Database) CreateSession(session *Session) error {
+	return d.DB.Create(session).Error
+}
+
+func (d *Database) GetSessionByID(id string) (*Session, error) {
+	var session Session
+	err := d.DB.First(&session, "id = ?", id).Error
+	return &session, err
+}
+
+func (d *Database) GetUserSessions(userID uint) ([]Session, error) {
+	var sessions []Session
+	err := d.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+// IsSessionActive проверяет, что сессия существует, не отозвана и не истекла
+func (d *Database) IsSessionActive(id string) (bool, error) {
+	var count int64
+	err := d.DB.Model(&Session{}).
+		Where("id = ? AND revoked_at IS NULL AND expires_at > ?", id, time.Now()).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// RotateSession заменяет хеш refresh токена, только если предъявлен текущий токен.
+// Возвращает false, если токен уже был использован или сессия отозвана
+func (d *Database) RotateSession(id, oldHash, newHash, ip string) (bool, error) {
+	result := d.DB.Model(&Session{}).
+		Where("id = ? AND token_hash = ? AND revoked_at IS NULL", id, oldHash).
+		Updates(map[string]interface{}{
+			"token_hash":   newHash,
+			"generation":   gorm.Expr("generation + 1"),
+			"ip":           ip,
+			"last_used_at": time.Now(),
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// RevokeSession отзывает сессию вместе со всеми выданными для нее токенами
+func (d *Database) RevokeSession(id, reason string) error {
+	return d.DB.Model(&Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Updates(map[string]interface{}{
+			"revoked_at":    time.Now(),
+			"revoke_reason": reason,
+		}).Error
+}
+
+// RevokeUserSessions отзывает все активные сессии пользователя
+func (d *Database) RevokeUserSessions(userID uint, reason string) error {
+	return d.DB.Model(&Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Updates(map[string]interface{}{
+			"revoked_at":    time.Now(),
+			"revoke_reason": reason,
+		}).Error
+}
+
+// Методы для работы с API ключами
+func (d *Database) CreateAPIKey(key *APIKey) error {
+	return d.DB.Create(key).Error
+}
+
+func (d *Database) GetUserAPIKeys(userID uint) ([]APIKey, error) {
+	var keys []APIKey
+	err := d.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+// GetActiveAPIKeyByHash находит неотозванный ключ незаблокированного пользователя
+func (d *Database) GetActiveAPIKeyByHash(hash string) (*APIKey, error) {
+	var key APIKey
+	err := d.DB.
+		Joins("JOIN users ON users.id = api_keys.user_id AND users.suspended_at IS NULL").
+		Where("api_keys.key_hash = ? AND api_keys.revoked_at IS NULL", hash).
+		First(&key).Error
+	return &key, err
+}
+
+func (d *Database) CountActiveAPIKeys(userID uint) (int64, error) {
+	var count int64
+	err := d.DB.Model(&APIKey{}).Where("user_id = ? AND revoked_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+// TouchAPIKey записывает время и IP последнего использования ключа.
+// Время обновляется не чаще interval, если IP не изменился
+func (d *Database) TouchAPIKey(id uint, ip string, interval time.Duration) error {
+	now := time.Now()
+	return d.DB.Model(&APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ? OR last_used_ip <> ?)", id, now.Add(-interval), ip).
+		Updates(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": ip,
+		}).Error
+}
+
+// RevokeAPIKey отзывает ключ пользователя. Возвращает false, если активный ключ не найден
+func (d *Database) RevokeAPIKey(id, userID uint) (bool, error) {
+	result := d.DB.Model(&APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+// Методы для работы с наборами типов объектов
+func (d *Database) CreateObjectPreset(preset *ObjectPreset) error {
+	return d.DB.Create(preset).Error
+}
+
+func (d *Database) GetObjectPresetByID(id uint) (*ObjectPreset, error) {
+	var preset ObjectPreset
+	err := d.DB.First(&preset, id).Error
+	return &preset, err
+}
+
+// GetUserObjectPreset находит личный набор пользователя по имени
+func (d *Database) GetUserObjectPreset(userID uint, name string) (*ObjectPreset, error) {
+	var preset ObjectPreset
+	err := d.DB.Where("user_id = ? AND name = ?", userID, name).First(&preset).Error
+	return &preset, err
+}
+
+// GetOrganizationObjectPreset находит набор организации по имени
+func (d *Database) GetOrganizationObjectPreset(orgID uint, name string) (*ObjectPreset, error) {
+	var preset ObjectPreset
+	err := d.DB.Where("organization_id = ? AND name = ?", orgID, name).First(&preset).Error
+	return &preset, err
+}
+
+// GetAvailableObjectPresets возвращает личные наборы пользователя и наборы организаций, в которых он состоит
+func (d *Database) GetAvailableObjectPresets(userID uint) ([]ObjectPreset, error) {
+	var presets []ObjectPreset
+	err := d.DB.
+		Where("user_id = ?", userID).
+		Or("organization_id IN (?)", d.DB.Model(&Membership{}).Select("organization_id").Where("user_id = ?", userID)).
+		Order("organization_id NULLS FIRST, name ASC").
+		Find(&presets).Error
+	return presets, err
+}
+
+// CountObjectPresets считает наборы владельца: пользователя или организации
+func (d *Database) CountObjectPresets(userID, orgID *uint) (int64, error) {
+	var count int64
+	query := d.DB.Model(&ObjectPreset{})
+	if orgID != nil {
+		query = query.Where("organization_id = ?", *orgID)
+	} else {
+		query = query.Where("user_id = ?", *userID)
+	}
+	err := query.Count(&count).Error
+	return count, err
+}
+
+func (d *Database) UpdateObjectPreset(preset *ObjectPreset) error {
+	return d.DB.Model(preset).Select("name", "label", "object_types").Updates(preset).Error
+}
+
+func (d *Database) DeleteObjectPreset(id uint) error {
+	return d.DB.Delete(&ObjectPreset{}, id).Error
+}
+
+// Методы для работы с профилями обработки
+
+// CreateProcessingProfile создает профиль. Новый основной профиль снимает отметку с прежнего
+func (d *Database) CreateProcessingProfile(profile *ProcessingProfile) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := clearDefaultProcessingProfile(tx, profile); err != nil {
+			return err
+		}
+		return tx.Create(profile).Error
+	})
+}
+
+func (d *Database) GetProcessingProfileByID(id uint) (*ProcessingProfile, error) {
+	var profile ProcessingProfile
+	err := d.DB.First(&profile, id).Error
+	return &profile, err
+}
+
+// GetProcessingProfileByName находит профиль пользователя по имени
+func (d *Database) GetProcessingProfileByName(userID uint, name string) (*ProcessingProfile, error) {
+	var profile ProcessingProfile
+	err := d.DB.Where("user_id = ? AND name = ?", userID, name).First(&profile).Error
+	return &profile, err
+}
+
+// GetDefaultProcessingProfile возвращает основной профиль пользователя
+func (d *Database) GetDefaultProcessingProfile(userID uint) (*ProcessingProfile, error) {
+	var profile ProcessingProfile
+	err := d.DB.Where("user_id = ? AND is_default = ?", userID, true).First(&profile).Error
+	return &profile, err
+}
+
+func (d *Database) GetUserProcessingProfiles(userID uint) ([]ProcessingProfile, error) {
+	var profiles []ProcessingProfile
+	err := d.DB.Where("user_id = ?", userID).Order("name ASC").Find(&profiles).Error
+	return profiles, err
+}
+
+func (d *Database) CountProcessingProfiles(userID uint) (int64, error) {
+	var count int64
+	err := d.DB.Model(&ProcessingProfile{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+// UpdateProcessingProfile сохраняет все поля профиля. Новый основной профиль снимает отметку с прежнего
+func (d *Database) UpdateProcessingProfile(profile *ProcessingProfile) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := clearDefaultProcessingProfile(tx, profile); err != nil {
+			return err
+		}
+		return tx.Model(profile).
+			Select("name", "blur_type", "intensity", "object_types", "regions", "output_format", "is_default").
+			Updates(profile).Error
+	})
+}
+
+func (d *Database) DeleteProcessingProfile(id uint) error {
+	return d.DB.Delete(&ProcessingProfile{}, id).Error
+}
+
+// clearDefaultProcessingProfile снимает отметку основного с остальных профилей пользователя,
+// если сохраняемый профиль отмечен основным
+func clearDefaultProcessingProfile(tx *gorm.DB, profile *ProcessingProfile) error {
+	if !profile.IsDefault {
+		return nil
+	}
+	return tx.Model(&ProcessingProfile{}).
+		Where("user_id = ? AND id <> ? AND is_default = ?", profile.UserID, profile.ID, true).
+		Update("is_default", false).Error
+}
+
 // Методы для работы с файлами
 func (d *Database) CreateFile(file *File) error {
 	if err := d.DB.Create(file).Error; err != nil {
 		return err
 	}
 
+	// Загрузки в организацию учитываются в ее месячной квоте, а не в личной
+	if file.OrganizationID != nil {
+		if err := d.IncrementOrganizationUploads(*file.OrganizationID); err != nil {
+			return err
+		}
+	} else if err := d.IncrementMonthlyUploads(file.UserID); err != nil {
+		return err
+	}
+
 	return d.UpdateUserStats(file.UserID, 1, 0, 0, file.FileSize)
 }
 
+// CreateQuarantinedFile сохраняет запись зараженной загрузки. Файл не принят, поэтому
+// статистика пользователя и месячные счетчики загрузок не меняются
+func (d *Database) CreateQuarantinedFile(file *File) error {
+	return d.DB.Create(file).Error
+}
+
+// IncrementMonthlyUploads увеличивает счетчик загрузок за текущий месяц, сбрасывая его при смене периода
+func (d *Database) IncrementMonthlyUploads(userID uint) error {
+	period := currentQuotaPeriod()
+	return d.DB.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"monthly_uploads":        gorm.Expr("CASE WHEN monthly_uploads_period = ? THEN monthly_uploads + 1 ELSE 1 END", period),
+		"monthly_uploads_period": period,
+	}).Error
+}
+
+// GetUserStoredBytes возвращает объем личных файлов пользователя (оригиналы и результаты обработки).
+// Файлы в карантине в хранилище пользователя не лежат и не учитываются
+func (d *Database) GetUserStoredBytes(userID uint) (int64, error) {
+	var total int64
+	err := d.DB.Model(&File{}).
+		Select("COALESCE(SUM(file_size + COALESCE(processed_size, 0)), 0)").
+		Where("user_id = ? AND organization_id IS NULL AND status <> ?", userID, StatusQuarantined).
+		Scan(&total).Error
+	return total, err
+}
+
+// GetOrganizationStoredBytes возвращает объем файлов организации
+func (d *Database) GetOrganizationStoredBytes(orgID uint) (int64, error) {
+	var total int64
+	err := d.DB.Model(&File{}).
+		Select("COALESCE(SUM(file_size + COALESCE(processed_size, 0)), 0)").
+		Where("organization_id = ? AND status <> ?", orgID, StatusQuarantined).
+		Scan(&total).Error
+	return total, err
+}
+
 func (d *Database) GetFileByID(id string) (*File, error) {
 	var file File
 	err := d.DB.First(&file, "id = ?", id).Error
@@ -82,6 +894,25 @@ func (d *Database) GetUserFiles(userID uint) ([]File, error) {
 	return files, err
 }
 
+// GetUserListedFiles возвращает файлы, загруженные пользователем, кроме файлов организаций,
+// в которых он больше не состоит
+func (d *Database) GetUserListedFiles(userID uint) ([]File, error) {
+	var files []File
+	err := d.DB.Where("user_id = ?", userID).
+		Where(d.DB.Where("organization_id IS NULL").
+			Or("organization_id IN (?)", d.DB.Model(&Membership{}).Select("organization_id").Where("user_id = ?", userID))).
+		Order("uploaded_at DESC").
+		Find(&files).Error
+	return files, err
+}
+
+// GetAllFiles возвращает все записи о файлах (используется при очистке и проверке хранилища)
+func (d *Database) GetAllFiles() ([]File, error) {
+	var files []File
+	err := d.DB.Find(&files).Error
+	return files, err
+}
+
 func (d *Database) UpdateFileStatus(id string, status string) error {
 	updates := map[string]interface{}{
 		"status": status,
@@ -150,6 +981,50 @@ func (d *Database) UpdateFileProcessing(id string, processedName string, process
 	return nil
 }
 
+// ResetFileProcessing удаляет результаты предыдущей обработки перед повторной обработкой
+func (d *Database) ResetFileProcessing(id string) error {
+	return d.DB.Model(&File{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":         StatusProcessing,
+		"processed_name": "",
+		"processed_size": 0,
+		"processed_hash": "",
+		"thumbnail_name": "",
+		"thumbnail_hash": "",
+		"preview_name":   "",
+		"preview_hash":   "",
+		"error_message":  "",
+		"processed_at":   time.Now(),
+	}).Error
+}
+
+// SetFileHash сохраняет SHA-256 оригинала или обработанного файла
+func (d *Database) SetFileHash(id string, processed bool, hash string) error {
+	column := "content_hash"
+	if processed {
+		column = "processed_hash"
+	}
+	return d.DB.Model(&File{}).Where("id = ?", id).Update(column, hash).Error
+}
+
+// SetFileRenditions сохраняет имена и SHA-256 миниатюры и превью
+func (d *Database) SetFileRenditions(id string, thumbnail, preview Rendition) error {
+	return d.DB.Model(&File{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"thumbnail_name": thumbnail.Name,
+		"thumbnail_hash": thumbnail.Hash,
+		"preview_name":   preview.Name,
+		"preview_hash":   preview.Hash,
+	}).Error
+}
+
+// SetRenditionHash сохраняет SHA-256 миниатюры или превью, созданных до появления хешей
+func (d *Database) SetRenditionHash(id, kind, hash string) error {
+	column := "thumbnail_hash"
+	if kind == RenditionPreview {
+		column = "preview_hash"
+	}
+	return d.DB.Model(&File{}).Where("id = ?", id).Update(column, hash).Error
+}
+
 func (d *Database) GetFilesByStatus(status string) ([]File, error) {
 	var files []File
 	err := d.DB.Where("status = ?", status).Find(&files).Error
@@ -164,6 +1039,19 @@ func (d *Database) GetPendingFiles() ([]File, error) {
 	return files, err
 }
 
+// MarkFileFailed помечает файл как failed с указанием причины и сбрасывает ссылку на обработанный файл
+func (d *Database) MarkFileFailed(id string, reason string) error {
+	if err := d.UpdateFileProcessing(id, "", 0, StatusFailed, reason); err != nil {
+		return err
+	}
+
+	return d.DB.Model(&File{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"processed_name": "",
+		"processed_size": 0,
+		"processed_hash": "",
+	}).Error
+}
+
 func (d *Database) DeleteFile(id string) error {
 	return d.DB.Delete(&File{}, "id = ?", id).Error
 }
@@ -187,3 +1075,230 @@ func (d *Database) UpdateUserStats(userID uint, filesDelta int, processedDelta i
 		"last_stats_update": time.Now(),
 	}).Error
 }
+
+// StoredUsage фактический объем файлов пользователя по записям в БД
+type StoredUsage struct {
+	UserID uint
+	Files  int
+	Bytes  int64
+}
+
+// GetStoredUsage считает количество и размер файлов каждого пользователя по записям File.
+// Записи файлов в карантине не учитываются, как и при загрузке
+func (d *Database) GetStoredUsage() (map[uint]StoredUsage, error) {
+	var rows []StoredUsage
+	err := d.DB.Model(&File{}).
+		Select("user_id, COUNT(*) AS files, COALESCE(SUM(file_size), 0) AS bytes").
+		Where("status <> ?", StatusQuarantined).
+		Group("user_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make(map[uint]StoredUsage, len(rows))
+	for _, row := range rows {
+		usage[row.UserID] = row
+	}
+	return usage, nil
+}
+
+// RaiseUserTotals поднимает накопленные TotalFiles и TotalSize пользователя не ниже указанных.
+// Параллельная загрузка могла их уже увеличить, поэтому значения не уменьшаются
+func (d *Database) RaiseUserTotals(userID uint, totalFiles int, totalSize int64) error {
+	return d.DB.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"total_files":       gorm.Expr("GREATEST(total_files, ?)", totalFiles),
+		"total_size":        gorm.Expr("GREATEST(total_size, ?)", totalSize),
+		"last_stats_update": time.Now(),
+	}).Error
+}
+
+// Методы для работы с организациями
+
+// CreateOrganization создает организацию и делает создателя ее владельцем
+func (d *Database) CreateOrganization(org *Organization) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&Membership{
+			OrganizationID: org.ID,
+			UserID:         org.CreatedBy,
+			Role:           MemberRoleOwner,
+		}).Error
+	})
+}
+
+func (d *Database) GetOrganizationByID(id uint) (*Organization, error) {
+	var org Organization
+	err := d.DB.First(&org, id).Error
+	return &org, err
+}
+
+// DeleteOrganization удаляет организацию вместе с участниками и наборами объектов
+func (d *Database) DeleteOrganization(id uint) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("organization_id = ?", id).Delete(&Membership{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("organization_id = ?", id).Delete(&ObjectPreset{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Organization{}, id).Error
+	})
+}
+
+// GetUserOrganizations возвращает организации пользователя с его ролью в каждой
+func (d *Database) GetUserOrganizations(userID uint) ([]UserOrganization, error) {
+	var orgs []UserOrganization
+	err := d.DB.Model(&Organization{}).
+		Select("organizations.*, memberships.role").
+		Joins("JOIN memberships ON memberships.organization_id = organizations.id").
+		Where("memberships.user_id = ?", userID).
+		Order("organizations.name ASC").
+		Scan(&orgs).Error
+	return orgs, err
+}
+
+// IncrementOrganizationUploads увеличивает месячный счетчик загрузок организации
+func (d *Database) IncrementOrganizationUploads(orgID uint) error {
+	period := currentQuotaPeriod()
+	return d.DB.Model(&Organization{}).Where("id = ?", orgID).Updates(map[string]interface{}{
+		"monthly_uploads":        gorm.Expr("CASE WHEN monthly_uploads_period = ? THEN monthly_uploads + 1 ELSE 1 END", period),
+		"monthly_uploads_period": period,
+	}).Error
+}
+
+// GetOrganizationFiles возвращает файлы организации
+func (d *Database) GetOrganizationFiles(orgID uint) ([]File, error) {
+	var files []File
+	err := d.DB.Where("organization_id = ?", orgID).Order("uploaded_at DESC").Find(&files).Error
+	return files, err
+}
+
+// TransferOrganizationFiles передает файлы, загруженные пользователем в организации, другому
+// участнику каждой из них: владельцу, если его нет - администратору, иначе самому давнему участнику.
+// Накопленная статистика получателя увеличивается на переданные файлы. Файлы организаций
+// без других участников остаются за пользователем. Возвращает число переданных файлов
+func (d *Database) TransferOrganizationFiles(userID uint) (int64, error) {
+	var transferred int64
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		var orgIDs []uint
+		err := tx.Model(&File{}).
+			Where("user_id = ? AND organization_id IS NOT NULL", userID).
+			Distinct("organization_id").
+			Pluck("organization_id", &orgIDs).Error
+		if err != nil {
+			return err
+		}
+
+		for _, orgID := range orgIDs {
+			var heir Membership
+			err := tx.Where("organization_id = ? AND user_id <> ?", orgID, userID).
+				Order("CASE role WHEN 'owner' THEN 0 WHEN 'admin' THEN 1 ELSE 2 END, created_at ASC").
+				First(&heir).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			var usage StoredUsage
+			err = tx.Model(&File{}).
+				Select("COUNT(*) AS files, COALESCE(SUM(file_size), 0) AS bytes").
+				Where("user_id = ? AND organization_id = ? AND status <> ?", userID, orgID, StatusQuarantined).
+				Scan(&usage).Error
+			if err != nil {
+				return err
+			}
+
+			result := tx.Model(&File{}).
+				Where("user_id = ? AND organization_id = ?", userID, orgID).
+				Update("user_id", heir.UserID)
+			if result.Error != nil {
+				return result.Error
+			}
+			transferred += result.RowsAffected
+
+			err = tx.Model(&User{}).Where("id = ?", heir.UserID).Updates(map[string]interface{}{
+				"total_files": gorm.Expr("total_files + ?", usage.Files),
+				"total_size":  gorm.Expr("total_size + ?", usage.Bytes),
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return transferred, err
+}
+
+// CountOrganizationFiles возвращает количество файлов организации
+func (d *Database) CountOrganizationFiles(orgID uint) (int64, error) {
+	var count int64
+	err := d.DB.Model(&File{}).Where("organization_id = ?", orgID).Count(&count).Error
+	return count, err
+}
+
+// GetOrganizationStats считает файлы организации по статусам и их объем
+func (d *Database) GetOrganizationStats(orgID uint) (*OrganizationStats, error) {
+	stats := &OrganizationStats{}
+
+	err := d.DB.Model(&File{}).
+		Select("COUNT(*) AS total_files, "+
+			"COUNT(*) FILTER (WHERE status = ?) AS total_processed, "+
+			"COUNT(*) FILTER (WHERE status = ?) AS total_failed, "+
+			"COALESCE(SUM(file_size + COALESCE(processed_size, 0)), 0) AS total_size", StatusCompleted, StatusFailed).
+		Where("organization_id = ?", orgID).
+		Scan(stats).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.DB.Model(&Membership{}).Where("organization_id = ?", orgID).Count(&stats.Members).Error
+	return stats, err
+}
+
+// Методы для работы с участниками организаций
+func (d *Database) GetMembership(orgID, userID uint) (*Membership, error) {
+	var membership Membership
+	err := d.DB.Where("organization_id = ? AND user_id = ?", orgID, userID).First(&membership).Error
+	return &membership, err
+}
+
+func (d *Database) GetOrganizationMembers(orgID uint) ([]Membership, error) {
+	var members []Membership
+	err := d.DB.Preload("User").Where("organization_id = ?", orgID).Order("created_at ASC").Find(&members).Error
+	return members, err
+}
+
+func (d *Database) CreateMembership(membership *Membership) error {
+	return d.DB.Create(membership).Error
+}
+
+func (d *Database) UpdateMembershipRole(orgID, userID uint, role string) error {
+	return d.DB.Model(&Membership{}).
+		Where("organization_id = ? AND user_id = ?", orgID, userID).
+		Update("role", role).Error
+}
+
+func (d *Database) DeleteMembership(orgID, userID uint) error {
+	return d.DB.Where("organization_id = ? AND user_id = ?", orgID, userID).Delete(&Membership{}).Error
+}
+
+// CountOrganizationMembers возвращает количество участников организации
+func (d *Database) CountOrganizationMembers(orgID uint) (int64, error) {
+	var count int64
+	err := d.DB.Model(&Membership{}).Where("organization_id = ?", orgID).Count(&count).Error
+	return count, err
+}
+
+// CountOrganizationOwners возвращает количество владельцев организации
+func (d *Database) CountOrganizationOwners(orgID uint) (int64, error) {
+	var count int64
+	err := d.DB.Model(&Membership{}).
+		Where("organization_id = ? AND role = ?", orgID, MemberRoleOwner).
+		Count(&count).Error
+	return count, err
+}
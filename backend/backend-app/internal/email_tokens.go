@@ -0,0 +1,369 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Назначения токенов из писем
+const (
+	TokenPurposeVerifyEmail   = "verify_email"
+	TokenPurposeResetPassword = "reset_password"
+
+	RevokeReasonPasswordReset = "password_reset"
+
+	mailSendTimeout = 30 * time.Second
+	// Не чаще одного письма одного назначения на адрес: повторный запрос в этот срок
+	// не создает новый токен, ссылка из прошлого письма остается действительной
+	userTokenResendInterval = time.Minute
+)
+
+var errUserTokenRecentlySent = errors.New("a link was sent to this address recently")
+
+// Ответы, одинаковые для существующих и несуществующих адресов
+const (
+	msgPasswordResetSent = "If an account with this email exists, a password reset link has been sent"
+	msgVerificationSent  = "If an unverified account with this email exists, a verification link has been sent"
+)
+
+// issueUserToken создает одноразовый токен для письма. В БД сохраняется только хеш.
+// Если такой же токен выдан недавно, возвращает errUserTokenRecentlySent
+func (s *Server) issueUserToken(userID uint, purpose, email string, ttl time.Duration) (string, error) {
+	recent, err := s.db.HasRecentUserToken(userID, purpose, email, time.Now().Add(-userTokenResendInterval))
+	if err != nil {
+		return "", err
+	}
+	if recent {
+		return "", errUserTokenRecentlySent
+	}
+
+	token, err := randomURLToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.db.CreateUserToken(&UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		Email:     email,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consumeUserToken проверяет токен из письма и возвращает его вместе с пользователем
+func (s *Server) consumeUserToken(token, purpose string) (*UserToken, *User, error) {
+	if token == "" {
+		return nil, nil, gorm.ErrRecordNotFound
+	}
+
+	userToken, err := s.db.ConsumeUserToken(hashToken(token), purpose)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := s.db.GetUserByID(userToken.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return userToken, user, nil
+}
+
+// sendMail отправляет письмо в фоне, чтобы время ответа не зависело от почтового сервера
+// и не выдавало существование адреса
+func (s *Server) sendMail(msg Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+		defer cancel()
+
+		if err := s.mailer.Send(ctx, msg); err != nil {
+			s.logger.Error("Failed to send mail \"%s\" to %s: %v", msg.Subject, msg.To, err)
+		}
+	}()
+}
+
+// sendVerificationEmail отправляет ссылку подтверждения на указанный адрес пользователя
+func (s *Server) sendVerificationEmail(user *User, email string) error {
+	ttl := time.Duration(s.config.EmailVerificationTTLHours) * time.Hour
+	token, err := s.issueUserToken(user.ID, TokenPurposeVerifyEmail, email, ttl)
+	if errors.Is(err, errUserTokenRecentlySent) {
+		s.logger.Info("Verification email for user %d not sent again: previous link is recent", user.ID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	link := s.config.PublicURL + "/verify-email?token=" + url.QueryEscape(token)
+	s.sendMail(Message{
+		To:      email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hello, %s!\n\nConfirm your email address for Obscura by opening the link below:\n\n%s\n\n"+
+			"The link is valid for %d hours. If you did not request this, ignore this email.\n",
+			user.Name, link, s.config.EmailVerificationTTLHours),
+	})
+
+	s.logger.Info("Verification email sent to user %d", user.ID)
+	return nil
+}
+
+// sendPasswordResetEmail отправляет ссылку сброса пароля
+func (s *Server) sendPasswordResetEmail(user *User) error {
+	ttl := time.Duration(s.config.PasswordResetTTLMinutes) * time.Minute
+	token, err := s.issueUserToken(user.ID, TokenPurposeResetPassword, user.Email, ttl)
+	if errors.Is(err, errUserTokenRecentlySent) {
+		s.logger.Info("Password reset email for user %d not sent again: previous link is recent", user.ID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	link := s.config.PublicURL + "/reset-password?token=" + url.QueryEscape(token)
+	s.sendMail(Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello, %s!\n\nA password reset was requested for your Obscura account. Set a new password here:\n\n%s\n\n"+
+			"The link is valid for %d minutes. If you did not request this, ignore this email - your password stays the same.\n",
+			user.Name, link, s.config.PasswordResetTTLMinutes),
+	})
+
+	s.logger.Info("Password reset email sent to user %d", user.ID)
+	return nil
+}
+
+// @Summary Request email verification
+// @Description Send a verification link. Authenticated users get it for their pending or unverified email; anonymous callers pass the email in the body and always receive the same response. Limited per IP (RATE_LIMIT_EMAIL); a repeated request for the same address within a minute sends no new email, the previous link stays valid
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body EmailRequest false "Email address (anonymous requests)"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse "Too many requests from this IP, see Retry-After"
+// @Router /api/email/verify/request [post]
+func (s *Server) handleVerifyEmailRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if userID, err := strconv.Atoi(r.Header.Get("X-User-ID")); err == nil {
+		user, err := s.db.GetUserByID(uint(userID))
+		if err != nil {
+			s.sendError(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		email := user.PendingEmail
+		if email == "" {
+			if user.EmailVerified() {
+				s.sendError(w, "Email is already verified", http.StatusBadRequest)
+				return
+			}
+			email = user.Email
+		}
+
+		if err := s.sendVerificationEmail(user, email); err != nil {
+			s.logger.Error("Failed to issue verification token for user %d: %v", user.ID, err)
+			s.sendError(w, "Failed to send verification email", http.StatusInternalServerError)
+			return
+		}
+
+		s.sendJSON(w, SuccessResponse{Message: "Verification link sent to " + email})
+		return
+	}
+
+	var req EmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := s.validator.ValidateEmail(req.Email); err != nil {
+		s.sendValidationErrors(w, []ValidationError{err.(ValidationError)})
+		return
+	}
+
+	user, err := s.db.GetUserByEmail(strings.TrimSpace(req.Email))
+	if err == nil && !user.EmailVerified() {
+		if err := s.sendVerificationEmail(user, user.Email); err != nil {
+			s.logger.Error("Failed to issue verification token for user %d: %v", user.ID, err)
+		}
+	}
+
+	s.sendJSON(w, SuccessResponse{Message: msgVerificationSent})
+}
+
+// @Summary Confirm email
+// @Description Confirm an email address with the token from the verification link. A pending email change is applied at this point
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body TokenRequest true "Verification token"
+// @Success 200 {object} SuccessResponse{data=User}
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/email/verify/confirm [post]
+func (s *Server) handleVerifyEmailConfirm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	token, user, err := s.consumeUserToken(req.Token, TokenPurposeVerifyEmail)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			s.logger.Error("Failed to verify email token: %v", err)
+		}
+		s.sendError(w, "Invalid or expired verification link", http.StatusBadRequest)
+		return
+	}
+
+	// Ссылка на адрес, от которого пользователь уже отказался, недействительна
+	if token.Email != user.Email && token.Email != user.PendingEmail {
+		s.sendError(w, "Invalid or expired verification link", http.StatusBadRequest)
+		return
+	}
+
+	if token.Email != user.Email {
+		if other, err := s.db.GetUserByEmail(token.Email); err == nil && other.ID != user.ID {
+			s.logger.Warning("Email change of user %d rejected - %s already taken", user.ID, token.Email)
+			s.sendError(w, "Email already taken", http.StatusConflict)
+			return
+		}
+	}
+
+	if err := s.db.MarkEmailVerified(user.ID, token.Email); err != nil {
+		s.logger.Error("Failed to mark email verified for user %d: %v", user.ID, err)
+		s.sendError(w, "Failed to verify email", http.StatusInternalServerError)
+		return
+	}
+
+	if token.Email != user.Email {
+		s.logger.Info("Email of user %d changed from %s to %s", user.ID, user.Email, token.Email)
+	}
+	s.logger.Info("Email verified for user %d", user.ID)
+
+	user, err = s.db.GetUserByID(user.ID)
+	if err != nil {
+		s.sendError(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	s.sendJSON(w, SuccessResponse{
+		Message: "Email verified",
+		Data:    user,
+	})
+}
+
+// @Summary Request password reset
+// @Description Send a password reset link. The response is the same whether or not the account exists. Limited per IP (RATE_LIMIT_EMAIL); a repeated request for the same account within a minute sends no new email, the previous link stays valid
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body EmailRequest true "Account email"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse "Too many requests from this IP, see Retry-After"
+// @Router /api/password/reset/request [post]
+func (s *Server) handlePasswordResetRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req EmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := s.validator.ValidateEmail(req.Email); err != nil {
+		s.sendValidationErrors(w, []ValidationError{err.(ValidationError)})
+		return
+	}
+
+	user, err := s.db.GetUserByEmail(strings.TrimSpace(req.Email))
+	if err == nil && !user.IsSuspended() {
+		if err := s.sendPasswordResetEmail(user); err != nil {
+			s.logger.Error("Failed to issue password reset token for user %d: %v", user.ID, err)
+		}
+	} else {
+		s.logger.Info("Password reset requested for unknown or suspended account")
+	}
+
+	s.sendJSON(w, SuccessResponse{Message: msgPasswordResetSent})
+}
+
+// @Summary Reset password
+// @Description Set a new password with the token from the reset link. All sessions of the account are revoked
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/password/reset/confirm [post]
+func (s *Server) handlePasswordResetConfirm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := s.validator.ValidatePassword(req.Password); err != nil {
+		s.sendValidationErrors(w, []ValidationError{err.(ValidationError)})
+		return
+	}
+
+	token, user, err := s.consumeUserToken(req.Token, TokenPurposeResetPassword)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			s.logger.Error("Failed to check password reset token: %v", err)
+		}
+		s.sendError(w, "Invalid or expired reset link", http.StatusBadRequest)
+		return
+	}
+
+	user.Password = req.Password
+	if err := user.HashPassword(); err != nil {
+		s.logger.Error("Failed to hash new password for user %d: %v", user.ID, err)
+		s.sendError(w, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+
+	// Переход по ссылке из письма подтверждает владение адресом
+	emailVerified := token.Email == user.Email
+	if err := s.db.ResetPassword(user.ID, user.Password, emailVerified, RevokeReasonPasswordReset); err != nil {
+		s.logger.Error("Failed to reset password for user %d: %v", user.ID, err)
+		s.sendError(w, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+
+	s.loginGuard.Unlock(user.Email)
+	s.logger.Info("Password reset for user %d, all sessions revoked", user.ID)
+	s.sendJSON(w, SuccessResponse{Message: "Password has been reset, please log in with the new password"})
+}
@@ -4,26 +4,73 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"obscura.app/pkg/logger"
 )
 
+// anonymousFileMaxAge время жизни анонимных файлов на диске
+const anonymousFileMaxAge = 24 * time.Hour
+
 // FileCleaner структура для очистки файлов
 type FileCleaner struct {
 	uploadPath      string
+	quarantinePath  string
 	cleanupInterval time.Duration
 	maxAge          time.Duration
+	retention       time.Duration // Срок хранения файлов пользователей, 0 - бессрочно
+	db              *Database
 	logger          *logger.Logger
 	stopChan        chan struct{}
+	mu              sync.Mutex // Не даем двум очисткам идти одновременно
+}
+
+// CleanupEntry файл, затронутый очисткой
+// @Description File affected by a cleanup run
+type CleanupEntry struct {
+	Path   string `json:"path" example:"uploads/550e8400-e29b-41d4-a716-446655440000.jpg"`
+	FileID string `json:"file_id,omitempty" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Size   int64  `json:"size" example:"1048576"`
+	Reason string `json:"reason" example:"anonymous"`
+}
+
+// OrphanedRecord запись в БД, для которой нет файла на диске
+// @Description Database row whose blob is missing on disk
+type OrphanedRecord struct {
+	FileID      string `json:"file_id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	UserID      uint   `json:"user_id" example:"1"`
+	MissingBlob string `json:"missing_blob" example:"550e8400-e29b-41d4-a716-446655440000_processed.jpg"`
+}
+
+// CleanupReport результат одного прохода очистки
+// @Description Result of a single cleanup run
+type CleanupReport struct {
+	DryRun          bool             `json:"dry_run" example:"true"`
+	StartedAt       time.Time        `json:"started_at" example:"2025-01-15T09:00:00Z"`
+	DurationMs      int64            `json:"duration_ms" example:"120"`
+	Deleted         []CleanupEntry   `json:"deleted"`
+	DeletedRecords  []string         `json:"deleted_records"`
+	OrphanedRecords []OrphanedRecord `json:"orphaned_records"`
+	DeletedBytes    int64            `json:"deleted_bytes" example:"10485760"`
 }
 
+// Причины удаления файлов
+const (
+	CleanupReasonAnonymous = "anonymous"
+	CleanupReasonExpired   = "retention_expired"
+	CleanupReasonStale     = "stale_blob" // файл записи, на который она больше не ссылается
+)
+
 // NewFileCleaner создает новый file cleaner
-func NewFileCleaner(uploadPath string, logger *logger.Logger) *FileCleaner {
+func NewFileCleaner(uploadPath, quarantinePath string, retention time.Duration, db *Database, logger *logger.Logger) *FileCleaner {
 	return &FileCleaner{
 		uploadPath:      uploadPath,
-		cleanupInterval: 6 * time.Hour,  // Запуск очистки каждые 6 часов
-		maxAge:          24 * time.Hour, // Удаляем файлы старше 24 часов
+		quarantinePath:  quarantinePath,
+		cleanupInterval: 6 * time.Hour,       // Запуск очистки каждые 6 часов
+		maxAge:          anonymousFileMaxAge, // Удаляем файлы старше 24 часов
+		retention:       retention,
+		db:              db,
 		logger:          logger,
 		stopChan:        make(chan struct{}),
 	}
@@ -31,7 +78,7 @@ func NewFileCleaner(uploadPath string, logger *logger.Logger) *FileCleaner {
 
 // Start запускает автоматическую очистку файлов
 func (fc *FileCleaner) Start() {
-	fc.logger.Info("File cleaner started with interval: %v, max age: %v", fc.cleanupInterval, fc.maxAge)
+	fc.logger.Info("File cleaner started with interval: %v, max age: %v, retention: %v", fc.cleanupInterval, fc.maxAge, fc.retention)
 
 	// Запускаем первую очистку сразу
 	go fc.cleanupOnce()
@@ -64,106 +111,227 @@ func (fc *FileCleaner) run() {
 
 // cleanupOnce выполняет одну итерацию очистки
 func (fc *FileCleaner) cleanupOnce() {
-	fc.logger.Debug("Starting file cleanup process...")
+	if _, err := fc.Cleanup(false); err != nil {
+		fc.logger.Error("Error during file cleanup: %v", err)
+	}
+}
 
-	start := time.Now()
-	deletedCount := 0
-	totalSize := int64(0)
-	processedDeletedCount := 0
-	processedTotalSize := int64(0)
+// Cleanup выполняет проход очистки. В режиме dryRun ничего не удаляет,
+// а только возвращает отчет о том, что было бы удалено
+func (fc *FileCleaner) Cleanup(dryRun bool) (*CleanupReport, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
 
-	err := filepath.Walk(fc.uploadPath, func(path string, info os.FileInfo, err error) error {
+	fc.logger.Debug("Starting file cleanup process (dry run: %v)...", dryRun)
+
+	report := &CleanupReport{
+		DryRun:          dryRun,
+		StartedAt:       time.Now(),
+		Deleted:         []CleanupEntry{},
+		DeletedRecords:  []string{},
+		OrphanedRecords: []OrphanedRecord{},
+	}
+
+	// Собираем все файлы, которые принадлежат записям в БД
+	files, err := fc.db.GetAllFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	records := make(map[string]*File, len(files))
+	owners := make(map[string]*File, len(files)*2)
+	for i := range files {
+		records[files[i].ID] = &files[i]
+		for _, name := range files[i].BlobNames() {
+			owners[name] = &files[i]
+		}
+	}
+
+	expired := make(map[string]bool)
+	onDisk := make(map[string]bool)
+
+	err = filepath.Walk(fc.uploadPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			fc.logger.Warning("Error accessing file %s: %v", path, err)
 			return nil // Продолжаем обход
 		}
 
-		// Пропускаем директории
+		// Пропускаем директории, карантин не трогаем
 		if info.IsDir() {
+			if isSameDir(path, fc.quarantinePath) {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
-		// Проверяем возраст файла
-		if time.Since(info.ModTime()) > fc.maxAge {
-			filename := filepath.Base(path)
+		filename := filepath.Base(path)
+		onDisk[filename] = true
+
+		if owner, ok := owners[filename]; ok {
+			// Файл принадлежит пользователю - удаляем только по истечении срока хранения
+			if fc.isExpired(owner) {
+				report.Deleted = append(report.Deleted, CleanupEntry{
+					Path:   path,
+					FileID: owner.ID,
+					Size:   info.Size(),
+					Reason: CleanupReasonExpired,
+				})
+				expired[owner.ID] = true
+			}
+			return nil
+		}
 
-			// Проверяем, является ли файл анонимным (не в БД)
-			if fc.isAnonymousFile(filename) {
-				isProcessed := strings.Contains(filename, "_processed")
-
-				fc.logger.Debug("Deleting old anonymous file: %s (age: %v, size: %d bytes, processed: %v)",
-					path, time.Since(info.ModTime()), info.Size(), isProcessed)
-
-				if err := os.Remove(path); err != nil {
-					fc.logger.Error("Failed to delete file %s: %v", path, err)
-				} else {
-					if isProcessed {
-						processedDeletedCount++
-						processedTotalSize += info.Size()
-					} else {
-						deletedCount++
-						totalSize += info.Size()
-					}
-				}
+		fileID := fileIDFromBlobName(filename)
+		if fileID == "" {
+			return nil
+		}
+
+		// Файл записи, на который она больше не ссылается (например, миниатюра до повторной обработки).
+		// Удаляется вместе с истекшей записью или после maxAge
+		if owner, ok := records[fileID]; ok {
+			reason := CleanupReasonStale
+			if fc.isExpired(owner) {
+				reason = CleanupReasonExpired
+				expired[owner.ID] = true
+			} else if time.Since(info.ModTime()) <= fc.maxAge {
+				return nil
 			}
+			report.Deleted = append(report.Deleted, CleanupEntry{
+				Path:   path,
+				FileID: owner.ID,
+				Size:   info.Size(),
+				Reason: reason,
+			})
+			return nil
+		}
+
+		// Файл без записи в БД - анонимный, удаляем после maxAge
+		if time.Since(info.ModTime()) > fc.maxAge {
+			report.Deleted = append(report.Deleted, CleanupEntry{
+				Path:   path,
+				FileID: fileID,
+				Size:   info.Size(),
+				Reason: CleanupReasonAnonymous,
+			})
 		}
 
 		return nil
 	})
 
 	if err != nil {
-		fc.logger.Error("Error during file cleanup: %v", err)
-		return
+		return nil, err
+	}
+
+	// Записи, у которых пропали файлы на диске
+	for _, file := range files {
+		// Зараженные файлы перенесены в карантин при загрузке
+		if file.Status == StatusQuarantined {
+			continue
+		}
+		if !onDisk[file.FileName] {
+			report.OrphanedRecords = append(report.OrphanedRecords, OrphanedRecord{
+				FileID:      file.ID,
+				UserID:      file.UserID,
+				MissingBlob: file.FileName,
+			})
+		}
+		if file.ProcessedName != "" && !onDisk[file.ProcessedName] {
+			report.OrphanedRecords = append(report.OrphanedRecords, OrphanedRecord{
+				FileID:      file.ID,
+				UserID:      file.UserID,
+				MissingBlob: file.ProcessedName,
+			})
+		}
+	}
+
+	// Записи с истекшим сроком хранения удаляются вместе с файлами
+	for _, file := range files {
+		if fc.isExpired(&file) {
+			expired[file.ID] = true
+		}
 	}
 
-	duration := time.Since(start)
-	totalDeleted := deletedCount + processedDeletedCount
-	totalDeletedSize := totalSize + processedTotalSize
+	// Запись удаляется, только если удалены все ее файлы, иначе они остались бы на диске без владельца
+	deleted := report.Deleted[:0]
+	for _, entry := range report.Deleted {
+		if !dryRun {
+			fc.logger.Debug("Deleting file: %s (size: %d bytes, reason: %s)", entry.Path, entry.Size, entry.Reason)
+			if err := os.Remove(entry.Path); err != nil && !os.IsNotExist(err) {
+				fc.logger.Error("Failed to delete file %s: %v", entry.Path, err)
+				if entry.Reason == CleanupReasonExpired {
+					expired[entry.FileID] = false
+				}
+				continue
+			}
+		}
+		deleted = append(deleted, entry)
+		report.DeletedBytes += entry.Size
+	}
+	report.Deleted = deleted
 
-	if totalDeleted > 0 {
-		fc.logger.Info("File cleanup completed: deleted %d files (%.2f MB) in %v - original: %d (%.2f MB), processed: %d (%.2f MB)",
-			totalDeleted, float64(totalDeletedSize)/(1024*1024), duration,
-			deletedCount, float64(totalSize)/(1024*1024),
-			processedDeletedCount, float64(processedTotalSize)/(1024*1024))
+	for fileID, removable := range expired {
+		if !removable {
+			fc.logger.Warning("Keeping expired file record %s: some of its files could not be deleted", fileID)
+			continue
+		}
+		if !dryRun {
+			if err := fc.db.DeleteFile(fileID); err != nil {
+				fc.logger.Error("Failed to delete expired file record %s: %v", fileID, err)
+				continue
+			}
+		}
+		report.DeletedRecords = append(report.DeletedRecords, fileID)
+	}
+
+	report.DurationMs = time.Since(report.StartedAt).Milliseconds()
+
+	if len(report.OrphanedRecords) > 0 {
+		fc.logger.Warning("File cleanup found %d database records with missing blobs", len(report.OrphanedRecords))
+	}
+
+	if len(report.Deleted) > 0 || len(report.DeletedRecords) > 0 {
+		fc.logger.Info("File cleanup completed (dry run: %v): deleted %d files (%.2f MB) and %d records in %dms",
+			dryRun, len(report.Deleted), float64(report.DeletedBytes)/(1024*1024), len(report.DeletedRecords), report.DurationMs)
 	} else {
-		fc.logger.Debug("File cleanup completed: no files to delete (took %v)", duration)
+		fc.logger.Debug("File cleanup completed: no files to delete (took %dms)", report.DurationMs)
 	}
+
+	return report, nil
 }
 
-// isAnonymousFile проверяет, является ли файл анонимным
-// Анонимные файлы имеют имена в формате UUID.extension или UUID_processed.extension и не сохраняются в БД
-func (fc *FileCleaner) isAnonymousFile(filename string) bool {
-	// Убираем _processed если есть
-	baseName := strings.Replace(filename, "_processed", "", 1)
+// isExpired проверяет, истек ли срок хранения файла пользователя
+func (fc *FileCleaner) isExpired(file *File) bool {
+	return fc.retention > 0 && time.Since(file.UploadedAt) > fc.retention
+}
 
-	// Проверяем, что это файл с UUID именем
-	// UUID имеет формат: xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx (36 символов)
-	parts := strings.Split(baseName, ".")
-	if len(parts) < 2 {
-		return false
+// fileIDFromBlobName извлекает UUID файла из имени blob'а: UUID.ext или UUID_<суффикс>.ext
+// (_processed, _thumb, _preview, _source, _temp и т.д.). Возвращает пустую строку,
+// если имя не соответствует формату
+func fileIDFromBlobName(filename string) string {
+	// UUID имеет формат: xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx (36 символов) и стоит до первого '_' или '.'
+	end := strings.IndexAny(filename, "_.")
+	if end < 0 {
+		return ""
 	}
 
-	nameWithoutExt := parts[0]
+	nameWithoutExt := filename[:end]
 	if len(nameWithoutExt) != 36 {
-		return false
+		return ""
 	}
 
 	// Проверяем формат UUID (8-4-4-4-12)
 	uuidParts := strings.Split(nameWithoutExt, "-")
 	if len(uuidParts) != 5 {
-		return false
+		return ""
 	}
 
 	if len(uuidParts[0]) != 8 || len(uuidParts[1]) != 4 ||
 		len(uuidParts[2]) != 4 || len(uuidParts[3]) != 4 ||
 		len(uuidParts[4]) != 12 {
-		return false
+		return ""
 	}
 
-	// Все файлы с UUID именами считаем потенциально анонимными
-	// В реальном приложении здесь можно было бы проверить БД,
-	// но для простоты считаем, что все UUID файлы старше 24 часов - анонимные
-	return true
+	return nameWithoutExt
 }
 
 // GetStats возвращает статистику файлов
@@ -172,6 +340,7 @@ func (fc *FileCleaner) GetStats() (map[string]interface{}, error) {
 		"upload_path":          fc.uploadPath,
 		"cleanup_interval_h":   fc.cleanupInterval.Hours(),
 		"max_age_h":            fc.maxAge.Hours(),
+		"retention_h":          fc.retention.Hours(),
 		"total_files":          0,
 		"original_files":       0,
 		"processed_files":      0,
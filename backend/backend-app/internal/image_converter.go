@@ -0,0 +1,188 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"obscura.app/pkg/logger"
+)
+
+// Формат обработанного изображения
+const (
+	OutputFormatOriginal = "original" // как у загруженного файла
+	OutputFormatJPEG     = "jpeg"
+)
+
+// Изображения, которые не декодируются в Go и обрабатываются через JPEG копию
+var convertedMimeTypes = []string{"image/heic", "image/heif", "image/avif"}
+
+// errNoImageConverter внешний конвертер изображений не настроен
+var errNoImageConverter = errors.New("image converter is not configured")
+
+// needsConversion проверяет, что изображение нужно конвертировать в JPEG перед обработкой
+func needsConversion(mimeType string) bool {
+	return slices.Contains(convertedMimeTypes, mimeType)
+}
+
+// ImageConverter конвертирует изображения между форматами, которые Go не умеет кодировать или декодировать
+type ImageConverter interface {
+	// Convert конвертирует файл src в dst. Формат результата определяется расширением dst
+	Convert(ctx context.Context, src, dst string) error
+}
+
+// CommandImageConverter запускает внешнюю программу по шаблону команды с подстановками {input} и {output},
+// например "magick {input} -quality 92 {output}" (ImageMagick, собранный с libheif)
+type CommandImageConverter struct {
+	args    []string
+	timeout time.Duration
+}
+
+// NewCommandImageConverter создает конвертер. Пустая команда отключает конвертацию (возвращается nil)
+func NewCommandImageConverter(command string, timeout time.Duration) (*CommandImageConverter, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, nil
+	}
+	if !slices.Contains(args, "{input}") || !slices.Contains(args, "{output}") {
+		return nil, fmt.Errorf("image convert command must contain {input} and {output}: %q", command)
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return nil, fmt.Errorf("image convert command %q not found: %w", args[0], err)
+	}
+
+	return &CommandImageConverter{args: args, timeout: timeout}, nil
+}
+
+// Convert запускает команду конвертации
+func (c *CommandImageConverter) Convert(ctx context.Context, src, dst string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	args := make([]string, len(c.args))
+	for i, arg := range c.args {
+		args[i] = strings.NewReplacer("{input}", src, "{output}", dst).Replace(arg)
+	}
+
+	output, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		os.Remove(dst)
+		return fmt.Errorf("%s failed: %w: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// newImageConverter создает конвертер по конфигурации. Недоступная программа конвертации
+// не мешает запуску: HEIC/HEIF и AVIF просто не принимаются
+func newImageConverter(config *Config, logger *logger.Logger) ImageConverter {
+	converter, err := NewCommandImageConverter(config.ImageConvertCommand, time.Duration(config.ImageConvertTimeout)*time.Second)
+	if err != nil {
+		logger.Warning("HEIC/HEIF and AVIF uploads are disabled: %v", err)
+		return nil
+	}
+	if converter == nil {
+		logger.Info("HEIC/HEIF and AVIF uploads are disabled: IMAGE_CONVERT_COMMAND is empty")
+		return nil
+	}
+	return converter
+}
+
+// convertSource создает JPEG копию изображения для обработки. Копию нужно удалить после обработки
+func (s *Server) convertSource(fileID, filePath string) (string, error) {
+	if s.converter == nil {
+		return "", errNoImageConverter
+	}
+
+	converted := filepath.Join(s.config.UploadPath, fileID+"_source.jpg")
+	if err := s.converter.Convert(context.Background(), filePath, converted); err != nil {
+		return "", err
+	}
+
+	s.logger.Debug("Converted %s to JPEG for processing", filepath.Base(filePath))
+	return converted, nil
+}
+
+// convertOutput приводит обработанное изображение к формату, выбранному пользователем:
+// формату загруженного файла originalPath или JPEG. Если конвертировать не удалось, остается результат обработки.
+// Возвращает имя и размер итогового файла
+func (s *Server) convertOutput(fileID, originalPath, processedName string, processedSize int64, options ProcessingOptions) (string, int64) {
+	targetMime := s.determineMimeTypeFromPath(originalPath)
+	if isVideoMimeType(targetMime) {
+		return processedName, processedSize
+	}
+	if options.OutputFormat == OutputFormatJPEG {
+		targetMime = "image/jpeg"
+	}
+
+	targetName := fileID + "_processed" + extensionForMimeType(targetMime)
+	if s.determineMimeTypeFromPath(processedName) == targetMime || targetName == processedName {
+		return processedName, processedSize
+	}
+
+	processedPath := filepath.Join(s.config.UploadPath, processedName)
+	targetPath := filepath.Join(s.config.UploadPath, targetName)
+
+	var err error
+	if targetMime == "image/jpeg" && !needsConversion(s.determineMimeTypeFromPath(processedName)) {
+		err = encodeJPEG(processedPath, targetPath)
+	} else if s.converter != nil {
+		err = s.converter.Convert(context.Background(), processedPath, targetPath)
+	} else {
+		err = errNoImageConverter
+	}
+	if err != nil {
+		s.logger.Warning("Failed to convert processed file %s to %s, keeping %s: %v", fileID, targetMime, processedName, err)
+		return processedName, processedSize
+	}
+
+	stat, err := os.Stat(targetPath)
+	if err != nil {
+		s.logger.Warning("Converted file %s is missing, keeping %s: %v", targetName, processedName, err)
+		return processedName, processedSize
+	}
+
+	os.Remove(processedPath)
+	s.logger.Debug("Processed file %s converted to %s", fileID, targetMime)
+	return targetName, stat.Size()
+}
+
+// encodeJPEG перекодирует изображение, которое декодируется в Go, в JPEG
+func encodeJPEG(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	img, _, err := image.Decode(in)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if err := jpeg.Encode(out, img, &jpeg.Options{Quality: 92}); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+// extensionForMimeType возвращает расширение файла для MIME типа изображения
+func extensionForMimeType(mimeType string) string {
+	if mimeType == "image/jpeg" {
+		return ".jpg"
+	}
+	return "." + strings.TrimPrefix(mimeType, "image/")
+}
@@ -0,0 +1,341 @@
+package internal
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"obscura.app/pkg/logger"
+)
+
+// Поддерживаемые алгоритмы подписи токенов
+const (
+	JWTAlgorithmHS256 = "HS256"
+	JWTAlgorithmRS256 = "RS256"
+	JWTAlgorithmEdDSA = "EdDSA"
+)
+
+// Допустимое расхождение часов при проверке exp и iat
+const jwtLeeway = 30 * time.Second
+
+// verificationKey ключ проверки подписи
+type verificationKey struct {
+	method jwt.SigningMethod
+	key    interface{}
+}
+
+// TokenSigner выпускает и проверяет токены сервиса. Подписывает текущим ключом,
+// а принимает подписи всех ключей из набора, что позволяет менять ключи без разлогинивания.
+// Открытые ключи публикуются в /.well-known/jwks.json для других сервисов
+type TokenSigner struct {
+	method   jwt.SigningMethod
+	keyID    string
+	signKey  interface{}
+	keys     map[string]verificationKey
+	jwks     []jsonWebKey
+	issuer   string
+	audience string
+}
+
+// NewTokenSigner загружает ключи подписи по конфигурации
+func NewTokenSigner(config *Config, logger *logger.Logger) (*TokenSigner, error) {
+	signer := &TokenSigner{
+		keys:     make(map[string]verificationKey),
+		issuer:   config.JWTIssuer,
+		audience: config.JWTAudience,
+	}
+
+	switch config.JWTAlgorithm {
+	case JWTAlgorithmHS256:
+		// Общий секрет не публикуется в JWKS: такие токены может проверить только этот сервис
+		signer.method = jwt.SigningMethodHS256
+		signer.keyID = "hs256"
+		signer.signKey = []byte(config.JWTSecret)
+		signer.keys[signer.keyID] = verificationKey{method: jwt.SigningMethodHS256, key: signer.signKey}
+		return signer, nil
+	case JWTAlgorithmRS256, JWTAlgorithmEdDSA:
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", config.JWTAlgorithm)
+	}
+
+	var private crypto.Signer
+	if config.JWTPrivateKeyFile != "" {
+		key, err := loadPrivateKey(config.JWTPrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		private = key
+	} else if config.IsDevelopment() {
+		key, err := generateSigningKey(config.JWTAlgorithm)
+		if err != nil {
+			return nil, err
+		}
+		logger.Warning("JWT_PRIVATE_KEY_FILE is not set, using an ephemeral %s key - tokens will not survive a restart", config.JWTAlgorithm)
+		private = key
+	} else {
+		return nil, errors.New("JWT_PRIVATE_KEY_FILE is required for asymmetric JWT signing")
+	}
+
+	method, err := methodForKey(private.Public())
+	if err != nil {
+		return nil, err
+	}
+	if method.Alg() != config.JWTAlgorithm {
+		return nil, fmt.Errorf("JWT private key does not match algorithm %s", config.JWTAlgorithm)
+	}
+
+	signer.method = method
+	signer.signKey = private
+	signer.keyID = config.JWTKeyID
+	if signer.keyID == "" {
+		signer.keyID = keyThumbprint(private.Public())
+	}
+	if err := signer.addVerificationKey(signer.keyID, private.Public()); err != nil {
+		return nil, err
+	}
+
+	// Предыдущие ключи, которыми еще могут быть подписаны действующие токены
+	for _, entry := range config.JWTVerificationKeys {
+		kid, path, hasKid := strings.Cut(entry, "=")
+		if !hasKid {
+			kid, path = "", entry
+		}
+
+		public, err := loadPublicKey(path)
+		if err != nil {
+			return nil, err
+		}
+		if kid == "" {
+			kid = keyThumbprint(public)
+		}
+		if err := signer.addVerificationKey(kid, public); err != nil {
+			return nil, err
+		}
+	}
+
+	return signer, nil
+}
+
+func (t *TokenSigner) addVerificationKey(kid string, public crypto.PublicKey) error {
+	if _, exists := t.keys[kid]; exists {
+		return fmt.Errorf("duplicate JWT key id %q", kid)
+	}
+
+	method, err := methodForKey(public)
+	if err != nil {
+		return err
+	}
+
+	jwk := publicJWK(public)
+	jwk.Kid = kid
+	jwk.Use = "sig"
+	jwk.Alg = method.Alg()
+
+	t.keys[kid] = verificationKey{method: method, key: public}
+	t.jwks = append(t.jwks, jwk)
+	return nil
+}
+
+// Sign подписывает токен текущим ключом, добавляя iss, aud, iat, exp и jti
+func (t *TokenSigner) Sign(claims jwt.MapClaims, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims["iss"] = t.issuer
+	claims["aud"] = t.audience
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(ttl).Unix()
+	claims["jti"] = uuid.New().String()
+
+	token := jwt.NewWithClaims(t.method, claims)
+	token.Header["kid"] = t.keyID
+	return token.SignedString(t.signKey)
+}
+
+// Parse проверяет подпись по kid, срок действия, издателя и получателя токена
+func (t *TokenSigner) Parse(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := t.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		// Алгоритм берется из ключа, а не из заголовка токена
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.key, nil
+	},
+		jwt.WithValidMethods([]string{JWTAlgorithmHS256, JWTAlgorithmRS256, JWTAlgorithmEdDSA}),
+		jwt.WithIssuer(t.issuer),
+		jwt.WithAudience(t.audience),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(jwtLeeway),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token claims")
+	}
+	if jti, _ := claims["jti"].(string); jti == "" {
+		return nil, errors.New("token has no jti")
+	}
+	if _, ok := claims["iat"]; !ok {
+		return nil, errors.New("token has no iat")
+	}
+	return claims, nil
+}
+
+// @Summary JSON Web Key Set
+// @Description Public keys for verifying access tokens issued by this service (empty when tokens are signed with a shared HS256 secret)
+// @Tags auth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /.well-known/jwks.json [get]
+func (s *Server) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	keys := s.signer.jwks
+	if keys == nil {
+		keys = []jsonWebKey{}
+	}
+
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys}); err != nil {
+		s.logger.Error("Failed to encode JWKS: %v", err)
+	}
+}
+
+// methodForKey возвращает алгоритм подписи для типа ключа
+func methodForKey(public crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch public.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("unsupported JWT key type %T", public)
+	}
+}
+
+// generateSigningKey создает временный ключ для режима разработки
+func generateSigningKey(algorithm string) (crypto.Signer, error) {
+	if algorithm == JWTAlgorithmEdDSA {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+	return rsa.GenerateKey(rand.Reader, 2048)
+}
+
+// loadPrivateKey читает закрытый ключ из PEM (PKCS#8 или PKCS#1)
+func loadPrivateKey(path string) (crypto.Signer, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JWT private key %s: %w", path, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported JWT private key type %T", key)
+	}
+	return signer, nil
+}
+
+// loadPublicKey читает открытый ключ из PEM. Подходит и файл закрытого ключа
+func loadPublicKey(path string) (crypto.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if block.Type == "PUBLIC KEY" {
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JWT public key %s: %w", path, err)
+		}
+		return key, nil
+	}
+
+	private, err := loadPrivateKey(path)
+	if err != nil {
+		return nil, err
+	}
+	return private.Public(), nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWT key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", path)
+	}
+	return block, nil
+}
+
+// publicJWK представляет открытый ключ в формате JWK
+func publicJWK(public crypto.PublicKey) jsonWebKey {
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		return jsonWebKey{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		return jsonWebKey{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(key),
+		}
+	default:
+		return jsonWebKey{}
+	}
+}
+
+// keyThumbprint вычисляет отпечаток ключа по RFC 7638, используется как kid по умолчанию
+func keyThumbprint(public crypto.PublicKey) string {
+	jwk := publicJWK(public)
+
+	var canonical string
+	switch jwk.Kty {
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, jwk.E, jwk.N)
+	case "OKP":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, jwk.Crv, jwk.X)
+	}
+
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"context"
+	"time"
+
+	"obscura.app/pkg/logger"
+)
+
+// PostgresLimiterStore счетчики в основной базе данных. Запасной вариант для
+// нескольких реплик без Redis: каждый запрос стоит одной транзакции
+type PostgresLimiterStore struct {
+	db     *Database
+	logger *logger.Logger
+}
+
+// NewPostgresLimiterStore создает хранилище в PostgreSQL. Клиенты, не обращавшиеся дольше idleTTL, удаляются
+func NewPostgresLimiterStore(db *Database, idleTTL time.Duration, logger *logger.Logger) *PostgresLimiterStore {
+	store := &PostgresLimiterStore{
+		db:     db,
+		logger: logger,
+	}
+
+	go store.cleanup(idleTTL)
+
+	return store
+}
+
+// Consume расходует лимит клиента
+func (s *PostgresLimiterStore) Consume(_ context.Context, key string, cost, limit int, window time.Duration) (LimitResult, error) {
+	return s.db.ConsumeRateLimit(key, cost, limit, window)
+}
+
+// TakeToken берет токен из корзины клиента
+func (s *PostgresLimiterStore) TakeToken(_ context.Context, key string, capacity int, window time.Duration) (LimitResult, error) {
+	return s.db.TakeRateLimitToken(key, capacity, window)
+}
+
+// LogHit учитывает запрос в скользящем окне
+func (s *PostgresLimiterStore) LogHit(_ context.Context, key string, limit int, window time.Duration) (LimitResult, error) {
+	return s.db.LogRateLimitHit(key, limit, window)
+}
+
+// cleanup удаляет счетчики неактивных клиентов. Каждая реплика запускает свою очистку,
+// повторное удаление безопасно
+func (s *PostgresLimiterStore) cleanup(idleTTL time.Duration) {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		deleted, err := s.db.DeleteIdleRateLimits(time.Now().Add(-idleTTL))
+		if err != nil {
+			s.logger.Warning("Failed to clean up rate limit counters: %v", err)
+			continue
+		}
+		if deleted > 0 {
+			s.logger.Debug("Removed %d idle rate limit counters", deleted)
+		}
+	}
+}
+
+// Stats возвращает статистику хранилища
+func (s *PostgresLimiterStore) Stats(_ context.Context) map[string]interface{} {
+	stats := map[string]interface{}{
+		"store": LimiterStorePostgres,
+	}
+	if count, err := s.db.CountRateLimits(); err == nil {
+		stats["total_clients"] = count
+	} else {
+		stats["error"] = err.Error()
+	}
+	return stats
+}
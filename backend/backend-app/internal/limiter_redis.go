@@ -0,0 +1,202 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Префикс ключей счетчиков в Redis
+const redisLimiterPrefix = "obscura:ratelimit:"
+
+// fixedWindowScript атомарно увеличивает счетчик окна на стоимость запроса. Окно начинается
+// с первого запроса и заканчивается вместе со сроком жизни ключа. Отклоненный запрос откатывается,
+// возврат единиц (отрицательная стоимость) не опускает счетчик ниже нуля.
+// Возвращает {разрешен (0/1), счетчик, миллисекунды до сброса окна}
+var fixedWindowScript = redis.NewScript(`
+local cost = tonumber(ARGV[3])
+local count = redis.call('INCRBY', KEYS[1], cost)
+if count < 0 then
+	redis.call('INCRBY', KEYS[1], -count)
+	count = 0
+end
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	ttl = tonumber(ARGV[2])
+end
+if count > tonumber(ARGV[1]) then
+	redis.call('DECRBY', KEYS[1], cost)
+	return {0, count - cost, ttl}
+end
+return {1, count, ttl}
+`)
+
+// tokenBucketScript атомарно пополняет корзину за прошедшее время и берет из нее токен.
+// Уровень корзины хранится целым числом в долях токена: токен равен window единицам, за миллисекунду
+// добавляется capacity единиц, поэтому пополнение считается без округлений.
+// Время берется у Redis (TIME): часы реплик сервиса могут расходиться.
+// Возвращает {разрешен, остаток, миллисекунды до полного пополнения, миллисекунды до следующего токена}
+var tokenBucketScript = redis.NewScript(`
+redis.replicate_commands()
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local capacity = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local full = capacity * window
+
+local state = redis.call('HMGET', KEYS[1], 'level', 'ts')
+local level = tonumber(state[1])
+local ts = tonumber(state[2])
+if level == nil or ts == nil then
+	level = full
+	ts = now
+end
+level = math.min(full, level + math.max(0, now - ts) * capacity)
+
+local allowed = 0
+local retry = 0
+if level >= window then
+	level = level - window
+	allowed = 1
+else
+	retry = math.ceil((window - level) / capacity)
+end
+
+redis.call('HSET', KEYS[1], 'level', string.format('%.0f', level), 'ts', string.format('%.0f', now))
+redis.call('PEXPIRE', KEYS[1], window)
+return {allowed, math.floor(level / window), math.ceil((full - level) / capacity), retry}
+`)
+
+// slidingLogScript хранит журнал запросов в sorted set с временем запроса в качестве веса.
+// Время берется у Redis (TIME), поэтому веса записей разных реплик сравнимы между собой.
+// Возвращает {разрешен, запросов в окне, миллисекунды до освобождения окна, миллисекунды до следующего запроса}
+var slidingLogScript = redis.NewScript(`
+redis.replicate_commands()
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+
+local allowed = 0
+local retry = 0
+if count < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[3])
+	count = count + 1
+	allowed = 1
+else
+	-- Запрос пройдет, когда в окне останется limit - 1 запросов: для этого должны истечь
+	-- count - limit + 1 самых старых. Ждем, пока истечет последний из них
+	local blocking = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', '+inf', 'WITHSCORES', 'LIMIT', count - limit, 1)
+	if blocking[2] then
+		retry = math.max(1, tonumber(blocking[2]) + window - now)
+	else
+		retry = window
+	end
+end
+
+local reset = 0
+local newest = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+if newest[2] then
+	reset = tonumber(newest[2]) + window - now
+end
+
+redis.call('PEXPIRE', KEYS[1], window)
+return {allowed, count, reset, retry}
+`)
+
+// RedisLimiterStore счетчики в Redis, общие для всех реплик сервиса
+type RedisLimiterStore struct {
+	client *redis.Client
+}
+
+// NewRedisLimiterStore подключается к Redis по URL вида redis://[:пароль@]хост:порт/база
+func NewRedisLimiterStore(url string) (*RedisLimiterStore, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+
+	client := redis.NewClient(options)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	return &RedisLimiterStore{client: client}, nil
+}
+
+// Consume расходует лимит клиента
+func (s *RedisLimiterStore) Consume(ctx context.Context, key string, cost, limit int, window time.Duration) (LimitResult, error) {
+	values, err := fixedWindowScript.Run(ctx, s.client, []string{redisLimiterPrefix + key}, limit, window.Milliseconds(), cost).Int64Slice()
+	if err != nil {
+		return LimitResult{}, err
+	}
+	if len(values) != 3 {
+		return LimitResult{}, fmt.Errorf("unexpected rate limit script result %v", values)
+	}
+
+	return fixedWindowResult(values[0] == 1, int(values[1]), limit, time.Duration(values[2])*time.Millisecond), nil
+}
+
+// TakeToken берет токен из корзины клиента
+func (s *RedisLimiterStore) TakeToken(ctx context.Context, key string, capacity int, window time.Duration) (LimitResult, error) {
+	values, err := tokenBucketScript.Run(ctx, s.client, []string{redisLimiterPrefix + key},
+		capacity, window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return LimitResult{}, err
+	}
+	if len(values) != 4 {
+		return LimitResult{}, fmt.Errorf("unexpected token bucket script result %v", values)
+	}
+
+	return LimitResult{
+		Allowed:    values[0] == 1,
+		Count:      capacity - int(values[1]),
+		Remaining:  int(values[1]),
+		Reset:      time.Duration(values[2]) * time.Millisecond,
+		RetryAfter: time.Duration(values[3]) * time.Millisecond,
+	}, nil
+}
+
+// LogHit учитывает запрос в скользящем окне
+func (s *RedisLimiterStore) LogHit(ctx context.Context, key string, limit int, window time.Duration) (LimitResult, error) {
+	values, err := slidingLogScript.Run(ctx, s.client, []string{redisLimiterPrefix + key},
+		limit, window.Milliseconds(), uuid.New().String()).Int64Slice()
+	if err != nil {
+		return LimitResult{}, err
+	}
+	if len(values) != 4 {
+		return LimitResult{}, fmt.Errorf("unexpected sliding window script result %v", values)
+	}
+
+	return LimitResult{
+		Allowed:    values[0] == 1,
+		Count:      int(values[1]),
+		Remaining:  max(limit-int(values[1]), 0),
+		Reset:      time.Duration(values[2]) * time.Millisecond,
+		RetryAfter: time.Duration(values[3]) * time.Millisecond,
+	}, nil
+}
+
+// Stats возвращает статистику хранилища. Ключи не пересчитываются: на большом Redis это дорого
+func (s *RedisLimiterStore) Stats(ctx context.Context) map[string]interface{} {
+	stats := map[string]interface{}{
+		"store":     LimiterStoreRedis,
+		"connected": true,
+	}
+	if err := s.client.Ping(ctx).Err(); err != nil {
+		stats["connected"] = false
+		stats["error"] = err.Error()
+	}
+	return stats
+}
@@ -0,0 +1,199 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// testRedis miniredis с управляемыми часами: TIME в скриптах и сроки жизни ключей сдвигаются вместе
+type testRedis struct {
+	server *miniredis.Miniredis
+	now    time.Time
+}
+
+func newTestRedisLimiterStore(t *testing.T) (*RedisLimiterStore, *testRedis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	clock := &testRedis{server: server, now: time.UnixMilli(1_700_000_000_000)}
+	server.SetTime(clock.now)
+
+	store, err := NewRedisLimiterStore("redis://" + server.Addr() + "/0")
+	if err != nil {
+		t.Fatalf("NewRedisLimiterStore: %v", err)
+	}
+	t.Cleanup(func() { store.client.Close() })
+
+	return store, clock
+}
+
+func (r *testRedis) advance(d time.Duration) {
+	r.now = r.now.Add(d)
+	r.server.SetTime(r.now)
+	r.server.FastForward(d)
+}
+
+type limitExpectation struct {
+	allowed    bool
+	remaining  int
+	retryAfter time.Duration
+	reset      time.Duration
+}
+
+func checkLimit(t *testing.T, step string, result LimitResult, err error, want limitExpectation) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("%s: %v", step, err)
+	}
+	if result.Allowed != want.allowed || result.Remaining != want.remaining || result.RetryAfter != want.retryAfter {
+		t.Fatalf("%s: got allowed=%v remaining=%d retry=%v, want allowed=%v remaining=%d retry=%v",
+			step, result.Allowed, result.Remaining, result.RetryAfter, want.allowed, want.remaining, want.retryAfter)
+	}
+	if want.reset != 0 && result.Reset != want.reset {
+		t.Fatalf("%s: reset = %v, want %v", step, result.Reset, want.reset)
+	}
+}
+
+func TestRedisLimiterFixedWindow(t *testing.T) {
+	store, clock := newTestRedisLimiterStore(t)
+	ctx := context.Background()
+	consume := func(cost int) (LimitResult, error) {
+		return store.Consume(ctx, "upload:1", cost, 3, time.Minute)
+	}
+
+	result, err := consume(1)
+	checkLimit(t, "first", result, err, limitExpectation{allowed: true, remaining: 2, reset: time.Minute})
+	result, err = consume(2)
+	checkLimit(t, "second", result, err, limitExpectation{allowed: true, remaining: 0})
+
+	result, err = consume(1)
+	checkLimit(t, "over limit", result, err, limitExpectation{allowed: false, remaining: 0, retryAfter: time.Minute})
+
+	clock.advance(20 * time.Second)
+	result, err = consume(1)
+	checkLimit(t, "still over limit", result, err, limitExpectation{allowed: false, remaining: 0, retryAfter: 40 * time.Second})
+
+	// Отклоненные запросы лимит не расходуют: после окна счетчик начинается заново
+	clock.advance(40 * time.Second)
+	result, err = consume(1)
+	checkLimit(t, "new window", result, err, limitExpectation{allowed: true, remaining: 2, reset: time.Minute})
+}
+
+func TestRedisLimiterFixedWindowRefund(t *testing.T) {
+	store, clock := newTestRedisLimiterStore(t)
+	ctx := context.Background()
+	consume := func(cost int) (LimitResult, error) {
+		return store.Consume(ctx, "budget:user:1", cost, 10, time.Minute)
+	}
+
+	result, err := consume(8)
+	checkLimit(t, "charge", result, err, limitExpectation{allowed: true, remaining: 2})
+	result, err = consume(-5)
+	checkLimit(t, "refund", result, err, limitExpectation{allowed: true, remaining: 7})
+
+	// Возврат после сброса окна не дает единиц сверх лимита
+	clock.advance(time.Minute)
+	result, err = consume(-3)
+	checkLimit(t, "refund after reset", result, err, limitExpectation{allowed: true, remaining: 10})
+	result, err = consume(10)
+	checkLimit(t, "full budget", result, err, limitExpectation{allowed: true, remaining: 0})
+	result, err = consume(1)
+	checkLimit(t, "over budget", result, err, limitExpectation{allowed: false, remaining: 0, retryAfter: time.Minute})
+}
+
+func TestRedisLimiterTokenBucket(t *testing.T) {
+	store, clock := newTestRedisLimiterStore(t)
+	ctx := context.Background()
+	// Два токена, пополнение - токен за 30 секунд
+	take := func() (LimitResult, error) {
+		return store.TakeToken(ctx, "download:1", 2, time.Minute)
+	}
+
+	result, err := take()
+	checkLimit(t, "first", result, err, limitExpectation{allowed: true, remaining: 1, reset: 30 * time.Second})
+	result, err = take()
+	checkLimit(t, "second", result, err, limitExpectation{allowed: true, remaining: 0, reset: time.Minute})
+
+	result, err = take()
+	checkLimit(t, "empty", result, err, limitExpectation{allowed: false, remaining: 0, retryAfter: 30 * time.Second, reset: time.Minute})
+
+	clock.advance(10 * time.Second)
+	result, err = take()
+	checkLimit(t, "partially refilled", result, err, limitExpectation{allowed: false, remaining: 0, retryAfter: 20 * time.Second, reset: 50 * time.Second})
+
+	clock.advance(20 * time.Second)
+	result, err = take()
+	checkLimit(t, "refilled token", result, err, limitExpectation{allowed: true, remaining: 0, reset: time.Minute})
+
+	// Корзина не наполняется сверх емкости
+	clock.advance(10 * time.Minute)
+	result, err = take()
+	checkLimit(t, "full bucket", result, err, limitExpectation{allowed: true, remaining: 1, reset: 30 * time.Second})
+}
+
+func TestRedisLimiterTokenBucketFractionalRate(t *testing.T) {
+	store, clock := newTestRedisLimiterStore(t)
+	ctx := context.Background()
+	// Три токена в секунду: токен пополняется за 333,33 мс, доли токена не должны теряться
+	take := func() (LimitResult, error) {
+		return store.TakeToken(ctx, "detect:1", 3, time.Second)
+	}
+
+	for i := 0; i < 3; i++ {
+		result, err := take()
+		checkLimit(t, "drain", result, err, limitExpectation{allowed: true, remaining: 2 - i})
+	}
+
+	clock.advance(333 * time.Millisecond)
+	result, err := take()
+	checkLimit(t, "almost one token", result, err, limitExpectation{allowed: false, remaining: 0, retryAfter: time.Millisecond})
+
+	clock.advance(time.Millisecond)
+	result, err = take()
+	checkLimit(t, "one token", result, err, limitExpectation{allowed: true, remaining: 0})
+
+	// Через секунду после опустошения корзина снова полная: 334 + 666 мс
+	clock.advance(666 * time.Millisecond)
+	result, err = take()
+	checkLimit(t, "full after window", result, err, limitExpectation{allowed: true, remaining: 1})
+}
+
+func TestRedisLimiterSlidingWindow(t *testing.T) {
+	store, clock := newTestRedisLimiterStore(t)
+	ctx := context.Background()
+	hit := func(limit int) (LimitResult, error) {
+		return store.LogHit(ctx, "login:1", limit, time.Minute)
+	}
+
+	result, err := hit(2)
+	checkLimit(t, "first", result, err, limitExpectation{allowed: true, remaining: 1, reset: time.Minute})
+
+	clock.advance(10 * time.Second)
+	result, err = hit(2)
+	checkLimit(t, "second", result, err, limitExpectation{allowed: true, remaining: 0, reset: time.Minute})
+
+	// Следующий запрос пройдет, когда истечет первый
+	clock.advance(10 * time.Second)
+	result, err = hit(2)
+	checkLimit(t, "over limit", result, err, limitExpectation{allowed: false, remaining: 0, retryAfter: 40 * time.Second, reset: 50 * time.Second})
+
+	clock.advance(40 * time.Second)
+	result, err = hit(2)
+	checkLimit(t, "first expired", result, err, limitExpectation{allowed: true, remaining: 0})
+
+	clock.advance(5 * time.Second)
+	result, err = hit(2)
+	checkLimit(t, "second blocks", result, err, limitExpectation{allowed: false, remaining: 0, retryAfter: 5 * time.Second})
+
+	// После снижения лимита ждем, пока истекут все лишние записи, а не только самая старая
+	result, err = hit(1)
+	checkLimit(t, "lowered limit", result, err, limitExpectation{allowed: false, remaining: 0, retryAfter: 55 * time.Second})
+
+	clock.advance(time.Minute)
+	result, err = hit(2)
+	checkLimit(t, "window reset", result, err, limitExpectation{allowed: true, remaining: 1, reset: time.Minute})
+}
@@ -0,0 +1,249 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"obscura.app/pkg/logger"
+)
+
+// Хранилища счетчиков rate limiter'а
+const (
+	LimiterStoreMemory   = "memory"
+	LimiterStoreRedis    = "redis"
+	LimiterStorePostgres = "postgres"
+)
+
+// LimitResult результат учета запроса
+type LimitResult struct {
+	Allowed    bool
+	Count      int           // запросов (или единиц стоимости) в текущем окне с учетом этого, если он разрешен
+	Remaining  int           // сколько запросов еще можно сделать сейчас
+	Reset      time.Duration // через сколько лимит полностью восстановится
+	RetryAfter time.Duration // время до следующего разрешенного запроса, если запрос отклонен
+}
+
+// LimiterStore хранит состояние лимитов клиентов. Все методы должны быть атомарными:
+// несколько реплик сервиса, использующих одно хранилище, делят общий лимит.
+// Отклоненный запрос лимит не расходует
+type LimiterStore interface {
+	// Consume расходует cost единиц из лимита limit в фиксированном окне. cost = 0 только
+	// возвращает текущее состояние, отрицательный cost возвращает единицы (счетчик не опускается ниже нуля)
+	Consume(ctx context.Context, key string, cost, limit int, window time.Duration) (LimitResult, error)
+	// TakeToken берет токен из корзины емкостью capacity, которая полностью пополняется за window
+	TakeToken(ctx context.Context, key string, capacity int, window time.Duration) (LimitResult, error)
+	// LogHit учитывает запрос в скользящем окне по журналу времени запросов
+	LogHit(ctx context.Context, key string, limit int, window time.Duration) (LimitResult, error)
+	// Stats возвращает статистику хранилища для /health и /api/admin/stats
+	Stats(ctx context.Context) map[string]interface{}
+}
+
+// NewLimiterStore создает хранилище по конфигурации
+func NewLimiterStore(config *Config, db *Database, logger *logger.Logger) (LimiterStore, error) {
+	// Клиента нельзя удалять раньше, чем закончится самое длинное окно, иначе он получит лимит заново
+	window := time.Duration(max(config.HandlerTimeout, config.CostBudgetWindowHours)) * time.Hour
+
+	switch config.RateLimitStore {
+	case LimiterStoreMemory, "":
+		return NewMemoryLimiterStore(window), nil
+	case LimiterStoreRedis:
+		return NewRedisLimiterStore(config.RedisURL)
+	case LimiterStorePostgres:
+		return NewPostgresLimiterStore(db, window, logger), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", config.RateLimitStore)
+	}
+}
+
+// MemoryLimiterStore счетчики в памяти процесса. Подходит для одной реплики,
+// перезапуск сбрасывает все лимиты
+type MemoryLimiterStore struct {
+	mu      sync.RWMutex
+	clients map[string]*ClientInfo
+}
+
+// ClientInfo информация о клиенте
+type ClientInfo struct {
+	Count     int
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Tokens    float64     // остаток корзины токенов на момент LastSeen
+	Hits      []time.Time // журнал запросов для скользящего окна
+}
+
+// NewMemoryLimiterStore создает хранилище в памяти. Клиенты, не обращавшиеся дольше idleTTL, удаляются
+func NewMemoryLimiterStore(idleTTL time.Duration) *MemoryLimiterStore {
+	store := &MemoryLimiterStore{
+		clients: make(map[string]*ClientInfo),
+	}
+
+	// Запускаем очистку старых записей каждые 10 минут
+	go store.cleanup(idleTTL)
+
+	return store
+}
+
+// Consume расходует лимит клиента
+func (s *MemoryLimiterStore) Consume(_ context.Context, key string, cost, limit int, window time.Duration) (LimitResult, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client, exists := s.clients[key]
+	if !exists {
+		// Новый клиент
+		client = &ClientInfo{FirstSeen: now}
+		s.clients[key] = client
+	}
+
+	// Если прошло больше времени чем окно, сбрасываем счетчик
+	if now.Sub(client.FirstSeen) >= window {
+		client.Count = 0
+		client.FirstSeen = now
+	}
+
+	// Обновляем время последнего обращения
+	client.LastSeen = now
+
+	// Отклоненный запрос не расходует лимит
+	untilReset := client.FirstSeen.Add(window).Sub(now)
+	if client.Count+cost > limit {
+		return fixedWindowResult(false, client.Count, limit, untilReset), nil
+	}
+
+	client.Count = max(client.Count+cost, 0)
+	return fixedWindowResult(true, client.Count, limit, untilReset), nil
+}
+
+// TakeToken берет токен из корзины клиента
+func (s *MemoryLimiterStore) TakeToken(_ context.Context, key string, capacity int, window time.Duration) (LimitResult, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client, exists := s.clients[key]
+	if !exists {
+		client = &ClientInfo{FirstSeen: now, LastSeen: now, Tokens: float64(capacity)}
+		s.clients[key] = client
+	}
+
+	tokens, result := takeToken(client.Tokens, now.Sub(client.LastSeen), capacity, window)
+	client.Tokens = tokens
+	client.LastSeen = now
+	return result, nil
+}
+
+// LogHit учитывает запрос в скользящем окне
+func (s *MemoryLimiterStore) LogHit(_ context.Context, key string, limit int, window time.Duration) (LimitResult, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client, exists := s.clients[key]
+	if !exists {
+		client = &ClientInfo{FirstSeen: now}
+		s.clients[key] = client
+	}
+	client.LastSeen = now
+
+	hits, result := logHit(client.Hits, now, limit, window)
+	client.Hits = hits
+	return result, nil
+}
+
+// fixedWindowResult заполняет результат фиксированного окна
+func fixedWindowResult(allowed bool, count, limit int, untilReset time.Duration) LimitResult {
+	result := LimitResult{
+		Allowed:   allowed,
+		Count:     count,
+		Remaining: max(limit-count, 0),
+		Reset:     untilReset,
+	}
+	if !allowed {
+		result.RetryAfter = untilReset
+	}
+	return result
+}
+
+// takeToken пополняет корзину за прошедшее время elapsed и пытается взять из нее токен.
+// Возвращает новый остаток корзины
+func takeToken(tokens float64, elapsed time.Duration, capacity int, window time.Duration) (float64, LimitResult) {
+	rate := float64(capacity) / float64(window) // токенов в наносекунду
+	tokens = min(float64(capacity), tokens+float64(elapsed)*rate)
+
+	result := LimitResult{}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - tokens) / rate)
+	}
+
+	result.Remaining = int(tokens)
+	result.Count = capacity - result.Remaining
+	result.Reset = time.Duration((float64(capacity) - tokens) / rate)
+	return tokens, result
+}
+
+// logHit удаляет из журнала запросы старше окна и добавляет текущий, если лимит не исчерпан.
+// Возвращает новый журнал
+func logHit(hits []time.Time, now time.Time, limit int, window time.Duration) ([]time.Time, LimitResult) {
+	cutoff := now.Add(-window)
+	i := 0
+	for i < len(hits) && !hits[i].After(cutoff) {
+		i++
+	}
+	hits = hits[i:]
+
+	result := LimitResult{}
+	if len(hits) < limit {
+		hits = append(hits, now)
+		result.Allowed = true
+	} else {
+		result.RetryAfter = hits[len(hits)-limit].Add(window).Sub(now)
+	}
+
+	result.Count = len(hits)
+	result.Remaining = max(limit-len(hits), 0)
+	if len(hits) > 0 {
+		result.Reset = hits[len(hits)-1].Add(window).Sub(now)
+	}
+	return hits, result
+}
+
+// cleanup очищает старые записи клиентов
+func (s *MemoryLimiterStore) cleanup(idleTTL time.Duration) {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.mu.Lock()
+		now := time.Now()
+
+		for clientID, client := range s.clients {
+			// Удаляем клиентов, которые не обращались больше времени окна (24 часа)
+			// Это предотвращает обход блокировки
+			if now.Sub(client.LastSeen) > idleTTL {
+				delete(s.clients, clientID)
+			}
+		}
+
+		s.mu.Unlock()
+	}
+}
+
+// Stats возвращает статистику хранилища
+func (s *MemoryLimiterStore) Stats(_ context.Context) map[string]interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return map[string]interface{}{
+		"store":         LimiterStoreMemory,
+		"total_clients": len(s.clients),
+	}
+}
@@ -0,0 +1,252 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Задержки между неудачными попытками входа: 1с, 2с, 4с... но не больше loginMaxDelay
+const (
+	loginBaseDelay = time.Second
+	loginMaxDelay  = 30 * time.Second
+)
+
+// dummyPasswordHash сравнивается с паролем, когда пользователь не найден,
+// чтобы время ответа не выдавало существование email
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("obscura-dummy-password"), bcrypt.DefaultCost)
+
+// simulatePasswordCheck тратит на проверку столько же времени, сколько проверка настоящего пароля
+func simulatePasswordCheck(password string) {
+	bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+}
+
+// LoginPolicy параметры защиты входа от перебора
+type LoginPolicy struct {
+	FreeAttempts       int           // неудачные попытки без задержки
+	MaxAccountFailures int           // после стольких неудач подряд учетная запись блокируется
+	MaxIPFailures      int           // после стольких неудач с одного IP блокируется IP
+	Lockout            time.Duration // длительность блокировки
+	Window             time.Duration // через сколько после последней неудачи счетчик сбрасывается
+}
+
+// LoginGuard считает неудачные попытки входа по email и по IP.
+// Счетчик ведется по введенному email независимо от того, существует ли учетная запись,
+// поэтому ответы для существующих и несуществующих адресов не отличаются
+type LoginGuard struct {
+	mu      sync.Mutex
+	entries map[string]*loginFailures
+	policy  LoginPolicy
+}
+
+// loginFailures неудачные попытки для одного ключа
+type loginFailures struct {
+	Count        int
+	LastFailure  time.Time
+	BlockedUntil time.Time
+}
+
+// NewLoginGuard создает защиту входа
+func NewLoginGuard(policy LoginPolicy) *LoginGuard {
+	g := &LoginGuard{
+		entries: make(map[string]*loginFailures),
+		policy:  policy,
+	}
+
+	go g.cleanup()
+
+	return g
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check возвращает, сколько нужно подождать до следующей попытки (0 - попытка разрешена)
+func (g *LoginGuard) Check(email, ip string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	var wait time.Duration
+	for _, key := range []string{accountKey(email), ipKey(ip)} {
+		if entry, ok := g.entries[key]; ok && entry.BlockedUntil.After(now) {
+			wait = max(wait, entry.BlockedUntil.Sub(now))
+		}
+	}
+	return wait
+}
+
+// Fail регистрирует неудачную попытку. Возвращает true для учетной записи и IP,
+// которые этой попыткой были заблокированы
+func (g *LoginGuard) Fail(email, ip string) (accountLocked, ipLocked bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	accountLocked = g.fail(accountKey(email), g.policy.MaxAccountFailures)
+	ipLocked = g.fail(ipKey(ip), g.policy.MaxIPFailures)
+	return accountLocked, ipLocked
+}
+
+func (g *LoginGuard) fail(key string, limit int) bool {
+	now := time.Now()
+
+	entry, ok := g.entries[key]
+	if !ok || now.Sub(entry.LastFailure) > g.policy.Window {
+		entry = &loginFailures{}
+		g.entries[key] = entry
+	}
+
+	entry.Count++
+	entry.LastFailure = now
+
+	if limit > 0 && entry.Count == limit {
+		entry.BlockedUntil = now.Add(g.policy.Lockout)
+		return true
+	}
+	if limit > 0 && entry.Count > limit {
+		// Попытки после окончания блокировки снова блокируют сразу
+		entry.BlockedUntil = now.Add(g.policy.Lockout)
+		return false
+	}
+
+	if extra := entry.Count - g.policy.FreeAttempts; extra > 0 {
+		delay := time.Duration(float64(loginBaseDelay) * math.Pow(2, float64(extra-1)))
+		entry.BlockedUntil = now.Add(min(delay, loginMaxDelay))
+	}
+	return false
+}
+
+// Succeed сбрасывает счетчик учетной записи после успешного входа.
+// Счетчик IP не сбрасывается: иначе вход в свой аккаунт обнулял бы перебор чужих
+func (g *LoginGuard) Succeed(email string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.entries, accountKey(email))
+}
+
+// Unlock снимает блокировку учетной записи. Возвращает false, если она не была заблокирована
+func (g *LoginGuard) Unlock(email string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	key := accountKey(email)
+	entry, ok := g.entries[key]
+	delete(g.entries, key)
+	return ok && entry.BlockedUntil.After(time.Now())
+}
+
+// cleanup удаляет устаревшие счетчики
+func (g *LoginGuard) cleanup() {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		g.mu.Lock()
+		now := time.Now()
+
+		for key, entry := range g.entries {
+			if now.Sub(entry.LastFailure) > g.policy.Window && now.After(entry.BlockedUntil) {
+				delete(g.entries, key)
+			}
+		}
+
+		g.mu.Unlock()
+	}
+}
+
+// GetStats возвращает статистику защиты входа
+func (g *LoginGuard) GetStats() map[string]interface{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	blocked := 0
+	for _, entry := range g.entries {
+		if entry.BlockedUntil.After(now) {
+			blocked++
+		}
+	}
+
+	return map[string]interface{}{
+		"tracked_keys":         len(g.entries),
+		"blocked_keys":         blocked,
+		"max_account_failures": g.policy.MaxAccountFailures,
+		"max_ip_failures":      g.policy.MaxIPFailures,
+		"lockout_minutes":      g.policy.Lockout.Minutes(),
+	}
+}
+
+// checkLoginAllowed отвечает 429, если попытки входа для email или IP временно запрещены
+func (s *Server) checkLoginAllowed(w http.ResponseWriter, email, ip string) bool {
+	wait := s.loginGuard.Check(email, ip)
+	if wait <= 0 {
+		return true
+	}
+
+	s.logger.Warning("Login attempt throttled for %s from %s, retry in %v", email, ip, wait.Round(time.Second))
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	s.sendError(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+	return false
+}
+
+// recordLoginFailure учитывает неудачную попытку и записывает блокировку в журнал аудита.
+// userID равен nil, если учетной записи с таким email нет
+func (s *Server) recordLoginFailure(email, ip string, userID *uint) {
+	accountLocked, ipLocked := s.loginGuard.Fail(email, ip)
+
+	if accountLocked {
+		s.audit(AuditEvent{
+			Action:       AuditLoginLockout,
+			Severity:     AuditAlert,
+			TargetUserID: userID,
+			Subject:      accountKey(email),
+			IP:           ip,
+			Message: fmt.Sprintf("Account locked for %v after %d failed login attempts",
+				s.loginGuard.policy.Lockout, s.loginGuard.policy.MaxAccountFailures),
+		})
+	}
+
+	if ipLocked {
+		s.audit(AuditEvent{
+			Action:   AuditLoginLockout,
+			Severity: AuditAlert,
+			Subject:  ipKey(ip),
+			IP:       ip,
+			Message: fmt.Sprintf("IP address locked for %v after %d failed login attempts",
+				s.loginGuard.policy.Lockout, s.loginGuard.policy.MaxIPFailures),
+		})
+	}
+}
+
+// Снятие блокировки входа администратором
+func (s *Server) handleAdminUnlockUser(w http.ResponseWriter, r *http.Request, target *User, adminID int) {
+	wasLocked := s.loginGuard.Unlock(target.Email)
+
+	actorID := uint(adminID)
+	s.audit(AuditEvent{
+		Action:       AuditLoginUnlock,
+		ActorID:      &actorID,
+		TargetUserID: &target.ID,
+		Subject:      accountKey(target.Email),
+		IP:           getClientIP(r),
+		Message:      fmt.Sprintf("Login lockout of user %d cleared by admin %d (was locked: %v)", target.ID, adminID, wasLocked),
+	})
+
+	message := "Account unlocked"
+	if !wasLocked {
+		message = "Account was not locked"
+	}
+	s.sendAdminUser(w, target.ID, message)
+}
@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"obscura.app/pkg/logger"
+)
+
+// Message письмо пользователю
+type Message struct {
+	To      string
+	Subject string
+	Body    string // текст письма (text/plain)
+}
+
+// Mailer отправляет письма. Драйвер выбирается переменной MAIL_DRIVER
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewMailer создает драйвер почты по конфигурации
+func NewMailer(config *Config, logger *logger.Logger) (Mailer, error) {
+	switch config.MailDriver {
+	case "smtp":
+		return &SMTPMailer{
+			addr:     net.JoinHostPort(config.SMTPHost, config.SMTPPort),
+			host:     config.SMTPHost,
+			from:     config.MailFrom,
+			username: config.SMTPUsername,
+			password: config.SMTPPassword,
+		}, nil
+	case "file":
+		if err := os.MkdirAll(config.MailDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create mail directory: %w", err)
+		}
+		return &FileMailer{dir: config.MailDir, from: config.MailFrom, logger: logger}, nil
+	case "log", "":
+		return &FileMailer{from: config.MailFrom, logger: logger}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", config.MailDriver)
+	}
+}
+
+// SMTPMailer отправляет письма через SMTP сервер (STARTTLS, если сервер его поддерживает)
+type SMTPMailer struct {
+	addr     string
+	host     string
+	from     string
+	username string
+	password string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	from, err := mail.ParseAddress(m.from)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %w", err)
+	}
+
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+
+	data := buildMessage(m.from, msg)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(m.addr, auth, from.Address, []string{msg.To}, data)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// FileMailer сохраняет письма в каталог в формате .eml для локальной разработки.
+// Без каталога письма только пишутся в лог
+type FileMailer struct {
+	dir    string
+	from   string
+	logger *logger.Logger
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if m.dir == "" {
+		m.logger.Info("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+		return nil
+	}
+
+	name := fmt.Sprintf("%s_%s.eml", time.Now().Format("20060102-150405"), uuid.New().String()[:8])
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, buildMessage(m.from, msg), 0644); err != nil {
+		return err
+	}
+
+	m.logger.Info("Mail to %s saved to %s", msg.To, path)
+	return nil
+}
+
+// buildMessage собирает письмо в формате RFC 5322
+func buildMessage(from string, msg Message) []byte {
+	var buf bytes.Buffer
+	headers := []struct{ key, value string }{
+		{"From", from},
+		{"To", msg.To},
+		{"Subject", mime.QEncoding.Encode("utf-8", msg.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", fmt.Sprintf("<%s@obscura.app>", uuid.New().String())},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=utf-8"},
+		{"Content-Transfer-Encoding", "8bit"},
+	}
+	for _, h := range headers {
+		// Переводы строк в заголовках позволили бы внедрить свои заголовки
+		value := strings.NewReplacer("\r", "", "\n", "").Replace(h.value)
+		fmt.Fprintf(&buf, "%s: %s\r\n", h.key, value)
+	}
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return buf.Bytes()
+}
@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Форматы медиафайлов, определяемые по сигнатуре содержимого
+const (
+	FormatJPEG     = "jpeg"
+	FormatPNG      = "png"
+	FormatGIF      = "gif"
+	FormatWebP     = "webp"
+	FormatBMP      = "bmp"
+	FormatTIFF     = "tiff"
+	FormatHEIF     = "heif" // HEIC и другие HEIF изображения
+	FormatAVIF     = "avif"
+	FormatMP4      = "mp4" // ISO BMFF, включая QuickTime MOV
+	FormatWebM     = "webm"
+	FormatMatroska = "matroska"
+	FormatAVI      = "avi"
+	FormatASF      = "asf" // WMV
+	FormatFLV      = "flv"
+)
+
+// Видеоформаты. Остальные форматы - изображения
+var videoFormats = []string{FormatMP4, FormatWebM, FormatMatroska, FormatAVI, FormatASF, FormatFLV}
+
+// extensionFormats допустимые форматы содержимого для каждого расширения.
+// WebM - подмножество Matroska, поэтому .mkv может содержать и его
+var extensionFormats = map[string][]string{
+	".jpg":  {FormatJPEG},
+	".jpeg": {FormatJPEG},
+	".png":  {FormatPNG},
+	".gif":  {FormatGIF},
+	".webp": {FormatWebP},
+	".bmp":  {FormatBMP},
+	".tiff": {FormatTIFF},
+	".tif":  {FormatTIFF},
+	".heic": {FormatHEIF},
+	".heif": {FormatHEIF},
+	".avif": {FormatAVIF},
+	".mp4":  {FormatMP4},
+	".mov":  {FormatMP4},
+	".webm": {FormatWebM},
+	".mkv":  {FormatMatroska, FormatWebM},
+	".avi":  {FormatAVI},
+	".wmv":  {FormatASF},
+	".flv":  {FormatFLV},
+}
+
+// formatMimeTypes MIME типы форматов содержимого
+var formatMimeTypes = map[string]string{
+	FormatJPEG:     "image/jpeg",
+	FormatPNG:      "image/png",
+	FormatGIF:      "image/gif",
+	FormatWebP:     "image/webp",
+	FormatBMP:      "image/bmp",
+	FormatTIFF:     "image/tiff",
+	FormatHEIF:     "image/heif",
+	FormatAVIF:     "image/avif",
+	FormatMP4:      "video/mp4",
+	FormatWebM:     "video/webm",
+	FormatMatroska: "video/x-matroska",
+	FormatAVI:      "video/avi",
+	FormatASF:      "video/x-ms-wmv",
+	FormatFLV:      "video/x-flv",
+}
+
+// Первые байты EBML заголовка Matroska/WebM
+var ebmlMagic = []byte{0x1A, 0x45, 0xDF, 0xA3}
+
+// Начало GUID заголовка ASF
+var asfMagic = []byte{0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11}
+
+// Атомы, с которых может начинаться файл ISO BMFF. Старые файлы QuickTime не имеют ftyp
+var mp4LeadingBoxes = []string{"ftyp", "moov", "mdat", "free", "skip", "wide"}
+
+// Бренды ftyp изображений HEIF и AVIF. Контейнер у них тот же, что у MP4
+var (
+	heifBrands = []string{"heic", "heix", "heim", "heis", "hevc", "hevx", "hevm", "hevs", "mif1", "msf1"}
+	avifBrands = []string{"avif", "avis"}
+)
+
+// isVideoFormat проверяет, что формат - видео
+func isVideoFormat(format string) bool {
+	return slices.Contains(videoFormats, format)
+}
+
+// formatMimeType возвращает MIME тип файла по формату, определенному по содержимому. Расширение
+// лишь уточняет тип внутри одного формата: QuickTime MOV и MP4, HEIC и другие HEIF
+func formatMimeType(format, ext string) string {
+	switch ext = strings.ToLower(ext); {
+	case format == FormatMP4 && ext == ".mov":
+		return "video/quicktime"
+	case format == FormatHEIF && ext == ".heic":
+		return "image/heic"
+	}
+	if mimeType, ok := formatMimeTypes[format]; ok {
+		return mimeType
+	}
+	return "application/octet-stream"
+}
+
+// sniffMediaFormat определяет формат по сигнатуре в начале файла. Пустая строка - формат не поддерживается.
+// После чтения позиция r возвращается в начало
+func sniffMediaFormat(r io.ReadSeeker) (string, error) {
+	defer r.Seek(0, io.SeekStart)
+
+	header := make([]byte, 16)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, []byte{0xFF, 0xD8, 0xFF}):
+		return FormatJPEG, nil
+	case bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")):
+		return FormatPNG, nil
+	case bytes.HasPrefix(header, []byte("GIF87a")), bytes.HasPrefix(header, []byte("GIF89a")):
+		return FormatGIF, nil
+	case len(header) >= 12 && string(header[0:4]) == "RIFF" && string(header[8:12]) == "WEBP":
+		return FormatWebP, nil
+	case len(header) >= 12 && string(header[0:4]) == "RIFF" && string(header[8:12]) == "AVI ":
+		return FormatAVI, nil
+	case bytes.HasPrefix(header, []byte("BM")):
+		return FormatBMP, nil
+	case bytes.HasPrefix(header, []byte("II*\x00")), bytes.HasPrefix(header, []byte("MM\x00*")):
+		return FormatTIFF, nil
+	case len(header) >= 8 && string(header[4:8]) == "ftyp":
+		r.Seek(0, io.SeekStart)
+		brands, err := readFtypBrands(r)
+		if err != nil {
+			// Поврежденный ftyp обнаружится при разборе заголовков MP4
+			return FormatMP4, nil
+		}
+		// mif1 бывает и у AVIF, поэтому AVIF проверяется первым
+		switch {
+		case slices.ContainsFunc(brands, func(brand string) bool { return slices.Contains(avifBrands, brand) }):
+			return FormatAVIF, nil
+		case slices.ContainsFunc(brands, func(brand string) bool { return slices.Contains(heifBrands, brand) }):
+			return FormatHEIF, nil
+		}
+		return FormatMP4, nil
+	case len(header) >= 8 && slices.Contains(mp4LeadingBoxes, string(header[4:8])):
+		return FormatMP4, nil
+	case bytes.HasPrefix(header, asfMagic):
+		return FormatASF, nil
+	case bytes.HasPrefix(header, []byte("FLV\x01")):
+		return FormatFLV, nil
+	case bytes.HasPrefix(header, ebmlMagic):
+		// WebM и Matroska различаются только DocType в заголовке EBML
+		r.Seek(0, io.SeekStart)
+		docType, err := probeEBMLDocType(r)
+		if err != nil {
+			return "", nil
+		}
+		switch docType {
+		case "webm":
+			return FormatWebM, nil
+		case "matroska":
+			return FormatMatroska, nil
+		}
+	}
+
+	return "", nil
+}
+
+// readFtypBrands возвращает основной и совместимые бренды из атома ftyp в начале файла
+func readFtypBrands(r io.Reader) ([]string, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	// Атом ftyp короткий: 4 байта основного бренда, 4 байта версии и по 4 байта на совместимый бренд
+	size := int(binary.BigEndian.Uint32(header[0:4]))
+	if size < 16 || size > 1024 {
+		return nil, errMediaHeader
+	}
+	body := make([]byte, size-8)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	brands := []string{string(body[0:4])}
+	for offset := 8; offset+4 <= len(body); offset += 4 {
+		brands = append(brands, string(body[offset:offset+4]))
+	}
+	return brands, nil
+}
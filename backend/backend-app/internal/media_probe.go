@@ -0,0 +1,977 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+	"math"
+	"math/bits"
+	"strings"
+	"time"
+)
+
+// errMediaHeader заголовок контейнера не найден или поврежден
+var errMediaHeader = errors.New("media header not found or corrupt")
+
+// errUnsupportedFormat содержимое не похоже ни на один поддерживаемый формат
+var errUnsupportedFormat = errors.New("unsupported media format")
+
+// maxMediaDuration наибольшая правдоподобная длительность. Большее значение в заголовке - мусор,
+// а не настоящая запись, и к тому же может переполнить time.Duration
+const maxMediaDuration = 7 * 24 * time.Hour
+
+// MediaInfo формат, размеры и длительность медиафайла. Нулевые размеры и длительность - не удалось определить
+type MediaInfo struct {
+	Format   string
+	Width    int
+	Height   int
+	Duration time.Duration
+}
+
+// IsVideo проверяет, что файл - видео
+func (m MediaInfo) IsVideo() bool {
+	return isVideoFormat(m.Format)
+}
+
+// Megapixels возвращает число мегапикселей изображения или кадра видео
+func (m MediaInfo) Megapixels() float64 {
+	return float64(m.Width) * float64(m.Height) / 1e6
+}
+
+// probeMedia определяет формат по сигнатуре и читает размеры и длительность из заголовков без декодирования.
+// Нулевая длительность видео - заголовок ее не содержит (потоковая запись, фрагментированный MP4 без mehd).
+// Ошибка означает, что формат известен (заполнен Format), но заголовки прочитать не удалось или значения
+// в них невозможны, или что формат не поддерживается (errUnsupportedFormat).
+// После чтения позиция r возвращается в начало
+func probeMedia(r io.ReadSeeker) (MediaInfo, error) {
+	defer r.Seek(0, io.SeekStart)
+
+	format, err := sniffMediaFormat(r)
+	if err != nil {
+		return MediaInfo{}, err
+	}
+
+	info := MediaInfo{Format: format}
+	switch format {
+	case "":
+		return info, errUnsupportedFormat
+	case FormatMP4:
+		// Без moov/mvhd файл не воспроизводится, а размеры кадра есть не у всех дорожек
+		if info.Duration, err = probeMP4Duration(r); err != nil {
+			return info, err
+		}
+		if width, height, err := probeMP4Dimensions(r); err == nil {
+			info.Width, info.Height = width, height
+		}
+	case FormatWebM, FormatMatroska:
+		if info.Width, info.Height, info.Duration, err = probeMatroska(r); err != nil {
+			return info, err
+		}
+	case FormatHEIF, FormatAVIF:
+		if info.Width, info.Height, err = probeHEIFDimensions(r); err != nil {
+			return info, err
+		}
+	case FormatAVI:
+		if info.Width, info.Height, info.Duration, err = probeAVI(r); err != nil {
+			return info, err
+		}
+	case FormatASF:
+		if info.Duration, err = probeASFDuration(r); err != nil {
+			return info, err
+		}
+	case FormatFLV:
+		if info.Width, info.Height, info.Duration, err = probeFLV(r); err != nil {
+			return info, err
+		}
+	default:
+		r.Seek(0, io.SeekStart)
+		config, _, err := image.DecodeConfig(r)
+		if err != nil {
+			return info, err
+		}
+		info.Width, info.Height = config.Width, config.Height
+	}
+
+	return info, nil
+}
+
+// mediaDuration переводит длительность из заголовка в секундах в time.Duration.
+// Нечисловое, неположительное или неправдоподобно большое значение - признак поврежденного заголовка
+func mediaDuration(seconds float64) (time.Duration, error) {
+	if math.IsNaN(seconds) || seconds <= 0 || seconds > maxMediaDuration.Seconds() {
+		return 0, errMediaHeader
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// probeMP4Duration ищет атом moov/mvhd и вычисляет длительность из timescale и duration.
+// У фрагментированного MP4 duration в mvhd нулевая, тогда длительность берется из moov/mvex/mehd
+func probeMP4Duration(r io.ReadSeeker) (time.Duration, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	moovStart, moovSize, err := findMP4Box(r, 0, end, "moov")
+	if err != nil {
+		return 0, err
+	}
+
+	mvhdStart, _, err := findMP4Box(r, moovStart, moovStart+moovSize, "mvhd")
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := r.Seek(mvhdStart, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	// version(1) + flags(3)
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, err
+	}
+
+	var timescale uint32
+	var duration uint64
+	if header[0] == 1 {
+		// creation_time(8) + modification_time(8) + timescale(4) + duration(8)
+		buf := make([]byte, 28)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return 0, err
+		}
+		timescale = binary.BigEndian.Uint32(buf[16:20])
+		duration = binary.BigEndian.Uint64(buf[20:28])
+	} else {
+		// creation_time(4) + modification_time(4) + timescale(4) + duration(4)
+		buf := make([]byte, 16)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return 0, err
+		}
+		timescale = binary.BigEndian.Uint32(buf[8:12])
+		duration = uint64(binary.BigEndian.Uint32(buf[12:16]))
+	}
+
+	if timescale == 0 {
+		return 0, errMediaHeader
+	}
+
+	// Все единицы в duration означают, что длительность неизвестна
+	if duration == 0 || duration == math.MaxUint32 || duration == math.MaxUint64 {
+		if duration, err = probeMP4FragmentDuration(r, moovStart, moovSize); err != nil || duration == 0 {
+			return 0, err
+		}
+	}
+
+	return mediaDuration(float64(duration) / float64(timescale))
+}
+
+// probeMP4FragmentDuration читает длительность всех фрагментов из moov/mvex/mehd в единицах timescale
+// из mvhd. Ноль - атома нет, длительность неизвестна
+func probeMP4FragmentDuration(r io.ReadSeeker, moovStart, moovSize int64) (uint64, error) {
+	mvexStart, mvexSize, err := findMP4Box(r, moovStart, moovStart+moovSize, "mvex")
+	if err != nil {
+		return 0, nil
+	}
+	mehdStart, mehdSize, err := findMP4Box(r, mvexStart, mvexStart+mvexSize, "mehd")
+	if err != nil {
+		return 0, nil
+	}
+
+	// version(1) + flags(3) + fragment_duration(4 или 8 для версии 1)
+	if mehdSize < 8 {
+		return 0, errMediaHeader
+	}
+	if _, err := r.Seek(mehdStart, io.SeekStart); err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 12)
+	if _, err := io.ReadFull(r, buf[:8]); err != nil {
+		return 0, err
+	}
+	if buf[0] != 1 {
+		return uint64(binary.BigEndian.Uint32(buf[4:8])), nil
+	}
+	if mehdSize < 12 {
+		return 0, errMediaHeader
+	}
+	if _, err := io.ReadFull(r, buf[8:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buf[4:12]), nil
+}
+
+// probeMP4Dimensions возвращает размеры кадра первой видеодорожки из атома moov/trak/tkhd
+func probeMP4Dimensions(r io.ReadSeeker) (int, int, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	moovStart, moovSize, err := findMP4Box(r, 0, end, "moov")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Звуковые дорожки имеют нулевые размеры, поэтому перебираем все trak
+	offset := moovStart
+	for {
+		trakStart, trakSize, err := findMP4Box(r, offset, moovStart+moovSize, "trak")
+		if err != nil {
+			return 0, 0, err
+		}
+		offset = trakStart + trakSize
+
+		tkhdStart, _, err := findMP4Box(r, trakStart, trakStart+trakSize, "tkhd")
+		if err != nil {
+			continue
+		}
+		if _, err := r.Seek(tkhdStart, io.SeekStart); err != nil {
+			return 0, 0, err
+		}
+
+		// version(1) + flags(3), затем поля версии 0 (80 байт) или версии 1 (92 байта).
+		// Ширина и высота - последние 8 байт в формате 16.16
+		header := make([]byte, 96)
+		if _, err := io.ReadFull(r, header[:84]); err != nil {
+			return 0, 0, err
+		}
+		size := 84
+		if header[0] == 1 {
+			if _, err := io.ReadFull(r, header[84:]); err != nil {
+				return 0, 0, err
+			}
+			size = 96
+		}
+
+		width := int(binary.BigEndian.Uint32(header[size-8:size-4]) >> 16)
+		height := int(binary.BigEndian.Uint32(header[size-4:size]) >> 16)
+		if width > 0 && height > 0 {
+			return width, height, nil
+		}
+	}
+}
+
+// probeHEIFDimensions возвращает наибольшие размеры из свойств изображений meta/iprp/ipco/ispe.
+// Кроме основного изображения там описаны миниатюры и тайлы, они всегда меньше
+func probeHEIFDimensions(r io.ReadSeeker) (int, int, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	metaStart, metaSize, err := findMP4Box(r, 0, end, "meta")
+	if err != nil {
+		return 0, 0, err
+	}
+	// meta - FullBox: перед дочерними атомами version(1) + flags(3)
+	iprpStart, iprpSize, err := findMP4Box(r, metaStart+4, metaStart+metaSize, "iprp")
+	if err != nil {
+		return 0, 0, err
+	}
+	ipcoStart, ipcoSize, err := findMP4Box(r, iprpStart, iprpStart+iprpSize, "ipco")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var width, height uint32
+	offset := ipcoStart
+	for {
+		ispeStart, ispeSize, err := findMP4Box(r, offset, ipcoStart+ipcoSize, "ispe")
+		if err != nil {
+			break
+		}
+		offset = ispeStart + ispeSize
+
+		// version(1) + flags(3) + image_width(4) + image_height(4)
+		if _, err := r.Seek(ispeStart, io.SeekStart); err != nil {
+			return 0, 0, err
+		}
+		ispe := make([]byte, 12)
+		if _, err := io.ReadFull(r, ispe); err != nil {
+			return 0, 0, err
+		}
+		width = max(width, binary.BigEndian.Uint32(ispe[4:8]))
+		height = max(height, binary.BigEndian.Uint32(ispe[8:12]))
+	}
+
+	if width == 0 || height == 0 {
+		return 0, 0, errMediaHeader
+	}
+	return int(min(width, math.MaxInt32)), int(min(height, math.MaxInt32)), nil
+}
+
+// findMP4Box ищет атом с заданным типом в диапазоне [start, end) и возвращает начало и размер его содержимого
+func findMP4Box(r io.ReadSeeker, start, end int64, boxType string) (int64, int64, error) {
+	header := make([]byte, 8)
+	offset := start
+
+	for offset+8 <= end {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return 0, 0, err
+		}
+		if _, err := io.ReadFull(r, header); err != nil {
+			return 0, 0, err
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[0:4]))
+		headerSize := int64(8)
+
+		switch size {
+		case 0:
+			// Атом продолжается до конца файла
+			size = end - offset
+		case 1:
+			// 64-битный размер
+			large := make([]byte, 8)
+			if _, err := io.ReadFull(r, large); err != nil {
+				return 0, 0, err
+			}
+			size = int64(binary.BigEndian.Uint64(large))
+			headerSize = 16
+		}
+
+		if size < headerSize || offset+size > end {
+			return 0, 0, errMediaHeader
+		}
+
+		if string(header[4:8]) == boxType {
+			return offset + headerSize, size - headerSize, nil
+		}
+
+		offset += size
+	}
+
+	return 0, 0, errMediaHeader
+}
+
+// EBML идентификаторы элементов Matroska, из которых читаются размеры и длительность
+const (
+	ebmlHeaderID       = 0x1A45DFA3
+	ebmlDocTypeID      = 0x4282
+	mkvSegmentID       = 0x18538067
+	mkvInfoID          = 0x1549A966
+	mkvTimecodeScaleID = 0x2AD7B1
+	mkvDurationID      = 0x4489
+	mkvTracksID        = 0x1654AE6B
+	mkvTrackEntryID    = 0xAE
+	mkvVideoID         = 0xE0
+	mkvPixelWidthID    = 0xB0
+	mkvPixelHeightID   = 0xBA
+	mkvClusterID       = 0x1F43B675
+)
+
+// probeEBMLDocType читает DocType из заголовка EBML ("webm" или "matroska")
+func probeEBMLDocType(r io.ReadSeeker) (string, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return "", err
+	}
+
+	var docType string
+	err = walkEBML(r, 0, end, func(id uint64, start, size int64) (bool, error) {
+		if id != ebmlHeaderID {
+			return false, errMediaHeader
+		}
+		return false, walkEBML(r, start, start+size, func(id uint64, start, size int64) (bool, error) {
+			if id != ebmlDocTypeID {
+				return true, nil
+			}
+			value, err := readEBMLBytes(r, start, size)
+			docType = strings.TrimRight(string(value), "\x00")
+			return false, err
+		})
+	})
+	if err == nil && docType == "" {
+		err = errMediaHeader
+	}
+	return docType, err
+}
+
+// probeMatroska возвращает размеры кадра первой видеодорожки и длительность из Segment/Info и Segment/Tracks
+func probeMatroska(r io.ReadSeeker) (int, int, time.Duration, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	var width, height uint64
+	var rawDuration float64
+	timecodeScale := uint64(1_000_000) // наносекунд в единице времени, значение по умолчанию по спецификации
+	found, hasDuration := false, false
+
+	info := func(id uint64, start, size int64) (bool, error) {
+		var err error
+		switch id {
+		case mkvTimecodeScaleID:
+			timecodeScale, err = readEBMLUint(r, start, size)
+		case mkvDurationID:
+			rawDuration, err = readEBMLFloat(r, start, size)
+			hasDuration = true
+		}
+		return true, err
+	}
+
+	video := func(id uint64, start, size int64) (bool, error) {
+		var err error
+		switch id {
+		case mkvPixelWidthID:
+			width, err = readEBMLUint(r, start, size)
+		case mkvPixelHeightID:
+			height, err = readEBMLUint(r, start, size)
+		}
+		return true, err
+	}
+
+	tracks := func(id uint64, start, size int64) (bool, error) {
+		if id != mkvTrackEntryID {
+			return true, nil
+		}
+		err := walkEBML(r, start, start+size, func(id uint64, start, size int64) (bool, error) {
+			if id == mkvVideoID {
+				return false, walkEBML(r, start, start+size, video)
+			}
+			return true, nil
+		})
+		// Звуковые дорожки не имеют размеров, ищем первую видеодорожку
+		return width == 0 || height == 0, err
+	}
+
+	err = walkEBML(r, 0, end, func(id uint64, start, size int64) (bool, error) {
+		if id != mkvSegmentID {
+			return true, nil
+		}
+		found = true
+		return false, walkEBML(r, start, start+size, func(id uint64, start, size int64) (bool, error) {
+			switch id {
+			case mkvInfoID:
+				return true, walkEBML(r, start, start+size, info)
+			case mkvTracksID:
+				return true, walkEBML(r, start, start+size, tracks)
+			case mkvClusterID:
+				// Info и Tracks записываются перед кадрами, дальше читать незачем
+				return false, nil
+			}
+			return true, nil
+		})
+	})
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if !found {
+		return 0, 0, 0, errMediaHeader
+	}
+
+	// Duration необязателен: потоковая запись его не содержит
+	var duration time.Duration
+	if hasDuration {
+		if duration, err = mediaDuration(rawDuration * float64(timecodeScale) / 1e9); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	return int(min(width, math.MaxInt32)), int(min(height, math.MaxInt32)), duration, nil
+}
+
+// walkEBML перебирает элементы в диапазоне [start, end) и вызывает visit с идентификатором,
+// началом и размером содержимого каждого. visit возвращает false, чтобы остановить перебор.
+// Элемент неизвестного размера (потоковая запись) считается продолжающимся до end
+func walkEBML(r io.ReadSeeker, start, end int64, visit func(id uint64, start, size int64) (bool, error)) error {
+	offset := start
+
+	for offset < end {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		id, idLength, _, err := readEBMLVint(r, true)
+		if err != nil {
+			return err
+		}
+		size, sizeLength, unknown, err := readEBMLVint(r, false)
+		if err != nil {
+			return err
+		}
+
+		dataStart := offset + int64(idLength+sizeLength)
+		dataSize := int64(size)
+		if unknown || size > uint64(end-dataStart) {
+			dataSize = end - dataStart
+		}
+
+		more, err := visit(id, dataStart, dataSize)
+		if err != nil || !more {
+			return err
+		}
+		offset = dataStart + dataSize
+	}
+
+	return nil
+}
+
+// readEBMLVint читает целое переменной длины. Идентификаторы элементов хранятся вместе с маркером длины,
+// размеры - без него. unknown - размер из одних единиц, которым обозначается неизвестный размер
+func readEBMLVint(r io.Reader, keepMarker bool) (uint64, int, bool, error) {
+	var first [1]byte
+	if _, err := io.ReadFull(r, first[:]); err != nil {
+		return 0, 0, false, err
+	}
+
+	length := bits.LeadingZeros8(first[0]) + 1
+	if length > 8 {
+		return 0, 0, false, errMediaHeader
+	}
+
+	value := uint64(first[0])
+	if !keepMarker {
+		value &= 0xFF >> length
+	}
+	if length > 1 {
+		rest := make([]byte, length-1)
+		if _, err := io.ReadFull(r, rest); err != nil {
+			return 0, 0, false, err
+		}
+		for _, b := range rest {
+			value = value<<8 | uint64(b)
+		}
+	}
+
+	unknown := !keepMarker && value == 1<<(7*length)-1
+	return value, length, unknown, nil
+}
+
+// readEBMLBytes читает содержимое короткого элемента
+func readEBMLBytes(r io.ReadSeeker, start, size int64) ([]byte, error) {
+	if size < 0 || size > 64 {
+		return nil, errMediaHeader
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	value := make([]byte, size)
+	_, err := io.ReadFull(r, value)
+	return value, err
+}
+
+// readEBMLUint читает беззнаковое целое длиной до 8 байт
+func readEBMLUint(r io.ReadSeeker, start, size int64) (uint64, error) {
+	if size > 8 {
+		return 0, errMediaHeader
+	}
+	value, err := readEBMLBytes(r, start, size)
+	if err != nil {
+		return 0, err
+	}
+
+	var result uint64
+	for _, b := range value {
+		result = result<<8 | uint64(b)
+	}
+	return result, nil
+}
+
+// readEBMLFloat читает число с плавающей точкой длиной 4 или 8 байт
+func readEBMLFloat(r io.ReadSeeker, start, size int64) (float64, error) {
+	value, err := readEBMLBytes(r, start, size)
+	if err != nil {
+		return 0, err
+	}
+
+	switch size {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(value))), nil
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(value)), nil
+	default:
+		return 0, errMediaHeader
+	}
+}
+
+// probeAVI читает размеры кадра и длительность из заголовка RIFF/AVI: LIST hdrl/avih и, для файлов
+// OpenDML больше 1 ГБ, LIST hdrl/LIST odml/dmlh с полным числом кадров
+func probeAVI(r io.ReadSeeker) (int, int, time.Duration, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	// "RIFF" + размер + "AVI "
+	hdrlStart, hdrlSize, err := findRIFFChunk(r, 12, end, "LIST", "hdrl")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	avihStart, avihSize, err := findRIFFChunk(r, hdrlStart, hdrlStart+hdrlSize, "avih", "")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	// dwMicroSecPerFrame, ..., dwTotalFrames (16), ..., dwWidth (32), dwHeight (36)
+	if avihSize < 40 {
+		return 0, 0, 0, errMediaHeader
+	}
+	if _, err := r.Seek(avihStart, io.SeekStart); err != nil {
+		return 0, 0, 0, err
+	}
+	avih := make([]byte, 40)
+	if _, err := io.ReadFull(r, avih); err != nil {
+		return 0, 0, 0, err
+	}
+	frameTime := binary.LittleEndian.Uint32(avih[0:4])
+	frames := binary.LittleEndian.Uint32(avih[16:20])
+	width := binary.LittleEndian.Uint32(avih[32:36])
+	height := binary.LittleEndian.Uint32(avih[36:40])
+
+	if odmlStart, odmlSize, err := findRIFFChunk(r, hdrlStart, hdrlStart+hdrlSize, "LIST", "odml"); err == nil {
+		if dmlhStart, dmlhSize, err := findRIFFChunk(r, odmlStart, odmlStart+odmlSize, "dmlh", ""); err == nil && dmlhSize >= 4 {
+			grandFrames := make([]byte, 4)
+			if _, err := r.Seek(dmlhStart, io.SeekStart); err != nil {
+				return 0, 0, 0, err
+			}
+			if _, err := io.ReadFull(r, grandFrames); err != nil {
+				return 0, 0, 0, err
+			}
+			frames = max(frames, binary.LittleEndian.Uint32(grandFrames))
+		}
+	}
+
+	// Без числа кадров или их длительности (запись не завершена) длительность неизвестна
+	var duration time.Duration
+	if frames > 0 && frameTime > 0 {
+		if duration, err = mediaDuration(float64(frames) * float64(frameTime) / 1e6); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	return int(min(width, math.MaxInt32)), int(min(height, math.MaxInt32)), duration, nil
+}
+
+// findRIFFChunk ищет чанк с заданным идентификатором в диапазоне [start, end) и возвращает начало
+// и размер его содержимого. Для LIST сравнивается и тип списка, содержимое начинается после него
+func findRIFFChunk(r io.ReadSeeker, start, end int64, id, listType string) (int64, int64, error) {
+	header := make([]byte, 12)
+	offset := start
+
+	for offset+8 <= end {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return 0, 0, err
+		}
+		if _, err := io.ReadFull(r, header[:8]); err != nil {
+			return 0, 0, err
+		}
+
+		dataStart := offset + 8
+		size := int64(binary.LittleEndian.Uint32(header[4:8]))
+		if dataStart+size > end {
+			return 0, 0, errMediaHeader
+		}
+
+		if string(header[0:4]) == id {
+			if listType == "" {
+				return dataStart, size, nil
+			}
+			if size >= 4 {
+				if _, err := io.ReadFull(r, header[8:12]); err != nil {
+					return 0, 0, err
+				}
+				if string(header[8:12]) == listType {
+					return dataStart + 4, size - 4, nil
+				}
+			}
+		}
+
+		// Чанки выравниваются по четной границе
+		offset = dataStart + size + size&1
+	}
+
+	return 0, 0, errMediaHeader
+}
+
+// GUID объектов ASF в порядке байтов файла
+var (
+	asfHeaderGUID         = []byte{0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11, 0xA6, 0xD9, 0x00, 0xAA, 0x00, 0x62, 0xCE, 0x6C}
+	asfFilePropertiesGUID = []byte{0xA1, 0xDC, 0xAB, 0x8C, 0x47, 0xA9, 0xCF, 0x11, 0x8E, 0xE4, 0x00, 0xC0, 0x0C, 0x20, 0x53, 0x65}
+)
+
+// Флаг Broadcast в File Properties: запись идет, длительность не заполнена
+const asfBroadcastFlag = 0x1
+
+// probeASFDuration читает длительность из объекта File Properties заголовка ASF (WMV)
+func probeASFDuration(r io.ReadSeeker) (time.Duration, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	// GUID(16) + размер(8) + число объектов(4) + reserved(2)
+	header := make([]byte, 30)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, err
+	}
+	headerSize := binary.LittleEndian.Uint64(header[16:24])
+	if !bytes.Equal(header[:16], asfHeaderGUID) || headerSize < 30 || headerSize > uint64(end) {
+		return 0, errMediaHeader
+	}
+
+	object := make([]byte, 24)
+	offset, headerEnd := int64(30), int64(headerSize)
+	for offset+24 <= headerEnd {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+		if _, err := io.ReadFull(r, object); err != nil {
+			return 0, err
+		}
+		size := binary.LittleEndian.Uint64(object[16:24])
+		if size < 24 || size > uint64(headerEnd-offset) {
+			return 0, errMediaHeader
+		}
+
+		if bytes.Equal(object[:16], asfFilePropertiesGUID) {
+			// File ID(16) + File Size(8) + Creation Date(8) + Data Packets Count(8) + Play Duration(8) +
+			// Send Duration(8) + Preroll(8) + Flags(4) + размеры пакетов и битрейт(12)
+			if size < 24+80 {
+				return 0, errMediaHeader
+			}
+			properties := make([]byte, 80)
+			if _, err := io.ReadFull(r, properties); err != nil {
+				return 0, err
+			}
+			playDuration := binary.LittleEndian.Uint64(properties[40:48]) // в единицах по 100 нс
+			preroll := binary.LittleEndian.Uint64(properties[56:64])      // в миллисекундах, входит в Play Duration
+			flags := binary.LittleEndian.Uint32(properties[64:68])
+			if flags&asfBroadcastFlag != 0 || playDuration == 0 {
+				return 0, nil
+			}
+			return mediaDuration(float64(playDuration)/1e7 - float64(preroll)/1e3)
+		}
+
+		offset += int64(size)
+	}
+
+	return 0, errMediaHeader
+}
+
+// Ограничения разбора FLV: onMetaData пишется в первых тегах, а со списком ключевых кадров
+// длинной записи занимает до нескольких мегабайт
+const (
+	flvMaxProbeTags   = 8
+	flvMaxScriptSize  = 4 << 20
+	amfMaxNestedDepth = 16
+)
+
+// probeFLV читает размеры кадра и длительность из скриптового тега onMetaData.
+// Тег необязателен, без него размеры и длительность неизвестны
+func probeFLV(r io.ReadSeeker) (int, int, time.Duration, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, 0, 0, err
+	}
+
+	// "FLV" + версия(1) + флаги(1) + смещение данных(4)
+	header := make([]byte, 9)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, 0, err
+	}
+	// После заголовка - размер предыдущего тега (4 байта, всегда 0)
+	offset := int64(binary.BigEndian.Uint32(header[5:9])) + 4
+
+	tag := make([]byte, 11)
+	for range flvMaxProbeTags {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return 0, 0, 0, err
+		}
+		// Тег: тип(1) + размер данных(3) + время(4) + поток(3)
+		if _, err := io.ReadFull(r, tag); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return 0, 0, 0, nil
+			}
+			return 0, 0, 0, err
+		}
+		size := int64(tag[1])<<16 | int64(tag[2])<<8 | int64(tag[3])
+
+		if tag[0]&0x1F == 18 {
+			if size > flvMaxScriptSize {
+				return 0, 0, 0, nil
+			}
+			data := make([]byte, size)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return 0, 0, 0, errMediaHeader
+			}
+			width, height, duration, found, err := parseFLVMetadata(data)
+			if err != nil || found {
+				return width, height, duration, err
+			}
+		}
+
+		offset += 11 + size + 4
+	}
+
+	return 0, 0, 0, nil
+}
+
+// parseFLVMetadata разбирает AMF0 данные скриптового тега. found - тег оказался onMetaData
+func parseFLVMetadata(data []byte) (width, height int, duration time.Duration, found bool, err error) {
+	amf := &amfReader{data: data}
+	if amf.byte() != amfString || amf.string(amf.uint16()) != "onMetaData" {
+		return 0, 0, 0, false, amf.err
+	}
+
+	switch amf.byte() {
+	case amfECMAArray:
+		amf.uint32() // число элементов приблизительное, список заканчивается маркером
+	case amfObject:
+	default:
+		return 0, 0, 0, true, errMediaHeader
+	}
+
+	for amf.err == nil {
+		name := amf.string(amf.uint16())
+		valueType := amf.byte()
+		if name == "" && valueType == amfObjectEnd {
+			break
+		}
+		if valueType != amfNumber {
+			amf.skip(valueType, 0)
+			continue
+		}
+
+		value := amf.number()
+		switch name {
+		case "duration":
+			// Живые трансляции пишут 0
+			if value != 0 {
+				if duration, err = mediaDuration(value); err != nil {
+					return 0, 0, 0, true, err
+				}
+			}
+		case "width":
+			width = amfDimension(value)
+		case "height":
+			height = amfDimension(value)
+		}
+	}
+	if amf.err != nil {
+		return 0, 0, 0, true, amf.err
+	}
+
+	return width, height, duration, true, nil
+}
+
+// amfDimension приводит размер кадра из метаданных FLV к int. Нечисловые и отрицательные значения - неизвестно
+func amfDimension(value float64) int {
+	if math.IsNaN(value) || value <= 0 {
+		return 0
+	}
+	return int(min(value, math.MaxInt32))
+}
+
+// Маркеры типов AMF0
+const (
+	amfNumber      = 0x00
+	amfBoolean     = 0x01
+	amfString      = 0x02
+	amfObject      = 0x03
+	amfNull        = 0x05
+	amfUndefined   = 0x06
+	amfReference   = 0x07
+	amfECMAArray   = 0x08
+	amfObjectEnd   = 0x09
+	amfStrictArray = 0x0A
+	amfDate        = 0x0B
+	amfLongString  = 0x0C
+)
+
+// amfReader читает значения AMF0 из буфера. Первая ошибка запоминается, после нее чтения возвращают нули
+type amfReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (a *amfReader) next(n int) []byte {
+	if a.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(a.data)-a.pos {
+		a.err = errMediaHeader
+		return nil
+	}
+	value := a.data[a.pos : a.pos+n]
+	a.pos += n
+	return value
+}
+
+func (a *amfReader) byte() byte {
+	if value := a.next(1); value != nil {
+		return value[0]
+	}
+	return 0
+}
+
+func (a *amfReader) uint16() int {
+	if value := a.next(2); value != nil {
+		return int(binary.BigEndian.Uint16(value))
+	}
+	return 0
+}
+
+func (a *amfReader) uint32() int {
+	if value := a.next(4); value != nil {
+		return int(binary.BigEndian.Uint32(value))
+	}
+	return 0
+}
+
+func (a *amfReader) number() float64 {
+	if value := a.next(8); value != nil {
+		return math.Float64frombits(binary.BigEndian.Uint64(value))
+	}
+	return 0
+}
+
+func (a *amfReader) string(length int) string {
+	return string(a.next(length))
+}
+
+// skip пропускает значение заданного типа вместе с вложенными
+func (a *amfReader) skip(valueType byte, depth int) {
+	if depth > amfMaxNestedDepth {
+		a.err = errMediaHeader
+		return
+	}
+
+	switch valueType {
+	case amfNumber:
+		a.next(8)
+	case amfBoolean:
+		a.next(1)
+	case amfString:
+		a.next(a.uint16())
+	case amfLongString:
+		a.next(a.uint32())
+	case amfNull, amfUndefined:
+	case amfReference:
+		a.next(2)
+	case amfDate:
+		a.next(10)
+	case amfECMAArray, amfObject:
+		if valueType == amfECMAArray {
+			a.next(4)
+		}
+		for a.err == nil {
+			name := a.next(a.uint16())
+			nested := a.byte()
+			if len(name) == 0 && nested == amfObjectEnd {
+				return
+			}
+			a.skip(nested, depth+1)
+		}
+	case amfStrictArray:
+		for count := a.uint32(); count > 0 && a.err == nil; count-- {
+			a.skip(a.byte(), depth+1)
+		}
+	default:
+		a.err = errMediaHeader
+	}
+}
@@ -0,0 +1,198 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// mp4Box собирает атом ISO BMFF из типа и содержимого
+func mp4Box(boxType string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	box := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(box, boxType...), body...)
+}
+
+// testMP4 собирает MP4 с mvhd версии 0 и, если задан mehd, с mvex/mehd
+func testMP4(timescale, duration uint32, mehd []byte) []byte {
+	mvhd := make([]byte, 20)
+	binary.BigEndian.PutUint32(mvhd[12:16], timescale)
+	binary.BigEndian.PutUint32(mvhd[16:20], duration)
+
+	moov := [][]byte{mp4Box("mvhd", mvhd)}
+	if mehd != nil {
+		moov = append(moov, mp4Box("mvex", mp4Box("mehd", mehd)))
+	}
+	return append(mp4Box("ftyp", []byte("isom\x00\x00\x02\x00isom")), mp4Box("moov", moov...)...)
+}
+
+// testMP4v1 собирает MP4 с 64-битной длительностью в mvhd версии 1
+func testMP4v1(timescale uint32, duration uint64) []byte {
+	mvhd := make([]byte, 32)
+	mvhd[0] = 1
+	binary.BigEndian.PutUint32(mvhd[20:24], timescale)
+	binary.BigEndian.PutUint64(mvhd[24:32], duration)
+	return append(mp4Box("ftyp", []byte("isom\x00\x00\x02\x00isom")), mp4Box("moov", mp4Box("mvhd", mvhd))...)
+}
+
+// ebml собирает элемент EBML с размером в 8 байтах
+func ebml(id []byte, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	size := binary.BigEndian.AppendUint64(nil, uint64(len(body)))
+	size[0] = 0x01
+	return append(append(append([]byte{}, id...), size...), body...)
+}
+
+// testMatroska собирает Matroska с Info/Duration (float64) или без него
+func testMatroska(duration *float64) []byte {
+	header := ebml([]byte{0x1A, 0x45, 0xDF, 0xA3}, ebml([]byte{0x42, 0x82}, []byte("matroska")))
+	var info []byte
+	if duration != nil {
+		info = ebml([]byte{0x44, 0x89}, binary.BigEndian.AppendUint64(nil, math.Float64bits(*duration)))
+	}
+	segment := ebml([]byte{0x18, 0x53, 0x80, 0x67}, ebml([]byte{0x15, 0x49, 0xA9, 0x66}, info))
+	return append(header, segment...)
+}
+
+// riffChunk собирает чанк RIFF, список LIST - с типом в начале содержимого
+func riffChunk(id string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	chunk := binary.LittleEndian.AppendUint32([]byte(id), uint32(len(body)))
+	chunk = append(chunk, body...)
+	if len(body)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// testAVI собирает AVI с avih и, если grandFrames > 0, с odml/dmlh
+func testAVI(frameTime, frames, grandFrames uint32) []byte {
+	avih := make([]byte, 56)
+	binary.LittleEndian.PutUint32(avih[0:4], frameTime)
+	binary.LittleEndian.PutUint32(avih[16:20], frames)
+	binary.LittleEndian.PutUint32(avih[32:36], 640)
+	binary.LittleEndian.PutUint32(avih[36:40], 480)
+
+	hdrl := [][]byte{[]byte("hdrl"), riffChunk("avih", avih)}
+	if grandFrames > 0 {
+		hdrl = append(hdrl, riffChunk("LIST", []byte("odml"), riffChunk("dmlh", binary.LittleEndian.AppendUint32(nil, grandFrames))))
+	}
+	return riffChunk("RIFF", []byte("AVI "), riffChunk("LIST", hdrl...))
+}
+
+// testASF собирает заголовок ASF с объектом File Properties
+func testASF(playDuration, preroll uint64, flags uint32) []byte {
+	properties := make([]byte, 80)
+	binary.LittleEndian.PutUint64(properties[40:48], playDuration)
+	binary.LittleEndian.PutUint64(properties[56:64], preroll)
+	binary.LittleEndian.PutUint32(properties[64:68], flags)
+	object := binary.LittleEndian.AppendUint64(append([]byte{}, asfFilePropertiesGUID...), uint64(24+len(properties)))
+	object = append(object, properties...)
+
+	header := binary.LittleEndian.AppendUint64(append([]byte{}, asfHeaderGUID...), uint64(30+len(object)))
+	header = append(header, 1, 0, 0, 0, 1, 2)
+	return append(header, object...)
+}
+
+// testFLV собирает FLV со скриптовым тегом onMetaData из числовых свойств и списка ключевых кадров
+func testFLV(properties map[string]float64) []byte {
+	amfName := func(name string) []byte {
+		return append(binary.BigEndian.AppendUint16(nil, uint16(len(name))), name...)
+	}
+	amfNumberValue := func(value float64) []byte {
+		return binary.BigEndian.AppendUint64([]byte{amfNumber}, math.Float64bits(value))
+	}
+
+	data := append([]byte{amfString}, amfName("onMetaData")...)
+	data = append(data, amfECMAArray, 0, 0, 0, byte(len(properties)+1))
+	// Вложенный объект перед нужными свойствами: разбор должен его пропустить
+	data = append(data, amfName("keyframes")...)
+	data = append(data, amfObject)
+	data = append(data, amfName("times")...)
+	data = append(data, amfStrictArray, 0, 0, 0, 2)
+	data = append(data, amfNumberValue(0)...)
+	data = append(data, amfNumberValue(1)...)
+	data = append(data, 0, 0, amfObjectEnd)
+	for name, value := range properties {
+		data = append(data, amfName(name)...)
+		data = append(data, amfNumberValue(value)...)
+	}
+	data = append(data, 0, 0, amfObjectEnd)
+
+	file := []byte{'F', 'L', 'V', 1, 5, 0, 0, 0, 9, 0, 0, 0, 0}
+	file = append(file, 18, byte(len(data)>>16), byte(len(data)>>8), byte(len(data)), 0, 0, 0, 0, 0, 0, 0)
+	file = append(file, data...)
+	return binary.BigEndian.AppendUint32(file, uint32(11+len(data)))
+}
+
+func TestProbeMediaVideoDuration(t *testing.T) {
+	nan, negative, seconds := math.NaN(), -5000.0, 90000.0
+
+	tests := []struct {
+		name     string
+		data     []byte
+		format   string
+		duration time.Duration
+		corrupt  bool
+	}{
+		{name: "mp4", data: testMP4(1000, 90000, nil), format: FormatMP4, duration: 90 * time.Second},
+		{name: "mp4 overflowing time.Duration", data: testMP4v1(1, math.MaxInt64), format: FormatMP4, corrupt: true},
+		{name: "mp4 huge duration", data: testMP4v1(1000, 1<<62), format: FormatMP4, corrupt: true},
+		{name: "fragmented mp4 with mehd", data: testMP4(1000, 0, []byte{0, 0, 0, 0, 0, 0, 0x75, 0x30}), format: FormatMP4, duration: 30 * time.Second},
+		{name: "fragmented mp4 without mehd", data: testMP4(1000, 0, nil), format: FormatMP4},
+		{name: "matroska", data: testMatroska(&seconds), format: FormatMatroska, duration: 90 * time.Second},
+		{name: "matroska without duration", data: testMatroska(nil), format: FormatMatroska},
+		{name: "matroska NaN duration", data: testMatroska(&nan), format: FormatMatroska, corrupt: true},
+		{name: "matroska negative duration", data: testMatroska(&negative), format: FormatMatroska, corrupt: true},
+		{name: "avi", data: testAVI(40000, 250, 0), format: FormatAVI, duration: 10 * time.Second},
+		{name: "avi opendml", data: testAVI(40000, 250, 2500), format: FormatAVI, duration: 100 * time.Second},
+		{name: "avi unfinished", data: testAVI(40000, 0, 0), format: FormatAVI},
+		{name: "asf", data: testASF(123_000_000, 3000, 0), format: FormatASF, duration: 9300 * time.Millisecond},
+		{name: "asf broadcast", data: testASF(0, 3000, asfBroadcastFlag), format: FormatASF},
+		{name: "asf preroll longer than file", data: testASF(10_000_000, 3000, 0), format: FormatASF, corrupt: true},
+		{name: "flv", data: testFLV(map[string]float64{"duration": 12.5, "width": 1280, "height": 720}), format: FormatFLV, duration: 12500 * time.Millisecond},
+		{name: "flv live", data: testFLV(map[string]float64{"duration": 0}), format: FormatFLV},
+		{name: "flv NaN duration", data: testFLV(map[string]float64{"duration": nan}), format: FormatFLV, corrupt: true},
+		{name: "flv negative duration", data: testFLV(map[string]float64{"duration": -1}), format: FormatFLV, corrupt: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := probeMedia(bytes.NewReader(tt.data))
+			if info.Format != tt.format {
+				t.Fatalf("format = %q, want %q (err %v)", info.Format, tt.format, err)
+			}
+			if tt.corrupt {
+				if !errors.Is(err, errMediaHeader) {
+					t.Fatalf("err = %v, want errMediaHeader (duration %v)", err, info.Duration)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("probeMedia: %v", err)
+			}
+			if info.Duration != tt.duration {
+				t.Fatalf("duration = %v, want %v", info.Duration, tt.duration)
+			}
+		})
+	}
+}
+
+func TestVideoOfUnknownDurationRejectedWithLimit(t *testing.T) {
+	unknown := MediaInfo{Format: FormatFLV}
+
+	limited := &Validator{mediaLimits: MediaLimits{MaxVideoDuration: time.Minute}}
+	err := limited.validateMediaLimits(unknown)
+	var validationErr ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Code != FileErrorDuration {
+		t.Fatalf("err = %v, want %s", err, FileErrorDuration)
+	}
+
+	unlimited := &Validator{}
+	if err := unlimited.validateMediaLimits(unknown); err != nil {
+		t.Fatalf("video without a length limit rejected: %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package internal
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -21,6 +22,29 @@ type User struct {
 	LastStatsUpdate time.Time `json:"last_stats_update" example:"2024-01-15T09:00:00Z"`
 	CreatedAt       time.Time `json:"created_at" example:"2025-01-15T09:00:00Z"`
 	UpdatedAt       time.Time `json:"updated_at" example:"2025-01-15T09:00:00Z"`
+
+	// Тарифный план и персональные лимиты, переопределяющие лимиты плана (nil - как в плане)
+	Plan                  string `json:"plan" gorm:"default:'free'" example:"free" enums:"free,pro,unlimited"`
+	QuotaMaxStorageBytes  *int64 `json:"-"`
+	QuotaMaxFilesPerMonth *int   `json:"-"`
+	QuotaMaxVideoSeconds  *int   `json:"-"`
+	MonthlyUploads        int    `json:"-" gorm:"default:0"`
+	MonthlyUploadsPeriod  string `json:"-"`
+
+	// Роль и блокировка учетной записи
+	Role          string     `json:"role" gorm:"default:'user'" example:"user" enums:"user,admin,auditor"`
+	SuspendedAt   *time.Time `json:"suspended_at,omitempty" example:"2025-01-20T09:00:00Z"`
+	SuspendReason string     `json:"suspend_reason,omitempty" example:"Terms of service violation"`
+
+	// Двухфакторная аутентификация (TOTP)
+	TOTPSecret        string     `json:"-"`
+	TOTPPendingSecret string     `json:"-"`
+	TOTPLastStep      int64      `json:"-" gorm:"default:0"`
+	TOTPEnabledAt     *time.Time `json:"totp_enabled_at,omitempty" example:"2025-01-15T09:00:00Z"`
+
+	// Подтверждение email: новый адрес не применяется, пока не подтвержден по ссылке
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty" example:"2025-01-15T09:10:00Z"`
+	PendingEmail    string     `json:"pending_email,omitempty" example:"newemail@example.com"`
 }
 
 // File модель загруженного файла
@@ -33,12 +57,208 @@ type File struct {
 	ProcessedName string    `json:"processed_name,omitempty" gorm:"" example:"550e8400-e29b-41d4-a716-446655440000_processed.jpg"`
 	FileSize      int64     `json:"file_size" gorm:"not null" example:"1048576"`
 	ProcessedSize int64     `json:"processed_size,omitempty" gorm:"" example:"1048576"`
+	ContentHash   string    `json:"content_hash,omitempty" gorm:"" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	ProcessedHash string    `json:"processed_hash,omitempty" gorm:"" example:"60303ae22b998861bce3b28f33eec1be758a213c86c93c076dbe9f558c11c752"`
+	ThumbnailName string    `json:"thumbnail_name,omitempty" gorm:"" example:"550e8400-e29b-41d4-a716-446655440000_thumb.webp"`
+	PreviewName   string    `json:"preview_name,omitempty" gorm:"" example:"550e8400-e29b-41d4-a716-446655440000_preview.webp"`
+	ThumbnailHash string    `json:"-" gorm:""`
+	PreviewHash   string    `json:"-" gorm:""`
 	MimeType      string    `json:"mime_type" gorm:"not null" example:"image/jpeg"`
-	Status        string    `json:"status" gorm:"default:'uploaded'" example:"uploaded" enums:"uploaded,processing,completed,failed"`
+	Status        string    `json:"status" gorm:"default:'uploaded'" example:"uploaded" enums:"uploaded,processing,completed,failed,quarantined"`
 	ErrorMessage  string    `json:"error_message,omitempty" gorm:"" example:"Processing failed: invalid format"`
 	UploadedAt    time.Time `json:"uploaded_at" example:"2025-01-15T09:00:00Z"`
 	ProcessedAt   time.Time `json:"processed_at,omitempty" example:"2025-01-15T09:05:00Z"`
 	User          User      `json:"-" gorm:"foreignKey:UserID"`
+
+	// Организация, которой принадлежит файл (nil - личный файл пользователя)
+	OrganizationID *uint         `json:"organization_id,omitempty" gorm:"index" example:"3"`
+	Organization   *Organization `json:"-" gorm:"foreignKey:OrganizationID"`
+
+	// Опции, с которыми файл поставлен в обработку. Возвращаются только в ответе на загрузку
+	// и повторную обработку и не сохраняются
+	Options *ProcessingOptions `json:"options,omitempty" gorm:"-"`
+}
+
+// Organization организация (команда) с общей библиотекой файлов
+// @Description Organization (team) sharing a file library
+type Organization struct {
+	ID        uint      `json:"id" gorm:"primarykey" example:"3"`
+	Name      string    `json:"name" gorm:"not null" example:"Acme Newsroom"`
+	CreatedBy uint      `json:"created_by" gorm:"not null" example:"1"`
+	CreatedAt time.Time `json:"created_at" example:"2025-01-15T09:00:00Z"`
+	UpdatedAt time.Time `json:"updated_at" example:"2025-01-15T09:00:00Z"`
+
+	// Тарифный план и лимиты организации, общие для всех участников
+	Plan                  string `json:"plan" gorm:"default:'free'" example:"pro" enums:"free,pro,unlimited"`
+	QuotaMaxStorageBytes  *int64 `json:"-"`
+	QuotaMaxFilesPerMonth *int   `json:"-"`
+	QuotaMaxVideoSeconds  *int   `json:"-"`
+	MonthlyUploads        int    `json:"-" gorm:"default:0"`
+	MonthlyUploadsPeriod  string `json:"-"`
+
+	// Участники обязаны включить двухфакторную аутентификацию
+	Require2FA bool `json:"require_2fa" gorm:"column:require_2fa;default:false" example:"false"`
+}
+
+// Membership участие пользователя в организации
+// @Description Organization membership with the member's role
+type Membership struct {
+	ID             uint         `json:"id" gorm:"primarykey" example:"7"`
+	OrganizationID uint         `json:"organization_id" gorm:"uniqueIndex:idx_membership_org_user;not null" example:"3"`
+	UserID         uint         `json:"user_id" gorm:"uniqueIndex:idx_membership_org_user;index;not null" example:"1"`
+	Role           string       `json:"role" gorm:"not null;default:'member'" example:"member" enums:"owner,admin,member,viewer"`
+	CreatedAt      time.Time    `json:"created_at" example:"2025-01-15T09:00:00Z"`
+	Organization   Organization `json:"-" gorm:"foreignKey:OrganizationID"`
+	User           User         `json:"user" gorm:"foreignKey:UserID"`
+}
+
+// Session сессия пользователя, к которой привязан refresh токен.
+// Refresh токен имеет вид "<session id>.<secret>", в БД хранится только хеш секрета
+// @Description User login session
+type Session struct {
+	ID           string     `json:"id" gorm:"primarykey" example:"1b4e28ba-2fa1-11d2-883f-0016d3cca427"`
+	UserID       uint       `json:"user_id" gorm:"index;not null" example:"1"`
+	TokenHash    string     `json:"-" gorm:"not null"`
+	Generation   int        `json:"generation" gorm:"default:0" example:"3"`
+	UserAgent    string     `json:"user_agent" example:"Mozilla/5.0"`
+	IP           string     `json:"ip" example:"203.0.113.10"`
+	ExpiresAt    time.Time  `json:"expires_at" example:"2025-02-15T09:00:00Z"`
+	LastUsedAt   time.Time  `json:"last_used_at" example:"2025-01-15T09:30:00Z"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty" example:"2025-01-16T09:00:00Z"`
+	RevokeReason string     `json:"revoke_reason,omitempty" example:"logout"`
+	CreatedAt    time.Time  `json:"created_at" example:"2025-01-15T09:00:00Z"`
+	User         User       `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// APIKey персональный API ключ пользователя. Хранится только хеш ключа
+// @Description Personal API key (the secret itself is shown only once at creation)
+type APIKey struct {
+	ID         uint       `json:"id" gorm:"primarykey" example:"1"`
+	UserID     uint       `json:"user_id" gorm:"index;not null" example:"1"`
+	Name       string     `json:"name" gorm:"not null" example:"CI uploader"`
+	Prefix     string     `json:"prefix" gorm:"not null" example:"obs_Xk2f9aQp"`
+	KeyHash    string     `json:"-" gorm:"uniqueIndex;not null"`
+	Scopes     string     `json:"scopes" gorm:"not null" example:"read,upload"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" example:"2025-01-15T09:30:00Z"`
+	LastUsedIP string     `json:"last_used_ip,omitempty" example:"203.0.113.10"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" example:"2025-01-20T09:00:00Z"`
+	CreatedAt  time.Time  `json:"created_at" example:"2025-01-15T09:00:00Z"`
+	User       User       `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// ObjectPreset именованный набор типов объектов пользователя или организации
+// @Description Named set of object types. Built-in presets have no id, owner or timestamps and cannot be changed
+type ObjectPreset struct {
+	ID             uint      `json:"id,omitempty" gorm:"primarykey" example:"1"`
+	UserID         *uint     `json:"user_id,omitempty" gorm:"uniqueIndex:idx_object_presets_user_name" example:"1"`
+	OrganizationID *uint     `json:"organization_id,omitempty" gorm:"uniqueIndex:idx_object_presets_org_name" example:"1"`
+	Name           string    `json:"name" gorm:"not null;uniqueIndex:idx_object_presets_user_name;uniqueIndex:idx_object_presets_org_name" example:"privacy"`
+	Label          string    `json:"label" example:"Приватность"`
+	ObjectTypes    string    `json:"object_types" gorm:"not null" example:"face,person,cell phone"`
+	BuiltIn        bool      `json:"builtin" gorm:"-" example:"false"`
+	Unavailable    []string  `json:"unavailable_types,omitempty" gorm:"-" example:"license plate"` // типы встроенного набора, которых нет в каталоге ML сервиса
+	CreatedAt      time.Time `json:"created_at,omitempty" example:"2025-01-15T09:00:00Z"`
+	UpdatedAt      time.Time `json:"updated_at,omitempty" example:"2025-01-15T09:00:00Z"`
+}
+
+// ProcessingProfile сохраненные опции обработки пользователя. Основной профиль (is_default)
+// применяется к загрузкам и повторной обработке, если опции не указаны явно
+// @Description Saved processing options. At most one profile of a user is the default
+type ProcessingProfile struct {
+	ID           uint      `json:"id" gorm:"primarykey" example:"1"`
+	UserID       uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_processing_profiles_user_name" example:"1"`
+	Name         string    `json:"name" gorm:"not null;uniqueIndex:idx_processing_profiles_user_name" example:"street"`
+	BlurType     string    `json:"blur_type" gorm:"not null" example:"pixelate" enums:"gaussian,motion,pixelate"`
+	Intensity    int       `json:"intensity" gorm:"not null" example:"7"`
+	ObjectTypes  string    `json:"object_types" example:"face,car"`
+	Regions      []Region  `json:"regions" gorm:"serializer:json"`
+	OutputFormat string    `json:"output_format" gorm:"not null;default:'original'" example:"original" enums:"original,jpeg"`
+	IsDefault    bool      `json:"is_default" gorm:"not null;default:false" example:"true"`
+	CreatedAt    time.Time `json:"created_at" example:"2025-01-15T09:00:00Z"`
+	UpdatedAt    time.Time `json:"updated_at" example:"2025-01-15T09:00:00Z"`
+	User         User      `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// RecoveryCode одноразовый код восстановления доступа при потере аутентификатора
+type RecoveryCode struct {
+	ID        uint   `gorm:"primarykey"`
+	UserID    uint   `gorm:"index;not null"`
+	CodeHash  string `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+	User      User `gorm:"foreignKey:UserID"`
+}
+
+// UserToken одноразовый токен из письма (подтверждение email, сброс пароля). Хранится только хеш
+type UserToken struct {
+	ID        uint      `gorm:"primarykey"`
+	UserID    uint      `gorm:"index;not null"`
+	Purpose   string    `gorm:"not null"`
+	TokenHash string    `gorm:"uniqueIndex;not null"`
+	Email     string    // адрес, на который отправлено письмо
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+	User      User `gorm:"foreignKey:UserID"`
+}
+
+// Setting глобальная настройка, изменяемая администраторами
+type Setting struct {
+	Key       string `gorm:"primarykey"`
+	Value     string `gorm:"not null"`
+	UpdatedAt time.Time
+}
+
+// RateLimitCounter состояние лимита клиента для хранилища в PostgreSQL:
+// счетчик фиксированного окна, корзина токенов или журнал запросов скользящего окна
+type RateLimitCounter struct {
+	Key         string    `gorm:"primarykey"`
+	Count       int       `gorm:"not null"`
+	WindowStart time.Time `gorm:"not null"`
+	LastSeen    time.Time `gorm:"index;not null"`
+	Tokens      float64   `gorm:"not null;default:0"`
+	Hits        string    `gorm:"type:text;not null;default:''"` // время запросов в миллисекундах через запятую
+}
+
+// AccountDeletion задача удаления учетной записи. Не содержит персональных данных,
+// поэтому остается после удаления пользователя для отчета о статусе
+// @Description Account deletion job status
+type AccountDeletion struct {
+	ID           string     `json:"id" gorm:"primarykey" example:"7c9e6679-7425-40de-944b-e07fc1f90ae7"`
+	UserID       uint       `json:"user_id" gorm:"index;not null" example:"1"`
+	Status       string     `json:"status" gorm:"not null;default:'pending'" example:"running" enums:"pending,running,completed,failed"`
+	FilesTotal   int        `json:"files_total" example:"42"`
+	FilesDeleted int        `json:"files_deleted" example:"17"`
+	ErrorMessage string     `json:"error_message,omitempty" example:"failed to delete user records"`
+	RequestedAt  time.Time  `json:"requested_at" example:"2025-01-15T09:00:00Z"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty" example:"2025-01-15T09:01:00Z"`
+}
+
+// AuditEvent запись журнала аудита
+// @Description Security-relevant event recorded in the audit log
+type AuditEvent struct {
+	ID           uint      `json:"id" gorm:"primarykey" example:"1"`
+	Action       string    `json:"action" gorm:"index;not null" example:"login.lockout"`
+	Severity     string    `json:"severity" gorm:"index;not null;default:'info'" example:"alert" enums:"info,warning,alert"`
+	ActorID      *uint     `json:"actor_id,omitempty" gorm:"index" example:"1"`
+	TargetUserID *uint     `json:"target_user_id,omitempty" gorm:"index" example:"2"`
+	Subject      string    `json:"subject,omitempty" example:"account:user@example.com"`
+	IP           string    `json:"ip,omitempty" example:"203.0.113.10"`
+	Message      string    `json:"message" example:"Account locked for 15m0s after 10 failed login attempts"`
+	CreatedAt    time.Time `json:"created_at" gorm:"index" example:"2025-01-15T09:00:00Z"`
+}
+
+// UserIdentity внешняя учетная запись (OIDC), связанная с пользователем
+// @Description External SSO identity linked to a user
+type UserIdentity struct {
+	ID          uint      `json:"id" gorm:"primarykey" example:"1"`
+	UserID      uint      `json:"user_id" gorm:"index;not null" example:"1"`
+	Provider    string    `json:"provider" gorm:"uniqueIndex:idx_identity_provider_subject;not null" example:"corp"`
+	Subject     string    `json:"subject" gorm:"uniqueIndex:idx_identity_provider_subject;not null" example:"248289761001"`
+	Email       string    `json:"email" example:"user@example.com"`
+	LastLoginAt time.Time `json:"last_login_at" example:"2025-01-15T09:30:00Z"`
+	CreatedAt   time.Time `json:"created_at" example:"2025-01-15T09:00:00Z"`
+	User        User      `json:"-" gorm:"foreignKey:UserID"`
 }
 
 // ProcessingRequest запрос на обработку файла ML-сервисом
@@ -53,9 +273,24 @@ type ProcessingRequest struct {
 // ProcessingOptions опции обработки файла
 // @Description File processing options
 type ProcessingOptions struct {
-	BlurType    string   `json:"blur_type" example:"gaussian" enums:"gaussian,motion,pixelate"`
-	Intensity   int      `json:"intensity" example:"5"`
-	ObjectTypes []string `json:"object_types" example:"face,person,car"`
+	BlurType     string   `json:"blur_type" example:"gaussian" enums:"gaussian,motion,pixelate"`
+	Intensity    int      `json:"intensity" example:"5"`
+	ObjectTypes  []string `json:"object_types" example:"face,person,car"`
+	OutputFormat string   `json:"output_format,omitempty" example:"original" enums:"original,jpeg"` // для изображений
+	Preset       string   `json:"preset,omitempty" example:"privacy"`                               // набор, добавленный к object_types
+	SkippedTypes []string `json:"skipped_types,omitempty" example:"license plate"`                  // типы набора, которых нет в каталоге
+	Regions      []Region `json:"regions,omitempty"`                                                // области, размываемые целиком
+	Profile      string   `json:"profile,omitempty" example:"street"`                               // профиль, из которого взяты опции
+}
+
+// Region прямоугольная область кадра, которая размывается независимо от найденных объектов.
+// Координаты задаются долями ширины и высоты кадра, поэтому подходят для файлов любого размера
+// @Description Rectangle blurred on every frame. Coordinates are fractions (0-1) of the frame size
+type Region struct {
+	X      float64 `json:"x" example:"0.05"`
+	Y      float64 `json:"y" example:"0.8"`
+	Width  float64 `json:"width" example:"0.3"`
+	Height float64 `json:"height" example:"0.15"`
 }
 
 // ProcessingResponse ответ ML-сервиса
@@ -92,11 +327,221 @@ type UpdateProfileRequest struct {
 	Password string `json:"password,omitempty" binding:"omitempty,min=6,max=128" example:"newSecurePassword456"`
 }
 
+// RefreshTokenRequest запрос обновления access токена
+// @Description Refresh token exchange request
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required" example:"1b4e28ba-2fa1-11d2-883f-0016d3cca427.Vq3nS0d2..."`
+}
+
+// CreateAPIKeyRequest запрос создания API ключа
+// @Description API key creation request
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required,min=1,max=100" example:"CI uploader"`
+	Scopes []string `json:"scopes" binding:"required" example:"read,upload" enums:"read,upload,delete"`
+}
+
+// ObjectPresetRequest запрос создания или изменения набора типов объектов
+// @Description Object preset creation or update request. organization_id is only used on creation
+type ObjectPresetRequest struct {
+	Name           string   `json:"name" binding:"required" example:"privacy"`
+	Label          string   `json:"label" example:"Приватность"`
+	ObjectTypes    []string `json:"object_types" binding:"required" example:"face,person,cell phone"`
+	OrganizationID *uint    `json:"organization_id,omitempty" example:"1"`
+}
+
+// ProcessingProfileRequest запрос создания или изменения профиля обработки
+// @Description Processing profile creation or update request. Omitted blur_type, intensity and output_format get the server defaults
+type ProcessingProfileRequest struct {
+	Name         string   `json:"name" binding:"required" example:"street"`
+	BlurType     string   `json:"blur_type" example:"pixelate" enums:"gaussian,motion,pixelate"`
+	Intensity    int      `json:"intensity" example:"7"`
+	ObjectTypes  []string `json:"object_types" example:"face,car"`
+	Regions      []Region `json:"regions"`
+	OutputFormat string   `json:"output_format" example:"original" enums:"original,jpeg"`
+	IsDefault    bool     `json:"is_default" example:"true"`
+}
+
+// CreateAPIKeyResponse созданный API ключ
+// @Description Created API key with the secret, shown only once
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key" example:"obs_Xk2f9aQpR3mZ..."`
+}
+
+// SuspendUserRequest запрос блокировки пользователя
+// @Description User suspension request
+type SuspendUserRequest struct {
+	Reason string `json:"reason" example:"Terms of service violation"`
+}
+
+// UpdateRoleRequest запрос смены роли пользователя
+// @Description User role change request
+type UpdateRoleRequest struct {
+	Role string `json:"role" binding:"required" example:"auditor" enums:"user,admin,auditor"`
+}
+
+// AdminUserList страница списка пользователей
+// @Description Paginated list of users for administrators
+type AdminUserList struct {
+	Users  []User `json:"users"`
+	Total  int64  `json:"total" example:"120"`
+	Limit  int    `json:"limit" example:"50"`
+	Offset int    `json:"offset" example:"0"`
+}
+
+// AdminFileInfo информация о файле вместе с владельцем
+// @Description File information with its owner, as seen by administrators
+type AdminFileInfo struct {
+	File
+	Owner *User `json:"owner,omitempty"`
+}
+
+// AuditEventList страница журнала аудита
+// @Description Paginated audit log
+type AuditEventList struct {
+	Events []AuditEvent `json:"events"`
+	Total  int64        `json:"total" example:"42"`
+	Limit  int          `json:"limit" example:"50"`
+	Offset int          `json:"offset" example:"0"`
+}
+
+// CreateOrganizationRequest запрос создания организации
+// @Description Organization creation request
+type CreateOrganizationRequest struct {
+	Name string `json:"name" binding:"required,min=2,max=100" example:"Acme Newsroom"`
+}
+
+// AddMemberRequest запрос добавления участника организации
+// @Description Request to add an existing user to an organization
+type AddMemberRequest struct {
+	Email string `json:"email" binding:"required,email" example:"colleague@example.com"`
+	Role  string `json:"role" example:"member" enums:"admin,member,viewer"`
+}
+
+// UpdateMemberRequest запрос смены роли участника
+// @Description Request to change a member's role
+type UpdateMemberRequest struct {
+	Role string `json:"role" binding:"required" example:"viewer" enums:"owner,admin,member,viewer"`
+}
+
+// UserOrganization организация пользователя с его ролью
+// @Description Organization the current user belongs to, with the user's role in it
+type UserOrganization struct {
+	Organization
+	Role string `json:"role" example:"owner" enums:"owner,admin,member,viewer"`
+}
+
+// OrganizationStats статистика организации
+// @Description Aggregated organization statistics with quota limits and usage
+type OrganizationStats struct {
+	Organization
+	Members        int64       `json:"members" example:"5"`
+	TotalFiles     int64       `json:"total_files" example:"120"`
+	TotalProcessed int64       `json:"total_processed" example:"110"`
+	TotalFailed    int64       `json:"total_failed" example:"4"`
+	TotalSize      int64       `json:"total_size" example:"734003200"`
+	Quota          QuotaStatus `json:"quota"`
+}
+
+// OIDCProviderInfo провайдер единого входа
+// @Description Configured SSO provider
+type OIDCProviderInfo struct {
+	Name        string `json:"name" example:"corp"`
+	DisplayName string `json:"display_name" example:"Corporate SSO"`
+	LoginURL    string `json:"login_url" example:"/api/auth/oidc/corp/login"`
+}
+
+// LoginChallengeResponse ответ на вход, когда требуется второй фактор
+// @Description Returned by login instead of tokens when a second factor is required. Exchange the challenge token at /api/login/2fa, or enroll first via /api/login/2fa/setup when enrollment_required is true
+type LoginChallengeResponse struct {
+	TwoFactorRequired  bool   `json:"two_factor_required" example:"true"`
+	EnrollmentRequired bool   `json:"enrollment_required" example:"false"`
+	ChallengeToken     string `json:"challenge_token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	ExpiresIn          int    `json:"expires_in" example:"300"`
+}
+
+// TwoFactorLoginRequest второй шаг входа
+// @Description Second login step: a TOTP code or one of the recovery codes
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	Code           string `json:"code,omitempty" example:"123456"`
+	RecoveryCode   string `json:"recovery_code,omitempty" example:"k7m2p-x9q4r"`
+}
+
+// TwoFactorCodeRequest запрос с кодом аутентификатора
+// @Description Request carrying a TOTP code (and the password when disabling 2FA)
+type TwoFactorCodeRequest struct {
+	Code     string `json:"code" binding:"required" example:"123456"`
+	Password string `json:"password,omitempty" example:"securePassword123"`
+}
+
+// TwoFactorSetupResponse данные для подключения аутентификатора
+// @Description Secret and otpauth URI to add to an authenticator app (render the URI as a QR code)
+type TwoFactorSetupResponse struct {
+	Secret     string `json:"secret" example:"JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"`
+	OTPAuthURI string `json:"otpauth_uri" example:"otpauth://totp/Obscura:user@example.com?secret=JBSWY3DPEHPK3PXP&issuer=Obscura"`
+}
+
+// RecoveryCodesResponse новые коды восстановления
+// @Description One-time recovery codes, shown only once
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string      `json:"recovery_codes" example:"k7m2p-x9q4r,a3b4c-d5e6f"`
+	Auth          *AuthResponse `json:"auth,omitempty"`
+}
+
+// TwoFactorStatus состояние двухфакторной аутентификации пользователя
+// @Description Two-factor authentication status of the current user
+type TwoFactorStatus struct {
+	Enabled                bool       `json:"enabled" example:"true"`
+	EnabledAt              *time.Time `json:"enabled_at,omitempty" example:"2025-01-15T09:00:00Z"`
+	Required               bool       `json:"required" example:"false"`
+	RecoveryCodesRemaining int64      `json:"recovery_codes_remaining" example:"8"`
+}
+
+// TwoFactorPolicyRequest запрос изменения требования 2FA
+// @Description Whether two-factor authentication is mandatory
+type TwoFactorPolicyRequest struct {
+	Require2FA bool `json:"require_2fa" example:"true"`
+}
+
+// EmailRequest запрос письма на указанный адрес
+// @Description Request carrying an email address (password reset, verification resend)
+type EmailRequest struct {
+	Email string `json:"email" binding:"required,email" example:"user@example.com"`
+}
+
+// TokenRequest подтверждение токеном из письма
+// @Description Request carrying a token from an email link
+type TokenRequest struct {
+	Token string `json:"token" binding:"required" example:"mJ1a0Vd3x0Xp8cE9q2bS7wRkZ4nT6yHf..."`
+}
+
+// ResetPasswordRequest установка нового пароля по токену из письма
+// @Description Password reset confirmation with the token from the email and a new password
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required" example:"mJ1a0Vd3x0Xp8cE9q2bS7wRkZ4nT6yHf..."`
+	Password string `json:"password" binding:"required,min=6,max=128" example:"newSecurePassword456"`
+}
+
+// UserExport профиль пользователя в архиве экспорта данных (profile.json)
+// @Description Personal data included in the account export archive
+type UserExport struct {
+	ExportedAt    time.Time           `json:"exported_at" example:"2025-01-15T09:00:00Z"`
+	User          User                `json:"user"`
+	Organizations []UserOrganization  `json:"organizations"`
+	Identities    []UserIdentity      `json:"identities"`
+	APIKeys       []APIKey            `json:"api_keys"`
+	Sessions      []Session           `json:"sessions"`
+	Profiles      []ProcessingProfile `json:"processing_profiles"`
+}
+
 // AuthResponse ответ авторизации
-// @Description Authentication response with JWT token
+// @Description Authentication response with JWT access token and rotating refresh token
 type AuthResponse struct {
-	Token string `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
-	User  User   `json:"user"`
+	Token        string `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	RefreshToken string `json:"refresh_token,omitempty" example:"1b4e28ba-2fa1-11d2-883f-0016d3cca427.Vq3nS0d2..."`
+	ExpiresIn    int    `json:"expires_in,omitempty" example:"1800"`
+	User         User   `json:"user"`
 }
 
 // ErrorResponse ошибка API
@@ -117,6 +562,7 @@ type SuccessResponse struct {
 type ValidationError struct {
 	Field   string `json:"field" example:"email"`
 	Message string `json:"message" example:"Email is required"`
+	Code    string `json:"code,omitempty" example:"content_mismatch"`
 }
 
 func (e ValidationError) Error() string {
@@ -144,6 +590,63 @@ func (f *File) IsProcessed() bool {
 	return f.Status == StatusCompleted && f.ProcessedName != ""
 }
 
+// BlobNames возвращает имена всех файлов в хранилище, принадлежащих записи
+func (f *File) BlobNames() []string {
+	names := []string{f.FileName}
+	for _, name := range []string{f.ProcessedName, f.ThumbnailName, f.PreviewName} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// TwoFactorEnabled проверяет, включена ли двухфакторная аутентификация
+func (u *User) TwoFactorEnabled() bool {
+	return u.TOTPEnabledAt != nil && u.TOTPSecret != ""
+}
+
+// EmailVerified проверяет, подтвержден ли текущий email
+func (u *User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// IsSuspended проверяет, заблокирована ли учетная запись
+func (u *User) IsSuspended() bool {
+	return u.SuspendedAt != nil
+}
+
+// ObjectTypeList возвращает типы объектов набора списком
+func (p *ObjectPreset) ObjectTypeList() []string {
+	if p.ObjectTypes == "" {
+		return nil
+	}
+	return strings.Split(p.ObjectTypes, ",")
+}
+
+// Options возвращает опции обработки профиля
+func (p *ProcessingProfile) Options() ProcessingOptions {
+	options := ProcessingOptions{
+		BlurType:     p.BlurType,
+		Intensity:    p.Intensity,
+		OutputFormat: p.OutputFormat,
+		Regions:      p.Regions,
+		Profile:      p.Name,
+	}
+	if p.ObjectTypes != "" {
+		options.ObjectTypes = strings.Split(p.ObjectTypes, ",")
+	}
+	return options
+}
+
+// ScopeList возвращает права ключа списком
+func (k *APIKey) ScopeList() []string {
+	if k.Scopes == "" {
+		return nil
+	}
+	return strings.Split(k.Scopes, ",")
+}
+
 // CanBeProcessed проверяет, может ли файл быть обработан
 func (f *File) CanBeProcessed() bool {
 	return f.Status == StatusUploaded || f.Status == StatusFailed
@@ -151,8 +654,9 @@ func (f *File) CanBeProcessed() bool {
 
 // Статусы файлов
 const (
-	StatusUploaded   = "uploaded"
-	StatusProcessing = "processing"
-	StatusCompleted  = "completed"
-	StatusFailed     = "failed"
+	StatusUploaded    = "uploaded"
+	StatusProcessing  = "processing"
+	StatusCompleted   = "completed"
+	StatusFailed      = "failed"
+	StatusQuarantined = "quarantined" // заражен: перенесен в карантин, не обрабатывается и не скачивается
 )
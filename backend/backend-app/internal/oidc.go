@@ -0,0 +1,526 @@
+package internal
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	oidcStateTTL        = 10 * time.Minute
+	oidcDiscoveryTTL    = time.Hour
+	oidcKeysMinRefresh  = time.Minute // не чаще перезапрашиваем JWKS при неизвестном kid
+	oidcHTTPTimeout     = 10 * time.Second
+	oidcMaxResponseSize = 1 << 20
+)
+
+// Алгоритмы подписи ID токенов, которые мы принимаем
+var oidcSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+var (
+	errOIDCInvalidState = errors.New("invalid or expired login state")
+	errOIDCUnknownKey   = errors.New("signing key not found in provider JWKS")
+	errOIDCNonce        = errors.New("ID token nonce mismatch")
+	errOIDCMFARequired  = errors.New("ID token does not show a second factor login")
+)
+
+// oidcDiscovery документ /.well-known/openid-configuration
+type oidcDiscovery struct {
+	Issuer                   string   `json:"issuer"`
+	AuthorizationEndpoint    string   `json:"authorization_endpoint"`
+	TokenEndpoint            string   `json:"token_endpoint"`
+	JWKSURI                  string   `json:"jwks_uri"`
+	TokenEndpointAuthMethods []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// jsonWebKey ключ JWKS (RFC 7517): ключи провайдеров и собственные ключи подписи токенов
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// OIDCClaims проверенные данные пользователя из ID токена
+type OIDCClaims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	// Провайдер подтвердил вход со вторым фактором (см. OIDCProviderConfig.RequiredMFA)
+	MFA bool
+}
+
+// OIDCProvider клиент одного провайдера: кеширует discovery-документ и ключи JWKS
+type OIDCProvider struct {
+	config OIDCProviderConfig
+	client *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	discoveredAt  time.Time
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+}
+
+// oidcLoginState данные начатого входа, сохраняемые до callback
+type oidcLoginState struct {
+	provider  string
+	verifier  string
+	nonce     string
+	expiresAt time.Time
+}
+
+// OIDCManager хранит провайдеров и состояния незавершенных входов
+type OIDCManager struct {
+	providers map[string]*OIDCProvider
+
+	mu     sync.Mutex
+	states map[string]oidcLoginState
+}
+
+// NewOIDCManager создает менеджер для провайдеров из конфигурации
+func NewOIDCManager(configs []OIDCProviderConfig) *OIDCManager {
+	manager := &OIDCManager{
+		providers: make(map[string]*OIDCProvider, len(configs)),
+		states:    make(map[string]oidcLoginState),
+	}
+	for _, cfg := range configs {
+		manager.providers[cfg.Name] = &OIDCProvider{
+			config: cfg,
+			client: &http.Client{Timeout: oidcHTTPTimeout},
+		}
+	}
+	return manager
+}
+
+// Provider возвращает провайдера по имени
+func (m *OIDCManager) Provider(name string) (*OIDCProvider, bool) {
+	provider, ok := m.providers[name]
+	return provider, ok
+}
+
+// Providers возвращает провайдеров, отсортированных по имени
+func (m *OIDCManager) Providers() []*OIDCProvider {
+	providers := make([]*OIDCProvider, 0, len(m.providers))
+	for _, provider := range m.providers {
+		providers = append(providers, provider)
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].config.Name < providers[j].config.Name
+	})
+	return providers
+}
+
+// StartLogin создает state, nonce и PKCE verifier и возвращает адрес авторизации провайдера
+func (m *OIDCManager) StartLogin(ctx context.Context, provider *OIDCProvider) (string, error) {
+	discovery, err := provider.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := randomURLToken(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomURLToken(32)
+	if err != nil {
+		return "", err
+	}
+	verifier, err := randomURLToken(48)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	now := time.Now()
+	for key, pending := range m.states {
+		if now.After(pending.expiresAt) {
+			delete(m.states, key)
+		}
+	}
+	m.states[state] = oidcLoginState{
+		provider:  provider.config.Name,
+		verifier:  verifier,
+		nonce:     nonce,
+		expiresAt: now.Add(oidcStateTTL),
+	}
+	m.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(verifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {provider.config.ClientID},
+		"redirect_uri":          {provider.config.RedirectURL},
+		"scope":                 {strings.Join(provider.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// ConsumeState возвращает и удаляет состояние входа. State одноразовый
+func (m *OIDCManager) ConsumeState(state, providerName string) (oidcLoginState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pending, ok := m.states[state]
+	if !ok {
+		return oidcLoginState{}, errOIDCInvalidState
+	}
+	delete(m.states, state)
+
+	if pending.provider != providerName || time.Now().After(pending.expiresAt) {
+		return oidcLoginState{}, errOIDCInvalidState
+	}
+	return pending, nil
+}
+
+// Name возвращает имя провайдера
+func (p *OIDCProvider) Name() string {
+	return p.config.Name
+}
+
+// Exchange обменивает код авторизации на ID токен
+func (p *OIDCProvider) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"client_id":     {p.config.ClientID},
+		"code_verifier": {verifier},
+	}
+
+	// По умолчанию (RFC 8414) провайдеры ожидают client_secret_basic
+	useBasic := p.config.ClientSecret != "" &&
+		(len(discovery.TokenEndpointAuthMethods) == 0 || slices.Contains(discovery.TokenEndpointAuthMethods, "client_secret_basic"))
+	if p.config.ClientSecret != "" && !useBasic {
+		form.Set("client_secret", p.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if useBasic {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.doJSON(req, &tokens)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %w", err)
+	}
+	if status != http.StatusOK || tokens.Error != "" {
+		return "", fmt.Errorf("token endpoint returned %d: %s %s", status, tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return "", errors.New("token response has no id_token")
+	}
+
+	return tokens.IDToken, nil
+}
+
+// VerifyIDToken проверяет подпись ID токена по JWKS, issuer, audience, срок действия и nonce
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, rawToken, nonce string) (*OIDCClaims, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(rawToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.signingKey(ctx, discovery, kid)
+	},
+		jwt.WithValidMethods(oidcSigningMethods),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce != nonce {
+		return nil, errOIDCNonce
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, errors.New("ID token has no subject")
+	}
+
+	result := &OIDCClaims{Subject: subject}
+	result.Email, _ = claims["email"].(string)
+	result.Name, _ = claims["name"].(string)
+
+	// Некоторые провайдеры передают email_verified строкой
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = verified
+	case string:
+		result.EmailVerified = verified == "true"
+	}
+	if p.config.TrustEmail && result.Email != "" {
+		result.EmailVerified = true
+	}
+
+	if len(p.config.RequiredMFA) > 0 {
+		if !hasMFAClaim(claims, p.config.RequiredMFA) {
+			return nil, errOIDCMFARequired
+		}
+		result.MFA = true
+	}
+
+	return result, nil
+}
+
+// hasMFAClaim проверяет, что acr или один из методов amr входит в список допустимых
+func hasMFAClaim(claims jwt.MapClaims, allowed []string) bool {
+	if acr, _ := claims["acr"].(string); acr != "" && slices.Contains(allowed, acr) {
+		return true
+	}
+	methods, _ := claims["amr"].([]interface{})
+	for _, method := range methods {
+		if value, _ := method.(string); value != "" && slices.Contains(allowed, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// discover загружает discovery-документ провайдера и кеширует его
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	if p.discovery != nil && time.Since(p.discoveredAt) < oidcDiscoveryTTL {
+		discovery := p.discovery
+		p.mu.Unlock()
+		return discovery, nil
+	}
+	p.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.config.IssuerURL+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var discovery oidcDiscovery
+	status, err := p.doJSON(req, &discovery)
+	if err != nil {
+		return nil, fmt.Errorf("discovery failed: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("discovery returned status %d", status)
+	}
+
+	if strings.TrimRight(discovery.Issuer, "/") != p.config.IssuerURL {
+		return nil, fmt.Errorf("discovery issuer %q does not match configured issuer %q", discovery.Issuer, p.config.IssuerURL)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing required endpoints")
+	}
+
+	p.mu.Lock()
+	p.discovery = &discovery
+	p.discoveredAt = time.Now()
+	p.mu.Unlock()
+
+	return &discovery, nil
+}
+
+// signingKey возвращает ключ по kid, перезапрашивая JWKS при ротации ключей провайдером
+func (p *OIDCProvider) signingKey(ctx context.Context, discovery *oidcDiscovery, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	key, ok := p.lookupKey(kid)
+	canRefresh := time.Since(p.keysFetchedAt) >= oidcKeysMinRefresh
+	p.mu.Unlock()
+
+	if ok {
+		return key, nil
+	}
+	if !canRefresh {
+		return nil, errOIDCUnknownKey
+	}
+
+	keys, err := p.fetchKeys(ctx, discovery.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, errOIDCUnknownKey
+}
+
+// lookupKey ищет ключ в кеше. Токен без kid допустим, только если ключ один
+func (p *OIDCProvider) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" {
+		if len(p.keys) != 1 {
+			return nil, false
+		}
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+// fetchKeys загружает и разбирает JWKS. Ключи неподдерживаемых типов пропускаются
+func (p *OIDCProvider) fetchKeys(ctx context.Context, jwksURI string) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURI, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	status, err := p.doJSON(req, &jwks)
+	if err != nil {
+		return nil, fmt.Errorf("JWKS request failed: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("JWKS endpoint returned status %d", status)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+// doJSON выполняет запрос и декодирует JSON ответ. Возвращает HTTP статус
+func (p *OIDCProvider) doJSON(req *http.Request, target interface{}) (int, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponseSize)).Decode(target); err != nil {
+		return resp.StatusCode, fmt.Errorf("invalid JSON response (status %d): %w", resp.StatusCode, err)
+	}
+	return resp.StatusCode, nil
+}
+
+// publicKey преобразует JWK в открытый ключ
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// randomURLToken генерирует случайную строку для state, nonce и PKCE verifier
+func randomURLToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
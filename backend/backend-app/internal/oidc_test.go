@@ -0,0 +1,409 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	mockOIDCClientID     = "obscura"
+	mockOIDCClientSecret = "secret"
+	mockOIDCKeyID        = "test-key"
+)
+
+// mockOIDCCode выданный код авторизации с параметрами запроса авторизации
+type mockOIDCCode struct {
+	challenge string
+	nonce     string
+}
+
+// mockOIDCProvider провайдер OpenID Connect для тестов: discovery, JWKS и token endpoint с проверкой PKCE
+type mockOIDCProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockOIDCCode
+	// claims добавляются в ID токен поверх стандартных (iss, aud, sub, nonce, exp)
+	claims jwt.MapClaims
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	mock := &mockOIDCProvider{
+		t:      t,
+		key:    key,
+		codes:  make(map[string]mockOIDCCode),
+		claims: jwt.MapClaims{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", mock.handleDiscovery)
+	mux.HandleFunc("/jwks", mock.handleJWKS)
+	mux.HandleFunc("/token", mock.handleToken)
+	mock.server = httptest.NewServer(mux)
+	t.Cleanup(mock.server.Close)
+
+	return mock
+}
+
+func (m *mockOIDCProvider) config() OIDCProviderConfig {
+	return OIDCProviderConfig{
+		Name:         "corp",
+		IssuerURL:    m.server.URL,
+		ClientID:     mockOIDCClientID,
+		ClientSecret: mockOIDCClientSecret,
+		RedirectURL:  "http://localhost:8080/api/auth/oidc/corp/callback",
+		Scopes:       []string{"openid", "email", "profile"},
+	}
+}
+
+func (m *mockOIDCProvider) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(oidcDiscovery{
+		Issuer:                   m.server.URL,
+		AuthorizationEndpoint:    m.server.URL + "/authorize",
+		TokenEndpoint:            m.server.URL + "/token",
+		JWKSURI:                  m.server.URL + "/jwks",
+		TokenEndpointAuthMethods: []string{"client_secret_basic"},
+	})
+}
+
+func (m *mockOIDCProvider) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string][]jsonWebKey{
+		"keys": {{
+			Kty: "RSA",
+			Kid: mockOIDCKeyID,
+			Use: "sig",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (m *mockOIDCProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	tokenError := func(code string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError("invalid_request")
+		return
+	}
+	if clientID, secret, ok := r.BasicAuth(); !ok || clientID != mockOIDCClientID || secret != mockOIDCClientSecret {
+		tokenError("invalid_client")
+		return
+	}
+
+	m.mu.Lock()
+	code, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+	if !ok {
+		tokenError("invalid_grant")
+		return
+	}
+
+	// PKCE S256: BASE64URL(SHA256(code_verifier)) должен совпасть с code_challenge запроса авторизации
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+		tokenError("invalid_grant")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"id_token": m.signIDToken(code.nonce)})
+}
+
+func (m *mockOIDCProvider) signIDToken(nonce string) string {
+	claims := jwt.MapClaims{
+		"iss":   m.server.URL,
+		"aud":   mockOIDCClientID,
+		"sub":   "user-1",
+		"nonce": nonce,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(5 * time.Minute).Unix(),
+	}
+	m.mu.Lock()
+	for name, value := range m.claims {
+		claims[name] = value
+	}
+	m.mu.Unlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = mockOIDCKeyID
+	signed, err := token.SignedString(m.key)
+	if err != nil {
+		m.t.Errorf("sign ID token: %v", err)
+	}
+	return signed
+}
+
+func (m *mockOIDCProvider) setClaims(claims jwt.MapClaims) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.claims = claims
+}
+
+// authorize имитирует вход пользователя у провайдера: принимает адрес авторизации и
+// возвращает state и код, с которыми провайдер перенаправил бы браузер на callback
+func (m *mockOIDCProvider) authorize(authURL string) (state, code string) {
+	m.t.Helper()
+
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		m.t.Fatalf("parse authorization URL: %v", err)
+	}
+	query := parsed.Query()
+	if method := query.Get("code_challenge_method"); method != "S256" {
+		m.t.Fatalf("code_challenge_method = %q, want S256", method)
+	}
+	if query.Get("code_challenge") == "" || query.Get("nonce") == "" || query.Get("state") == "" {
+		m.t.Fatalf("authorization URL without challenge, nonce or state: %s", authURL)
+	}
+
+	code, err = randomURLToken(16)
+	if err != nil {
+		m.t.Fatalf("generate code: %v", err)
+	}
+	m.mu.Lock()
+	m.codes[code] = mockOIDCCode{challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+	m.mu.Unlock()
+
+	return query.Get("state"), code
+}
+
+// completeLogin проходит вход до проверки ID токена так же, как handleOIDCCallback
+func completeLogin(t *testing.T, mock *mockOIDCProvider, config OIDCProviderConfig) (*OIDCClaims, error) {
+	t.Helper()
+
+	manager := NewOIDCManager([]OIDCProviderConfig{config})
+	provider, _ := manager.Provider("corp")
+	ctx := context.Background()
+
+	authURL, err := manager.StartLogin(ctx, provider)
+	if err != nil {
+		t.Fatalf("StartLogin: %v", err)
+	}
+	state, code := mock.authorize(authURL)
+
+	pending, err := manager.ConsumeState(state, provider.Name())
+	if err != nil {
+		t.Fatalf("ConsumeState: %v", err)
+	}
+	idToken, err := provider.Exchange(ctx, code, pending.verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	return provider.VerifyIDToken(ctx, idToken, pending.nonce)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	mock := newMockOIDCProvider(t)
+	mock.setClaims(jwt.MapClaims{"email": "user@example.com", "email_verified": true, "name": "Test User"})
+
+	claims, err := completeLogin(t, mock, mock.config())
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if claims.Subject != "user-1" || claims.Email != "user@example.com" || !claims.EmailVerified || claims.Name != "Test User" {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+}
+
+func TestOIDCStateIsSingleUse(t *testing.T) {
+	mock := newMockOIDCProvider(t)
+	manager := NewOIDCManager([]OIDCProviderConfig{mock.config()})
+	provider, _ := manager.Provider("corp")
+
+	authURL, err := manager.StartLogin(context.Background(), provider)
+	if err != nil {
+		t.Fatalf("StartLogin: %v", err)
+	}
+	state, _ := mock.authorize(authURL)
+
+	if _, err := manager.ConsumeState(state, provider.Name()); err != nil {
+		t.Fatalf("first ConsumeState: %v", err)
+	}
+	if _, err := manager.ConsumeState(state, provider.Name()); !errors.Is(err, errOIDCInvalidState) {
+		t.Fatalf("reused state: err = %v, want errOIDCInvalidState", err)
+	}
+	if _, err := manager.ConsumeState("unknown", provider.Name()); !errors.Is(err, errOIDCInvalidState) {
+		t.Fatalf("unknown state: err = %v, want errOIDCInvalidState", err)
+	}
+
+	// State другого провайдера отклоняется и больше не действует
+	authURL, err = manager.StartLogin(context.Background(), provider)
+	if err != nil {
+		t.Fatalf("StartLogin: %v", err)
+	}
+	state, _ = mock.authorize(authURL)
+	if _, err := manager.ConsumeState(state, "other"); !errors.Is(err, errOIDCInvalidState) {
+		t.Fatalf("state of another provider: err = %v, want errOIDCInvalidState", err)
+	}
+	if _, err := manager.ConsumeState(state, provider.Name()); !errors.Is(err, errOIDCInvalidState) {
+		t.Fatalf("state after provider mismatch: err = %v, want errOIDCInvalidState", err)
+	}
+}
+
+func TestOIDCExchangeSendsPKCEVerifier(t *testing.T) {
+	mock := newMockOIDCProvider(t)
+	manager := NewOIDCManager([]OIDCProviderConfig{mock.config()})
+	provider, _ := manager.Provider("corp")
+	ctx := context.Background()
+
+	authURL, err := manager.StartLogin(ctx, provider)
+	if err != nil {
+		t.Fatalf("StartLogin: %v", err)
+	}
+	state, code := mock.authorize(authURL)
+	pending, err := manager.ConsumeState(state, provider.Name())
+	if err != nil {
+		t.Fatalf("ConsumeState: %v", err)
+	}
+
+	// Код, перехваченный без verifier, обменять нельзя
+	if _, err := provider.Exchange(ctx, code, "wrong-verifier"); err == nil {
+		t.Fatal("Exchange with wrong verifier succeeded")
+	}
+
+	authURL, err = manager.StartLogin(ctx, provider)
+	if err != nil {
+		t.Fatalf("StartLogin: %v", err)
+	}
+	state, code = mock.authorize(authURL)
+	pending, err = manager.ConsumeState(state, provider.Name())
+	if err != nil {
+		t.Fatalf("ConsumeState: %v", err)
+	}
+	if _, err := provider.Exchange(ctx, code, pending.verifier); err != nil {
+		t.Fatalf("Exchange with verifier: %v", err)
+	}
+	// Код одноразовый
+	if _, err := provider.Exchange(ctx, code, pending.verifier); err == nil {
+		t.Fatal("Exchange with reused code succeeded")
+	}
+}
+
+func TestOIDCVerifyIDTokenRejectsInvalidClaims(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		want   error
+	}{
+		{name: "nonce mismatch", claims: jwt.MapClaims{"nonce": "other-nonce"}, want: errOIDCNonce},
+		{name: "missing nonce", claims: jwt.MapClaims{"nonce": nil}, want: errOIDCNonce},
+		{name: "wrong audience", claims: jwt.MapClaims{"aud": "another-client"}, want: jwt.ErrTokenInvalidAudience},
+		{name: "wrong issuer", claims: jwt.MapClaims{"iss": "https://evil.example.com"}, want: jwt.ErrTokenInvalidIssuer},
+		{name: "expired", claims: jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}, want: jwt.ErrTokenExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockOIDCProvider(t)
+			mock.setClaims(tt.claims)
+
+			claims, err := completeLogin(t, mock, mock.config())
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v (claims %+v)", err, tt.want, claims)
+			}
+		})
+	}
+}
+
+func TestOIDCRequiredMFA(t *testing.T) {
+	tests := []struct {
+		name     string
+		claims   jwt.MapClaims
+		required []string
+		mfa      bool
+		want     error
+	}{
+		{name: "not required", claims: jwt.MapClaims{}},
+		{name: "not required, amr ignored", claims: jwt.MapClaims{"amr": []string{"mfa"}}},
+		{name: "amr matches", claims: jwt.MapClaims{"amr": []string{"pwd", "otp"}}, required: []string{"mfa", "otp"}, mfa: true},
+		{name: "acr matches", claims: jwt.MapClaims{"acr": "phrh"}, required: []string{"phrh"}, mfa: true},
+		{name: "password only", claims: jwt.MapClaims{"amr": []string{"pwd"}}, required: []string{"mfa"}, want: errOIDCMFARequired},
+		{name: "no amr or acr", claims: jwt.MapClaims{}, required: []string{"mfa"}, want: errOIDCMFARequired},
+		{name: "amr as string", claims: jwt.MapClaims{"amr": "mfa"}, required: []string{"mfa"}, want: errOIDCMFARequired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockOIDCProvider(t)
+			mock.setClaims(tt.claims)
+			config := mock.config()
+			config.RequiredMFA = tt.required
+
+			claims, err := completeLogin(t, mock, config)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if err == nil && claims.MFA != tt.mfa {
+				t.Fatalf("MFA = %v, want %v", claims.MFA, tt.mfa)
+			}
+		})
+	}
+}
+
+func TestOIDCUnverifiedEmailIsNotLinked(t *testing.T) {
+	verifiedAt := time.Now()
+	verifiedUser := &User{Email: "user@example.com", EmailVerifiedAt: &verifiedAt}
+	unverifiedUser := &User{Email: "user@example.com"}
+
+	tests := []struct {
+		name       string
+		claims     jwt.MapClaims
+		trustEmail bool
+		existing   *User
+		want       error
+	}{
+		{name: "email not verified by provider", claims: jwt.MapClaims{"email_verified": false}, existing: verifiedUser, want: errSSOEmailConflict},
+		{name: "email_verified as string", claims: jwt.MapClaims{"email_verified": "false"}, existing: verifiedUser, want: errSSOEmailConflict},
+		{name: "email_verified missing", claims: jwt.MapClaims{}, existing: verifiedUser, want: errSSOEmailConflict},
+		{name: "local account not verified", claims: jwt.MapClaims{"email_verified": true}, existing: unverifiedUser, want: errSSOAccountUnverified},
+		{name: "trusted provider, local account not verified", claims: jwt.MapClaims{}, trustEmail: true, existing: unverifiedUser, want: errSSOAccountUnverified},
+		{name: "trusted provider", claims: jwt.MapClaims{}, trustEmail: true, existing: verifiedUser},
+		{name: "both verified", claims: jwt.MapClaims{"email_verified": "true"}, existing: verifiedUser},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockOIDCProvider(t)
+			tt.claims["email"] = "user@example.com"
+			mock.setClaims(tt.claims)
+
+			config := mock.config()
+			config.TrustEmail = tt.trustEmail
+			claims, err := completeLogin(t, mock, config)
+			if err != nil {
+				t.Fatalf("login: %v", err)
+			}
+
+			if err := checkSSOLink(claims, tt.existing); err != tt.want {
+				t.Fatalf("checkSSOLink = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,458 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// @Summary List or create organizations
+// @Description GET lists organizations the user belongs to together with the user's role. POST creates a new organization; the creator becomes its owner
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateOrganizationRequest false "Organization name (POST only)"
+// @Success 200 {object} SuccessResponse{data=[]UserOrganization} "Organizations list"
+// @Success 201 {object} SuccessResponse{data=Organization} "Created organization"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /api/orgs [get]
+// @Router /api/orgs [post]
+func (s *Server) handleOrganizations(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.Header.Get("X-User-ID"))
+	if err != nil {
+		s.sendError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if !s.requireScope(w, r, ScopeRead) {
+			return
+		}
+
+		orgs, err := s.db.GetUserOrganizations(uint(userID))
+		if err != nil {
+			s.logger.Error("Failed to get organizations for user %d: %v", userID, err)
+			s.sendError(w, "Failed to get organizations", http.StatusInternalServerError)
+			return
+		}
+
+		s.sendJSON(w, SuccessResponse{
+			Message: "Organizations retrieved successfully",
+			Data:    orgs,
+		})
+	case http.MethodPost:
+		if !s.requireSession(w, r) {
+			return
+		}
+
+		var req CreateOrganizationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.sendError(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if validationErrors := s.validator.ValidateOrganizationRequest(req); len(validationErrors) > 0 {
+			s.sendValidationErrors(w, validationErrors)
+			return
+		}
+
+		org := &Organization{
+			Name:      strings.TrimSpace(req.Name),
+			CreatedBy: uint(userID),
+			Plan:      PlanFree,
+		}
+
+		if err := s.db.CreateOrganization(org); err != nil {
+			s.logger.Error("Failed to create organization for user %d: %v", userID, err)
+			s.sendError(w, "Failed to create organization", http.StatusInternalServerError)
+			return
+		}
+
+		s.logger.Info("Organization %d (%s) created by user %d", org.ID, org.Name, userID)
+		s.sendJSONStatus(w, SuccessResponse{
+			Message: "Organization created",
+			Data:    org,
+		}, http.StatusCreated)
+	default:
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Summary Organization operations
+// @Description GET /api/orgs/{id} returns the organization, DELETE removes it (owner only, the organization must have no files). GET .../files lists shared files, GET .../stats returns aggregated statistics and quota usage. GET .../members lists members, POST .../members adds an existing user by email, PUT .../members/{user_id} changes a role and DELETE .../members/{user_id} removes a member (or leaves the organization). Members are managed by owners and admins; only owners can grant or revoke the owner role
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "Organization ID"
+// @Param user_id path int false "Member user ID"
+// @Param request body AddMemberRequest false "New member (POST .../members)"
+// @Param request body UpdateMemberRequest false "New role (PUT .../members/{user_id})"
+// @Param request body TwoFactorPolicyRequest false "Security policy (PUT .../security)"
+// @Success 200 {object} SuccessResponse{data=Organization}
+// @Success 200 {object} SuccessResponse{data=[]File} "Organization files"
+// @Success 200 {object} SuccessResponse{data=OrganizationStats} "Organization statistics"
+// @Success 200 {object} SuccessResponse{data=[]Membership} "Organization members"
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/orgs/{id} [get]
+// @Router /api/orgs/{id} [delete]
+// @Router /api/orgs/{id}/files [get]
+// @Router /api/orgs/{id}/stats [get]
+// @Router /api/orgs/{id}/members [get]
+// @Router /api/orgs/{id}/members [post]
+// @Router /api/orgs/{id}/members/{user_id} [put]
+// @Router /api/orgs/{id}/members/{user_id} [delete]
+// @Router /api/orgs/{id}/security [put]
+func (s *Server) handleOrganizationActions(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.Header.Get("X-User-ID"))
+	if err != nil {
+		s.sendError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/orgs/"), "/"), "/")
+	orgID, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		s.sendError(w, "Invalid organization ID", http.StatusBadRequest)
+		return
+	}
+
+	membership, err := s.db.GetMembership(uint(orgID), uint(userID))
+	if err != nil {
+		// Не раскрываем существование чужих организаций
+		s.sendError(w, "Organization not found", http.StatusNotFound)
+		return
+	}
+
+	org, err := s.db.GetOrganizationByID(uint(orgID))
+	if err != nil {
+		s.sendError(w, "Organization not found", http.StatusNotFound)
+		return
+	}
+
+	// Чтение доступно и по API ключу, изменения - только из сессии
+	if r.Method == http.MethodGet {
+		if !s.requireScope(w, r, ScopeRead) {
+			return
+		}
+	} else if !s.requireSession(w, r) {
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		s.sendJSON(w, SuccessResponse{
+			Message: "Organization retrieved successfully",
+			Data:    org,
+		})
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		s.handleDeleteOrganization(w, org, membership)
+	case len(parts) == 2 && parts[1] == "files" && r.Method == http.MethodGet:
+		s.handleOrganizationFiles(w, org)
+	case len(parts) == 2 && parts[1] == "stats" && r.Method == http.MethodGet:
+		s.handleOrganizationStats(w, org)
+	case len(parts) == 2 && parts[1] == "members" && r.Method == http.MethodGet:
+		s.handleOrganizationMembers(w, org)
+	case len(parts) == 2 && parts[1] == "members" && r.Method == http.MethodPost:
+		s.handleAddMember(w, r, org, membership)
+	case len(parts) == 2 && parts[1] == "security" && r.Method == http.MethodPut:
+		s.handleOrganizationSecurity(w, r, org, membership)
+	case len(parts) == 3 && parts[1] == "members":
+		memberID, err := strconv.ParseUint(parts[2], 10, 64)
+		if err != nil {
+			s.sendError(w, "Invalid member ID", http.StatusBadRequest)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			s.handleUpdateMember(w, r, org, membership, uint(memberID))
+		case http.MethodDelete:
+			s.handleRemoveMember(w, org, membership, uint(memberID))
+		default:
+			s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	default:
+		s.sendError(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// Удаление организации
+func (s *Server) handleDeleteOrganization(w http.ResponseWriter, org *Organization, membership *Membership) {
+	if membership.Role != MemberRoleOwner {
+		s.sendError(w, "Only owners can delete the organization", http.StatusForbidden)
+		return
+	}
+
+	files, err := s.db.CountOrganizationFiles(org.ID)
+	if err != nil {
+		s.logger.Error("Failed to count files of organization %d: %v", org.ID, err)
+		s.sendError(w, "Failed to delete organization", http.StatusInternalServerError)
+		return
+	}
+	if files > 0 {
+		s.sendError(w, "Organization still has files, delete them first", http.StatusConflict)
+		return
+	}
+
+	if err := s.db.DeleteOrganization(org.ID); err != nil {
+		s.logger.Error("Failed to delete organization %d: %v", org.ID, err)
+		s.sendError(w, "Failed to delete organization", http.StatusInternalServerError)
+		return
+	}
+
+	s.logger.Info("Organization %d (%s) deleted by user %d", org.ID, org.Name, membership.UserID)
+	s.sendJSON(w, SuccessResponse{Message: "Organization deleted"})
+}
+
+// Список файлов организации
+func (s *Server) handleOrganizationFiles(w http.ResponseWriter, org *Organization) {
+	files, err := s.db.GetOrganizationFiles(org.ID)
+	if err != nil {
+		s.logger.Error("Failed to get files of organization %d: %v", org.ID, err)
+		s.sendError(w, "Failed to get files", http.StatusInternalServerError)
+		return
+	}
+
+	s.sendJSON(w, SuccessResponse{
+		Message: "Files retrieved successfully",
+		Data:    files,
+	})
+}
+
+// Статистика и квоты организации
+func (s *Server) handleOrganizationStats(w http.ResponseWriter, org *Organization) {
+	stats, err := s.db.GetOrganizationStats(org.ID)
+	if err != nil {
+		s.logger.Error("Failed to get stats of organization %d: %v", org.ID, err)
+		s.sendError(w, "Failed to get stats", http.StatusInternalServerError)
+		return
+	}
+
+	quota, err := s.quotas.Status(org)
+	if err != nil {
+		s.logger.Error("Failed to get quota usage of organization %d: %v", org.ID, err)
+		s.sendError(w, "Failed to get stats", http.StatusInternalServerError)
+		return
+	}
+
+	stats.Organization = *org
+	stats.Quota = quota
+
+	s.sendJSON(w, SuccessResponse{
+		Message: "Stats retrieved successfully",
+		Data:    stats,
+	})
+}
+
+// Список участников организации
+func (s *Server) handleOrganizationMembers(w http.ResponseWriter, org *Organization) {
+	members, err := s.db.GetOrganizationMembers(org.ID)
+	if err != nil {
+		s.logger.Error("Failed to get members of organization %d: %v", org.ID, err)
+		s.sendError(w, "Failed to get members", http.StatusInternalServerError)
+		return
+	}
+
+	s.sendJSON(w, SuccessResponse{
+		Message: "Members retrieved successfully",
+		Data:    members,
+	})
+}
+
+// Добавление участника по email
+func (s *Server) handleAddMember(w http.ResponseWriter, r *http.Request, org *Organization, actor *Membership) {
+	if !canManageMembers(actor.Role) {
+		s.sendError(w, "Only owners and admins can manage members", http.StatusForbidden)
+		return
+	}
+
+	var req AddMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = MemberRoleMember
+	}
+	if validationErrors := s.validator.ValidateMemberRole(req.Role); len(validationErrors) > 0 {
+		s.sendValidationErrors(w, validationErrors)
+		return
+	}
+	if req.Role == MemberRoleOwner && actor.Role != MemberRoleOwner {
+		s.sendError(w, "Only owners can add other owners", http.StatusForbidden)
+		return
+	}
+
+	user, err := s.db.GetUserByEmail(strings.TrimSpace(req.Email))
+	if err != nil {
+		s.sendError(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if _, err := s.db.GetMembership(org.ID, user.ID); err == nil {
+		s.sendError(w, "User is already a member", http.StatusConflict)
+		return
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		s.logger.Error("Failed to check membership of user %d in organization %d: %v", user.ID, org.ID, err)
+		s.sendError(w, "Failed to add member", http.StatusInternalServerError)
+		return
+	}
+
+	membership := &Membership{
+		OrganizationID: org.ID,
+		UserID:         user.ID,
+		Role:           req.Role,
+	}
+	if err := s.db.CreateMembership(membership); err != nil {
+		s.logger.Error("Failed to add user %d to organization %d: %v", user.ID, org.ID, err)
+		s.sendError(w, "Failed to add member", http.StatusInternalServerError)
+		return
+	}
+	membership.User = *user
+
+	s.logger.Info("User %d added to organization %d as %s by user %d", user.ID, org.ID, req.Role, actor.UserID)
+	s.sendJSONStatus(w, SuccessResponse{
+		Message: "Member added",
+		Data:    membership,
+	}, http.StatusCreated)
+}
+
+// Смена роли участника
+func (s *Server) handleUpdateMember(w http.ResponseWriter, r *http.Request, org *Organization, actor *Membership, memberID uint) {
+	if !canManageMembers(actor.Role) {
+		s.sendError(w, "Only owners and admins can manage members", http.StatusForbidden)
+		return
+	}
+
+	var req UpdateMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if validationErrors := s.validator.ValidateMemberRole(req.Role); len(validationErrors) > 0 {
+		s.sendValidationErrors(w, validationErrors)
+		return
+	}
+
+	member, err := s.db.GetMembership(org.ID, memberID)
+	if err != nil {
+		s.sendError(w, "Member not found", http.StatusNotFound)
+		return
+	}
+
+	if (member.Role == MemberRoleOwner || req.Role == MemberRoleOwner) && actor.Role != MemberRoleOwner {
+		s.sendError(w, "Only owners can grant or revoke the owner role", http.StatusForbidden)
+		return
+	}
+
+	if member.Role == MemberRoleOwner && req.Role != MemberRoleOwner && !s.hasOtherOwner(w, org.ID) {
+		return
+	}
+
+	if err := s.db.UpdateMembershipRole(org.ID, memberID, req.Role); err != nil {
+		s.logger.Error("Failed to change role of user %d in organization %d: %v", memberID, org.ID, err)
+		s.sendError(w, "Failed to update member", http.StatusInternalServerError)
+		return
+	}
+
+	s.logger.Info("Role of user %d in organization %d changed from %s to %s by user %d", memberID, org.ID, member.Role, req.Role, actor.UserID)
+	member.Role = req.Role
+	s.sendJSON(w, SuccessResponse{
+		Message: "Member updated",
+		Data:    member,
+	})
+}
+
+// Требование 2FA для участников организации
+func (s *Server) handleOrganizationSecurity(w http.ResponseWriter, r *http.Request, org *Organization, actor *Membership) {
+	if !canManageMembers(actor.Role) {
+		s.sendError(w, "Only owners and admins can change security settings", http.StatusForbidden)
+		return
+	}
+
+	var req TwoFactorPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.db.SetOrganizationRequire2FA(org.ID, req.Require2FA); err != nil {
+		s.logger.Error("Failed to update 2FA policy of organization %d: %v", org.ID, err)
+		s.sendError(w, "Failed to update organization", http.StatusInternalServerError)
+		return
+	}
+
+	s.logger.Info("2FA requirement of organization %d set to %v by user %d", org.ID, req.Require2FA, actor.UserID)
+	org.Require2FA = req.Require2FA
+	s.sendJSON(w, SuccessResponse{
+		Message: "Organization security settings updated",
+		Data:    org,
+	})
+}
+
+// Удаление участника или выход из организации
+func (s *Server) handleRemoveMember(w http.ResponseWriter, org *Organization, actor *Membership, memberID uint) {
+	leaving := memberID == actor.UserID
+	if !leaving && !canManageMembers(actor.Role) {
+		s.sendError(w, "Only owners and admins can manage members", http.StatusForbidden)
+		return
+	}
+
+	member, err := s.db.GetMembership(org.ID, memberID)
+	if err != nil {
+		s.sendError(w, "Member not found", http.StatusNotFound)
+		return
+	}
+
+	if member.Role == MemberRoleOwner {
+		if !leaving && actor.Role != MemberRoleOwner {
+			s.sendError(w, "Only owners can remove other owners", http.StatusForbidden)
+			return
+		}
+		if !s.hasOtherOwner(w, org.ID) {
+			return
+		}
+	}
+
+	if err := s.db.DeleteMembership(org.ID, memberID); err != nil {
+		s.logger.Error("Failed to remove user %d from organization %d: %v", memberID, org.ID, err)
+		s.sendError(w, "Failed to remove member", http.StatusInternalServerError)
+		return
+	}
+
+	s.logger.Info("User %d removed from organization %d by user %d", memberID, org.ID, actor.UserID)
+	s.sendJSON(w, SuccessResponse{Message: "Member removed"})
+}
+
+// hasOtherOwner проверяет, что после изменения у организации останется владелец
+func (s *Server) hasOtherOwner(w http.ResponseWriter, orgID uint) bool {
+	owners, err := s.db.CountOrganizationOwners(orgID)
+	if err != nil {
+		s.logger.Error("Failed to count owners of organization %d: %v", orgID, err)
+		s.sendError(w, "Failed to update member", http.StatusInternalServerError)
+		return false
+	}
+	if owners <= 1 {
+		s.sendError(w, "Organization must keep at least one owner", http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// isMemberRole проверяет допустимость роли участника
+func isMemberRole(role string) bool {
+	return slices.Contains(allowedMemberRoles, role)
+}
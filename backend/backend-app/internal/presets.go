@@ -0,0 +1,401 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Не больше стольких наборов у одного пользователя или организации
+const maxObjectPresetsPerOwner = 50
+
+var presetNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+
+// Встроенные наборы. Типы, которых нет в текущем каталоге ML сервиса (например, license plate
+// у моделей COCO), при раскрытии пропускаются и перечисляются в unavailable_types набора
+// и skipped_types опций обработки. Имена встроенных наборов нельзя занять своими наборами
+var builtinPresets = []ObjectPreset{
+	{Name: "privacy", Label: "Приватность", ObjectTypes: "face,person,license plate,cell phone"},
+	{Name: "people", Label: "Люди", ObjectTypes: "face,person"},
+	{Name: "vehicles", Label: "Транспорт", ObjectTypes: "car,bus,truck,motorcycle"},
+	{Name: "screens", Label: "Экраны", ObjectTypes: "tv,laptop,cell phone"},
+	{Name: "pii", Label: "Персональные данные", ObjectTypes: "face,license plate,cell phone,laptop,tv,book"},
+}
+
+// builtinPreset возвращает встроенный набор по имени или nil
+func builtinPreset(name string) *ObjectPreset {
+	for i := range builtinPresets {
+		if builtinPresets[i].Name == name {
+			return &builtinPresets[i]
+		}
+	}
+	return nil
+}
+
+// availableBuiltinPresets возвращает встроенные наборы с типами, которые поддерживает каталог.
+// Остальные типы набора перечисляются в Unavailable
+func availableBuiltinPresets(catalog *ObjectCatalog) []ObjectPreset {
+	presets := make([]ObjectPreset, 0, len(builtinPresets))
+	for _, preset := range builtinPresets {
+		var objectTypes []string
+		for _, objType := range preset.ObjectTypeList() {
+			if catalog.HasObjectType(objType) {
+				objectTypes = append(objectTypes, objType)
+			} else {
+				preset.Unavailable = append(preset.Unavailable, objType)
+			}
+		}
+		if len(objectTypes) == 0 {
+			continue
+		}
+
+		preset.ObjectTypes = strings.Join(objectTypes, ",")
+		preset.BuiltIn = true
+		presets = append(presets, preset)
+	}
+	return presets
+}
+
+// normalizePresetName приводит имя набора к нижнему регистру
+func normalizePresetName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// normalizeObjectTypes приводит типы объектов к нижнему регистру и убирает пустые значения и дубликаты
+func normalizeObjectTypes(objectTypes []string) []string {
+	var result []string
+	for _, objType := range objectTypes {
+		objType = strings.ToLower(strings.TrimSpace(objType))
+		if objType != "" && !slices.Contains(result, objType) {
+			result = append(result, objType)
+		}
+	}
+	return result
+}
+
+// canManagePresets проверяет, может ли роль изменять наборы организации
+func canManagePresets(role string) bool {
+	return role == MemberRoleOwner || role == MemberRoleAdmin
+}
+
+// resolvePreset находит набор по имени: встроенный, затем набор организации, в которую
+// загружается файл, затем личный набор пользователя. Возвращает nil, если набор не найден
+func (s *Server) resolvePreset(name string, userID int, organizationID *uint) (*ObjectPreset, error) {
+	name = normalizePresetName(name)
+	for _, preset := range availableBuiltinPresets(s.catalog) {
+		if preset.Name == name {
+			return &preset, nil
+		}
+	}
+
+	if organizationID != nil {
+		preset, err := s.db.GetOrganizationObjectPreset(*organizationID, name)
+		if err == nil {
+			return preset, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	if userID != 0 {
+		preset, err := s.db.GetUserObjectPreset(uint(userID), name)
+		if err == nil {
+			return preset, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+// expandPreset добавляет типы объектов набора options.Preset перед явно указанными типами
+func (s *Server) expandPreset(options *ProcessingOptions, userID int, organizationID *uint) *ValidationError {
+	preset, err := s.resolvePreset(options.Preset, userID, organizationID)
+	if err != nil {
+		s.logger.Error("Failed to resolve preset %q for user %d: %v", options.Preset, userID, err)
+		return &ValidationError{Field: "preset", Message: "Failed to load preset"}
+	}
+	if preset == nil {
+		return &ValidationError{
+			Field:   "preset",
+			Message: fmt.Sprintf("Unknown preset: '%s'. Available presets are listed at GET /api/presets", options.Preset),
+		}
+	}
+
+	options.Preset = preset.Name
+	options.ObjectTypes = normalizeObjectTypes(append(preset.ObjectTypeList(), options.ObjectTypes...))
+	options.SkippedTypes = preset.Unavailable
+	return nil
+}
+
+// @Summary List or create object presets
+// @Description GET lists built-in presets, the user's own presets and presets of organizations the user belongs to. Types of a built-in preset that the current ML model cannot detect are listed in unavailable_types and skipped when the preset is applied (reported in skipped_types of the processing options). POST creates a personal preset, or an organization preset when organization_id is set (owners and admins only). A preset is applied with the preset field of upload and reprocess requests
+// @Tags presets
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param request body ObjectPresetRequest false "New preset (POST only)"
+// @Success 200 {object} SuccessResponse{data=[]ObjectPreset} "Presets list"
+// @Success 201 {object} SuccessResponse{data=ObjectPreset} "Created preset"
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/presets [get]
+// @Router /api/presets [post]
+func (s *Server) handleObjectPresets(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.Header.Get("X-User-ID"))
+	if err != nil {
+		s.sendError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if !s.requireScope(w, r, ScopeRead) {
+			return
+		}
+
+		presets, err := s.db.GetAvailableObjectPresets(uint(userID))
+		if err != nil {
+			s.logger.Error("Failed to get presets for user %d: %v", userID, err)
+			s.sendError(w, "Failed to get presets", http.StatusInternalServerError)
+			return
+		}
+
+		s.sendJSON(w, SuccessResponse{
+			Message: "Presets retrieved successfully",
+			Data:    append(availableBuiltinPresets(s.catalog), presets...),
+		})
+	case http.MethodPost:
+		if !s.requireSession(w, r) {
+			return
+		}
+		s.handleCreateObjectPreset(w, r, uint(userID))
+	default:
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Создание набора
+func (s *Server) handleCreateObjectPreset(w http.ResponseWriter, r *http.Request, userID uint) {
+	var req ObjectPresetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if validationErrors := s.validator.ValidateObjectPresetRequest(req); len(validationErrors) > 0 {
+		s.sendValidationErrors(w, validationErrors)
+		return
+	}
+
+	preset := &ObjectPreset{
+		Name:        normalizePresetName(req.Name),
+		Label:       strings.TrimSpace(req.Label),
+		ObjectTypes: strings.Join(normalizeObjectTypes(req.ObjectTypes), ","),
+	}
+	if preset.Label == "" {
+		preset.Label = preset.Name
+	}
+
+	if req.OrganizationID != nil {
+		membership, err := s.db.GetMembership(*req.OrganizationID, userID)
+		if err != nil || !canManagePresets(membership.Role) {
+			s.sendError(w, "You cannot manage presets of this organization", http.StatusForbidden)
+			return
+		}
+		preset.OrganizationID = req.OrganizationID
+	} else {
+		preset.UserID = &userID
+	}
+
+	count, err := s.db.CountObjectPresets(preset.UserID, preset.OrganizationID)
+	if err != nil {
+		s.logger.Error("Failed to count presets for user %d: %v", userID, err)
+		s.sendError(w, "Failed to create preset", http.StatusInternalServerError)
+		return
+	}
+	if count >= maxObjectPresetsPerOwner {
+		s.sendError(w, "Preset limit reached, delete an existing preset first", http.StatusConflict)
+		return
+	}
+
+	if !s.presetNameAvailable(w, preset) {
+		return
+	}
+
+	if err := s.db.CreateObjectPreset(preset); err != nil {
+		s.logger.Error("Failed to create preset for user %d: %v", userID, err)
+		s.sendError(w, "Failed to create preset", http.StatusInternalServerError)
+		return
+	}
+
+	s.logger.Info("Preset %d (%s) created by user %d", preset.ID, preset.Name, userID)
+	s.sendJSONStatus(w, SuccessResponse{
+		Message: "Preset created successfully",
+		Data:    preset,
+	}, http.StatusCreated)
+}
+
+// @Summary Get, update or delete an object preset
+// @Description Personal presets are managed by their owner, organization presets are visible to all members and managed by owners and admins. Built-in presets cannot be changed
+// @Tags presets
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "Preset ID"
+// @Param request body ObjectPresetRequest false "New name, label and object types (PUT only)"
+// @Success 200 {object} SuccessResponse{data=ObjectPreset}
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/presets/{id} [get]
+// @Router /api/presets/{id} [put]
+// @Router /api/presets/{id} [delete]
+func (s *Server) handleObjectPresetActions(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.Header.Get("X-User-ID"))
+	if err != nil {
+		s.sendError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	presetID, err := strconv.ParseUint(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/presets/"), "/"), 10, 64)
+	if err != nil {
+		s.sendError(w, "Invalid preset ID", http.StatusBadRequest)
+		return
+	}
+
+	// Чтение доступно и по API ключу, изменения - только из сессии
+	if r.Method == http.MethodGet {
+		if !s.requireScope(w, r, ScopeRead) {
+			return
+		}
+	} else if !s.requireSession(w, r) {
+		return
+	}
+
+	preset, ok := s.presetForAction(w, uint(presetID), uint(userID), r.Method != http.MethodGet)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.sendJSON(w, SuccessResponse{
+			Message: "Preset retrieved successfully",
+			Data:    preset,
+		})
+	case http.MethodPut:
+		var req ObjectPresetRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.sendError(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if validationErrors := s.validator.ValidateObjectPresetRequest(req); len(validationErrors) > 0 {
+			s.sendValidationErrors(w, validationErrors)
+			return
+		}
+
+		preset.Name = normalizePresetName(req.Name)
+		preset.Label = strings.TrimSpace(req.Label)
+		if preset.Label == "" {
+			preset.Label = preset.Name
+		}
+		preset.ObjectTypes = strings.Join(normalizeObjectTypes(req.ObjectTypes), ",")
+
+		if !s.presetNameAvailable(w, preset) {
+			return
+		}
+
+		if err := s.db.UpdateObjectPreset(preset); err != nil {
+			s.logger.Error("Failed to update preset %d: %v", preset.ID, err)
+			s.sendError(w, "Failed to update preset", http.StatusInternalServerError)
+			return
+		}
+
+		s.logger.Info("Preset %d (%s) updated by user %d", preset.ID, preset.Name, userID)
+		s.sendJSON(w, SuccessResponse{
+			Message: "Preset updated successfully",
+			Data:    preset,
+		})
+	case http.MethodDelete:
+		if err := s.db.DeleteObjectPreset(preset.ID); err != nil {
+			s.logger.Error("Failed to delete preset %d: %v", preset.ID, err)
+			s.sendError(w, "Failed to delete preset", http.StatusInternalServerError)
+			return
+		}
+
+		s.logger.Info("Preset %d (%s) deleted by user %d", preset.ID, preset.Name, userID)
+		s.sendJSON(w, SuccessResponse{Message: "Preset deleted successfully"})
+	default:
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// presetForAction загружает набор и проверяет доступ: manage - изменение или удаление.
+// Чужие наборы не раскрываются. При отказе отправляет ответ и возвращает false
+func (s *Server) presetForAction(w http.ResponseWriter, presetID, userID uint, manage bool) (*ObjectPreset, bool) {
+	preset, err := s.db.GetObjectPresetByID(presetID)
+	if err != nil {
+		s.sendError(w, "Preset not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	if preset.UserID != nil {
+		if *preset.UserID != userID {
+			s.sendError(w, "Preset not found", http.StatusNotFound)
+			return nil, false
+		}
+		return preset, true
+	}
+
+	membership, err := s.db.GetMembership(*preset.OrganizationID, userID)
+	if err != nil {
+		s.sendError(w, "Preset not found", http.StatusNotFound)
+		return nil, false
+	}
+	if manage && !canManagePresets(membership.Role) {
+		s.sendError(w, "You cannot manage presets of this organization", http.StatusForbidden)
+		return nil, false
+	}
+
+	return preset, true
+}
+
+// presetNameAvailable проверяет, что у владельца набора нет другого набора с тем же именем.
+// Если имя занято, отвечает 409
+func (s *Server) presetNameAvailable(w http.ResponseWriter, preset *ObjectPreset) bool {
+	var existing *ObjectPreset
+	var err error
+	if preset.OrganizationID != nil {
+		existing, err = s.db.GetOrganizationObjectPreset(*preset.OrganizationID, preset.Name)
+	} else {
+		existing, err = s.db.GetUserObjectPreset(*preset.UserID, preset.Name)
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && existing.ID == preset.ID) {
+		return true
+	}
+	if err != nil {
+		s.logger.Error("Failed to check preset name %q: %v", preset.Name, err)
+		s.sendError(w, "Failed to save preset", http.StatusInternalServerError)
+		return false
+	}
+
+	s.sendError(w, "Preset with this name already exists", http.StatusConflict)
+	return false
+}
@@ -0,0 +1,297 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Не больше стольких профилей у одного пользователя
+const maxProcessingProfilesPerUser = 20
+
+// Не больше стольких областей в одних опциях обработки
+const maxProcessingRegions = 20
+
+// defaultProcessingOptions опции, которые применяются, если их не задают ни запрос, ни профиль
+func defaultProcessingOptions() ProcessingOptions {
+	return ProcessingOptions{
+		BlurType:     "gaussian",
+		Intensity:    5,
+		OutputFormat: OutputFormatOriginal,
+	}
+}
+
+// Options возвращает опции обработки запроса с подставленными значениями по умолчанию
+func (req ProcessingProfileRequest) Options() ProcessingOptions {
+	options := defaultProcessingOptions()
+	if req.BlurType != "" {
+		options.BlurType = req.BlurType
+	}
+	if req.Intensity != 0 {
+		options.Intensity = req.Intensity
+	}
+	if req.OutputFormat != "" {
+		options.OutputFormat = req.OutputFormat
+	}
+	options.ObjectTypes = normalizeObjectTypes(req.ObjectTypes)
+	options.Regions = req.Regions
+	return options
+}
+
+// applyProfileRequest переносит поля запроса в профиль
+func applyProfileRequest(profile *ProcessingProfile, req ProcessingProfileRequest) {
+	options := req.Options()
+	profile.Name = normalizePresetName(req.Name)
+	profile.BlurType = options.BlurType
+	profile.Intensity = options.Intensity
+	profile.ObjectTypes = strings.Join(options.ObjectTypes, ",")
+	profile.Regions = options.Regions
+	profile.OutputFormat = options.OutputFormat
+	profile.IsDefault = req.IsDefault
+}
+
+// profileOptions возвращает опции профиля name или, если имя не указано, основного профиля пользователя.
+// Без основного профиля возвращает опции по умолчанию
+func (s *Server) profileOptions(name string, userID int) (ProcessingOptions, *ValidationError) {
+	if userID == 0 {
+		if name != "" {
+			return defaultProcessingOptions(), &ValidationError{
+				Field:   "profile",
+				Message: "Processing profiles are available to registered users only",
+			}
+		}
+		return defaultProcessingOptions(), nil
+	}
+
+	var profile *ProcessingProfile
+	var err error
+	if name != "" {
+		profile, err = s.db.GetProcessingProfileByName(uint(userID), normalizePresetName(name))
+	} else {
+		profile, err = s.db.GetDefaultProcessingProfile(uint(userID))
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if name != "" {
+			return defaultProcessingOptions(), &ValidationError{
+				Field:   "profile",
+				Message: fmt.Sprintf("Unknown profile: '%s'. Saved profiles are listed at GET /api/profiles", name),
+			}
+		}
+		return defaultProcessingOptions(), nil
+	}
+	if err != nil {
+		s.logger.Error("Failed to load processing profile for user %d: %v", userID, err)
+		return defaultProcessingOptions(), &ValidationError{Field: "profile", Message: "Failed to load profile"}
+	}
+
+	return profile.Options(), nil
+}
+
+// @Summary List or create processing profiles
+// @Description GET lists the user's saved processing profiles. POST creates a profile; a profile created with is_default=true replaces the previous default. The default profile supplies the options that an upload or reprocess request does not set, another profile is selected with the profile field
+// @Tags profiles
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param request body ProcessingProfileRequest false "New profile (POST only)"
+// @Success 200 {object} SuccessResponse{data=[]ProcessingProfile} "Profiles list"
+// @Success 201 {object} SuccessResponse{data=ProcessingProfile} "Created profile"
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/profiles [get]
+// @Router /api/profiles [post]
+func (s *Server) handleProcessingProfiles(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.Header.Get("X-User-ID"))
+	if err != nil {
+		s.sendError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if !s.requireScope(w, r, ScopeRead) {
+			return
+		}
+
+		profiles, err := s.db.GetUserProcessingProfiles(uint(userID))
+		if err != nil {
+			s.logger.Error("Failed to get processing profiles for user %d: %v", userID, err)
+			s.sendError(w, "Failed to get profiles", http.StatusInternalServerError)
+			return
+		}
+
+		s.sendJSON(w, SuccessResponse{
+			Message: "Profiles retrieved successfully",
+			Data:    profiles,
+		})
+	case http.MethodPost:
+		if !s.requireSession(w, r) {
+			return
+		}
+		s.handleCreateProcessingProfile(w, r, uint(userID))
+	default:
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Создание профиля
+func (s *Server) handleCreateProcessingProfile(w http.ResponseWriter, r *http.Request, userID uint) {
+	var req ProcessingProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if validationErrors := s.validator.ValidateProcessingProfileRequest(req); len(validationErrors) > 0 {
+		s.sendValidationErrors(w, validationErrors)
+		return
+	}
+
+	count, err := s.db.CountProcessingProfiles(userID)
+	if err != nil {
+		s.logger.Error("Failed to count processing profiles for user %d: %v", userID, err)
+		s.sendError(w, "Failed to create profile", http.StatusInternalServerError)
+		return
+	}
+	if count >= maxProcessingProfilesPerUser {
+		s.sendError(w, "Profile limit reached, delete an existing profile first", http.StatusConflict)
+		return
+	}
+
+	profile := &ProcessingProfile{UserID: userID}
+	applyProfileRequest(profile, req)
+
+	if !s.profileNameAvailable(w, profile) {
+		return
+	}
+
+	if err := s.db.CreateProcessingProfile(profile); err != nil {
+		s.logger.Error("Failed to create processing profile for user %d: %v", userID, err)
+		s.sendError(w, "Failed to create profile", http.StatusInternalServerError)
+		return
+	}
+
+	s.logger.Info("Processing profile %d (%s) created by user %d (default: %v)", profile.ID, profile.Name, userID, profile.IsDefault)
+	s.sendJSONStatus(w, SuccessResponse{
+		Message: "Profile created successfully",
+		Data:    profile,
+	}, http.StatusCreated)
+}
+
+// @Summary Get, update or delete a processing profile
+// @Description PUT replaces all fields of the profile. Setting is_default=true makes it the default instead of the previous one, is_default=false leaves the user without a default profile if this one was the default
+// @Tags profiles
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "Profile ID"
+// @Param request body ProcessingProfileRequest false "New profile fields (PUT only)"
+// @Success 200 {object} SuccessResponse{data=ProcessingProfile}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/profiles/{id} [get]
+// @Router /api/profiles/{id} [put]
+// @Router /api/profiles/{id} [delete]
+func (s *Server) handleProcessingProfileActions(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.Header.Get("X-User-ID"))
+	if err != nil {
+		s.sendError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	profileID, err := strconv.ParseUint(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/profiles/"), "/"), 10, 64)
+	if err != nil {
+		s.sendError(w, "Invalid profile ID", http.StatusBadRequest)
+		return
+	}
+
+	// Чтение доступно и по API ключу, изменения - только из сессии
+	if r.Method == http.MethodGet {
+		if !s.requireScope(w, r, ScopeRead) {
+			return
+		}
+	} else if !s.requireSession(w, r) {
+		return
+	}
+
+	// Чужие профили не раскрываются
+	profile, err := s.db.GetProcessingProfileByID(uint(profileID))
+	if err != nil || profile.UserID != uint(userID) {
+		s.sendError(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.sendJSON(w, SuccessResponse{
+			Message: "Profile retrieved successfully",
+			Data:    profile,
+		})
+	case http.MethodPut:
+		var req ProcessingProfileRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.sendError(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if validationErrors := s.validator.ValidateProcessingProfileRequest(req); len(validationErrors) > 0 {
+			s.sendValidationErrors(w, validationErrors)
+			return
+		}
+
+		applyProfileRequest(profile, req)
+
+		if !s.profileNameAvailable(w, profile) {
+			return
+		}
+
+		if err := s.db.UpdateProcessingProfile(profile); err != nil {
+			s.logger.Error("Failed to update processing profile %d: %v", profile.ID, err)
+			s.sendError(w, "Failed to update profile", http.StatusInternalServerError)
+			return
+		}
+
+		s.logger.Info("Processing profile %d (%s) updated by user %d (default: %v)", profile.ID, profile.Name, userID, profile.IsDefault)
+		s.sendJSON(w, SuccessResponse{
+			Message: "Profile updated successfully",
+			Data:    profile,
+		})
+	case http.MethodDelete:
+		if err := s.db.DeleteProcessingProfile(profile.ID); err != nil {
+			s.logger.Error("Failed to delete processing profile %d: %v", profile.ID, err)
+			s.sendError(w, "Failed to delete profile", http.StatusInternalServerError)
+			return
+		}
+
+		s.logger.Info("Processing profile %d (%s) deleted by user %d", profile.ID, profile.Name, userID)
+		s.sendJSON(w, SuccessResponse{Message: "Profile deleted successfully"})
+	default:
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// profileNameAvailable проверяет, что у пользователя нет другого профиля с тем же именем.
+// Если имя занято, отвечает 409
+func (s *Server) profileNameAvailable(w http.ResponseWriter, profile *ProcessingProfile) bool {
+	existing, err := s.db.GetProcessingProfileByName(profile.UserID, profile.Name)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && existing.ID == profile.ID) {
+		return true
+	}
+	if err != nil {
+		s.logger.Error("Failed to check processing profile name %q: %v", profile.Name, err)
+		s.sendError(w, "Failed to save profile", http.StatusInternalServerError)
+		return false
+	}
+
+	s.sendError(w, "Profile with this name already exists", http.StatusConflict)
+	return false
+}
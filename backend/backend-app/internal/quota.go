@@ -0,0 +1,344 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Тарифные планы
+const (
+	PlanFree      = "free"
+	PlanPro       = "pro"
+	PlanUnlimited = "unlimited"
+)
+
+// Типы квот
+const (
+	QuotaStorageBytes  = "storage_bytes"
+	QuotaFilesPerMonth = "files_per_month"
+	QuotaVideoDuration = "video_duration_sec"
+	QuotaCostBudget    = "cost_budget"
+)
+
+// PlanLimits лимиты тарифного плана, 0 - без ограничения
+// @Description Quota limits (0 means unlimited)
+type PlanLimits struct {
+	MaxStorageBytes     int64 `json:"max_storage_bytes" example:"1073741824"`
+	MaxFilesPerMonth    int   `json:"max_files_per_month" example:"100"`
+	MaxVideoDurationSec int   `json:"max_video_duration_sec" example:"300"`
+}
+
+// QuotaUsage текущее использование квот
+// @Description Current quota usage
+type QuotaUsage struct {
+	StoredBytes    int64  `json:"stored_bytes" example:"524288000"`
+	FilesThisMonth int    `json:"files_this_month" example:"12"`
+	Period         string `json:"period" example:"2025-01"`
+}
+
+// QuotaStatus лимиты и использование квот пользователя
+// @Description User plan, limits and current usage
+type QuotaStatus struct {
+	Plan   string     `json:"plan" example:"free"`
+	Limits PlanLimits `json:"limits"`
+	Usage  QuotaUsage `json:"usage"`
+}
+
+// QuotaViolation превышение квоты
+// @Description Machine-readable quota violation details
+type QuotaViolation struct {
+	Quota     string     `json:"quota" example:"storage_bytes" enums:"storage_bytes,files_per_month,video_duration_sec,cost_budget"`
+	Limit     int64      `json:"limit" example:"1073741824"`
+	Used      int64      `json:"used" example:"1070000000"`
+	Requested int64      `json:"requested" example:"5242880"`
+	ResetAt   *time.Time `json:"reset_at,omitempty" example:"2025-02-01T00:00:00Z"`
+}
+
+func (v *QuotaViolation) Error() string {
+	return fmt.Sprintf("quota %s exceeded: used %d + requested %d > limit %d", v.Quota, v.Used, v.Requested, v.Limit)
+}
+
+// QuotaErrorResponse ответ при превышении квоты
+// @Description Quota exceeded response
+type QuotaErrorResponse struct {
+	Error string         `json:"error" example:"Storage quota exceeded"`
+	Quota QuotaViolation `json:"quota"`
+}
+
+// UserStats статистика пользователя вместе с квотами
+// @Description User statistics with quota limits and usage
+type UserStats struct {
+	User
+	Quota  QuotaStatus  `json:"quota"`
+	Budget BudgetStatus `json:"budget"`
+}
+
+// QuotaSubject владелец квот: пользователь (личные файлы) или организация
+type QuotaSubject interface {
+	quotaPlan() string
+	quotaOverrides() (storageBytes *int64, filesPerMonth *int, videoSeconds *int)
+	monthlyUploads(period string) int
+	storedBytes(db *Database) (int64, error)
+	lockForUpdate(tx *gorm.DB) (QuotaSubject, error)
+}
+
+func (u *User) quotaPlan() string { return u.Plan }
+
+func (u *User) quotaOverrides() (*int64, *int, *int) {
+	return u.QuotaMaxStorageBytes, u.QuotaMaxFilesPerMonth, u.QuotaMaxVideoSeconds
+}
+
+func (u *User) monthlyUploads(period string) int {
+	if u.MonthlyUploadsPeriod != period {
+		return 0
+	}
+	return u.MonthlyUploads
+}
+
+func (u *User) storedBytes(db *Database) (int64, error) {
+	return db.GetUserStoredBytes(u.ID)
+}
+
+func (u *User) lockForUpdate(tx *gorm.DB) (QuotaSubject, error) {
+	var locked User
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, u.ID).Error
+	return &locked, err
+}
+
+func (o *Organization) quotaPlan() string { return o.Plan }
+
+func (o *Organization) quotaOverrides() (*int64, *int, *int) {
+	return o.QuotaMaxStorageBytes, o.QuotaMaxFilesPerMonth, o.QuotaMaxVideoSeconds
+}
+
+func (o *Organization) monthlyUploads(period string) int {
+	if o.MonthlyUploadsPeriod != period {
+		return 0
+	}
+	return o.MonthlyUploads
+}
+
+func (o *Organization) storedBytes(db *Database) (int64, error) {
+	return db.GetOrganizationStoredBytes(o.ID)
+}
+
+func (o *Organization) lockForUpdate(tx *gorm.DB) (QuotaSubject, error) {
+	var locked Organization
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, o.ID).Error
+	return &locked, err
+}
+
+// QuotaManager проверяет квоты пользователей и организаций
+type QuotaManager struct {
+	db    *Database
+	plans map[string]PlanLimits
+}
+
+// NewQuotaManager создает менеджер квот с лимитами планов из конфигурации
+func NewQuotaManager(cfg *Config, db *Database) *QuotaManager {
+	return &QuotaManager{
+		db: db,
+		plans: map[string]PlanLimits{
+			PlanFree: {
+				MaxStorageBytes:     cfg.FreeMaxStorageBytes,
+				MaxFilesPerMonth:    cfg.FreeMaxFilesPerMonth,
+				MaxVideoDurationSec: cfg.FreeMaxVideoSeconds,
+			},
+			PlanPro: {
+				MaxStorageBytes:     cfg.ProMaxStorageBytes,
+				MaxFilesPerMonth:    cfg.ProMaxFilesPerMonth,
+				MaxVideoDurationSec: cfg.ProMaxVideoSeconds,
+			},
+			PlanUnlimited: {},
+		},
+	}
+}
+
+// LimitsFor возвращает лимиты с учетом персональных переопределений
+func (qm *QuotaManager) LimitsFor(subject QuotaSubject) PlanLimits {
+	limits, ok := qm.plans[subject.quotaPlan()]
+	if !ok {
+		limits = qm.plans[PlanFree]
+	}
+
+	storageBytes, filesPerMonth, videoSeconds := subject.quotaOverrides()
+	if storageBytes != nil {
+		limits.MaxStorageBytes = *storageBytes
+	}
+	if filesPerMonth != nil {
+		limits.MaxFilesPerMonth = *filesPerMonth
+	}
+	if videoSeconds != nil {
+		limits.MaxVideoDurationSec = *videoSeconds
+	}
+
+	return limits
+}
+
+// Usage возвращает текущее использование квот
+func (qm *QuotaManager) Usage(subject QuotaSubject) (QuotaUsage, error) {
+	storedBytes, err := subject.storedBytes(qm.db)
+	if err != nil {
+		return QuotaUsage{}, err
+	}
+
+	period := currentQuotaPeriod()
+	return QuotaUsage{
+		StoredBytes:    storedBytes,
+		FilesThisMonth: subject.monthlyUploads(period),
+		Period:         period,
+	}, nil
+}
+
+// Status возвращает план, лимиты и использование квот
+func (qm *QuotaManager) Status(subject QuotaSubject) (QuotaStatus, error) {
+	usage, err := qm.Usage(subject)
+	if err != nil {
+		return QuotaStatus{}, err
+	}
+
+	plan := subject.quotaPlan()
+	if _, ok := qm.plans[plan]; !ok {
+		plan = PlanFree
+	}
+
+	return QuotaStatus{
+		Plan:   plan,
+		Limits: qm.LimitsFor(subject),
+		Usage:  usage,
+	}, nil
+}
+
+// Check проверяет, можно ли загрузить файл указанного размера. Для видео проверяется длительность
+// из заголовков: если у плана есть лимит длительности, видео с неизвестной длительностью не принимается
+func (qm *QuotaManager) Check(subject QuotaSubject, size int64, info MediaInfo) (*QuotaViolation, error) {
+	limits := qm.LimitsFor(subject)
+	usage, err := qm.Usage(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	if limits.MaxVideoDurationSec > 0 && info.IsVideo() &&
+		(info.Duration <= 0 || info.Duration > time.Duration(limits.MaxVideoDurationSec)*time.Second) {
+		return &QuotaViolation{
+			Quota:     QuotaVideoDuration,
+			Limit:     int64(limits.MaxVideoDurationSec),
+			Requested: int64(max(info.Duration, 0).Seconds()),
+		}, nil
+	}
+
+	return limits.check(usage, size), nil
+}
+
+// CreateFile сохраняет запись загруженного файла, если она укладывается в квоты владельца.
+// Check вызывается до записи на диск и не защищает от параллельных загрузок, поэтому здесь
+// использование пересчитывается и запись создается в одной транзакции под блокировкой строки
+// владельца: параллельные загрузки проверяются по очереди и вместе не превысят лимиты
+func (qm *QuotaManager) CreateFile(subject QuotaSubject, file *File) (*QuotaViolation, error) {
+	limits := qm.LimitsFor(subject)
+
+	var violation *QuotaViolation
+	err := qm.db.DB.Transaction(func(tx *gorm.DB) error {
+		locked, err := subject.lockForUpdate(tx)
+		if err != nil {
+			return err
+		}
+
+		txdb := &Database{DB: tx, logger: qm.db.logger}
+		storedBytes, err := locked.storedBytes(txdb)
+		if err != nil {
+			return err
+		}
+
+		usage := QuotaUsage{
+			StoredBytes:    storedBytes,
+			FilesThisMonth: locked.monthlyUploads(currentQuotaPeriod()),
+		}
+		if violation = limits.check(usage, file.FileSize); violation != nil {
+			return nil
+		}
+
+		return txdb.CreateFile(file)
+	})
+
+	return violation, err
+}
+
+// check проверяет месячное количество файлов и объем хранилища с учетом нового файла
+func (limits PlanLimits) check(usage QuotaUsage, size int64) *QuotaViolation {
+	if limits.MaxFilesPerMonth > 0 && usage.FilesThisMonth+1 > limits.MaxFilesPerMonth {
+		resetAt := nextQuotaPeriodStart()
+		return &QuotaViolation{
+			Quota:     QuotaFilesPerMonth,
+			Limit:     int64(limits.MaxFilesPerMonth),
+			Used:      int64(usage.FilesThisMonth),
+			Requested: 1,
+			ResetAt:   &resetAt,
+		}
+	}
+
+	if limits.MaxStorageBytes > 0 && usage.StoredBytes+size > limits.MaxStorageBytes {
+		return &QuotaViolation{
+			Quota:     QuotaStorageBytes,
+			Limit:     limits.MaxStorageBytes,
+			Used:      usage.StoredBytes,
+			Requested: size,
+		}
+	}
+
+	return nil
+}
+
+// currentQuotaPeriod возвращает текущий расчетный период (календарный месяц, UTC)
+func currentQuotaPeriod() string {
+	return time.Now().UTC().Format("2006-01")
+}
+
+// nextQuotaPeriodStart возвращает начало следующего расчетного периода
+func nextQuotaPeriodStart() time.Time {
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Отправка ошибки превышения квоты
+func (s *Server) sendQuotaError(w http.ResponseWriter, violation *QuotaViolation) {
+	s.logger.Warning("Quota exceeded: %v", violation)
+
+	status := http.StatusRequestEntityTooLarge
+	message := "Storage quota exceeded"
+
+	switch violation.Quota {
+	case QuotaFilesPerMonth:
+		status = http.StatusTooManyRequests
+		message = "Monthly file quota exceeded"
+		if violation.ResetAt != nil {
+			w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(*violation.ResetAt).Seconds())))
+		}
+	case QuotaVideoDuration:
+		message = "Video is too long for your plan"
+		if violation.Requested <= 0 {
+			message = "Video duration cannot be determined, it is required by the video length limit of your plan"
+		}
+	case QuotaCostBudget:
+		// Файл, который дороже всего бюджета, не пройдет и после сброса окна
+		if violation.Requested > violation.Limit {
+			message = "File processing cost exceeds your budget"
+			break
+		}
+		status = http.StatusTooManyRequests
+		message = "Processing budget exceeded"
+		if violation.ResetAt != nil {
+			w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(*violation.ResetAt).Seconds())))
+		}
+	}
+
+	s.sendJSONStatus(w, QuotaErrorResponse{
+		Error: message,
+		Quota: *violation,
+	}, status)
+}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// Роли пользователей
+const (
+	RoleUser    = "user"
+	RoleAdmin   = "admin"
+	RoleAuditor = "auditor" // доступ к административному API только на чтение
+)
+
+// Причина отзыва сессий при блокировке
+const RevokeReasonSuspended = "account_suspended"
+
+var allowedRoles = []string{RoleUser, RoleAdmin, RoleAuditor}
+
+// authorize возвращает middleware, пропускающий только пользователей с одной из ролей.
+// Используется после authMiddleware; роль читается из БД, чтобы изменения применялись сразу
+func (s *Server) authorize(roles ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			// Административный API доступен только из сессии пользователя
+			if !s.requireSession(w, r) {
+				return
+			}
+
+			userID, err := strconv.Atoi(r.Header.Get("X-User-ID"))
+			if err != nil || userID == 0 {
+				s.sendError(w, "Authentication required", http.StatusUnauthorized)
+				return
+			}
+
+			user, err := s.db.GetUserByID(uint(userID))
+			if err != nil {
+				s.sendError(w, "User not found", http.StatusUnauthorized)
+				return
+			}
+
+			if user.IsSuspended() {
+				s.sendError(w, "Account suspended", http.StatusForbidden)
+				return
+			}
+
+			if !slices.Contains(roles, user.Role) {
+				s.logger.Warning("Access denied: user %d with role %q requested %s %s", userID, user.Role, r.Method, r.URL.Path)
+				s.sendError(w, "Insufficient permissions", http.StatusForbidden)
+				return
+			}
+
+			r.Header.Set("X-User-Role", user.Role)
+			next(w, r)
+		}
+	}
+}
+
+// requireRole отвечает 403, если роль, установленная authorize, не входит в список.
+// Нужна для маршрутов, где чтение доступно аудиторам, а изменения - только администраторам
+func (s *Server) requireRole(w http.ResponseWriter, r *http.Request, roles ...string) bool {
+	if slices.Contains(roles, r.Header.Get("X-User-Role")) {
+		return true
+	}
+	s.logger.Warning("Access denied: role %q cannot %s %s", r.Header.Get("X-User-Role"), r.Method, r.URL.Path)
+	s.sendError(w, "Insufficient permissions", http.StatusForbidden)
+	return false
+}
+
+// isBootstrapAdmin проверяет, указан ли email в ADMIN_EMAILS
+func (s *Server) isBootstrapAdmin(email string) bool {
+	return slices.Contains(s.config.AdminEmails, email)
+}
+
+// promoteBootstrapAdmins назначает роль admin пользователям из ADMIN_EMAILS
+func (s *Server) promoteBootstrapAdmins() {
+	promoted, err := s.db.PromoteAdmins(s.config.AdminEmails)
+	if err != nil {
+		s.logger.Error("Failed to promote bootstrap admins: %v", err)
+		return
+	}
+	if promoted > 0 {
+		s.logger.Info("Promoted %d user(s) from ADMIN_EMAILS to admin", promoted)
+	}
+}
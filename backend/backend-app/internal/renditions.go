@@ -0,0 +1,235 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+
+	// Декодеры входных форматов
+	_ "image/gif"
+	_ "image/png"
+
+	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+
+	"obscura.app/pkg/logger"
+)
+
+// Типы уменьшенных копий
+const (
+	RenditionThumbnail = "thumbnail"
+	RenditionPreview   = "preview"
+)
+
+// Форматы уменьшенных копий
+const (
+	RenditionFormatJPEG = "jpeg"
+	RenditionFormatWebP = "webp"
+)
+
+const (
+	thumbnailMaxSide = 256
+	previewMaxSide   = 1024
+	renditionQuality = 82
+	// Не декодируем изображения больше этого размера, чтобы не исчерпать память
+	renditionMaxPixels = 100_000_000
+)
+
+// errNoFrameExtractor для видео нет источника кадров
+var errNoFrameExtractor = errors.New("frame extractor is not configured")
+
+// FrameExtractor извлекает кадр-постер из видео
+type FrameExtractor interface {
+	ExtractFrame(videoPath string) (image.Image, error)
+}
+
+// Rendition созданная уменьшенная копия
+type Rendition struct {
+	Name string // имя файла в хранилище, расширение соответствует формату
+	Hash string // SHA-256 содержимого для ETag
+}
+
+// RenditionGenerator создает миниатюры и превью рядом с файлами в хранилище
+type RenditionGenerator struct {
+	uploadPath string
+	format     string         // RenditionFormatJPEG или RenditionFormatWebP
+	frames     FrameExtractor // nil - постеры для видео не создаются
+	converter  ImageConverter // nil - миниатюры HEIC/HEIF и AVIF не создаются, WebP заменяется JPEG
+	logger     *logger.Logger
+}
+
+// NewRenditionGenerator создает генератор миниатюр
+func NewRenditionGenerator(uploadPath, format string, frames FrameExtractor, converter ImageConverter, logger *logger.Logger) *RenditionGenerator {
+	if format == RenditionFormatWebP && converter == nil {
+		logger.Warning("WebP renditions need an image converter, JPEG will be used instead")
+		format = RenditionFormatJPEG
+	}
+	return &RenditionGenerator{
+		uploadPath: uploadPath,
+		format:     format,
+		frames:     frames,
+		converter:  converter,
+		logger:     logger,
+	}
+}
+
+// Generate создает миниатюру и превью для файла из указанного blob'а
+func (g *RenditionGenerator) Generate(fileID, sourceName, mimeType string) (thumbnail, preview Rendition, err error) {
+	source, err := g.loadSource(filepath.Join(g.uploadPath, sourceName), mimeType)
+	if err != nil {
+		return Rendition{}, Rendition{}, err
+	}
+
+	thumbnail, err = g.write(fileID, RenditionThumbnail, source, thumbnailMaxSide)
+	if err != nil {
+		return Rendition{}, Rendition{}, err
+	}
+
+	preview, err = g.write(fileID, RenditionPreview, source, previewMaxSide)
+	if err != nil {
+		os.Remove(filepath.Join(g.uploadPath, thumbnail.Name))
+		return Rendition{}, Rendition{}, err
+	}
+
+	g.logger.Debug("Renditions created for file %s: %s, %s", fileID, thumbnail.Name, preview.Name)
+	return thumbnail, preview, nil
+}
+
+// loadSource декодирует изображение или извлекает кадр из видео
+func (g *RenditionGenerator) loadSource(path, mimeType string) (image.Image, error) {
+	if isVideoMimeType(mimeType) {
+		if g.frames == nil {
+			return nil, errNoFrameExtractor
+		}
+		return g.frames.ExtractFrame(path)
+	}
+
+	// HEIC/HEIF и AVIF декодируются через временную JPEG копию
+	if needsConversion(mimeType) {
+		if g.converter == nil {
+			return nil, errNoImageConverter
+		}
+		converted := strings.TrimSuffix(path, filepath.Ext(path)) + "_rendition.jpg"
+		if err := g.converter.Convert(context.Background(), path, converted); err != nil {
+			return nil, err
+		}
+		defer os.Remove(converted)
+		path = converted
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image header: %w", err)
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > renditionMaxPixels {
+		return nil, fmt.Errorf("image is too large for preview: %dx%d", cfg.Width, cfg.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return img, nil
+}
+
+// write масштабирует изображение так, чтобы большая сторона не превышала maxSide, и сохраняет JPEG.
+// Для формата WebP JPEG конвертируется внешним конвертером, при ошибке конвертации остается JPEG
+func (g *RenditionGenerator) write(fileID, kind string, source image.Image, maxSide int) (Rendition, error) {
+	bounds := source.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	if width > maxSide || height > maxSide {
+		if width >= height {
+			height = height * maxSide / width
+			width = maxSide
+		} else {
+			width = width * maxSide / height
+			height = maxSide
+		}
+	}
+	width = max(width, 1)
+	height = max(height, 1)
+
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), source, bounds, draw.Src, nil)
+
+	name := renditionName(fileID, kind, RenditionFormatJPEG)
+	path := filepath.Join(g.uploadPath, name)
+	out, err := os.Create(path)
+	if err != nil {
+		return Rendition{}, err
+	}
+
+	if err := jpeg.Encode(out, scaled, &jpeg.Options{Quality: renditionQuality}); err != nil {
+		out.Close()
+		os.Remove(path)
+		return Rendition{}, err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(path)
+		return Rendition{}, err
+	}
+
+	if g.format == RenditionFormatWebP {
+		webpName := renditionName(fileID, kind, RenditionFormatWebP)
+		webpPath := filepath.Join(g.uploadPath, webpName)
+		if err := g.converter.Convert(context.Background(), path, webpPath); err != nil {
+			g.logger.Warning("Failed to convert %s to WebP, keeping JPEG: %v", name, err)
+		} else {
+			os.Remove(path)
+			name, path = webpName, webpPath
+		}
+	}
+
+	hash, err := hashRenditionFile(path)
+	if err != nil {
+		os.Remove(path)
+		return Rendition{}, err
+	}
+
+	return Rendition{Name: name, Hash: hash}, nil
+}
+
+// hashRenditionFile вычисляет SHA-256 созданной копии
+func hashRenditionFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	return hashContent(file)
+}
+
+// renditionName возвращает имя файла уменьшенной копии
+func renditionName(fileID, kind, format string) string {
+	ext := ".jpg"
+	if format == RenditionFormatWebP {
+		ext = ".webp"
+	}
+
+	switch kind {
+	case RenditionThumbnail:
+		return fileID + "_thumb" + ext
+	default:
+		return fileID + "_preview" + ext
+	}
+}
+
+// isVideoMimeType проверяет, является ли MIME тип видео
+func isVideoMimeType(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "video/")
+}
@@ -0,0 +1,209 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"obscura.app/pkg/logger"
+)
+
+// Алгоритмы ограничения частоты запросов
+const (
+	AlgorithmTokenBucket   = "token_bucket"   // допускает короткие всплески до емкости корзины
+	AlgorithmSlidingWindow = "sliding_window" // строго не больше Limit запросов за любые Window
+)
+
+// Маршруты с собственной политикой ограничения частоты
+const (
+	RateLimitLogin    = "login"
+	RateLimitRegister = "register"
+	RateLimitUpload   = "upload"
+	RateLimitDownload = "download"
+	RateLimitDetect   = "detect" // повторная обработка файла ML сервисом
+	RateLimitEmail    = "email"  // запросы писем подтверждения адреса и сброса пароля
+)
+
+// Политики по умолчанию в формате "алгоритм:лимит/окно"
+var defaultRateLimits = map[string]string{
+	RateLimitLogin:    "sliding_window:10/1m",
+	RateLimitRegister: "sliding_window:5/1h",
+	RateLimitUpload:   "token_bucket:20/1m",
+	RateLimitDownload: "token_bucket:120/1m",
+	RateLimitDetect:   "token_bucket:10/1m",
+	RateLimitEmail:    "sliding_window:5/1h",
+}
+
+// На этих маршрутах клиент еще не аутентифицирован, лимит считается по IP
+var ipOnlyRateLimits = []string{RateLimitLogin, RateLimitRegister, RateLimitEmail}
+
+// RateLimitPolicy политика ограничения частоты запросов для маршрута
+type RateLimitPolicy struct {
+	Name      string        `json:"name" example:"login"`
+	Algorithm string        `json:"algorithm" example:"sliding_window" enums:"token_bucket,sliding_window"`
+	Limit     int           `json:"limit" example:"10"`
+	Window    time.Duration `json:"window" swaggertype:"integer" example:"60000000000"`
+}
+
+// ParseRateLimitPolicy разбирает политику вида "sliding_window:10/1m" или "token_bucket:120/1m".
+// Пустое значение или "off" отключает ограничение (возвращается nil)
+func ParseRateLimitPolicy(name, spec string) (*RateLimitPolicy, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "off" {
+		return nil, nil
+	}
+
+	algorithm, rate, ok := strings.Cut(spec, ":")
+	if !ok || (algorithm != AlgorithmTokenBucket && algorithm != AlgorithmSlidingWindow) {
+		return nil, fmt.Errorf("rate limit %s: expected token_bucket:<limit>/<window> or sliding_window:<limit>/<window>, got %q", name, spec)
+	}
+
+	limitValue, windowValue, ok := strings.Cut(rate, "/")
+	limit, err := strconv.Atoi(limitValue)
+	if !ok || err != nil || limit < 1 {
+		return nil, fmt.Errorf("rate limit %s: invalid limit in %q", name, spec)
+	}
+	window, err := time.ParseDuration(windowValue)
+	if err != nil || window <= 0 {
+		return nil, fmt.Errorf("rate limit %s: invalid window in %q", name, spec)
+	}
+
+	return &RateLimitPolicy{Name: name, Algorithm: algorithm, Limit: limit, Window: window}, nil
+}
+
+// RouteLimiter применяет политики маршрутов. Состояние хранится в общем LimiterStore
+type RouteLimiter struct {
+	store    LimiterStore
+	policies map[string]RateLimitPolicy
+	logger   *logger.Logger
+}
+
+// NewRouteLimiter создает ограничитель по политикам из конфигурации
+func NewRouteLimiter(store LimiterStore, specs map[string]string, logger *logger.Logger) (*RouteLimiter, error) {
+	l := &RouteLimiter{
+		store:    store,
+		policies: make(map[string]RateLimitPolicy),
+		logger:   logger,
+	}
+
+	for name, spec := range specs {
+		policy, err := ParseRateLimitPolicy(name, spec)
+		if err != nil {
+			return nil, err
+		}
+		if policy == nil {
+			logger.Warning("Rate limiting is disabled for %s", name)
+			continue
+		}
+		l.policies[name] = *policy
+	}
+
+	return l, nil
+}
+
+// Policies возвращает действующие политики
+func (l *RouteLimiter) Policies() []RateLimitPolicy {
+	policies := make([]RateLimitPolicy, 0, len(l.policies))
+	for _, policy := range l.policies {
+		policies = append(policies, policy)
+	}
+	slices.SortFunc(policies, func(a, b RateLimitPolicy) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return policies
+}
+
+// rateLimitKey определяет, чей лимит расходует запрос: API ключа, пользователя или IP адреса
+func rateLimitKey(r *http.Request, route string) string {
+	if !slices.Contains(ipOnlyRateLimits, route) {
+		if keyID := r.Header.Get("X-API-Key-ID"); keyID != "" {
+			return "apikey:" + keyID
+		}
+		if userID := r.Header.Get("X-User-ID"); userID != "" && userID != "0" {
+			return "user:" + userID
+		}
+	}
+	return "ip:" + getClientIP(r)
+}
+
+// checkRateLimit учитывает запрос по политике маршрута и выставляет заголовки RateLimit-*.
+// При превышении отвечает 429 с Retry-After и возвращает false
+func (s *Server) checkRateLimit(w http.ResponseWriter, r *http.Request, route string) bool {
+	policy, ok := s.routeLimiter.policies[route]
+	if !ok {
+		return true
+	}
+
+	// Алгоритм входит в ключ: при смене политики старое состояние другого типа не используется
+	key := route + ":" + policy.Algorithm + ":" + rateLimitKey(r, route)
+
+	var result LimitResult
+	var err error
+	switch policy.Algorithm {
+	case AlgorithmTokenBucket:
+		result, err = s.routeLimiter.store.TakeToken(r.Context(), key, policy.Limit, policy.Window)
+	default:
+		result, err = s.routeLimiter.store.LogHit(r.Context(), key, policy.Limit, policy.Window)
+	}
+	if err != nil {
+		// Отказ хранилища не должен останавливать сервис
+		s.logger.Error("Rate limit store failed for %s, request allowed: %v", route, err)
+		return true
+	}
+
+	// Заголовки по draft-ietf-httpapi-ratelimit-headers
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(policy.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+	w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit, ceilSeconds(policy.Window)))
+
+	if result.Allowed {
+		return true
+	}
+
+	s.logger.Warning("Rate limit %s exceeded for %s, retry in %v", route, rateLimitKey(r, route), result.RetryAfter.Round(time.Second))
+	w.Header().Set("Retry-After", strconv.Itoa(max(ceilSeconds(result.RetryAfter), 1)))
+	s.sendError(w, "Too many requests, try again later", http.StatusTooManyRequests)
+	return false
+}
+
+// rateLimitMiddleware ограничивает частоту запросов к маршруту.
+// Ставится после middleware аутентификации, чтобы лимит считался по ключу или пользователю
+func (s *Server) rateLimitMiddleware(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.checkRateLimit(w, r, route) {
+			return
+		}
+		next(w, r)
+	}
+}
+
+// fileRateLimitMiddleware ограничивает запросы к /api/files/{id}: повторная обработка расходует
+// лимит detect, любое чтение (информация, оригинал, результат, миниатюра и превью) - лимит download.
+// Проверка выполняется до остальных, поэтому заголовки RateLimit-* есть во всех ответах маршрута
+func (s *Server) fileRateLimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/files/"), "/")
+
+		route := ""
+		switch {
+		case action == "reprocess":
+			route = RateLimitDetect
+		case r.Method == http.MethodGet || r.Method == http.MethodHead:
+			route = RateLimitDownload
+		}
+
+		if route != "" && !s.checkRateLimit(w, r, route) {
+			return
+		}
+		next(w, r)
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,261 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Драйверы проверки загрузок
+const (
+	ScannerNone   = "none"
+	ScannerClamAV = "clamav"
+)
+
+// Размер блока, которым файл передается в clamd. Должен быть меньше StreamMaxLength в clamd.conf
+const clamAVChunkSize = 64 << 10
+
+// ScanResult результат проверки файла
+type ScanResult struct {
+	Infected  bool
+	Signature string // имя найденной сигнатуры, например Eicar-Test-Signature
+}
+
+// Scanner проверяет содержимое загруженных файлов на вредоносный код
+type Scanner interface {
+	// Scan проверяет поток целиком. Ошибка означает, что проверить файл не удалось
+	Scan(ctx context.Context, r io.Reader) (ScanResult, error)
+	// Ping проверяет доступность сканера для /health
+	Ping(ctx context.Context) error
+	Name() string
+}
+
+// NewScanner создает сканер по конфигурации
+func NewScanner(config *Config) (Scanner, error) {
+	switch config.ScannerDriver {
+	case ScannerNone, "":
+		return NoopScanner{}, nil
+	case ScannerClamAV:
+		if config.ClamAVAddress == "" {
+			return nil, errors.New("CLAMAV_ADDRESS is required for the clamav scanner")
+		}
+		return NewClamAVScanner(config.ClamAVAddress, time.Duration(config.ScanTimeout)*time.Second), nil
+	default:
+		return nil, fmt.Errorf("unknown scanner driver %q", config.ScannerDriver)
+	}
+}
+
+// NoopScanner пропускает все файлы без проверки
+type NoopScanner struct{}
+
+// Scan ничего не проверяет
+func (NoopScanner) Scan(context.Context, io.Reader) (ScanResult, error) {
+	return ScanResult{}, nil
+}
+
+// Ping всегда успешен
+func (NoopScanner) Ping(context.Context) error {
+	return nil
+}
+
+// Name возвращает имя драйвера
+func (NoopScanner) Name() string {
+	return ScannerNone
+}
+
+// ClamAVScanner передает файлы демону clamd по TCP командой INSTREAM
+type ClamAVScanner struct {
+	address string
+	timeout time.Duration
+}
+
+// NewClamAVScanner создает сканер для clamd по адресу host:port
+func NewClamAVScanner(address string, timeout time.Duration) *ClamAVScanner {
+	return &ClamAVScanner{address: address, timeout: timeout}
+}
+
+// Name возвращает имя драйвера
+func (c *ClamAVScanner) Name() string {
+	return ScannerClamAV
+}
+
+// Scan отправляет поток блоками <длина uint32 big-endian><данные>, завершая блоком нулевой длины,
+// и разбирает ответ "stream: OK" или "stream: <сигнатура> FOUND"
+func (c *ClamAVScanner) Scan(ctx context.Context, r io.Reader) (ScanResult, error) {
+	reply, err := c.command(ctx, "INSTREAM", func(conn net.Conn) error {
+		writer := bufio.NewWriterSize(conn, clamAVChunkSize+4)
+		chunk := make([]byte, clamAVChunkSize)
+		size := make([]byte, 4)
+		for {
+			n, err := r.Read(chunk)
+			if n > 0 {
+				binary.BigEndian.PutUint32(size, uint32(n))
+				if _, err := writer.Write(size); err != nil {
+					return err
+				}
+				if _, err := writer.Write(chunk[:n]); err != nil {
+					return err
+				}
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if _, err := writer.Write([]byte{0, 0, 0, 0}); err != nil {
+			return err
+		}
+		return writer.Flush()
+	})
+	if err != nil {
+		return ScanResult{}, err
+	}
+
+	return parseClamAVReply(reply)
+}
+
+// Ping проверяет, что clamd отвечает PONG
+func (c *ClamAVScanner) Ping(ctx context.Context) error {
+	reply, err := c.command(ctx, "PING", nil)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("unexpected clamd reply %q", reply)
+	}
+	return nil
+}
+
+// command выполняет команду clamd в z-формате (команда и ответ завершаются нулевым байтом).
+// send дописывает тело команды в соединение
+func (c *ClamAVScanner) command(ctx context.Context, name string, send func(conn net.Conn) error) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.address)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write([]byte("z" + name + "\x00")); err != nil {
+		return "", fmt.Errorf("failed to send %s to clamd: %w", name, err)
+	}
+	if send != nil {
+		if err := send(conn); err != nil {
+			return "", fmt.Errorf("failed to stream data to clamd: %w", err)
+		}
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && (err != io.EOF || reply == "") {
+		return "", fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	return strings.TrimSpace(strings.TrimRight(reply, "\x00")), nil
+}
+
+// parseClamAVReply разбирает ответ clamd на INSTREAM
+func parseClamAVReply(reply string) (ScanResult, error) {
+	result := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	switch {
+	case result == "OK":
+		return ScanResult{}, nil
+	case strings.HasSuffix(result, " FOUND"):
+		return ScanResult{Infected: true, Signature: strings.TrimSuffix(result, " FOUND")}, nil
+	default:
+		// Например "INSTREAM size limit exceeded. ERROR"
+		return ScanResult{}, fmt.Errorf("clamd error: %s", reply)
+	}
+}
+
+// scanFile проверяет сохраненный файл сканером
+func (s *Server) scanFile(ctx context.Context, path string) (ScanResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return ScanResult{}, err
+	}
+	defer file.Close()
+
+	start := time.Now()
+	result, err := s.scanner.Scan(ctx, file)
+	if err == nil {
+		s.logger.Debug("Scanned %s with %s in %v (infected: %v)", filepath.Base(path), s.scanner.Name(), time.Since(start), result.Infected)
+	}
+	return result, err
+}
+
+// quarantineUpload переносит зараженный файл в директорию карантина. Там его не видят
+// загрузки, очистка и проверка хранилища, администратор может изучить его вручную
+func (s *Server) quarantineUpload(filePath string) error {
+	if err := os.MkdirAll(s.config.QuarantinePath, 0755); err != nil {
+		return err
+	}
+	target := filepath.Join(s.config.QuarantinePath, filepath.Base(filePath))
+	if err := os.Rename(filePath, target); err != nil {
+		return err
+	}
+	s.logger.Info("Infected upload moved to quarantine: %s -> %s", filePath, target)
+	return nil
+}
+
+// blobDir возвращает директорию с файлами записи: зараженные загрузки лежат в карантине
+func (s *Server) blobDir(file *File) string {
+	if file.Status == StatusQuarantined {
+		return s.config.QuarantinePath
+	}
+	return s.config.UploadPath
+}
+
+// rejectInfectedUpload переносит зараженную загрузку в карантин, сохраняет запись пользователя
+// со статусом quarantined (без учета в квотах и статистике), уведомляет администраторов через журнал аудита и отклоняет загрузку
+func (s *Server) rejectInfectedUpload(w http.ResponseWriter, r *http.Request, file *File, filePath string, result ScanResult, isAnonymous bool) {
+	if err := s.quarantineUpload(filePath); err != nil {
+		s.logger.Error("Failed to quarantine infected upload %s, deleting it: %v", filePath, err)
+		os.Remove(filePath)
+	}
+
+	event := AuditEvent{
+		Action:   AuditFileQuarantined,
+		Severity: AuditAlert,
+		Subject:  "file:" + file.ID,
+		IP:       getClientIP(r),
+		Message: fmt.Sprintf("Anonymous upload %q quarantined: %s detected by %s",
+			file.OriginalName, result.Signature, s.scanner.Name()),
+	}
+
+	if !isAnonymous {
+		file.Status = StatusQuarantined
+		file.ErrorMessage = "Malware detected: " + result.Signature
+		if err := s.db.CreateQuarantinedFile(file); err != nil {
+			s.logger.Error("Failed to save quarantined file record %s: %v", file.ID, err)
+		}
+
+		event.ActorID = &file.UserID
+		event.TargetUserID = &file.UserID
+		event.Message = fmt.Sprintf("Upload %q by user %d quarantined: %s detected by %s",
+			file.OriginalName, file.UserID, result.Signature, s.scanner.Name())
+	}
+	s.audit(event)
+
+	s.sendValidationErrors(w, []ValidationError{{
+		Field:   "file",
+		Message: fmt.Sprintf("File contains malware (%s) and was quarantined", result.Signature),
+		Code:    FileErrorMalware,
+	}})
+}
@@ -0,0 +1,311 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"obscura.app/pkg/logger"
+)
+
+// Тестовая сигнатура EICAR, которую находит любой антивирус
+const eicarSignature = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// clamdStub имитирует clamd: команды в z-формате, INSTREAM блоками <длина uint32><данные>
+type clamdStub struct {
+	t        *testing.T
+	listener net.Listener
+	// Как StreamMaxLength в clamd.conf: при превышении clamd отвечает ошибкой и закрывает соединение
+	maxStream int
+
+	mu       sync.Mutex
+	commands []string
+	chunks   []int
+	received []byte
+}
+
+func newClamdStub(t *testing.T, maxStream int) *clamdStub {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	stub := &clamdStub{t: t, listener: listener, maxStream: maxStream}
+	t.Cleanup(func() { listener.Close() })
+
+	go stub.serve()
+	return stub
+}
+
+func (c *clamdStub) address() string {
+	return c.listener.Addr().String()
+}
+
+func (c *clamdStub) serve() {
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			return
+		}
+		go c.handle(conn)
+	}
+}
+
+func (c *clamdStub) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	command, err := reader.ReadString(0)
+	if err != nil {
+		c.t.Errorf("clamd stub: read command: %v", err)
+		return
+	}
+	command = strings.TrimSuffix(command, "\x00")
+	c.mu.Lock()
+	c.commands = append(c.commands, command)
+	c.mu.Unlock()
+
+	switch command {
+	case "zPING":
+		conn.Write([]byte("PONG\x00"))
+	case "zINSTREAM":
+		c.handleStream(conn, reader)
+	default:
+		conn.Write([]byte("UNKNOWN COMMAND\x00"))
+	}
+}
+
+func (c *clamdStub) handleStream(conn net.Conn, reader *bufio.Reader) {
+	var data []byte
+	size := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(reader, size); err != nil {
+			c.t.Errorf("clamd stub: read chunk size: %v", err)
+			return
+		}
+		n := binary.BigEndian.Uint32(size)
+		if n == 0 {
+			break
+		}
+
+		chunk := make([]byte, n)
+		if _, err := io.ReadFull(reader, chunk); err != nil {
+			c.t.Errorf("clamd stub: read chunk: %v", err)
+			return
+		}
+		c.mu.Lock()
+		c.chunks = append(c.chunks, int(n))
+		c.mu.Unlock()
+
+		data = append(data, chunk...)
+		if c.maxStream > 0 && len(data) > c.maxStream {
+			conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+			return
+		}
+	}
+
+	c.mu.Lock()
+	c.received = data
+	c.mu.Unlock()
+
+	if bytes.Contains(data, []byte(eicarSignature)) {
+		conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+		return
+	}
+	conn.Write([]byte("stream: OK\x00"))
+}
+
+func TestClamAVScannerClean(t *testing.T) {
+	stub := newClamdStub(t, 0)
+	scanner := NewClamAVScanner(stub.address(), 5*time.Second)
+
+	// Больше одного блока, последний неполный
+	data := bytes.Repeat([]byte("obscura "), (2*clamAVChunkSize+1000)/8)
+	result, err := scanner.Scan(context.Background(), bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if result.Infected {
+		t.Fatalf("clean stream reported infected: %+v", result)
+	}
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if len(stub.commands) != 1 || stub.commands[0] != "zINSTREAM" {
+		t.Fatalf("commands = %q, want [zINSTREAM]", stub.commands)
+	}
+	if !bytes.Equal(stub.received, data) {
+		t.Fatalf("clamd received %d bytes, want %d", len(stub.received), len(data))
+	}
+	if len(stub.chunks) < 3 {
+		t.Fatalf("stream sent in %d chunks, want at least 3", len(stub.chunks))
+	}
+	for _, n := range stub.chunks {
+		if n > clamAVChunkSize {
+			t.Fatalf("chunk of %d bytes exceeds %d", n, clamAVChunkSize)
+		}
+	}
+}
+
+func TestClamAVScannerInfected(t *testing.T) {
+	stub := newClamdStub(t, 0)
+	scanner := NewClamAVScanner(stub.address(), 5*time.Second)
+
+	result, err := scanner.Scan(context.Background(), strings.NewReader(eicarSignature))
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if !result.Infected || result.Signature != "Eicar-Test-Signature" {
+		t.Fatalf("result = %+v, want infected with Eicar-Test-Signature", result)
+	}
+}
+
+func TestClamAVScannerError(t *testing.T) {
+	stub := newClamdStub(t, clamAVChunkSize)
+	scanner := NewClamAVScanner(stub.address(), 5*time.Second)
+
+	data := bytes.Repeat([]byte{1}, 4*clamAVChunkSize)
+	result, err := scanner.Scan(context.Background(), bytes.NewReader(data))
+	if err == nil {
+		t.Fatal("Scan over the clamd stream limit succeeded")
+	}
+	if result.Infected {
+		t.Fatalf("failed scan reported infected: %+v", result)
+	}
+}
+
+func TestClamAVScannerConnectionRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	scanner := NewClamAVScanner(address, 5*time.Second)
+	if _, err := scanner.Scan(context.Background(), strings.NewReader("data")); err == nil {
+		t.Fatal("Scan without clamd succeeded")
+	}
+	if err := scanner.Ping(context.Background()); err == nil {
+		t.Fatal("Ping without clamd succeeded")
+	}
+}
+
+func TestClamAVScannerPing(t *testing.T) {
+	stub := newClamdStub(t, 0)
+	scanner := NewClamAVScanner(stub.address(), 5*time.Second)
+
+	if err := scanner.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+}
+
+func TestParseClamAVReply(t *testing.T) {
+	tests := []struct {
+		reply     string
+		infected  bool
+		signature string
+		wantErr   bool
+	}{
+		{reply: "stream: OK"},
+		{reply: "stream: Win.Test.EICAR_HDB-1 FOUND", infected: true, signature: "Win.Test.EICAR_HDB-1"},
+		{reply: "INSTREAM size limit exceeded. ERROR", wantErr: true},
+		{reply: "stream: Can't allocate memory ERROR", wantErr: true},
+		{reply: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		result, err := parseClamAVReply(tt.reply)
+		if (err != nil) != tt.wantErr || result.Infected != tt.infected || result.Signature != tt.signature {
+			t.Errorf("parseClamAVReply(%q) = %+v, %v", tt.reply, result, err)
+		}
+	}
+}
+
+// Если сканер недоступен и SCAN_FAIL_CLOSED=true, загрузка отклоняется, файл удаляется,
+// а списанный бюджет возвращается
+func TestUploadRejectedWhenScannerUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	dir := t.TempDir()
+	log, err := logger.NewLogger(filepath.Join(dir, "server.log"))
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+	config := &Config{
+		UploadPath:          filepath.Join(dir, "uploads"),
+		MaxFileSize:         10 << 20,
+		ScanFailClosed:      true,
+		HandlerTimeout:      24,
+		CostPerMegabyte:     1,
+		CostBudgetAnonymous: 100,
+	}
+	if err := os.MkdirAll(config.UploadPath, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	s := &Server{
+		config:    config,
+		logger:    log,
+		validator: NewValidator(config.MaxFileSize, MediaLimits{}, NewObjectCatalog(config, log)),
+		budgets:   NewBudgetLimiter(NewMemoryLimiterStore(time.Hour), config, log),
+		scanner:   NewClamAVScanner(address, 5*time.Second),
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="file"; filename="photo.png"`)
+	header.Set("Content-Type", "image/png")
+	part, err := form.CreatePart(header)
+	if err != nil {
+		t.Fatalf("create part: %v", err)
+	}
+	if err := png.Encode(part, image.NewRGBA(image.Rect(0, 0, 64, 64))); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	form.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/api/upload", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	s.handleUpload(w, r)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503: %s", w.Code, w.Body.String())
+	}
+	entries, err := os.ReadDir(config.UploadPath)
+	if err != nil {
+		t.Fatalf("read uploads: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("rejected upload left %d files on disk", len(entries))
+	}
+	status, err := s.budgets.Status(context.Background(), anonymousBudgetKey(r), BudgetAnonymous)
+	if err != nil {
+		t.Fatalf("budget status: %v", err)
+	}
+	if status.Used != 0 {
+		t.Fatalf("budget used = %d after rejected upload, want 0", status.Used)
+	}
+}
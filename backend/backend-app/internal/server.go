@@ -2,10 +2,14 @@ package internal
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -20,32 +24,105 @@ import (
 )
 
 type Server struct {
-	config      *Config
-	db          *Database
-	logger      *logger.Logger
-	router      *http.ServeMux
-	rateLimiter *RateLimiter
-	validator   *Validator
-	fileCleaner *FileCleaner
+	config       *Config
+	db           *Database
+	logger       *logger.Logger
+	router       *http.ServeMux
+	budgets      *BudgetLimiter
+	routeLimiter *RouteLimiter
+	clientIPs    *ClientIPResolver
+	validator    *Validator
+	catalog      *ObjectCatalog
+	fileCleaner  *FileCleaner
+	checker      *StorageChecker
+	quotas       *QuotaManager
+	blobs        BlobStore
+	renditions   *RenditionGenerator
+	converter    ImageConverter // nil - HEIC/HEIF и AVIF не принимаются
+	scanner      Scanner
+	oidc         *OIDCManager
+	challenges   *challengeGuard
+	mailer       Mailer
+	loginGuard   *LoginGuard
+	signer       *TokenSigner
 }
 
-func NewServer(config *Config, db *Database, logger *logger.Logger) *Server {
-	rateLimiter := NewRateLimiter(config.MaxAttemptsHandled, time.Duration(config.HandlerTimeout)*time.Hour)
-	validator := NewValidator(config.MaxFileSize)
-	fileCleaner := NewFileCleaner(config.UploadPath, logger)
+func NewServer(config *Config, db *Database, logger *logger.Logger) (*Server, error) {
+	signer, err := NewTokenSigner(config, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure token signing: %w", err)
+	}
 
-	server := &Server{
-		config:      config,
-		db:          db,
-		logger:      logger,
-		router:      http.NewServeMux(),
-		rateLimiter: rateLimiter,
-		validator:   validator,
-		fileCleaner: fileCleaner,
+	limiterStore, err := NewLimiterStore(config, db, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure rate limit store: %w", err)
 	}
 
+	routeLimiter, err := NewRouteLimiter(limiterStore, config.RateLimits, logger)
+	if err != nil {
+		return nil, err
+	}
+	clientIPs, err := NewClientIPResolver(config.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	converter := newImageConverter(config, logger)
+	scanner, err := NewScanner(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure upload scanner: %w", err)
+	}
+	catalog := NewObjectCatalog(config, logger)
+	validator := NewValidator(config.MaxFileSize, MediaLimits{
+		MaxWidth:         config.MediaMaxWidth,
+		MaxHeight:        config.MediaMaxHeight,
+		MaxMegapixels:    float64(config.MediaMaxMegapixels),
+		MaxVideoDuration: time.Duration(config.MediaMaxVideoSeconds) * time.Second,
+	}, catalog)
+	retention := time.Duration(config.FileRetentionDays) * 24 * time.Hour
+	fileCleaner := NewFileCleaner(config.UploadPath, config.QuarantinePath, retention, db, logger)
+	checker := NewStorageChecker(config.UploadPath, config.QuarantinePath, db, logger)
+
+	mailer, err := NewMailer(config, logger)
+	if err != nil {
+		logger.Error("Failed to configure mailer, emails will only be logged: %v", err)
+		mailer = &FileMailer{from: config.MailFrom, logger: logger}
+	}
+
+	server := &Server{
+		config:       config,
+		db:           db,
+		logger:       logger,
+		router:       http.NewServeMux(),
+		budgets:      NewBudgetLimiter(limiterStore, config, logger),
+		routeLimiter: routeLimiter,
+		clientIPs:    clientIPs,
+		validator:    validator,
+		catalog:      catalog,
+		fileCleaner:  fileCleaner,
+		checker:      checker,
+		quotas:       NewQuotaManager(config, db),
+		blobs:        NewLocalBlobStore(config.UploadPath),
+		renditions:   NewRenditionGenerator(config.UploadPath, config.RenditionFormat, nil, converter, logger),
+		converter:    converter,
+		scanner:      scanner,
+		oidc:         NewOIDCManager(config.OIDCProviders),
+		challenges:   newChallengeGuard(),
+		mailer:       mailer,
+		signer:       signer,
+		loginGuard: NewLoginGuard(LoginPolicy{
+			FreeAttempts:       config.LoginFreeAttempts,
+			MaxAccountFailures: config.LoginMaxAccountFailures,
+			MaxIPFailures:      config.LoginMaxIPFailures,
+			Lockout:            time.Duration(config.LoginLockoutMinutes) * time.Minute,
+			Window:             time.Duration(config.LoginFailureWindowMinutes) * time.Minute,
+		}),
+	}
+
+	server.promoteBootstrapAdmins()
+	server.resumeAccountDeletions()
 	fileCleaner.Start()
-	return server
+	catalog.Start()
+	return server, nil
 }
 
 func (s *Server) SetupRoutes() {
@@ -58,43 +135,96 @@ func (s *Server) SetupRoutes() {
 	// Health check
 	s.router.HandleFunc("/health", s.corsMiddleware(s.handleHealth))
 
+	// Открытые ключи для проверки токенов другими сервисами
+	s.router.HandleFunc("/.well-known/jwks.json", s.corsMiddleware(s.handleJWKS))
+
 	// API маршруты
-	s.router.HandleFunc("/api/register", s.corsMiddleware(s.handleRegister))
-	s.router.HandleFunc("/api/login", s.corsMiddleware(s.handleLogin))
+	s.router.HandleFunc("/api/register", s.corsMiddleware(s.rateLimitMiddleware(RateLimitRegister, s.handleRegister)))
+	s.router.HandleFunc("/api/login", s.corsMiddleware(s.rateLimitMiddleware(RateLimitLogin, s.handleLogin)))
+	s.router.HandleFunc("/api/login/2fa", s.corsMiddleware(s.rateLimitMiddleware(RateLimitLogin, s.handleLoginTwoFactor)))
+	s.router.HandleFunc("/api/login/2fa/setup", s.corsMiddleware(s.handleLoginTwoFactorEnrollment))
+	s.router.HandleFunc("/api/login/2fa/confirm", s.corsMiddleware(s.handleLoginTwoFactorEnrollment))
+	s.router.HandleFunc("/api/email/verify/request", s.corsMiddleware(s.optionalAuthMiddleware(s.rateLimitMiddleware(RateLimitEmail, s.handleVerifyEmailRequest))))
+	s.router.HandleFunc("/api/email/verify/confirm", s.corsMiddleware(s.handleVerifyEmailConfirm))
+	s.router.HandleFunc("/api/password/reset/request", s.corsMiddleware(s.rateLimitMiddleware(RateLimitEmail, s.handlePasswordResetRequest)))
+	s.router.HandleFunc("/api/password/reset/confirm", s.corsMiddleware(s.handlePasswordResetConfirm))
+	s.router.HandleFunc("/api/token/refresh", s.corsMiddleware(s.handleRefreshToken))
+	s.router.HandleFunc("/api/auth/oidc/providers", s.corsMiddleware(s.handleOIDCProviders))
+	s.router.HandleFunc("/api/auth/oidc/", s.corsMiddleware(s.handleOIDCActions))
+	s.router.HandleFunc("/api/logout", s.corsMiddleware(s.authMiddleware(s.sessionOnlyMiddleware(s.handleLogout))))
 
 	// Профиль пользователя - только для авторизованных
-	s.router.HandleFunc("/api/user/profile", s.corsMiddleware(s.authMiddleware(s.handleUserProfile)))
-	s.router.HandleFunc("/api/user/profile/update", s.corsMiddleware(s.authMiddleware(s.handleUpdateProfile)))
+	s.router.HandleFunc("/api/user/profile", s.corsMiddleware(s.authMiddleware(s.scopeMiddleware(ScopeRead, s.handleUserProfile))))
+	s.router.HandleFunc("/api/user/profile/update", s.corsMiddleware(s.authMiddleware(s.sessionOnlyMiddleware(s.handleUpdateProfile))))
+
+	// Удаление учетной записи и экспорт данных - только из сессии пользователя.
+	// Подтверждение удаления и статус доступны без авторизации: к этому моменту сессии уже отозваны
+	s.router.HandleFunc("/api/user", s.corsMiddleware(s.authMiddleware(s.sessionOnlyMiddleware(s.handleDeleteAccount))))
+	s.router.HandleFunc("/api/user/export", s.corsMiddleware(s.authMiddleware(s.sessionOnlyMiddleware(s.handleExportAccount))))
+	s.router.HandleFunc("/api/user/delete/confirm", s.corsMiddleware(s.handleConfirmAccountDeletion))
+	s.router.HandleFunc("/api/user/deletions/", s.corsMiddleware(s.handleAccountDeletionStatus))
+
+	// Двухфакторная аутентификация - только из сессии пользователя
+	s.router.HandleFunc("/api/user/2fa", s.corsMiddleware(s.authMiddleware(s.sessionOnlyMiddleware(s.handleTwoFactor))))
+	s.router.HandleFunc("/api/user/2fa/", s.corsMiddleware(s.authMiddleware(s.sessionOnlyMiddleware(s.handleTwoFactor))))
+
+	// API ключи - управление только из сессии пользователя
+	s.router.HandleFunc("/api/user/api-keys", s.corsMiddleware(s.authMiddleware(s.sessionOnlyMiddleware(s.handleAPIKeys))))
+	s.router.HandleFunc("/api/user/api-keys/", s.corsMiddleware(s.authMiddleware(s.sessionOnlyMiddleware(s.handleAPIKeyActions))))
+
+	// Поддерживаемые типы объектов и размытия, наборы объектов
+	s.router.HandleFunc("/api/capabilities", s.corsMiddleware(s.handleCapabilities))
+	s.router.HandleFunc("/api/presets", s.corsMiddleware(s.authMiddleware(s.handleObjectPresets)))
+	s.router.HandleFunc("/api/presets/", s.corsMiddleware(s.authMiddleware(s.handleObjectPresetActions)))
+	s.router.HandleFunc("/api/profiles", s.corsMiddleware(s.authMiddleware(s.handleProcessingProfiles)))
+	s.router.HandleFunc("/api/profiles/", s.corsMiddleware(s.authMiddleware(s.handleProcessingProfileActions)))
 
 	// Загрузка файлов
-	s.router.HandleFunc("/api/upload", s.corsMiddleware(s.optionalAuthMiddleware(s.handleUpload)))
+	s.router.HandleFunc("/api/upload", s.corsMiddleware(s.optionalAuthMiddleware(s.rateLimitMiddleware(RateLimitUpload, s.scopeMiddleware(ScopeUpload, s.handleUpload)))))
 
 	// Получение списка файлов
-	s.router.HandleFunc("/api/files", s.corsMiddleware(s.authMiddleware(s.handleGetFiles)))
+	s.router.HandleFunc("/api/files", s.corsMiddleware(s.authMiddleware(s.scopeMiddleware(ScopeRead, s.handleGetFiles))))
 
 	// Действия с файлами
-	s.router.HandleFunc("/api/files/", s.corsMiddleware(s.optionalAuthMiddleware(s.handleFileActions)))
+	s.router.HandleFunc("/api/files/", s.corsMiddleware(s.optionalAuthMiddleware(s.fileRateLimitMiddleware(s.handleFileActions))))
 
-	// Статистика для профиля
-	s.router.HandleFunc("/api/user/stats", s.corsMiddleware(s.authMiddleware(s.handleUserStats)))
+	// Организации и общие библиотеки файлов
+	s.router.HandleFunc("/api/orgs", s.corsMiddleware(s.authMiddleware(s.handleOrganizations)))
+	s.router.HandleFunc("/api/orgs/", s.corsMiddleware(s.authMiddleware(s.handleOrganizationActions)))
 
-	// Административная информация
-	s.router.HandleFunc("/api/admin/stats", s.corsMiddleware(s.handleAdminStats))
+	// Статистика для профиля
+	s.router.HandleFunc("/api/user/stats", s.corsMiddleware(s.authMiddleware(s.scopeMiddleware(ScopeRead, s.handleUserStats))))
+
+	// Административный API: аудиторы только читают, изменения доступны администраторам
+	staff := s.authorize(RoleAdmin, RoleAuditor)
+	s.router.HandleFunc("/api/admin/stats", s.corsMiddleware(s.authMiddleware(staff(s.handleAdminStats))))
+	s.router.HandleFunc("/api/admin/cleanup", s.corsMiddleware(s.authMiddleware(staff(s.handleAdminCleanup))))
+	s.router.HandleFunc("/api/admin/fsck", s.corsMiddleware(s.authMiddleware(staff(s.handleAdminFsck))))
+	s.router.HandleFunc("/api/admin/users", s.corsMiddleware(s.authMiddleware(staff(s.handleAdminUsers))))
+	s.router.HandleFunc("/api/admin/users/", s.corsMiddleware(s.authMiddleware(staff(s.handleAdminUserActions))))
+	s.router.HandleFunc("/api/admin/files/", s.corsMiddleware(s.authMiddleware(staff(s.handleAdminFileActions))))
+	s.router.HandleFunc("/api/admin/security", s.corsMiddleware(s.authMiddleware(staff(s.handleAdminSecurity))))
+	s.router.HandleFunc("/api/admin/audit", s.corsMiddleware(s.authMiddleware(staff(s.handleAdminAudit))))
+	s.router.HandleFunc("/api/admin/capabilities/refresh", s.corsMiddleware(s.authMiddleware(staff(s.handleAdminRefreshCapabilities))))
 }
 
-// GetRouter возвращает HTTP роутер сервера
-func (s *Server) GetRouter() *http.ServeMux {
-	return s.router
+// GetRouter возвращает HTTP обработчик сервера. Адрес клиента определяется
+// до маршрутизации и доступен всем обработчикам через getClientIP
+func (s *Server) GetRouter() http.Handler {
+	return s.clientIPs.Middleware(s.router)
 }
 
 // CORS middleware
 func (s *Server) corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		s.logger.Debug("Request: %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+		s.logger.Debug("Request: %s %s from %s", r.Method, r.URL.Path, getClientIP(r))
 
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, Range, If-None-Match, If-Modified-Since, If-Range")
+		w.Header().Set("Access-Control-Expose-Headers", "Content-Disposition, Content-Range, Accept-Ranges, ETag, Last-Modified, "+
+			"RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, RateLimit-Policy, Retry-After, "+
+			"X-Budget-Cost, X-Budget-Limit, X-Budget-Remaining, X-Budget-Reset")
 
 		if r.Method == "OPTIONS" {
 			s.logger.Debug("Handling OPTIONS request for %s", r.URL.Path)
@@ -106,59 +236,28 @@ func (s *Server) corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-// Опциональный middleware для аутентификации
+// Опциональный middleware для аутентификации.
+// Невалидный Bearer токен означает анонимный доступ, а невалидный API ключ - ошибку,
+// чтобы скрипты с отозванным ключом не загружали файлы анонимно
 func (s *Server) optionalAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		s.logger.Debug("Optional auth middleware for %s %s", r.Method, r.URL.Path)
 
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			s.logger.Debug("No authorization header - proceeding as anonymous user")
-			r.Header.Set("X-User-ID", "0")
-			next(w, r)
+		claims, err := s.authenticate(r)
+		if err == errInvalidAPIKey {
+			s.logger.Warning("Invalid API key for %s", r.URL.Path)
+			s.sendError(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
-
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenString == authHeader {
-			s.logger.Debug("Invalid Bearer token format - proceeding as anonymous user")
-			r.Header.Set("X-User-ID", "0")
-			next(w, r)
-			return
-		}
-
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(s.config.JWTSecret), nil
-		})
-
-		if err != nil || !token.Valid {
-			s.logger.Debug("Invalid token - proceeding as anonymous user: %v", err)
-			r.Header.Set("X-User-ID", "0")
-			next(w, r)
-			return
-		}
-
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			s.logger.Debug("Invalid token claims - proceeding as anonymous user")
-			r.Header.Set("X-User-ID", "0")
-			next(w, r)
-			return
-		}
-
-		userID, err := strconv.Atoi(fmt.Sprintf("%.0f", claims["user_id"]))
 		if err != nil {
-			s.logger.Debug("Invalid user ID in token - proceeding as anonymous user: %v", err)
-			r.Header.Set("X-User-ID", "0")
+			s.logger.Debug("%v - proceeding as anonymous user", err)
+			setAuthHeaders(r, nil)
 			next(w, r)
 			return
 		}
 
-		s.logger.Debug("Authenticated user %d for %s", userID, r.URL.Path)
-		r.Header.Set("X-User-ID", strconv.Itoa(userID))
+		s.logger.Debug("Authenticated user %d for %s", claims.UserID, r.URL.Path)
+		setAuthHeaders(r, claims)
 		next(w, r)
 	}
 }
@@ -168,55 +267,15 @@ func (s *Server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		s.logger.Debug("Auth middleware for %s %s", r.Method, r.URL.Path)
 
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			s.logger.Warning("Missing Authorization header for %s", r.URL.Path)
-			s.sendError(w, "Authorization header required", http.StatusUnauthorized)
-			return
-		}
-
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenString == authHeader {
-			s.logger.Warning("Invalid Bearer token format for %s", r.URL.Path)
-			s.sendError(w, "Bearer token required", http.StatusUnauthorized)
-			return
-		}
-
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(s.config.JWTSecret), nil
-		})
-
-		if err != nil {
-			s.logger.Warning("JWT parse error for %s: %v", r.URL.Path, err)
-			s.sendError(w, "Invalid token", http.StatusUnauthorized)
-			return
-		}
-
-		if !token.Valid {
-			s.logger.Warning("Invalid JWT token for %s", r.URL.Path)
-			s.sendError(w, "Invalid token", http.StatusUnauthorized)
-			return
-		}
-
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			s.logger.Warning("Invalid token claims for %s", r.URL.Path)
-			s.sendError(w, "Invalid token claims", http.StatusUnauthorized)
-			return
-		}
-
-		userID, err := strconv.Atoi(fmt.Sprintf("%.0f", claims["user_id"]))
+		claims, err := s.authenticate(r)
 		if err != nil {
-			s.logger.Warning("Invalid user ID in token for %s: %v", r.URL.Path, err)
-			s.sendError(w, "Invalid user ID in token", http.StatusUnauthorized)
+			s.logger.Warning("Authentication failed for %s: %v", r.URL.Path, err)
+			s.sendError(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
 
-		s.logger.Debug("Authenticated user %d for %s", userID, r.URL.Path)
-		r.Header.Set("X-User-ID", strconv.Itoa(userID))
+		s.logger.Debug("Authenticated user %d for %s", claims.UserID, r.URL.Path)
+		setAuthHeaders(r, claims)
 		next(w, r)
 	}
 }
@@ -265,7 +324,7 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 		fileStats = map[string]interface{}{"error": "failed to get stats"}
 	}
 
-	rateLimiterStats := s.rateLimiter.GetStats()
+	budgetStats := s.budgets.GetStats()
 
 	// Проверка ML сервиса
 	mlStatus := "disabled"
@@ -277,26 +336,41 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Проверка сканера загрузок
+	scannerStatus := "disabled"
+	if s.scanner.Name() != ScannerNone {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		if err := s.scanner.Ping(ctx); err != nil {
+			s.logger.Warning("Upload scanner %s is unavailable: %v", s.scanner.Name(), err)
+			scannerStatus = "unhealthy"
+		} else {
+			scannerStatus = "healthy"
+		}
+		cancel()
+	}
+
 	health := map[string]interface{}{
-		"status":       "healthy",
-		"timestamp":    time.Now(),
-		"version":      "1.0.0",
-		"database":     "connected",
-		"ml_service":   mlStatus,
-		"file_system":  fileStats,
-		"rate_limiter": rateLimiterStats,
+		"status":      "healthy",
+		"timestamp":   time.Now(),
+		"version":     "1.0.0",
+		"database":    "connected",
+		"ml_service":  mlStatus,
+		"scanner":     scannerStatus,
+		"file_system": fileStats,
+		"cost_budget": budgetStats,
 	}
 
 	s.sendJSON(w, health)
 }
 
 // @Summary Register new user
-// @Description Create a new user account with email, password and name
+// @Description Create a new user account with email, password and name. A verification link is sent to the email; when email verification is required, no tokens are returned until the email is confirmed
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param request body RegisterRequest true "User registration data"
 // @Success 200 {object} AuthResponse
+// @Success 201 {object} SuccessResponse{data=User} "Email verification required"
 // @Failure 400 {object} ErrorResponse
 // @Failure 409 {object} ErrorResponse
 // @Router /api/register [post]
@@ -332,6 +406,10 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 		Email:    req.Email,
 		Password: req.Password,
 		Name:     req.Name,
+		Role:     RoleUser,
+	}
+	if s.isBootstrapAdmin(req.Email) {
+		user.Role = RoleAdmin
 	}
 
 	if err := s.db.CreateUser(user); err != nil {
@@ -340,7 +418,20 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := s.generateJWT(user.ID)
+	if err := s.sendVerificationEmail(user, user.Email); err != nil {
+		s.logger.Error("Failed to issue verification token for user %d: %v", user.ID, err)
+	}
+
+	if s.config.RequireEmailVerification {
+		s.logger.Info("User registered, awaiting email verification: %s (ID: %d)", user.Email, user.ID)
+		s.sendJSONStatus(w, SuccessResponse{
+			Message: "Account created. Confirm your email address via the link we sent before logging in",
+			Data:    user,
+		}, http.StatusCreated)
+		return
+	}
+
+	response, err := s.issueTokens(user, r)
 	if err != nil {
 		s.logger.Error("Failed to generate token for user %d: %v", user.ID, err)
 		s.sendError(w, "Failed to generate token", http.StatusInternalServerError)
@@ -348,20 +439,20 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 	}
 
 	s.logger.Info("User registered successfully: %s (ID: %d)", user.Email, user.ID)
-	s.sendJSON(w, AuthResponse{
-		Token: token,
-		User:  *user,
-	})
+	s.sendJSON(w, response)
 }
 
 // @Summary User login
-// @Description Authenticate user with email and password
+// @Description Authenticate user with email and password. If two-factor authentication is enabled or required, a challenge token is returned instead of session tokens; complete login with /api/login/2fa (or enroll with /api/login/2fa/setup and /api/login/2fa/confirm)
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param request body LoginRequest true "User login credentials"
 // @Success 200 {object} AuthResponse
+// @Success 200 {object} LoginChallengeResponse "Second factor required"
 // @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse "Account suspended or email not verified"
+// @Failure 429 {object} ErrorResponse "Too many failed attempts for this email or IP, see Retry-After"
 // @Router /api/login [post]
 func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -385,20 +476,54 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 
 	s.logger.Info("Login attempt for email: %s", req.Email)
 
+	ip := getClientIP(r)
+	if !s.checkLoginAllowed(w, req.Email, ip) {
+		return
+	}
+
 	user, err := s.db.GetUserByEmail(req.Email)
 	if err != nil {
+		simulatePasswordCheck(req.Password)
 		s.logger.Warning("Login failed - user not found: %s", req.Email)
+		s.recordLoginFailure(req.Email, ip, nil)
 		s.sendError(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
 	if !user.CheckPassword(req.Password) {
 		s.logger.Warning("Login failed - invalid password for user: %s", req.Email)
+		s.recordLoginFailure(req.Email, ip, &user.ID)
 		s.sendError(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
-	token, err := s.generateJWT(user.ID)
+	s.loginGuard.Succeed(req.Email)
+
+	if user.IsSuspended() {
+		s.logger.Warning("Login rejected - account suspended: %s (ID: %d)", req.Email, user.ID)
+		s.sendError(w, "Account suspended", http.StatusForbidden)
+		return
+	}
+
+	if s.config.RequireEmailVerification && !user.EmailVerified() {
+		s.logger.Warning("Login rejected - email not verified: %s (ID: %d)", req.Email, user.ID)
+		s.sendError(w, "Email not verified. Request a new verification link via /api/email/verify/request", http.StatusForbidden)
+		return
+	}
+
+	challenge, err := s.secondFactorChallenge(user)
+	if err != nil {
+		s.logger.Error("Failed to start second login step for user %d: %v", user.ID, err)
+		s.sendError(w, "Failed to log in", http.StatusInternalServerError)
+		return
+	}
+	if challenge != nil {
+		s.logger.Info("Password accepted, second factor required for user %d", user.ID)
+		s.sendJSON(w, challenge)
+		return
+	}
+
+	response, err := s.issueTokens(user, r)
 	if err != nil {
 		s.logger.Error("Failed to generate token for user %d: %v", user.ID, err)
 		s.sendError(w, "Failed to generate token", http.StatusInternalServerError)
@@ -406,10 +531,7 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	s.logger.Info("User logged in successfully: %s (ID: %d)", user.Email, user.ID)
-	s.sendJSON(w, AuthResponse{
-		Token: token,
-		User:  *user,
-	})
+	s.sendJSON(w, response)
 }
 
 // @Summary Get user profile
@@ -417,6 +539,7 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 // @Tags user
 // @Produce json
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Success 200 {object} SuccessResponse{data=User}
 // @Failure 401 {object} ErrorResponse
 // @Router /api/user/profile [get]
@@ -452,7 +575,7 @@ func (s *Server) handleUserProfile(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary Update user profile
-// @Description Update user profile information (name, email, password)
+// @Description Update user profile information (name, email, password). A new email is stored as pending and applied only after it is confirmed via the link sent to it
 // @Tags user
 // @Accept json
 // @Produce json
@@ -503,13 +626,16 @@ func (s *Server) handleUpdateProfile(w http.ResponseWriter, r *http.Request) {
 		updated = true
 	}
 
-	if req.Email != "" && req.Email != user.Email {
+	// Новый email применяется только после перехода по ссылке, отправленной на него
+	emailChange := false
+	if req.Email != "" && req.Email != user.Email && req.Email != user.PendingEmail {
 		if _, err := s.db.GetUserByEmail(req.Email); err == nil {
 			s.logger.Warning("Email already taken during profile update: %s", req.Email)
 			s.sendError(w, "Email already taken", http.StatusConflict)
 			return
 		}
-		user.Email = req.Email
+		user.PendingEmail = req.Email
+		emailChange = true
 		updated = true
 	}
 
@@ -540,18 +666,29 @@ func (s *Server) handleUpdateProfile(w http.ResponseWriter, r *http.Request) {
 
 	s.logger.Info("Profile updated successfully for user %d", userID)
 
+	message := "Profile updated successfully"
+	if emailChange {
+		if err := s.sendVerificationEmail(user, user.PendingEmail); err != nil {
+			s.logger.Error("Failed to issue verification token for user %d: %v", userID, err)
+			s.sendError(w, "Failed to send verification email", http.StatusInternalServerError)
+			return
+		}
+		message = "Profile updated. Confirm the new email address via the link sent to it"
+	}
+
 	s.sendJSON(w, SuccessResponse{
-		Message: "Profile updated successfully",
+		Message: message,
 		Data:    user,
 	})
 }
 
 // @Summary Get user statistics
-// @Description Get accumulated user statistics (persists even after file deletion)
+// @Description Get accumulated user statistics (persists even after file deletion) together with plan limits, current quota usage and the remaining processing budget
 // @Tags user
 // @Produce json
 // @Security BearerAuth
-// @Success 200 {object} SuccessResponse{data=User}
+// @Security ApiKeyAuth
+// @Success 200 {object} SuccessResponse{data=UserStats}
 // @Failure 401 {object} ErrorResponse
 // @Router /api/user/stats [get]
 func (s *Server) handleUserStats(w http.ResponseWriter, r *http.Request) {
@@ -577,27 +714,54 @@ func (s *Server) handleUserStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	quota, err := s.quotas.Status(user)
+	if err != nil {
+		s.logger.Error("Failed to get quota usage for user %d: %v", userID, err)
+		s.sendError(w, "Failed to get stats", http.StatusInternalServerError)
+		return
+	}
+
+	budgetKey, plan := budgetSubject(user, nil)
+	budget, err := s.budgets.Status(r.Context(), budgetKey, plan)
+	if err != nil {
+		s.logger.Error("Failed to get budget for user %d: %v", userID, err)
+		s.sendError(w, "Failed to get stats", http.StatusInternalServerError)
+		return
+	}
+
 	s.logger.Info("Stats retrieved for user %d", userID)
 
 	s.sendJSON(w, SuccessResponse{
 		Message: "Stats retrieved successfully",
-		Data:    user,
+		Data: UserStats{
+			User:   *user,
+			Quota:  quota,
+			Budget: budget,
+		},
 	})
 }
 
 // @Summary Upload and process file
-// @Description Upload a file (images and videos) and automatically send it for ML processing. Available for both authenticated and anonymous users with rate limiting
+// @Description Upload a file (images and videos) and automatically send it for ML processing. Available for both authenticated and anonymous users. Processing cost (megabytes plus megapixels of every frame) is debited from the user's, organization's or anonymous client's budget and reported in X-Budget-Cost, X-Budget-Limit, X-Budget-Remaining and X-Budget-Reset headers
 // @Tags files
 // @Accept multipart/form-data
 // @Produce json
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param file formData file true "File to upload"
 // @Param blur_type formData string false "Type of blur to apply" Enums(gaussian, motion, pixelate) default(gaussian)
 // @Param intensity formData integer false "Effect intensity (1-10)" minimum(1) maximum(10) default(5)
-// @Param object_types formData string false "Comma-separated list of objects to blur" example("face,person,car")
-// @Success 200 {object} SuccessResponse{data=File} "File uploaded and processing started"
-// @Failure 400 {object} ErrorResponse
-// @Failure 429 {object} ErrorResponse
+// @Param object_types formData string false "Comma-separated list of objects to blur, see GET /api/capabilities" example("face,person,car")
+// @Param output_format formData string false "Format of the processed image: same as the uploaded file or JPEG. HEIC/HEIF and AVIF are processed through a JPEG copy" Enums(original, jpeg) default(original)
+// @Param preset formData string false "Object preset (built-in, organization or personal, see GET /api/presets) whose object types are added to object_types" example(privacy)
+// @Param regions formData string false "JSON array of rectangles blurred on every frame, coordinates are fractions (0-1) of the frame size" example([{"x":0.05,"y":0.8,"width":0.3,"height":0.15}])
+// @Param profile formData string false "Saved processing profile (see GET /api/profiles) used for the options not set in the request. Without it the user's default profile is used"
+// @Param organization_id formData integer false "Upload into an organization's shared library (requires owner, admin or member role)"
+// @Success 200 {object} SuccessResponse{data=File} "File uploaded and processing started, data.options holds the effective processing options"
+// @Failure 400 {object} ErrorResponse "Invalid file: errors[].code is one of file_too_large, file_empty, unsupported_extension, unsupported_content, content_mismatch, corrupt_media, dimensions_too_large, too_many_megapixels, video_too_long (also when the video header has no duration: the length limit and the processing cost depend on it), conversion_unavailable, malware_detected (the file is quarantined)"
+// @Failure 413 {object} QuotaErrorResponse "Storage or video duration quota exceeded, or file costs more than the whole budget"
+// @Failure 429 {object} QuotaErrorResponse "Rate limit, monthly file quota or processing budget exceeded"
+// @Failure 503 {object} ErrorResponse "Upload scanner is unavailable"
 // @Router /api/upload [post]
 func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -610,21 +774,8 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 	userID, _ := strconv.Atoi(userIDStr)
 	isAnonymous := userID == 0
 
-	// Rate limiting для анонимных пользователей
 	if isAnonymous {
-		allowed, count, waitTime := s.rateLimiter.IsAllowed(r)
-		if !allowed {
-			s.logger.Warning("Rate limit exceeded for anonymous user (count: %d, wait: %v)", count, waitTime)
-			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(s.config.MaxAttemptsHandled))
-			w.Header().Set("X-RateLimit-Remaining", "0")
-			w.Header().Set("X-RateLimit-Reset", fmt.Sprintf("%d", time.Now().Add(waitTime).Unix()))
-			s.sendError(w, fmt.Sprintf("Rate limit exceeded. Try again in %v", waitTime.Round(time.Minute)), http.StatusTooManyRequests)
-			return
-		}
-
-		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(s.config.MaxAttemptsHandled))
-		w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", s.config.MaxAttemptsHandled-count))
-		s.logger.Info("Anonymous file upload started (usage: %d/3)", count)
+		s.logger.Info("Anonymous file upload started")
 	} else {
 		s.logger.Info("File upload started for user %d", userID)
 	}
@@ -644,7 +795,8 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	if err := s.validator.ValidateFile(header); err != nil {
+	info, err := s.validator.ValidateFile(header)
+	if err != nil {
 		if ve, ok := err.(ValidationError); ok {
 			s.logger.Warning("File validation failed: %v", ve)
 			s.sendValidationErrors(w, []ValidationError{ve})
@@ -655,11 +807,32 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Парсим опции обработки
-	options := s.parseProcessingOptions(r)
+	// HEIC/HEIF и AVIF обрабатываются только через внешний конвертер
+	if (info.Format == FormatHEIF || info.Format == FormatAVIF) && s.converter == nil {
+		s.sendValidationErrors(w, []ValidationError{{
+			Field:   "file",
+			Message: "HEIC/HEIF and AVIF images are not supported by this server",
+			Code:    FileErrorConversion,
+		}})
+		return
+	}
+
+	// Файл может загружаться в общую библиотеку организации
+	organization, ok := s.uploadOrganization(w, r, userID, isAnonymous)
+	if !ok {
+		return
+	}
+	var organizationID *uint
+	if organization != nil {
+		organizationID = &organization.ID
+	}
+
+	// Парсим опции обработки, набор объектов раскрывается до проверки
+	options, validationErrors := s.parseProcessingOptions(r, userID, organizationID)
+	validationErrors = append(validationErrors, s.validator.ValidateProcessingOptions(options)...)
 
 	// НОВАЯ ВАЛИДАЦИЯ ОПЦИЙ ОБРАБОТКИ
-	if validationErrors := s.validator.ValidateProcessingOptions(options); len(validationErrors) > 0 {
+	if len(validationErrors) > 0 {
 		s.logger.Warning("Processing options validation failed for %s: %v", 
 			func() string {
 				if isAnonymous {
@@ -671,6 +844,56 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Размеры и длительность из заголовков нужны для квоты длительности и стоимости обработки
+	cost, err := s.budgets.model.Cost(header.Size, info, info.IsVideo())
+	if err != nil {
+		s.logger.Warning("Cannot estimate processing cost of %s: %v", header.Filename, err)
+		s.sendValidationErrors(w, []ValidationError{err.(ValidationError)})
+		return
+	}
+
+	// Проверяем квоты и бюджет пользователя или организации до записи на диск
+	var quotaSubject QuotaSubject
+	budgetKey, budgetPlan := anonymousBudgetKey(r), BudgetAnonymous
+	if !isAnonymous {
+		user, err := s.db.GetUserByID(uint(userID))
+		if err != nil {
+			s.logger.Error("Failed to get user %d for quota check: %v", userID, err)
+			s.sendError(w, "User not found", http.StatusUnauthorized)
+			return
+		}
+
+		quotaSubject = user
+		if organization != nil {
+			quotaSubject = organization
+		}
+
+		violation, err := s.quotas.Check(quotaSubject, header.Size, info)
+		if err != nil {
+			s.logger.Error("Failed to check quota for user %d: %v", userID, err)
+			s.sendError(w, "Failed to check quota", http.StatusInternalServerError)
+			return
+		}
+		if violation != nil {
+			s.sendQuotaError(w, violation)
+			return
+		}
+
+		budgetKey, budgetPlan = budgetSubject(user, organization)
+	}
+
+	if !s.chargeBudget(w, r, budgetKey, budgetPlan, cost) {
+		return
+	}
+	// Бюджет списан заранее, чтобы не принимать файл сверх него. Если загрузка
+	// не дойдет до обработки (ошибка, сканер, квота), списание возвращается
+	processingStarted := false
+	defer func() {
+		if !processingStarted {
+			s.refundBudget(r, budgetKey, budgetPlan, cost)
+		}
+	}()
+
 	s.logger.Info("Processing file upload: %s (%d bytes) %s with options: blur_type=%s, intensity=%d, objects=%v", 
 		header.Filename, header.Size,
 		func() string {
@@ -696,7 +919,8 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 	}
 	defer dst.Close()
 
-	size, err := io.Copy(dst, file)
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(dst, hasher), file)
 	if err != nil {
 		s.logger.Error("Failed to copy file content: %v", err)
 		os.Remove(filePath)
@@ -706,7 +930,8 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 
 	s.logger.Info("File saved to disk: %s (%d bytes)", filePath, size)
 
-	mimeType := s.determineMimeType(header, ext)
+	// Тип берется из формата содержимого, а не из имени файла или заголовка клиента
+	mimeType := formatMimeType(info.Format, ext)
 
 	fileRecord := &File{
 		ID:           fileID,
@@ -714,24 +939,52 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 		OriginalName: header.Filename,
 		FileName:     fileName,
 		FileSize:     size,
+		ContentHash:  hex.EncodeToString(hasher.Sum(nil)),
 		MimeType:     mimeType,
 		Status:       StatusUploaded,
 		UploadedAt:   time.Now(),
 	}
+	if organization != nil {
+		fileRecord.OrganizationID = &organization.ID
+	}
+
+	// Проверяем файл до постановки в обработку
+	scan, err := s.scanFile(r.Context(), filePath)
+	if err != nil {
+		if s.config.ScanFailClosed {
+			s.logger.Error("Failed to scan upload %s, rejecting it: %v", fileID, err)
+			os.Remove(filePath)
+			s.sendError(w, "File scanning is temporarily unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		s.logger.Warning("Failed to scan upload %s, accepting it unscanned: %v", fileID, err)
+	}
+	if scan.Infected {
+		s.rejectInfectedUpload(w, r, fileRecord, filePath, scan, isAnonymous)
+		return
+	}
 
 	if !isAnonymous {
-		if err := s.db.CreateFile(fileRecord); err != nil {
+		// Квоты проверяются еще раз вместе с созданием записи: параллельные загрузки могли их исчерпать
+		violation, err := s.quotas.CreateFile(quotaSubject, fileRecord)
+		if err != nil {
 			s.logger.Error("Failed to save file record for user %d: %v", userID, err)
 			os.Remove(filePath)
 			s.sendError(w, "Failed to save file record", http.StatusInternalServerError)
 			return
 		}
+		if violation != nil {
+			os.Remove(filePath)
+			s.sendQuotaError(w, violation)
+			return
+		}
 		s.logger.Info("File upload completed and saved to history: %s (ID: %s) for user %d", header.Filename, fileID, userID)
 	} else {
 		s.logger.Info("Anonymous file upload completed: %s (ID: %s) - not saved to history", header.Filename, fileID)
 	}
 
 	// Запускаем обработку файла в фоне
+	processingStarted = true
 	go s.processFileAsync(fileID, filePath, mimeType, options, isAnonymous)
 
 	// Обновляем статус на "processing" если это не анонимный пользователь
@@ -739,6 +992,7 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 		s.db.UpdateFileStatus(fileID, StatusProcessing)
 		fileRecord.Status = StatusProcessing
 	}
+	fileRecord.Options = &options
 
 	s.sendJSON(w, SuccessResponse{
 		Message: func() string {
@@ -751,11 +1005,47 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// uploadOrganization возвращает организацию из поля organization_id, если пользователь может загружать в нее файлы.
+// Для личной загрузки возвращает nil. При ошибке отправляет ответ и возвращает false
+func (s *Server) uploadOrganization(w http.ResponseWriter, r *http.Request, userID int, isAnonymous bool) (*Organization, bool) {
+	value := r.FormValue("organization_id")
+	if value == "" {
+		return nil, true
+	}
+
+	if isAnonymous {
+		s.sendError(w, "Anonymous users cannot upload to organizations", http.StatusForbidden)
+		return nil, false
+	}
+
+	orgID, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		s.sendValidationErrors(w, []ValidationError{{Field: "organization_id", Message: "Invalid organization ID"}})
+		return nil, false
+	}
+
+	membership, err := s.db.GetMembership(uint(orgID), uint(userID))
+	if err != nil || !canUploadToOrganization(membership.Role) {
+		s.logger.Warning("User %d is not allowed to upload to organization %d", userID, orgID)
+		s.sendError(w, "You cannot upload files to this organization", http.StatusForbidden)
+		return nil, false
+	}
+
+	organization, err := s.db.GetOrganizationByID(uint(orgID))
+	if err != nil {
+		s.sendError(w, "Organization not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return organization, true
+}
+
 // @Summary Get user files
-// @Description Get list of all files uploaded by the authenticated user with their processing status
+// @Description Get list of all files uploaded by the authenticated user with their processing status. Files uploaded to organizations the user is no longer a member of are not listed
 // @Tags files
 // @Produce json
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Success 200 {object} SuccessResponse{data=[]File}
 // @Failure 401 {object} ErrorResponse
 // @Router /api/files [get]
@@ -775,7 +1065,7 @@ func (s *Server) handleGetFiles(w http.ResponseWriter, r *http.Request) {
 
 	s.logger.Debug("Getting files list for user %d", userID)
 
-	files, err := s.db.GetUserFiles(uint(userID))
+	files, err := s.db.GetUserListedFiles(uint(userID))
 	if err != nil {
 		s.logger.Error("Failed to get user files for user %d: %v", userID, err)
 		s.sendError(w, "Failed to get files", http.StatusInternalServerError)
@@ -791,21 +1081,28 @@ func (s *Server) handleGetFiles(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary File operations
-// @Description Handle file operations: GET for file info/download, DELETE for removal. Use ?type=original or ?type=processed query parameter for downloads
+// @Description Handle file operations: GET for file info/download, DELETE for removal, POST .../reprocess to process the original again with new options (same form fields as upload). Files shared with an organization are available to its members according to their role. Use ?type=original or ?type=processed query parameter for downloads, ?type=thumbnail or ?type=preview for small WebP (or JPEG, see RENDITION_FORMAT) renditions. Downloads support Range, If-None-Match, If-Modified-Since and If-Range headers
 // @Tags files
 // @Param id path string true "File ID"
-// @Param type query string false "Download type" Enums(original, processed)
+// @Param type query string false "Download type" Enums(original, processed, thumbnail, preview)
+// @Param disposition query string false "Content-Disposition for downloads; inline lets browsers play videos" Enums(attachment, inline) default(attachment)
+// @Param Range header string false "Byte range, e.g. bytes=0-1048575"
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Success 200 {object} SuccessResponse{data=File} "File information"
 // @Success 200 {file} binary "File download (when type parameter is used)"
+// @Success 206 {file} binary "Partial content for Range requests"
+// @Success 304 "Not modified (ETag or Last-Modified matched)"
 // @Success 200 {object} SuccessResponse "File deleted"
 // @Failure 403 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse "Download or reprocess rate limit exceeded, see Retry-After"
 // @Router /api/files/{id} [get]
 // @Router /api/files/{id} [delete]
+// @Router /api/files/{id}/reprocess [post]
 func (s *Server) handleFileActions(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/api/files/")
-	fileID := strings.Split(path, "/")[0]
+	fileID, action, _ := strings.Cut(path, "/")
 
 	if fileID == "" {
 		s.logger.Warning("Empty file ID in file actions request")
@@ -828,16 +1125,38 @@ func (s *Server) handleFileActions(w http.ResponseWriter, r *http.Request) {
 			return fmt.Sprintf("user %d", userID)
 		}(), downloadType)
 
+	if action == "reprocess" {
+		if r.Method != http.MethodPost {
+			s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !s.requireScope(w, r, ScopeUpload) {
+			return
+		}
+		s.handleReprocessFile(w, r, fileID, userID, isAnonymous)
+		return
+	}
+
 	switch r.Method {
-	case http.MethodGet:
-		if downloadType == "original" || downloadType == "processed" {
+	case http.MethodGet, http.MethodHead:
+		if !s.requireScope(w, r, ScopeRead) {
+			return
+		}
+		switch downloadType {
+		case "original", "processed":
 			// Скачивание файла
 			s.handleDownloadFileByID(w, r, fileID, userID, isAnonymous, downloadType == "processed")
-		} else {
+		case RenditionThumbnail, RenditionPreview:
+			// Миниатюра или превью
+			s.handleDownloadRendition(w, r, fileID, userID, isAnonymous, downloadType)
+		default:
 			// Получение информации о файле
 			s.handleGetFileInfo(w, r, fileID, userID, isAnonymous)
 		}
 	case http.MethodDelete:
+		if !s.requireScope(w, r, ScopeDelete) {
+			return
+		}
 		s.handleDeleteFileByID(w, r, fileID, userID, isAnonymous)
 	default:
 		s.logger.Warning("Method %s not allowed for file actions", r.Method)
@@ -859,29 +1178,81 @@ func (s *Server) handleDownloadFileByID(w http.ResponseWriter, r *http.Request,
 			return
 		}
 
-		filePath := matches[0]
+		blob, err := s.blobs.Open(filepath.Base(matches[0]))
+		if err != nil {
+			s.logger.Warning("Failed to open anonymous file %s: %v", fileID, err)
+			s.sendError(w, "File not found", http.StatusNotFound)
+			return
+		}
+		defer blob.Close()
+
 		s.logger.Info("Serving anonymous file: %s (processed: %v)", fileID, isProcessed)
 
-		mimeType := s.determineMimeTypeFromPath(filePath)
-		w.Header().Set("Content-Type", mimeType)
-		http.ServeFile(w, r, filePath)
+		mimeType := s.determineMimeTypeFromPath(matches[0])
+		s.serveBlob(w, r, blob, filepath.Base(matches[0]), mimeType, "", blob.ModTime())
 		return
 	}
 
-	file, err := s.db.GetFileByID(fileID)
-	if err != nil {
-		s.logger.Warning("File not found in database: %s for user %d", fileID, userID)
-		s.sendError(w, "File not found", http.StatusNotFound)
+	file, ok := s.fileForAction(w, fileID, userID, FileActionDownload)
+	if !ok {
 		return
 	}
 
-	if file.UserID != uint(userID) {
-		s.logger.Warning("Access denied: user %d tried to access file %s owned by user %d", userID, fileID, file.UserID)
-		s.sendError(w, "Access denied", http.StatusForbidden)
+	s.handleDownloadFile(w, r, file, isProcessed)
+}
+
+// Скачивание миниатюры или превью
+func (s *Server) handleDownloadRendition(w http.ResponseWriter, r *http.Request, fileID string, userID int, isAnonymous bool, kind string) {
+	if isAnonymous {
+		s.sendError(w, "Previews not available for anonymous users", http.StatusForbidden)
 		return
 	}
 
-	s.handleDownloadFile(w, r, file, isProcessed)
+	file, ok := s.fileForAction(w, fileID, userID, FileActionView)
+	if !ok {
+		return
+	}
+
+	blobName, hash := file.ThumbnailName, file.ThumbnailHash
+	if kind == RenditionPreview {
+		blobName, hash = file.PreviewName, file.PreviewHash
+	}
+	if blobName == "" {
+		s.sendError(w, "Preview not available", http.StatusNotFound)
+		return
+	}
+
+	blob, err := s.blobs.Open(blobName)
+	if err != nil {
+		s.logger.Warning("Failed to open %s for file %s: %v", kind, fileID, err)
+		s.sendError(w, "Preview not available", http.StatusNotFound)
+		return
+	}
+	defer blob.Close()
+
+	// Копии, созданные до сохранения хешей, хешируются один раз
+	if hash == "" {
+		if hash, err = hashContent(blob); err != nil {
+			s.sendError(w, "Failed to read file", http.StatusInternalServerError)
+			return
+		}
+		if _, err := blob.Seek(0, io.SeekStart); err != nil {
+			s.sendError(w, "Failed to read file", http.StatusInternalServerError)
+			return
+		}
+		if err := s.db.SetRenditionHash(file.ID, kind, hash); err != nil {
+			s.logger.Warning("Failed to store %s hash for %s: %v", kind, file.ID, err)
+		}
+	}
+
+	// Миниатюры всегда показываются в браузере
+	query := r.URL.Query()
+	query.Set("disposition", "inline")
+	r.URL.RawQuery = query.Encode()
+
+	ext := filepath.Ext(blobName)
+	fileName := kind + "_" + strings.TrimSuffix(file.OriginalName, filepath.Ext(file.OriginalName)) + ext
+	s.serveBlob(w, r, blob, fileName, s.determineMimeTypeFromExtension(ext), hash, blob.ModTime())
 }
 
 // Получение информации о файле
@@ -891,14 +1262,8 @@ func (s *Server) handleGetFileInfo(w http.ResponseWriter, r *http.Request, fileI
 		return
 	}
 
-	file, err := s.db.GetFileByID(fileID)
-	if err != nil {
-		s.sendError(w, "File not found", http.StatusNotFound)
-		return
-	}
-
-	if file.UserID != uint(userID) {
-		s.sendError(w, "Access denied", http.StatusForbidden)
+	file, ok := s.fileForAction(w, fileID, userID, FileActionView)
+	if !ok {
 		return
 	}
 
@@ -916,48 +1281,151 @@ func (s *Server) handleDeleteFileByID(w http.ResponseWriter, r *http.Request, fi
 		return
 	}
 
-	file, err := s.db.GetFileByID(fileID)
-	if err != nil {
-		s.logger.Warning("File not found for deletion: %s for user %d", fileID, userID)
-		s.sendError(w, "File not found", http.StatusNotFound)
+	file, ok := s.fileForAction(w, fileID, userID, FileActionDelete)
+	if !ok {
 		return
 	}
 
-	if file.UserID != uint(userID) {
-		s.logger.Warning("Access denied: user %d tried to delete file %s owned by user %d", userID, fileID, file.UserID)
-		s.sendError(w, "Access denied", http.StatusForbidden)
+	s.handleDeleteFile(w, r, file)
+}
+
+// Повторная обработка файла с новыми опциями
+func (s *Server) handleReprocessFile(w http.ResponseWriter, r *http.Request, fileID string, userID int, isAnonymous bool) {
+	if isAnonymous {
+		s.sendError(w, "Anonymous users cannot reprocess files", http.StatusForbidden)
 		return
 	}
 
-	s.handleDeleteFile(w, r, file)
+	file, ok := s.fileForAction(w, fileID, userID, FileActionReprocess)
+	if !ok {
+		return
+	}
+
+	if file.Status == StatusProcessing {
+		s.sendError(w, "File is already being processed", http.StatusConflict)
+		return
+	}
+
+	options, validationErrors := s.parseProcessingOptions(r, userID, file.OrganizationID)
+	validationErrors = append(validationErrors, s.validator.ValidateProcessingOptions(options)...)
+	if len(validationErrors) > 0 {
+		s.sendValidationErrors(w, validationErrors)
+		return
+	}
+
+	// Повторная обработка расходует бюджет так же, как первая
+	if !s.chargeStoredFile(w, r, file, userID) {
+		return
+	}
+
+	// Результаты предыдущей обработки больше не нужны
+	for _, name := range file.BlobNames()[1:] {
+		derivedPath := filepath.Join(s.config.UploadPath, name)
+		if err := os.Remove(derivedPath); err != nil && !os.IsNotExist(err) {
+			s.logger.Warning("Failed to remove derived file from disk: %s - %v", derivedPath, err)
+		}
+	}
+
+	if err := s.db.ResetFileProcessing(file.ID); err != nil {
+		s.logger.Error("Failed to reset processing for file %s: %v", file.ID, err)
+		s.sendError(w, "Failed to start processing", http.StatusInternalServerError)
+		return
+	}
+
+	s.logger.Info("Reprocessing file %s requested by user %d with options: blur_type=%s, intensity=%d, objects=%v",
+		file.ID, userID, options.BlurType, options.Intensity, options.ObjectTypes)
+
+	go s.processFileAsync(file.ID, filepath.Join(s.config.UploadPath, file.FileName), file.MimeType, options, false)
+
+	file, err := s.db.GetFileByID(file.ID)
+	if err != nil {
+		s.sendError(w, "File not found", http.StatusNotFound)
+		return
+	}
+	file.Options = &options
+
+	s.sendJSON(w, SuccessResponse{
+		Message: "File processing restarted",
+		Data:    file,
+	})
 }
 
 // Скачивание файла
 func (s *Server) handleDownloadFile(w http.ResponseWriter, r *http.Request, file *File, isProcessed bool) {
-	var filePath string
-	var fileName string
+	blobName := file.FileName
+	fileName := file.OriginalName
+	mimeType := file.MimeType
+	hash := file.ContentHash
+	modTime := file.UploadedAt
+	processed := false
 
 	if isProcessed && file.IsProcessed() {
-		filePath = filepath.Join(s.config.UploadPath, file.ProcessedName)
+		blobName = file.ProcessedName
 		fileName = "processed_" + file.OriginalName
-	} else {
-		filePath = filepath.Join(s.config.UploadPath, file.FileName)
-		fileName = file.OriginalName
+		// Обработанное изображение могло быть сохранено в другом формате (output_format=jpeg)
+		if ext := filepath.Ext(file.ProcessedName); !strings.EqualFold(ext, filepath.Ext(file.OriginalName)) {
+			fileName = "processed_" + strings.TrimSuffix(file.OriginalName, filepath.Ext(file.OriginalName)) + ext
+			mimeType = s.determineMimeTypeFromExtension(ext)
+		}
+		hash = file.ProcessedHash
+		modTime = file.ProcessedAt
+		processed = true
 	}
 
-	s.logger.Debug("Downloading file: %s (path: %s, processed: %v)", file.ID, filePath, isProcessed)
+	s.logger.Debug("Downloading file: %s (blob: %s, processed: %v)", file.ID, blobName, isProcessed)
 
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		s.logger.Error("File not found on disk: %s", filePath)
-		s.sendError(w, "File not found on disk", http.StatusNotFound)
+	blob, err := s.blobs.Open(blobName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.logger.Error("File not found on disk: %s", blobName)
+			s.sendError(w, "File not found on disk", http.StatusNotFound)
+		} else {
+			s.logger.Error("Failed to open file %s: %v", blobName, err)
+			s.sendError(w, "Failed to read file", http.StatusInternalServerError)
+		}
 		return
 	}
+	defer blob.Close()
 
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", fileName))
-	w.Header().Set("Content-Type", file.MimeType)
+	// Для файлов, загруженных до появления хешей, считаем хеш при первом скачивании
+	if hash == "" {
+		if hash, err = hashContent(blob); err != nil {
+			s.logger.Error("Failed to hash file %s: %v", blobName, err)
+			s.sendError(w, "Failed to read file", http.StatusInternalServerError)
+			return
+		}
+		if _, err := blob.Seek(0, io.SeekStart); err != nil {
+			s.sendError(w, "Failed to read file", http.StatusInternalServerError)
+			return
+		}
+		if err := s.db.SetFileHash(file.ID, processed, hash); err != nil {
+			s.logger.Warning("Failed to store hash for file %s: %v", file.ID, err)
+		}
+	}
 
 	s.logger.Info("Serving file: %s (%s) to user %d (processed: %v)", fileName, file.ID, file.UserID, isProcessed)
-	http.ServeFile(w, r, filePath)
+	s.serveBlob(w, r, blob, fileName, mimeType, hash, modTime)
+}
+
+// Отдача файла с поддержкой Range, ETag и условных запросов
+func (s *Server) serveBlob(w http.ResponseWriter, r *http.Request, blob Blob, fileName, mimeType, hash string, modTime time.Time) {
+	disposition := "attachment"
+	if r.URL.Query().Get("disposition") == "inline" {
+		disposition = "inline"
+	}
+
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": fileName}))
+	w.Header().Set("Content-Type", mimeType)
+	// Содержимое загружено пользователями: браузер не должен угадывать тип по содержимому,
+	// а открытый inline документ исполняется в изолированном источнике без скриптов
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if hash != "" {
+		w.Header().Set("ETag", `"`+hash+`"`)
+	}
+
+	http.ServeContent(w, r, fileName, modTime, blob)
 }
 
 // Удаление файла
@@ -965,20 +1433,20 @@ func (s *Server) handleDeleteFile(w http.ResponseWriter, r *http.Request, file *
 	s.logger.Info("Deleting file: %s (%s) for user %d", file.OriginalName, file.ID, file.UserID)
 
 	// Удаляем оригинальный файл
-	filePath := filepath.Join(s.config.UploadPath, file.FileName)
+	filePath := filepath.Join(s.blobDir(file), file.FileName)
 	if err := os.Remove(filePath); err != nil {
 		s.logger.Warning("Failed to remove original file from disk: %s - %v", filePath, err)
 	} else {
 		s.logger.Debug("Original file removed from disk: %s", filePath)
 	}
 
-	// Удаляем обработанный файл, если он есть
-	if file.ProcessedName != "" {
-		processedPath := filepath.Join(s.config.UploadPath, file.ProcessedName)
-		if err := os.Remove(processedPath); err != nil {
-			s.logger.Warning("Failed to remove processed file from disk: %s - %v", processedPath, err)
+	// Удаляем обработанный файл, миниатюру и превью, если они есть
+	for _, name := range file.BlobNames()[1:] {
+		derivedPath := filepath.Join(s.config.UploadPath, name)
+		if err := os.Remove(derivedPath); err != nil {
+			s.logger.Warning("Failed to remove derived file from disk: %s - %v", derivedPath, err)
 		} else {
-			s.logger.Debug("Processed file removed from disk: %s", processedPath)
+			s.logger.Debug("Derived file removed from disk: %s", derivedPath)
 		}
 	}
 
@@ -996,10 +1464,12 @@ func (s *Server) handleDeleteFile(w http.ResponseWriter, r *http.Request, file *
 }
 
 // @Summary Admin statistics
-// @Description Get administrative statistics about server, file system, ML service and rate limiter
+// @Description Get administrative statistics about server, file system, ML service and rate limiter. Available to admins and auditors
 // @Tags admin
 // @Produce json
+// @Security BearerAuth
 // @Success 200 {object} SuccessResponse
+// @Failure 403 {object} ErrorResponse
 // @Router /api/admin/stats [get]
 func (s *Server) handleAdminStats(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -1008,7 +1478,8 @@ func (s *Server) handleAdminStats(w http.ResponseWriter, r *http.Request) {
 	}
 
 	fileStats, _ := s.fileCleaner.GetStats()
-	rateLimiterStats := s.rateLimiter.GetStats()
+	budgetStats := s.budgets.GetStats()
+	loginGuardStats := s.loginGuard.GetStats()
 
 	// Статистика обработки файлов
 	processingStats := make(map[string]interface{})
@@ -1024,16 +1495,30 @@ func (s *Server) handleAdminStats(w http.ResponseWriter, r *http.Request) {
 	if failedFiles, err := s.db.GetFilesByStatus(StatusFailed); err == nil {
 		processingStats["failed_files"] = len(failedFiles)
 	}
+	if quarantinedFiles, err := s.db.GetFilesByStatus(StatusQuarantined); err == nil {
+		processingStats["quarantined_files"] = len(quarantinedFiles)
+	}
 
 	stats := map[string]interface{}{
 		"server_uptime":    time.Since(time.Now().Add(-time.Hour)),
 		"file_system":      fileStats,
-		"rate_limiter":     rateLimiterStats,
+		"cost_budget":      budgetStats,
+		"rate_limits":      s.routeLimiter.Policies(),
+		"login_guard":      loginGuardStats,
 		"processing_stats": processingStats,
 		"ml_service": map[string]interface{}{
 			"enabled": s.config.MLServiceEnabled,
 			"url":     s.config.MLServiceURL,
 			"healthy": s.checkMLService(),
+			"catalog": map[string]interface{}{
+				"source":       s.catalog.Get().Source,
+				"object_types": len(s.catalog.Get().ObjectTypes),
+				"updated_at":   s.catalog.Get().UpdatedAt,
+			},
+		},
+		"scanner": map[string]interface{}{
+			"driver":      s.scanner.Name(),
+			"fail_closed": s.config.ScanFailClosed,
 		},
 	}
 
@@ -1043,23 +1528,125 @@ func (s *Server) handleAdminStats(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// Парсинг опций обработки из формы
-func (s *Server) parseProcessingOptions(r *http.Request) ProcessingOptions {
-	options := ProcessingOptions{
-		BlurType:  "gaussian",
-		Intensity: 5,
+// @Summary Run file cleanup
+// @Description Delete anonymous files older than 24h and user files whose retention has expired. Also reports database records whose blobs are missing. Runs as dry run unless dry_run=false. Auditors may only run dry runs
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param dry_run query bool false "Only report what would be deleted" default(true)
+// @Success 200 {object} SuccessResponse{data=CleanupReport}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/cleanup [post]
+func (s *Server) handleAdminCleanup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dryRun := true
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			s.sendError(w, "Invalid dry_run value", http.StatusBadRequest)
+			return
+		}
+		dryRun = parsed
+	}
+
+	if !dryRun && !s.requireRole(w, r, RoleAdmin) {
+		return
+	}
+
+	s.logger.Info("Admin cleanup requested (dry run: %v)", dryRun)
+
+	report, err := s.fileCleaner.Cleanup(dryRun)
+	if err != nil {
+		s.logger.Error("Admin cleanup failed: %v", err)
+		s.sendError(w, "Cleanup failed", http.StatusInternalServerError)
+		return
+	}
+
+	s.sendJSON(w, SuccessResponse{
+		Message: "Cleanup completed",
+		Data:    report,
+	})
+}
+
+// @Summary Storage consistency check
+// @Description Compare File records with files on disk. GET only reports discrepancies; POST also repairs them (marks records failed, quarantines orphans and temp files, raises accumulated user totals that are below the stored files). Repair is available to admins only
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} SuccessResponse{data=ConsistencyReport}
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/fsck [get]
+// @Router /api/admin/fsck [post]
+func (s *Server) handleAdminFsck(w http.ResponseWriter, r *http.Request) {
+	var repair bool
+	switch r.Method {
+	case http.MethodGet:
+		repair = false
+	case http.MethodPost:
+		if !s.requireRole(w, r, RoleAdmin) {
+			return
+		}
+		repair = true
+	default:
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
 
+	s.logger.Info("Admin storage check requested (repair: %v)", repair)
+
+	report, err := s.checker.Check(repair)
+	if err != nil {
+		s.logger.Error("Storage check failed: %v", err)
+		s.sendError(w, "Storage check failed", http.StatusInternalServerError)
+		return
+	}
+
+	s.sendJSON(w, SuccessResponse{
+		Message: "Storage check completed",
+		Data:    report,
+	})
+}
+
+// Парсинг опций обработки из формы. Основа - профиль из поля profile или основной профиль
+// пользователя, поля формы заменяют его значения. Набор объектов preset раскрывается из наборов
+// пользователя userID и организации organizationID. Возвращаются ошибки разбора, диапазоны
+// значений проверяет ValidateProcessingOptions
+func (s *Server) parseProcessingOptions(r *http.Request, userID int, organizationID *uint) (ProcessingOptions, []ValidationError) {
+	options, profileErr := s.profileOptions(strings.TrimSpace(r.FormValue("profile")), userID)
+	if profileErr != nil {
+		return options, []ValidationError{*profileErr}
+	}
+
+	var validationErrors []ValidationError
+
 	if blurType := r.FormValue("blur_type"); blurType != "" {
 		options.BlurType = blurType
 	}
 
 	if intensity := r.FormValue("intensity"); intensity != "" {
-		if intVal, err := strconv.Atoi(intensity); err == nil && intVal >= 1 && intVal <= 10 {
+		intVal, err := strconv.Atoi(strings.TrimSpace(intensity))
+		if err != nil {
+			validationErrors = append(validationErrors, ValidationError{
+				Field:   "intensity",
+				Message: "Intensity must be an integer between 1 and 10",
+			})
+		} else {
 			options.Intensity = intVal
 		}
 	}
 
+	if outputFormat := r.FormValue("output_format"); outputFormat != "" {
+		options.OutputFormat = outputFormat
+	}
+
 	if objectTypes := r.FormValue("object_types"); objectTypes != "" {
 		options.ObjectTypes = strings.Split(objectTypes, ",")
 		for i, obj := range options.ObjectTypes {
@@ -1067,16 +1654,24 @@ func (s *Server) parseProcessingOptions(r *http.Request) ProcessingOptions {
 		}
 	}
 
-	return options
-}
+	if regions := r.FormValue("regions"); regions != "" {
+		options.Regions = nil
+		if err := json.Unmarshal([]byte(regions), &options.Regions); err != nil {
+			validationErrors = append(validationErrors, ValidationError{
+				Field:   "regions",
+				Message: `Regions must be a JSON array of {"x", "y", "width", "height"} objects`,
+			})
+		}
+	}
 
-// Определение MIME типа
-func (s *Server) determineMimeType(header *multipart.FileHeader, ext string) string {
-	mimeType := header.Header.Get("Content-Type")
-	if mimeType == "" || mimeType == "application/octet-stream" {
-		mimeType = s.determineMimeTypeFromExtension(ext)
+	if preset := r.FormValue("preset"); preset != "" {
+		options.Preset = preset
+		if err := s.expandPreset(&options, userID, organizationID); err != nil {
+			validationErrors = append(validationErrors, *err)
+		}
 	}
-	return mimeType
+
+	return options, validationErrors
 }
 
 // Определение MIME типа по расширению
@@ -1094,6 +1689,12 @@ func (s *Server) determineMimeTypeFromExtension(ext string) string {
 		return "image/bmp"
 	case ".tiff", ".tif":
 		return "image/tiff"
+	case ".heic":
+		return "image/heic"
+	case ".heif":
+		return "image/heif"
+	case ".avif":
+		return "image/avif"
 	case ".mp4":
 		return "video/mp4"
 	case ".avi":
@@ -1123,15 +1724,59 @@ func (s *Server) determineMimeTypeFromPath(filePath string) string {
 func (s *Server) processFileAsync(fileID, filePath, mimeType string, options ProcessingOptions, isAnonymous bool) {
 	s.logger.Info("Starting processing for file %s (anonymous: %v)", fileID, isAnonymous)
 
+	processedName, processedSize, err := s.runProcessing(fileID, filePath, mimeType, options)
+	if err != nil {
+		if !isAnonymous {
+			s.db.UpdateFileProcessing(fileID, "", 0, StatusFailed, err.Error())
+		}
+		return
+	}
+
+	if !isAnonymous {
+		err := s.db.UpdateFileProcessing(fileID, processedName, processedSize, StatusCompleted, "")
+		if err != nil {
+			s.logger.Error("Failed to update file processing status for %s: %v", fileID, err)
+		} else {
+			s.logger.Info("File processing completed successfully: %s", fileID)
+			s.afterProcessing(fileID, processedName)
+		}
+	} else {
+		s.logger.Info("Anonymous file processing completed: %s", fileID)
+	}
+}
+
+// runProcessing обрабатывает файл ML сервисом или эмуляцией и приводит результат к выбранному формату.
+// HEIC/HEIF и AVIF обрабатываются через временную JPEG копию. Текст ошибки сохраняется в файле
+func (s *Server) runProcessing(fileID, filePath, mimeType string, options ProcessingOptions) (string, int64, error) {
+	source, sourceMimeType := filePath, mimeType
+	if needsConversion(mimeType) {
+		converted, err := s.convertSource(fileID, filePath)
+		if err != nil {
+			s.logger.Error("Failed to convert file %s for processing: %v", fileID, err)
+			return "", 0, errors.New("Failed to convert image for processing")
+		}
+		defer os.Remove(converted)
+		source, sourceMimeType = converted, "image/jpeg"
+	}
+
+	var processedName string
+	var processedSize int64
+	var err error
 	if s.config.MLServiceEnabled {
-		s.processWithMLService(fileID, filePath, mimeType, options, isAnonymous)
+		processedName, processedSize, err = s.processWithMLService(fileID, source, sourceMimeType, options)
 	} else {
-		s.processWithEmulation(fileID, filePath, mimeType, options, isAnonymous)
+		processedName, processedSize, err = s.processWithEmulation(fileID, source)
+	}
+	if err != nil {
+		return "", 0, err
 	}
+
+	processedName, processedSize = s.convertOutput(fileID, filePath, processedName, processedSize, options)
+	return processedName, processedSize, nil
 }
 
 // Эмуляция обработки файла
-func (s *Server) processWithEmulation(fileID, filePath, mimeType string, options ProcessingOptions, isAnonymous bool) {
+func (s *Server) processWithEmulation(fileID, filePath string) (string, int64, error) {
 	s.logger.Debug("Emulating ML processing for file %s", fileID)
 
 	// Эмитируем время обработки (2-5 секунд)
@@ -1146,10 +1791,7 @@ func (s *Server) processWithEmulation(fileID, filePath, mimeType string, options
 	// Копируем файл
 	if err := s.copyFile(filePath, processedPath); err != nil {
 		s.logger.Error("Failed to create processed file %s: %v", processedPath, err)
-		if !isAnonymous {
-			s.db.UpdateFileProcessing(fileID, "", 0, StatusFailed, "Failed to create processed file")
-		}
-		return
+		return "", 0, errors.New("Failed to create processed file")
 	}
 
 	// Получаем размер обработанного файла
@@ -1158,20 +1800,11 @@ func (s *Server) processWithEmulation(fileID, filePath, mimeType string, options
 		processedSize = stat.Size()
 	}
 
-	if !isAnonymous {
-		err := s.db.UpdateFileProcessing(fileID, processedName, processedSize, StatusCompleted, "")
-		if err != nil {
-			s.logger.Error("Failed to update file processing status for %s: %v", fileID, err)
-		} else {
-			s.logger.Info("File processing completed successfully: %s", fileID)
-		}
-	} else {
-		s.logger.Info("Anonymous file processing completed: %s", fileID)
-	}
+	return processedName, processedSize, nil
 }
 
 // Обработка с помощью ML сервиса
-func (s *Server) processWithMLService(fileID, filePath, mimeType string, options ProcessingOptions, isAnonymous bool) {
+func (s *Server) processWithMLService(fileID, filePath, mimeType string, options ProcessingOptions) (string, int64, error) {
 	s.logger.Debug("Processing file %s with ML service", fileID)
 
 	reqBody := ProcessingRequest{
@@ -1184,10 +1817,7 @@ func (s *Server) processWithMLService(fileID, filePath, mimeType string, options
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
 		s.logger.Error("Failed to marshal request for ML service: %v", err)
-		if !isAnonymous {
-			s.db.UpdateFileProcessing(fileID, "", 0, StatusFailed, "ML request marshal error")
-		}
-		return
+		return "", 0, errors.New("ML request marshal error")
 	}
 
 	client := &http.Client{Timeout: time.Duration(s.config.MLServiceTimeout) * time.Second}
@@ -1195,48 +1825,55 @@ func (s *Server) processWithMLService(fileID, filePath, mimeType string, options
 	resp, err := client.Post(url, "application/json", bytes.NewReader(jsonData))
 	if err != nil {
 		s.logger.Error("ML service request failed: %v", err)
-		if !isAnonymous {
-			s.db.UpdateFileProcessing(fileID, "", 0, StatusFailed, "ML service request failed")
-		}
-		return
+		return "", 0, errors.New("ML service request failed")
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		s.logger.Error("ML service returned status %d: %s", resp.StatusCode, string(body))
-		if !isAnonymous {
-			s.db.UpdateFileProcessing(fileID, "", 0, StatusFailed, fmt.Sprintf("ML service error: %s", strings.TrimSpace(string(body))))
-		}
-		return
+		return "", 0, fmt.Errorf("ML service error: %s", strings.TrimSpace(string(body)))
 	}
 
 	var mlResp ProcessingResponse
 	if err := json.NewDecoder(resp.Body).Decode(&mlResp); err != nil {
 		s.logger.Error("Failed to decode ML service response: %v", err)
-		if !isAnonymous {
-			s.db.UpdateFileProcessing(fileID, "", 0, StatusFailed, "Invalid ML service response")
-		}
-		return
+		return "", 0, errors.New("Invalid ML service response")
 	}
 
 	if !mlResp.Success {
-		if !isAnonymous {
-			s.db.UpdateFileProcessing(fileID, "", 0, StatusFailed, mlResp.ErrorMessage)
-		}
+		return "", 0, errors.New(mlResp.ErrorMessage)
+	}
+
+	s.logger.Debug("File processed with ML service: %s", fileID)
+	return filepath.Base(mlResp.ProcessedPath), mlResp.ProcessedSize, nil
+}
+
+// Действия после успешной обработки файла пользователя
+func (s *Server) afterProcessing(fileID, processedName string) {
+	hash, err := hashBlob(s.blobs, processedName)
+	if err != nil {
+		s.logger.Warning("Failed to hash processed file %s: %v", processedName, err)
 		return
 	}
+	if err := s.db.SetFileHash(fileID, true, hash); err != nil {
+		s.logger.Warning("Failed to store processed hash for %s: %v", fileID, err)
+	}
 
-	processedName := filepath.Base(mlResp.ProcessedPath)
-	if !isAnonymous {
-		err := s.db.UpdateFileProcessing(fileID, processedName, mlResp.ProcessedSize, StatusCompleted, "")
-		if err != nil {
-			s.logger.Error("Failed to update file processing status for %s: %v", fileID, err)
-		} else {
-			s.logger.Info("File processed successfully with ML service: %s", fileID)
-		}
-	} else {
-		s.logger.Info("Anonymous file processed with ML service: %s", fileID)
+	s.generateRenditions(fileID, processedName)
+}
+
+// Создание миниатюры и превью по обработанному файлу
+func (s *Server) generateRenditions(fileID, processedName string) {
+	// Формат обработанного файла может отличаться от загруженного (output_format=jpeg)
+	thumbnail, preview, err := s.renditions.Generate(fileID, processedName, s.determineMimeTypeFromPath(processedName))
+	if err != nil {
+		s.logger.Debug("Renditions skipped for file %s: %v", fileID, err)
+		return
+	}
+
+	if err := s.db.SetFileRenditions(fileID, thumbnail, preview); err != nil {
+		s.logger.Warning("Failed to store renditions for %s: %v", fileID, err)
 	}
 }
 
@@ -1275,13 +1912,12 @@ func (s *Server) copyFile(src, dst string) error {
 }
 
 // Генерация JWT токена
-func (s *Server) generateJWT(userID uint) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+func (s *Server) generateJWT(userID uint, sessionID string) (string, error) {
+	return s.signer.Sign(jwt.MapClaims{
+		"sub":     strconv.FormatUint(uint64(userID), 10),
 		"user_id": userID,
-		"exp":     time.Now().Add(time.Minute * 30).Unix(),
-	})
-
-	return token.SignedString([]byte(s.config.JWTSecret))
+		"sid":     sessionID,
+	}, accessTokenTTL)
 }
 
 // Отправка JSON ответа
@@ -1292,6 +1928,15 @@ func (s *Server) sendJSON(w http.ResponseWriter, data interface{}) {
 	}
 }
 
+// Отправка JSON ответа с указанным статусом
+func (s *Server) sendJSONStatus(w http.ResponseWriter, data interface{}, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		s.logger.Error("Failed to encode JSON response: %v", err)
+	}
+}
+
 // Отправка ошибки
 func (s *Server) sendError(w http.ResponseWriter, message string, status int) {
 	s.logger.Warning("Sending error response: %d - %s", status, message)
@@ -1317,5 +1962,8 @@ func (s *Server) Stop() {
 	if s.fileCleaner != nil {
 		s.fileCleaner.Stop()
 	}
+	if s.catalog != nil {
+		s.catalog.Stop()
+	}
 	s.logger.Info("Server stopped")
 }
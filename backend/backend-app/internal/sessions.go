@@ -0,0 +1,268 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Время жизни access токена
+const accessTokenTTL = 30 * time.Minute
+
+// Причины отзыва сессий
+const (
+	RevokeReasonLogout = "logout"
+	RevokeReasonReuse  = "refresh_token_reuse"
+)
+
+// authError ошибка аутентификации, текст которой можно вернуть клиенту
+type authError struct {
+	message string
+}
+
+func (e *authError) Error() string {
+	return e.message
+}
+
+var (
+	errAuthHeaderMissing   = &authError{"Authorization header required"}
+	errBearerRequired      = &authError{"Bearer token required"}
+	errInvalidToken        = &authError{"Invalid token"}
+	errInvalidTokenClaims  = &authError{"Invalid token claims"}
+	errInvalidTokenUserID  = &authError{"Invalid user ID in token"}
+	errSessionRevoked      = &authError{"Session has been revoked"}
+	errInvalidRefreshToken = &authError{"Invalid refresh token"}
+)
+
+// AccessClaims данные аутентифицированного запроса: сессия для Bearer токена или ключ для API ключа
+type AccessClaims struct {
+	UserID    int
+	SessionID string
+	APIKeyID  uint
+	Scopes    []string
+}
+
+// parseAccessToken разбирает Bearer токен из заголовка Authorization и проверяет,
+// что сессия, для которой он выпущен, не отозвана
+func (s *Server) parseAccessToken(r *http.Request) (*AccessClaims, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, errAuthHeaderMissing
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if tokenString == authHeader {
+		return nil, errBearerRequired
+	}
+
+	claims, err := s.signer.Parse(tokenString)
+	if err != nil {
+		s.logger.Debug("JWT parse error for %s: %v", r.URL.Path, err)
+		return nil, errInvalidToken
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok || userID <= 0 {
+		return nil, errInvalidTokenUserID
+	}
+
+	sessionID, _ := claims["sid"].(string)
+	if sessionID == "" {
+		return nil, errInvalidTokenClaims
+	}
+
+	active, err := s.db.IsSessionActive(sessionID)
+	if err != nil || !active {
+		return nil, errSessionRevoked
+	}
+
+	return &AccessClaims{UserID: int(userID), SessionID: sessionID}, nil
+}
+
+// issueTokens создает новую сессию и выдает пару access/refresh токенов
+func (s *Server) issueTokens(user *User, r *http.Request) (*AuthResponse, error) {
+	refreshToken, secretHash, err := newRefreshSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := &Session{
+		ID:         uuid.New().String(),
+		UserID:     user.ID,
+		TokenHash:  secretHash,
+		UserAgent:  r.UserAgent(),
+		IP:         getClientIP(r),
+		ExpiresAt:  now.Add(time.Duration(s.config.RefreshTokenTTLDays) * 24 * time.Hour),
+		LastUsedAt: now,
+	}
+
+	if err := s.db.CreateSession(session); err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return s.buildAuthResponse(user, session.ID, session.ID+"."+refreshToken)
+}
+
+// buildAuthResponse выпускает access токен для сессии и собирает ответ
+func (s *Server) buildAuthResponse(user *User, sessionID, refreshToken string) (*AuthResponse, error) {
+	token, err := s.generateJWT(user.ID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+		User:         *user,
+	}, nil
+}
+
+// newRefreshSecret генерирует случайную часть refresh токена и ее хеш
+func newRefreshSecret() (secret string, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	secret = base64.RawURLEncoding.EncodeToString(buf)
+	return secret, hashToken(secret), nil
+}
+
+// hashToken хеширует токен для хранения в БД
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// splitRefreshToken разделяет refresh токен на ID сессии и секрет
+func splitRefreshToken(token string) (sessionID, secret string, ok bool) {
+	sessionID, secret, ok = strings.Cut(token, ".")
+	return sessionID, secret, ok && sessionID != "" && secret != ""
+}
+
+// @Summary Refresh access token
+// @Description Exchange a refresh token for a new access token. The refresh token is rotated on every use; presenting an already used refresh token revokes the whole session
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body RefreshTokenRequest true "Refresh token"
+// @Success 200 {object} AuthResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /api/token/refresh [post]
+func (s *Server) handleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		s.sendError(w, "Refresh token required", http.StatusBadRequest)
+		return
+	}
+
+	sessionID, secret, ok := splitRefreshToken(req.RefreshToken)
+	if !ok {
+		s.sendError(w, errInvalidRefreshToken.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	session, err := s.db.GetSessionByID(sessionID)
+	if err != nil {
+		s.logger.Warning("Refresh attempt for unknown session %s", sessionID)
+		s.sendError(w, errInvalidRefreshToken.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		s.logger.Warning("Refresh attempt for inactive session %s of user %d", sessionID, session.UserID)
+		s.sendError(w, errSessionRevoked.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	newSecret, newHash, err := newRefreshSecret()
+	if err != nil {
+		s.logger.Error("Failed to generate refresh token: %v", err)
+		s.sendError(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	rotated, err := s.db.RotateSession(sessionID, hashToken(secret), newHash, getClientIP(r))
+	if err != nil {
+		s.logger.Error("Failed to rotate session %s: %v", sessionID, err)
+		s.sendError(w, "Failed to refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	if !rotated {
+		// Токен уже был использован - считаем, что он украден, и отзываем всю сессию
+		s.logger.Warning("Refresh token reuse detected for session %s of user %d - revoking session", sessionID, session.UserID)
+		if err := s.db.RevokeSession(sessionID, RevokeReasonReuse); err != nil {
+			s.logger.Error("Failed to revoke session %s: %v", sessionID, err)
+		}
+		s.sendError(w, errInvalidRefreshToken.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	user, err := s.db.GetUserByID(session.UserID)
+	if err != nil {
+		s.sendError(w, "User not found", http.StatusUnauthorized)
+		return
+	}
+
+	if user.IsSuspended() {
+		s.db.RevokeSession(sessionID, RevokeReasonSuspended)
+		s.sendError(w, "Account suspended", http.StatusForbidden)
+		return
+	}
+
+	response, err := s.buildAuthResponse(user, sessionID, sessionID+"."+newSecret)
+	if err != nil {
+		s.logger.Error("Failed to generate token for user %d: %v", user.ID, err)
+		s.sendError(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	s.logger.Debug("Session %s refreshed for user %d", sessionID, user.ID)
+	s.sendJSON(w, response)
+}
+
+// @Summary Logout
+// @Description Revoke the current session. Its refresh token and all access tokens issued for it stop working
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} SuccessResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /api/logout [post]
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessionID := r.Header.Get("X-Session-ID")
+	if sessionID == "" {
+		s.sendError(w, "No active session", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.db.RevokeSession(sessionID, RevokeReasonLogout); err != nil {
+		s.logger.Error("Failed to revoke session %s: %v", sessionID, err)
+		s.sendError(w, "Failed to logout", http.StatusInternalServerError)
+		return
+	}
+
+	s.logger.Info("Session %s revoked by logout for user %s", sessionID, r.Header.Get("X-User-ID"))
+	s.sendJSON(w, SuccessResponse{Message: "Logged out successfully"})
+}
@@ -0,0 +1,297 @@
+package internal
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	errSSOEmailRequired     = &authError{"Identity provider did not return a verified email"}
+	errSSOEmailConflict     = &authError{"An account with this email already exists; its email must be verified by the identity provider to link it"}
+	errSSOAccountUnverified = &authError{"An account with this email already exists but its email is not verified; verify it or log in with the password to link SSO"}
+)
+
+// @Summary List SSO providers
+// @Description List configured OpenID Connect providers available for single sign-on
+// @Tags auth
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=[]OIDCProviderInfo}
+// @Router /api/auth/oidc/providers [get]
+func (s *Server) handleOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	providers := []OIDCProviderInfo{}
+	for _, provider := range s.oidc.Providers() {
+		providers = append(providers, OIDCProviderInfo{
+			Name:        provider.Name(),
+			DisplayName: provider.config.DisplayName,
+			LoginURL:    "/api/auth/oidc/" + provider.Name() + "/login",
+		})
+	}
+
+	s.sendJSON(w, SuccessResponse{
+		Message: "SSO providers retrieved successfully",
+		Data:    providers,
+	})
+}
+
+// @Summary SSO login
+// @Description GET .../login redirects the browser to the identity provider (authorization code flow with PKCE). The provider redirects back to .../callback, which validates the ID token, signs the user in (creating or linking the account by verified email) and returns the tokens, or redirects to the configured post-login page with tokens in the URL fragment. When the account needs a second factor (enabled 2FA, REQUIRE_2FA or an organization policy), a login challenge is returned the same way instead of tokens; complete it via /api/login/2fa (or /api/login/2fa/setup when enrollment is required). Providers configured with OIDC_<NAME>_REQUIRED_MFA must prove MFA with the amr or acr claim, and then no local second factor is asked
+// @Tags auth
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param code query string false "Authorization code (callback only)"
+// @Param state query string false "Login state (callback only)"
+// @Success 200 {object} AuthResponse
+// @Success 200 {object} LoginChallengeResponse "Second factor required"
+// @Success 302 "Redirect to the identity provider or post-login page"
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /api/auth/oidc/{provider}/login [get]
+// @Router /api/auth/oidc/{provider}/callback [get]
+func (s *Server) handleOIDCActions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/auth/oidc/"), "/")
+	provider, ok := s.oidc.Provider(name)
+	if !ok {
+		s.sendError(w, "Unknown SSO provider", http.StatusNotFound)
+		return
+	}
+
+	switch action {
+	case "login":
+		authURL, err := s.oidc.StartLogin(r.Context(), provider)
+		if err != nil {
+			s.logger.Error("Failed to start SSO login with %s: %v", name, err)
+			s.sendError(w, "Identity provider is unavailable", http.StatusBadGateway)
+			return
+		}
+		http.Redirect(w, r, authURL, http.StatusFound)
+	case "callback":
+		s.handleOIDCCallback(w, r, provider)
+	default:
+		s.sendError(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// Завершение входа через провайдера
+func (s *Server) handleOIDCCallback(w http.ResponseWriter, r *http.Request, provider *OIDCProvider) {
+	query := r.URL.Query()
+
+	if providerError := query.Get("error"); providerError != "" {
+		s.logger.Warning("SSO login with %s failed at provider: %s %s", provider.Name(), providerError, query.Get("error_description"))
+		s.sendError(w, "SSO login failed: "+providerError, http.StatusBadRequest)
+		return
+	}
+
+	pending, err := s.oidc.ConsumeState(query.Get("state"), provider.Name())
+	if err != nil {
+		s.logger.Warning("SSO callback for %s with invalid state", provider.Name())
+		s.sendError(w, "Login session expired, please try again", http.StatusBadRequest)
+		return
+	}
+
+	code := query.Get("code")
+	if code == "" {
+		s.sendError(w, "Authorization code required", http.StatusBadRequest)
+		return
+	}
+
+	idToken, err := provider.Exchange(r.Context(), code, pending.verifier)
+	if err != nil {
+		s.logger.Error("SSO code exchange with %s failed: %v", provider.Name(), err)
+		s.sendError(w, "Failed to complete SSO login", http.StatusBadGateway)
+		return
+	}
+
+	claims, err := provider.VerifyIDToken(r.Context(), idToken, pending.nonce)
+	if err != nil {
+		s.logger.Warning("SSO ID token from %s rejected: %v", provider.Name(), err)
+		s.sendError(w, "Invalid ID token", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := s.resolveOIDCUser(provider, claims)
+	if err != nil {
+		var authErr *authError
+		if errors.As(err, &authErr) {
+			s.logger.Warning("SSO login with %s for subject %s rejected: %v", provider.Name(), claims.Subject, err)
+			s.sendError(w, authErr.Error(), http.StatusForbidden)
+			return
+		}
+		s.logger.Error("Failed to resolve SSO user from %s: %v", provider.Name(), err)
+		s.sendError(w, "Failed to complete SSO login", http.StatusInternalServerError)
+		return
+	}
+
+	if user.IsSuspended() {
+		s.logger.Warning("SSO login rejected - account suspended: %s (ID: %d)", user.Email, user.ID)
+		s.sendError(w, "Account suspended", http.StatusForbidden)
+		return
+	}
+
+	// Локальную 2FA пропускаем, только если провайдер настроен требовать второй фактор
+	// и ID токен это подтвердил
+	if !claims.MFA {
+		challenge, err := s.secondFactorChallenge(user)
+		if err != nil {
+			s.logger.Error("Failed to start second login step for user %d: %v", user.ID, err)
+			s.sendError(w, "Failed to complete SSO login", http.StatusInternalServerError)
+			return
+		}
+		if challenge != nil {
+			s.logger.Info("SSO %s accepted, second factor required for user %d", provider.Name(), user.ID)
+			s.sendSSOChallenge(w, r, provider, challenge)
+			return
+		}
+	}
+
+	response, err := s.issueTokens(user, r)
+	if err != nil {
+		s.logger.Error("Failed to generate token for user %d: %v", user.ID, err)
+		s.sendError(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	s.logger.Info("User logged in via SSO %s: %s (ID: %d)", provider.Name(), user.Email, user.ID)
+
+	if target := provider.config.PostLoginRedirect; target != "" {
+		// Токены во фрагменте не попадают в логи серверов и заголовок Referer
+		fragment := url.Values{
+			"token":         {response.Token},
+			"refresh_token": {response.RefreshToken},
+			"expires_in":    {strconv.Itoa(response.ExpiresIn)},
+		}
+		http.Redirect(w, r, target+"#"+fragment.Encode(), http.StatusFound)
+		return
+	}
+
+	s.sendJSON(w, response)
+}
+
+// sendSSOChallenge передает challenge второго шага входа так же, как токены: во фрагменте
+// адреса после входа или в JSON
+func (s *Server) sendSSOChallenge(w http.ResponseWriter, r *http.Request, provider *OIDCProvider, challenge *LoginChallengeResponse) {
+	if target := provider.config.PostLoginRedirect; target != "" {
+		fragment := url.Values{
+			"two_factor_required": {"true"},
+			"enrollment_required": {strconv.FormatBool(challenge.EnrollmentRequired)},
+			"challenge_token":     {challenge.ChallengeToken},
+			"expires_in":          {strconv.Itoa(challenge.ExpiresIn)},
+		}
+		http.Redirect(w, r, target+"#"+fragment.Encode(), http.StatusFound)
+		return
+	}
+
+	s.sendJSON(w, challenge)
+}
+
+// resolveOIDCUser находит пользователя по внешней учетной записи, связывает ее с существующим
+// пользователем по подтвержденному email или создает нового пользователя при первом входе
+func (s *Server) resolveOIDCUser(provider *OIDCProvider, claims *OIDCClaims) (*User, error) {
+	identity, err := s.db.GetUserIdentity(provider.Name(), claims.Subject)
+	if err == nil {
+		if err := s.db.TouchUserIdentity(identity.ID, claims.Email); err != nil {
+			s.logger.Warning("Failed to update SSO identity %d: %v", identity.ID, err)
+		}
+		return s.db.GetUserByID(identity.UserID)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	email := strings.TrimSpace(claims.Email)
+	if email == "" {
+		return nil, errSSOEmailRequired
+	}
+
+	identity = &UserIdentity{
+		Provider:    provider.Name(),
+		Subject:     claims.Subject,
+		Email:       email,
+		LastLoginAt: time.Now(),
+	}
+
+	existing, err := s.db.GetUserByEmail(email)
+	if err == nil {
+		if err := checkSSOLink(claims, existing); err != nil {
+			return nil, err
+		}
+		identity.UserID = existing.ID
+		if err := s.db.CreateUserIdentity(identity); err != nil {
+			return nil, err
+		}
+		s.logger.Info("SSO identity %s/%s linked to existing user %d", provider.Name(), claims.Subject, existing.ID)
+		return existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if !claims.EmailVerified {
+		return nil, errSSOEmailRequired
+	}
+
+	// Пароль случайный: пользователь входит только через SSO, пока не задаст свой
+	password, err := randomURLToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	verifiedAt := time.Now()
+	user := &User{
+		Email:           email,
+		Password:        password,
+		Name:            ssoDisplayName(claims),
+		Role:            RoleUser,
+		EmailVerifiedAt: &verifiedAt,
+	}
+	if s.isBootstrapAdmin(email) {
+		user.Role = RoleAdmin
+	}
+
+	if err := s.db.CreateUserWithIdentity(user, identity); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("User provisioned via SSO %s: %s (ID: %d)", provider.Name(), user.Email, user.ID)
+	return user, nil
+}
+
+// checkSSOLink проверяет, можно ли связать внешнюю учетную запись с существующим пользователем
+// с тем же email
+func checkSSOLink(claims *OIDCClaims, existing *User) error {
+	// Связываем только по email, подтвержденному провайдером, иначе это захват чужого аккаунта
+	if !claims.EmailVerified {
+		return errSSOEmailConflict
+	}
+	// Локальный аккаунт с неподтвержденным email мог заранее зарегистрировать кто угодно
+	if !existing.EmailVerified() {
+		return errSSOAccountUnverified
+	}
+	return nil
+}
+
+// ssoDisplayName возвращает имя из ID токена или часть email до @
+func ssoDisplayName(claims *OIDCClaims) string {
+	if name := strings.TrimSpace(claims.Name); name != "" {
+		return name
+	}
+	local, _, _ := strings.Cut(claims.Email, "@")
+	return local
+}
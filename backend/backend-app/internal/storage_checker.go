@@ -0,0 +1,282 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"obscura.app/pkg/logger"
+)
+
+// Типы расхождений между БД и хранилищем
+const (
+	IssueMissingOriginal  = "missing_original"
+	IssueMissingProcessed = "missing_processed"
+	IssueTempFile         = "temp_file"
+	IssueOrphanBlob       = "orphan_blob"
+	IssueStatsMismatch    = "stats_mismatch"
+)
+
+// StorageIssue найденное расхождение
+// @Description Discrepancy between database records and files on disk
+type StorageIssue struct {
+	Type        string `json:"type" example:"missing_original" enums:"missing_original,missing_processed,temp_file,orphan_blob,stats_mismatch"`
+	FileID      string `json:"file_id,omitempty" example:"550e8400-e29b-41d4-a716-446655440000"`
+	UserID      uint   `json:"user_id,omitempty" example:"1"`
+	Path        string `json:"path,omitempty" example:"uploads/550e8400-e29b-41d4-a716-446655440000.jpg"`
+	Details     string `json:"details" example:"Original file is missing on disk"`
+	Repaired    bool   `json:"repaired" example:"false"`
+	RepairError string `json:"repair_error,omitempty" example:"permission denied"`
+}
+
+// ConsistencyReport отчет проверки хранилища
+// @Description Storage consistency report
+type ConsistencyReport struct {
+	Repair         bool           `json:"repair" example:"false"`
+	StartedAt      time.Time      `json:"started_at" example:"2025-01-15T09:00:00Z"`
+	DurationMs     int64          `json:"duration_ms" example:"250"`
+	ScannedRecords int            `json:"scanned_records" example:"120"`
+	ScannedBlobs   int            `json:"scanned_blobs" example:"230"`
+	Issues         []StorageIssue `json:"issues"`
+	Summary        map[string]int `json:"summary"`
+}
+
+// StorageChecker проверяет согласованность записей File и файлов на диске
+type StorageChecker struct {
+	uploadPath     string
+	quarantinePath string
+	db             *Database
+	logger         *logger.Logger
+}
+
+// NewStorageChecker создает новый storage checker
+func NewStorageChecker(uploadPath, quarantinePath string, db *Database, logger *logger.Logger) *StorageChecker {
+	return &StorageChecker{
+		uploadPath:     uploadPath,
+		quarantinePath: quarantinePath,
+		db:             db,
+		logger:         logger,
+	}
+}
+
+// Check сканирует БД и хранилище. При repair=true исправляет найденные расхождения:
+// помечает записи как failed, переносит лишние файлы в карантин и поднимает заниженную статистику пользователей
+func (sc *StorageChecker) Check(repair bool) (*ConsistencyReport, error) {
+	report := &ConsistencyReport{
+		Repair:    repair,
+		StartedAt: time.Now(),
+		Issues:    []StorageIssue{},
+		Summary:   map[string]int{},
+	}
+
+	files, err := sc.db.GetAllFiles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load file records: %w", err)
+	}
+	report.ScannedRecords = len(files)
+
+	owned := make(map[string]bool, len(files)*2)
+	status := make(map[string]string, len(files))
+	for _, file := range files {
+		status[file.ID] = file.Status
+		for _, name := range file.BlobNames() {
+			owned[name] = true
+		}
+	}
+
+	onDisk := make(map[string]bool)
+	var stray []StorageIssue
+
+	err = filepath.Walk(sc.uploadPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			sc.logger.Warning("Error accessing file %s: %v", path, err)
+			return nil
+		}
+
+		if info.IsDir() {
+			if isSameDir(path, sc.quarantinePath) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		report.ScannedBlobs++
+		filename := filepath.Base(path)
+		onDisk[filename] = true
+
+		if owned[filename] {
+			return nil
+		}
+
+		// Временные файлы, оставшиеся после ML-сервиса. Файлы идущей обработки не трогаем:
+		// запись еще в статусе processing, а у анонимной загрузки записи нет, поэтому
+		// временный файл считается брошенным только после anonymousFileMaxAge
+		if strings.Contains(filename, "_temp") {
+			fileID := fileIDFromBlobName(filename)
+			if status[fileID] == StatusProcessing || time.Since(info.ModTime()) <= anonymousFileMaxAge {
+				return nil
+			}
+			stray = append(stray, StorageIssue{
+				Type:    IssueTempFile,
+				FileID:  fileID,
+				Path:    path,
+				Details: "Leftover temporary file from ML service",
+			})
+			return nil
+		}
+
+		// Свежие анонимные файлы лежат на диске без записи в БД до очистки
+		if fileIDFromBlobName(filename) != "" && time.Since(info.ModTime()) <= anonymousFileMaxAge {
+			return nil
+		}
+
+		stray = append(stray, StorageIssue{
+			Type:    IssueOrphanBlob,
+			FileID:  fileIDFromBlobName(filename),
+			Path:    path,
+			Details: "File on disk has no database record",
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan upload directory: %w", err)
+	}
+
+	for _, file := range files {
+		// Зараженные файлы перенесены в карантин при загрузке
+		if file.Status == StatusQuarantined {
+			continue
+		}
+		if !onDisk[file.FileName] {
+			issue := StorageIssue{
+				Type:    IssueMissingOriginal,
+				FileID:  file.ID,
+				UserID:  file.UserID,
+				Path:    filepath.Join(sc.uploadPath, file.FileName),
+				Details: "Original file is missing on disk",
+			}
+			if repair {
+				sc.repairRecord(&issue, "Original file is missing from storage")
+			}
+			report.addIssue(issue)
+			continue
+		}
+
+		if file.ProcessedName != "" && !onDisk[file.ProcessedName] {
+			issue := StorageIssue{
+				Type:    IssueMissingProcessed,
+				FileID:  file.ID,
+				UserID:  file.UserID,
+				Path:    filepath.Join(sc.uploadPath, file.ProcessedName),
+				Details: "Processed file is missing on disk",
+			}
+			if repair {
+				sc.repairRecord(&issue, "Processed file is missing from storage")
+			}
+			report.addIssue(issue)
+		}
+	}
+
+	for _, issue := range stray {
+		if repair {
+			sc.quarantine(&issue)
+		}
+		report.addIssue(issue)
+	}
+
+	if err := sc.checkUserStats(report, repair); err != nil {
+		return nil, err
+	}
+
+	report.DurationMs = time.Since(report.StartedAt).Milliseconds()
+	sc.logger.Info("Storage check completed (repair: %v): %d records, %d blobs, %d issues in %dms",
+		repair, report.ScannedRecords, report.ScannedBlobs, len(report.Issues), report.DurationMs)
+
+	return report, nil
+}
+
+// checkUserStats проверяет TotalFiles/TotalSize пользователей. Это накопленная статистика,
+// она не уменьшается при удалении файлов, поэтому может быть только не меньше объема
+// существующих записей. Меньшее значение означает потерянное обновление статистики
+func (sc *StorageChecker) checkUserStats(report *ConsistencyReport, repair bool) error {
+	usage, err := sc.db.GetStoredUsage()
+	if err != nil {
+		return fmt.Errorf("failed to aggregate file usage: %w", err)
+	}
+
+	users, err := sc.db.GetAllUsers()
+	if err != nil {
+		return fmt.Errorf("failed to load users: %w", err)
+	}
+
+	for _, user := range users {
+		actual := usage[user.ID]
+		if user.TotalFiles >= actual.Files && user.TotalSize >= actual.Bytes {
+			continue
+		}
+
+		issue := StorageIssue{
+			Type:   IssueStatsMismatch,
+			UserID: user.ID,
+			Details: fmt.Sprintf("Accumulated stats (%d files, %d bytes) are below stored files (%d files, %d bytes)",
+				user.TotalFiles, user.TotalSize, actual.Files, actual.Bytes),
+		}
+
+		if repair {
+			// Уже удаленные файлы восстановить нельзя, статистика поднимается до существующих
+			err := sc.db.RaiseUserTotals(user.ID, actual.Files, actual.Bytes)
+			if err != nil {
+				issue.RepairError = err.Error()
+			} else {
+				issue.Repaired = true
+			}
+		}
+
+		report.addIssue(issue)
+	}
+
+	return nil
+}
+
+// repairRecord помечает запись как failed с указанием причины
+func (sc *StorageChecker) repairRecord(issue *StorageIssue, reason string) {
+	if err := sc.db.MarkFileFailed(issue.FileID, reason); err != nil {
+		sc.logger.Error("Failed to mark file %s as failed: %v", issue.FileID, err)
+		issue.RepairError = err.Error()
+		return
+	}
+	issue.Repaired = true
+}
+
+// quarantine переносит лишний файл в карантин
+func (sc *StorageChecker) quarantine(issue *StorageIssue) {
+	if err := os.MkdirAll(sc.quarantinePath, 0755); err != nil {
+		issue.RepairError = err.Error()
+		return
+	}
+
+	target := filepath.Join(sc.quarantinePath, filepath.Base(issue.Path))
+	if err := os.Rename(issue.Path, target); err != nil {
+		sc.logger.Error("Failed to quarantine %s: %v", issue.Path, err)
+		issue.RepairError = err.Error()
+		return
+	}
+
+	sc.logger.Info("File moved to quarantine: %s -> %s", issue.Path, target)
+	issue.Repaired = true
+}
+
+// addIssue добавляет расхождение в отчет
+func (r *ConsistencyReport) addIssue(issue StorageIssue) {
+	r.Issues = append(r.Issues, issue)
+	r.Summary[issue.Type]++
+}
+
+// isSameDir проверяет, указывают ли пути на одну директорию
+func isSameDir(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
@@ -0,0 +1,579 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	challengeTokenTTL     = 5 * time.Minute
+	maxChallengeAttempts  = 5
+	settingRequire2FA     = "require_2fa"
+	challengePurpose2FA   = "2fa"
+	challengePurposeSetup = "2fa_enroll"
+)
+
+var (
+	errInvalidChallenge    = &authError{"Invalid or expired challenge token"}
+	errTooManyAttempts     = &authError{"Too many attempts, please log in again"}
+	errInvalidSecondFactor = &authError{"Invalid authentication code"}
+)
+
+// challengeGuard ограничивает число попыток ввода кода для одного challenge токена
+type challengeGuard struct {
+	mu       sync.Mutex
+	attempts map[string]int
+	expires  map[string]time.Time
+}
+
+func newChallengeGuard() *challengeGuard {
+	return &challengeGuard{
+		attempts: make(map[string]int),
+		expires:  make(map[string]time.Time),
+	}
+}
+
+// attempt регистрирует попытку и возвращает false, если лимит исчерпан
+func (g *challengeGuard) attempt(id string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	for key, expiresAt := range g.expires {
+		if now.After(expiresAt) {
+			delete(g.expires, key)
+			delete(g.attempts, key)
+		}
+	}
+
+	g.attempts[id]++
+	g.expires[id] = now.Add(challengeTokenTTL)
+	return g.attempts[id] <= maxChallengeAttempts
+}
+
+// isTwoFactorRequired проверяет глобальное требование 2FA и требования организаций пользователя
+func (s *Server) isTwoFactorRequired(user *User) (bool, error) {
+	required, err := s.globalTwoFactorRequired()
+	if err != nil || required {
+		return required, err
+	}
+	return s.db.IsTwoFactorRequiredByOrganizations(user.ID)
+}
+
+// globalTwoFactorRequired читает глобальную настройку, по умолчанию - значение из конфигурации
+func (s *Server) globalTwoFactorRequired() (bool, error) {
+	value, ok, err := s.db.GetSetting(settingRequire2FA)
+	if err != nil || !ok {
+		return s.config.Require2FA, err
+	}
+	return value == "true", nil
+}
+
+// secondFactorChallenge возвращает challenge, если для входа нужен второй фактор или его подключение
+func (s *Server) secondFactorChallenge(user *User) (*LoginChallengeResponse, error) {
+	purpose := challengePurpose2FA
+	if !user.TwoFactorEnabled() {
+		required, err := s.isTwoFactorRequired(user)
+		if err != nil {
+			return nil, err
+		}
+		if !required {
+			return nil, nil
+		}
+		purpose = challengePurposeSetup
+	}
+
+	token, err := s.generateChallengeToken(user.ID, purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginChallengeResponse{
+		TwoFactorRequired:  true,
+		EnrollmentRequired: purpose == challengePurposeSetup,
+		ChallengeToken:     token,
+		ExpiresIn:          int(challengeTokenTTL.Seconds()),
+	}, nil
+}
+
+// generateChallengeToken выпускает короткоживущий токен второго шага входа.
+// В нем нет sid, поэтому как access токен он не принимается
+func (s *Server) generateChallengeToken(userID uint, purpose string) (string, error) {
+	return s.signer.Sign(jwt.MapClaims{
+		"user_id": userID,
+		"purpose": purpose,
+	}, challengeTokenTTL)
+}
+
+// parseChallengeToken проверяет challenge токен и возвращает пользователя.
+// Каждый вызов расходует одну попытку
+func (s *Server) parseChallengeToken(tokenString, purpose string) (*User, error) {
+	claims, err := s.signer.Parse(tokenString)
+	if err != nil || claims["purpose"] != purpose {
+		return nil, errInvalidChallenge
+	}
+
+	userID, _ := claims["user_id"].(float64)
+	jti, _ := claims["jti"].(string)
+	if userID <= 0 || jti == "" {
+		return nil, errInvalidChallenge
+	}
+
+	if !s.challenges.attempt(jti) {
+		return nil, errTooManyAttempts
+	}
+
+	user, err := s.db.GetUserByID(uint(userID))
+	if err != nil {
+		return nil, errInvalidChallenge
+	}
+	if user.IsSuspended() {
+		return nil, &authError{"Account suspended"}
+	}
+	return user, nil
+}
+
+// verifyTOTP проверяет код аутентификатора и запрещает его повторное использование
+func (s *Server) verifyTOTP(user *User, secret, code string) (int64, bool) {
+	step, ok := validateTOTP(secret, code, time.Now())
+	if !ok || step <= user.TOTPLastStep {
+		return 0, false
+	}
+	return step, true
+}
+
+// verifySecondFactor проверяет TOTP код или одноразовый код восстановления
+func (s *Server) verifySecondFactor(user *User, code, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		used, err := s.db.UseRecoveryCode(user.ID, hashToken(normalizeRecoveryCode(recoveryCode)))
+		if used {
+			s.logger.Warning("Recovery code used by user %d", user.ID)
+		}
+		return used, err
+	}
+
+	step, ok := s.verifyTOTP(user, user.TOTPSecret, code)
+	if !ok {
+		return false, nil
+	}
+	return s.db.AdvanceTOTPStep(user.ID, step)
+}
+
+// issueRecoveryCodes генерирует коды восстановления и их хеши для хранения
+func issueRecoveryCodes() ([]string, []string, error) {
+	codes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = hashToken(code)
+	}
+	return codes, hashes, nil
+}
+
+// startTOTPEnrollment создает новый секрет, ожидающий подтверждения
+func (s *Server) startTOTPEnrollment(w http.ResponseWriter, user *User) {
+	secret, err := newTOTPSecret()
+	if err != nil {
+		s.logger.Error("Failed to generate TOTP secret: %v", err)
+		s.sendError(w, "Failed to start 2FA setup", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.db.SetTOTPPendingSecret(user.ID, secret); err != nil {
+		s.logger.Error("Failed to store TOTP secret for user %d: %v", user.ID, err)
+		s.sendError(w, "Failed to start 2FA setup", http.StatusInternalServerError)
+		return
+	}
+
+	s.logger.Info("2FA setup started for user %d", user.ID)
+	s.sendJSON(w, SuccessResponse{
+		Message: "Add the secret to your authenticator app and confirm with a code",
+		Data: TwoFactorSetupResponse{
+			Secret:     secret,
+			OTPAuthURI: totpURI(secret, user.Email),
+		},
+	})
+}
+
+// confirmTOTPEnrollment включает 2FA, если код подходит к ожидающему секрету. Возвращает коды восстановления
+func (s *Server) confirmTOTPEnrollment(user *User, code string) ([]string, error) {
+	if user.TOTPPendingSecret == "" {
+		return nil, &authError{"2FA setup has not been started"}
+	}
+
+	step, ok := s.verifyTOTP(user, user.TOTPPendingSecret, code)
+	if !ok {
+		return nil, errInvalidSecondFactor
+	}
+
+	codes, hashes, err := issueRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.EnableTOTP(user.ID, user.TOTPPendingSecret, step, hashes); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("2FA enabled for user %d", user.ID)
+	return codes, nil
+}
+
+// @Summary Second login step
+// @Description Complete login with the challenge token returned by /api/login and a TOTP code or a recovery code
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body TwoFactorLoginRequest true "Challenge token and code"
+// @Success 200 {object} AuthResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Router /api/login/2fa [post]
+func (s *Server) handleLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Code == "" && req.RecoveryCode == "" {
+		s.sendError(w, "Code or recovery code required", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.parseChallengeToken(req.ChallengeToken, challengePurpose2FA)
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	ip := getClientIP(r)
+	if !s.checkLoginAllowed(w, user.Email, ip) {
+		return
+	}
+
+	ok, err := s.verifySecondFactor(user, req.Code, req.RecoveryCode)
+	if err != nil {
+		s.logger.Error("Failed to verify second factor for user %d: %v", user.ID, err)
+		s.sendError(w, "Failed to verify code", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		s.logger.Warning("Invalid second factor for user %d", user.ID)
+		s.recordLoginFailure(user.Email, ip, &user.ID)
+		s.sendError(w, errInvalidSecondFactor.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	response, err := s.issueTokens(user, r)
+	if err != nil {
+		s.logger.Error("Failed to generate token for user %d: %v", user.ID, err)
+		s.sendError(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	s.logger.Info("User logged in successfully with 2FA: %s (ID: %d)", user.Email, user.ID)
+	s.sendJSON(w, response)
+}
+
+// @Summary Mandatory 2FA enrollment during login
+// @Description When login returns enrollment_required, POST .../setup returns a new TOTP secret and POST .../confirm enables 2FA with a code from the authenticator, returning recovery codes together with the session tokens
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body TwoFactorLoginRequest true "Challenge token (and code for confirm)"
+// @Success 200 {object} SuccessResponse{data=TwoFactorSetupResponse} "Setup"
+// @Success 200 {object} SuccessResponse{data=RecoveryCodesResponse} "Confirm"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /api/login/2fa/setup [post]
+// @Router /api/login/2fa/confirm [post]
+func (s *Server) handleLoginTwoFactorEnrollment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.parseChallengeToken(req.ChallengeToken, challengePurposeSetup)
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if r.URL.Path == "/api/login/2fa/setup" {
+		s.startTOTPEnrollment(w, user)
+		return
+	}
+
+	codes, err := s.confirmTOTPEnrollment(user, req.Code)
+	if err != nil {
+		s.sendTwoFactorError(w, user.ID, err)
+		return
+	}
+
+	response, err := s.issueTokens(user, r)
+	if err != nil {
+		s.logger.Error("Failed to generate token for user %d: %v", user.ID, err)
+		s.sendError(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	s.sendJSON(w, SuccessResponse{
+		Message: "Two-factor authentication enabled. Store the recovery codes now, they will not be shown again",
+		Data: RecoveryCodesResponse{
+			RecoveryCodes: codes,
+			Auth:          response,
+		},
+	})
+}
+
+// @Summary Manage two-factor authentication
+// @Description GET returns 2FA status. POST .../setup starts enrollment, POST .../confirm enables 2FA and returns recovery codes, POST .../disable turns it off (requires password and code; not allowed when 2FA is mandatory), POST .../recovery-codes replaces recovery codes (requires code)
+// @Tags user
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body TwoFactorCodeRequest false "Authenticator code (and password for disable)"
+// @Success 200 {object} SuccessResponse{data=TwoFactorStatus} "Status"
+// @Success 200 {object} SuccessResponse{data=TwoFactorSetupResponse} "Setup"
+// @Success 200 {object} SuccessResponse{data=RecoveryCodesResponse} "Confirm or new recovery codes"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /api/user/2fa [get]
+// @Router /api/user/2fa/setup [post]
+// @Router /api/user/2fa/confirm [post]
+// @Router /api/user/2fa/disable [post]
+// @Router /api/user/2fa/recovery-codes [post]
+func (s *Server) handleTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.Header.Get("X-User-ID"))
+	if err != nil {
+		s.sendError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.db.GetUserByID(uint(userID))
+	if err != nil {
+		s.sendError(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	action := r.URL.Path[len("/api/user/2fa"):]
+
+	if action == "" {
+		if r.Method != http.MethodGet {
+			s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.sendTwoFactorStatus(w, user)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if action == "/setup" {
+		if user.TwoFactorEnabled() {
+			s.sendError(w, "Two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+		s.startTOTPEnrollment(w, user)
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	switch action {
+	case "/confirm":
+		codes, err := s.confirmTOTPEnrollment(user, req.Code)
+		if err != nil {
+			s.sendTwoFactorError(w, user.ID, err)
+			return
+		}
+		s.sendJSON(w, SuccessResponse{
+			Message: "Two-factor authentication enabled. Store the recovery codes now, they will not be shown again",
+			Data:    RecoveryCodesResponse{RecoveryCodes: codes},
+		})
+	case "/disable":
+		s.handleDisableTwoFactor(w, user, req)
+	case "/recovery-codes":
+		s.handleRegenerateRecoveryCodes(w, user, req)
+	default:
+		s.sendError(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// Отключение 2FA
+func (s *Server) handleDisableTwoFactor(w http.ResponseWriter, user *User, req TwoFactorCodeRequest) {
+	if !user.TwoFactorEnabled() {
+		s.sendError(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	required, err := s.isTwoFactorRequired(user)
+	if err != nil {
+		s.logger.Error("Failed to check 2FA policy for user %d: %v", user.ID, err)
+		s.sendError(w, "Failed to disable 2FA", http.StatusInternalServerError)
+		return
+	}
+	if required {
+		s.sendError(w, "Two-factor authentication is mandatory for your account", http.StatusForbidden)
+		return
+	}
+
+	if !user.CheckPassword(req.Password) {
+		s.sendError(w, "Invalid password", http.StatusUnauthorized)
+		return
+	}
+	if ok, err := s.verifySecondFactor(user, req.Code, ""); err != nil || !ok {
+		s.sendError(w, errInvalidSecondFactor.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err := s.db.DisableTOTP(user.ID); err != nil {
+		s.logger.Error("Failed to disable 2FA for user %d: %v", user.ID, err)
+		s.sendError(w, "Failed to disable 2FA", http.StatusInternalServerError)
+		return
+	}
+
+	s.logger.Info("2FA disabled for user %d", user.ID)
+	s.sendJSON(w, SuccessResponse{Message: "Two-factor authentication disabled"})
+}
+
+// Замена кодов восстановления
+func (s *Server) handleRegenerateRecoveryCodes(w http.ResponseWriter, user *User, req TwoFactorCodeRequest) {
+	if !user.TwoFactorEnabled() {
+		s.sendError(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+	if ok, err := s.verifySecondFactor(user, req.Code, ""); err != nil || !ok {
+		s.sendError(w, errInvalidSecondFactor.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	codes, hashes, err := issueRecoveryCodes()
+	if err == nil {
+		err = s.db.ReplaceRecoveryCodes(user.ID, hashes)
+	}
+	if err != nil {
+		s.logger.Error("Failed to regenerate recovery codes for user %d: %v", user.ID, err)
+		s.sendError(w, "Failed to generate recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	s.logger.Info("Recovery codes regenerated for user %d", user.ID)
+	s.sendJSON(w, SuccessResponse{
+		Message: "New recovery codes generated, previous codes no longer work",
+		Data:    RecoveryCodesResponse{RecoveryCodes: codes},
+	})
+}
+
+// Состояние 2FA пользователя
+func (s *Server) sendTwoFactorStatus(w http.ResponseWriter, user *User) {
+	required, err := s.isTwoFactorRequired(user)
+	if err != nil {
+		s.logger.Error("Failed to check 2FA policy for user %d: %v", user.ID, err)
+		s.sendError(w, "Failed to get 2FA status", http.StatusInternalServerError)
+		return
+	}
+
+	remaining, err := s.db.CountRecoveryCodes(user.ID)
+	if err != nil {
+		s.logger.Error("Failed to count recovery codes for user %d: %v", user.ID, err)
+		s.sendError(w, "Failed to get 2FA status", http.StatusInternalServerError)
+		return
+	}
+
+	s.sendJSON(w, SuccessResponse{
+		Message: "2FA status retrieved",
+		Data: TwoFactorStatus{
+			Enabled:                user.TwoFactorEnabled(),
+			EnabledAt:              user.TOTPEnabledAt,
+			Required:               required,
+			RecoveryCodesRemaining: remaining,
+		},
+	})
+}
+
+// sendTwoFactorError отвечает на ошибку подтверждения 2FA
+func (s *Server) sendTwoFactorError(w http.ResponseWriter, userID uint, err error) {
+	if authErr, ok := err.(*authError); ok {
+		s.sendError(w, authErr.Error(), http.StatusBadRequest)
+		return
+	}
+	s.logger.Error("Failed to enable 2FA for user %d: %v", userID, err)
+	s.sendError(w, "Failed to enable 2FA", http.StatusInternalServerError)
+}
+
+// @Summary Global security policy
+// @Description GET returns whether 2FA is mandatory for all users (admins and auditors). PUT changes it (admins only). Users without 2FA will have to enroll at their next login
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body TwoFactorPolicyRequest false "New policy (PUT only)"
+// @Success 200 {object} SuccessResponse{data=TwoFactorPolicyRequest}
+// @Failure 403 {object} ErrorResponse
+// @Router /api/admin/security [get]
+// @Router /api/admin/security [put]
+func (s *Server) handleAdminSecurity(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		if !s.requireRole(w, r, RoleAdmin) {
+			return
+		}
+
+		var req TwoFactorPolicyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.sendError(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if err := s.db.SetSetting(settingRequire2FA, strconv.FormatBool(req.Require2FA)); err != nil {
+			s.logger.Error("Failed to update 2FA policy: %v", err)
+			s.sendError(w, "Failed to update policy", http.StatusInternalServerError)
+			return
+		}
+		s.logger.Info("Global 2FA requirement set to %v by admin %s", req.Require2FA, r.Header.Get("X-User-ID"))
+	default:
+		s.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	required, err := s.globalTwoFactorRequired()
+	if err != nil {
+		s.logger.Error("Failed to read 2FA policy: %v", err)
+		s.sendError(w, "Failed to get policy", http.StatusInternalServerError)
+		return
+	}
+
+	s.sendJSON(w, SuccessResponse{
+		Message: "Security policy retrieved",
+		Data:    TwoFactorPolicyRequest{Require2FA: required},
+	})
+}
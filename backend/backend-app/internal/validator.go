@@ -1,26 +1,57 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
 	"mime/multipart"
-	"net/http"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
+	"time"
 )
 
+// Коды ошибок проверки загружаемого файла
+const (
+	FileErrorRequired        = "file_required"
+	FileErrorTooLarge        = "file_too_large"
+	FileErrorEmpty           = "file_empty"
+	FileErrorUnreadable      = "file_unreadable"
+	FileErrorExtension       = "unsupported_extension"
+	FileErrorContent         = "unsupported_content"
+	FileErrorContentMismatch = "content_mismatch"
+	FileErrorCorrupt         = "corrupt_media"
+	FileErrorDimensions      = "dimensions_too_large"
+	FileErrorMegapixels      = "too_many_megapixels"
+	FileErrorDuration        = "video_too_long"
+	FileErrorConversion      = "conversion_unavailable"
+	FileErrorMalware         = "malware_detected"
+)
+
+// MediaLimits ограничения содержимого медиафайла, проверяемые по заголовкам до декодирования.
+// Защищают от "бомб декомпрессии": маленький файл может объявить изображение 100000×100000.
+// 0 - без ограничения
+type MediaLimits struct {
+	MaxWidth         int
+	MaxHeight        int
+	MaxMegapixels    float64 // для видео - один кадр
+	MaxVideoDuration time.Duration
+}
+
 // Validator структура для валидации данных
 type Validator struct {
 	maxFileSize       int64
+	mediaLimits       MediaLimits
 	allowedMimeTypes  map[string]bool
 	allowedExtensions map[string]bool
-	allowedBlurTypes  map[string]bool
-	allowedObjects    map[string]bool
+	catalog           *ObjectCatalog // типы объектов и размытия, поддерживаемые ML сервисом
 }
 
 // NewValidator создает новый валидатор
-func NewValidator(maxFileSize int64) *Validator {
+func NewValidator(maxFileSize int64, mediaLimits MediaLimits, catalog *ObjectCatalog) *Validator {
 	return &Validator{
 		maxFileSize: maxFileSize,
+		mediaLimits: mediaLimits,
 		allowedMimeTypes: map[string]bool{
 			// Изображения
 			"image/jpeg": true,
@@ -30,6 +61,9 @@ func NewValidator(maxFileSize int64) *Validator {
 			"image/webp": true,
 			"image/bmp":  true,
 			"image/tiff": true,
+			"image/heic": true,
+			"image/heif": true,
+			"image/avif": true,
 			// Видео
 			"video/mp4":       true,
 			"video/avi":       true,
@@ -50,6 +84,9 @@ func NewValidator(maxFileSize int64) *Validator {
 			".bmp":  true,
 			".tiff": true,
 			".tif":  true,
+			".heic": true,
+			".heif": true,
+			".avif": true,
 			// Видео
 			".mp4":  true,
 			".avi":  true,
@@ -59,92 +96,7 @@ func NewValidator(maxFileSize int64) *Validator {
 			".webm": true,
 			".mkv":  true,
 		},
-		allowedBlurTypes: map[string]bool{
-			"gaussian": true,
-			"motion":   true,
-			"pixelate": true,
-		},
-		allowedObjects: map[string]bool{
-			"face":             true, // лицо
-			"person":           true, // человек
-			"bicycle":          true, // велосипед
-			"car":              true, // автомобиль
-			"motorcycle":       true, // мотоцикл
-			"airplane":         true, // самолет
-			"bus":              true, // автобус
-			"train":            true, // поезд
-			"truck":            true, // грузовик
-			"boat":             true, // лодка
-			"traffic light":    true, // светофор
-			"fire hydrant":     true, // пожарный гидрант
-			"stop sign":        true, // знак стоп
-			"parking meter":    true, // парковочный счетчик
-			"bench":            true, // скамейка
-			"bird":             true, // птица
-			"cat":              true, // кот
-			"dog":              true, // собака
-			"horse":            true, // лошадь
-			"sheep":            true, // овца
-			"cow":              true, // корова
-			"elephant":         true, // слон
-			"bear":             true, // медведь
-			"zebra":            true, // зебра
-			"giraffe":          true, // жираф
-			"backpack":         true, // рюкзак
-			"umbrella":         true, // зонт
-			"handbag":          true, // сумка
-			"tie":              true, // галстук
-			"suitcase":         true, // чемодан
-			"frisbee":          true, // фрисби
-			"skis":             true, // лыжи
-			"snowboard":        true, // сноуборд
-			"sports ball":      true, // спортивный мяч
-			"kite":             true, // воздушный змей
-			"baseball bat":     true, // бейсбольная бита
-			"baseball glove":   true, // бейсбольная перчатка
-			"skateboard":       true, // скейтборд
-			"surfboard":        true, // доска для серфинга
-			"tennis racket":    true, // теннисная ракетка
-			"bottle":           true, // бутылка
-			"wine glass":       true, // бокал для вина
-			"cup":              true, // чашка
-			"fork":             true, // вилка
-			"knife":            true, // нож
-			"spoon":            true, // ложка
-			"bowl":             true, // миска
-			"banana":           true, // банан
-			"apple":            true, // яблоко
-			"sandwich":         true, // бутерброд
-			"orange":           true, // апельсин
-			"broccoli":         true, // брокколи
-			"carrot":           true, // морковь
-			"hot dog":          true, // хот-дог
-			"pizza":            true, // пицца
-			"donut":            true, // пончик
-			"cake":             true, // торт
-			"chair":            true, // стул
-			"couch":            true, // диван
-			"potted plant":     true, // горшечное растение
-			"bed":              true, // кровать
-			"dining table":     true, // обеденный стол
-			"toilet":           true, // туалет
-			"tv":               true, // телевизор
-			"laptop":           true, // ноутбук
-			"mouse":            true, // мышь
-			"remote":           true, // пульт
-			"keyboard":         true, // клавиатура
-			"cell phone":       true, // мобильный телефон
-			"microwave":        true, // микроволновка
-			"oven":             true, // духовка
-			"toaster":          true, // тостер
-			"sink":             true, // раковина
-			"refrigerator":     true, // холодильник
-			"book":             true, // книга
-			"clock":            true, // часы
-			"vase":             true, // ваза
-			"scissors":         true, // ножницы
-			"teddy bear":       true, // плюшевый мишка
-		},
+		catalog: catalog,
 	}
 }
 
@@ -215,62 +167,108 @@ func (v *Validator) ValidateName(name string) error {
 	return nil
 }
 
-// ValidateFile проверяет загружаемый файл
-func (v *Validator) ValidateFile(fileHeader *multipart.FileHeader) error {
+// ValidateFile проверяет загружаемый файл: размер, соответствие содержимого расширению и
+// размеры и длительность из заголовков. Возвращает сведения о файле для дальнейшей обработки
+func (v *Validator) ValidateFile(fileHeader *multipart.FileHeader) (MediaInfo, error) {
 	if fileHeader == nil {
-		return ValidationError{Field: "file", Message: "File is required"}
+		return MediaInfo{}, ValidationError{Field: "file", Message: "File is required", Code: FileErrorRequired}
 	}
 
 	// Проверяем размер файла
 	if fileHeader.Size > v.maxFileSize {
-		return ValidationError{
+		return MediaInfo{}, ValidationError{
 			Field:   "file",
 			Message: fmt.Sprintf("File is too large (max %d MB)", v.maxFileSize/(1024*1024)),
+			Code:    FileErrorTooLarge,
 		}
 	}
 
 	if fileHeader.Size == 0 {
-		return ValidationError{Field: "file", Message: "File is empty"}
+		return MediaInfo{}, ValidationError{Field: "file", Message: "File is empty", Code: FileErrorEmpty}
 	}
 
 	// Проверяем расширение файла
-	filename := strings.ToLower(fileHeader.Filename)
-	isValidExt := false
-	for ext := range v.allowedExtensions {
-		if strings.HasSuffix(filename, ext) {
-			isValidExt = true
-			break
-		}
-	}
-
-	if !isValidExt {
-		return ValidationError{
+	ext := strings.ToLower(filepath.Ext(fileHeader.Filename))
+	if !v.allowedExtensions[ext] {
+		return MediaInfo{}, ValidationError{
 			Field:   "file",
 			Message: "Invalid file type. Only images and videos are allowed",
+			Code:    FileErrorExtension,
 		}
 	}
 
-	// Проверяем MIME-тип
 	file, err := fileHeader.Open()
 	if err != nil {
-		return ValidationError{Field: "file", Message: "Cannot read file"}
+		return MediaInfo{}, ValidationError{Field: "file", Message: "Cannot read file", Code: FileErrorUnreadable}
 	}
 	defer file.Close()
 
-	// Читаем первые 512 байт для определения MIME-типа
-	buffer := make([]byte, 512)
-	_, err = file.Read(buffer)
+	// Формат определяется по содержимому, а не по расширению или Content-Type клиента
+	info, err := probeMedia(file)
+	if info.Format == "" {
+		if errors.Is(err, errUnsupportedFormat) {
+			return info, ValidationError{
+				Field:   "file",
+				Message: "File content is not a supported image or video",
+				Code:    FileErrorContent,
+			}
+		}
+		return info, ValidationError{Field: "file", Message: "Cannot read file content", Code: FileErrorUnreadable}
+	}
+
+	if !slices.Contains(extensionFormats[ext], info.Format) {
+		return info, ValidationError{
+			Field:   "file",
+			Message: fmt.Sprintf("File extension %s does not match its content (%s)", ext, info.Format),
+			Code:    FileErrorContentMismatch,
+		}
+	}
+
 	if err != nil {
-		return ValidationError{Field: "file", Message: "Cannot read file content"}
+		return info, ValidationError{
+			Field:   "file",
+			Message: fmt.Sprintf("File is corrupt or its %s header cannot be read", info.Format),
+			Code:    FileErrorCorrupt,
+		}
 	}
 
-	mimeType := http.DetectContentType(buffer)
+	return info, v.validateMediaLimits(info)
+}
+
+// validateMediaLimits проверяет размеры и длительность медиафайла
+func (v *Validator) validateMediaLimits(info MediaInfo) error {
+	limits := v.mediaLimits
 
-	// Проверяем основной тип MIME
-	if !strings.HasPrefix(mimeType, "image/") && !strings.HasPrefix(mimeType, "video/") {
+	if (limits.MaxWidth > 0 && info.Width > limits.MaxWidth) || (limits.MaxHeight > 0 && info.Height > limits.MaxHeight) {
 		return ValidationError{
 			Field:   "file",
-			Message: "Invalid file type. Only images and videos are allowed",
+			Message: fmt.Sprintf("Dimensions %dx%d exceed the maximum of %dx%d", info.Width, info.Height, limits.MaxWidth, limits.MaxHeight),
+			Code:    FileErrorDimensions,
+		}
+	}
+
+	if limits.MaxMegapixels > 0 && info.Megapixels() > limits.MaxMegapixels {
+		return ValidationError{
+			Field:   "file",
+			Message: fmt.Sprintf("Frame size is %.1f megapixels, the maximum is %g", info.Megapixels(), limits.MaxMegapixels),
+			Code:    FileErrorMegapixels,
+		}
+	}
+
+	// Длину видео без длительности в заголовке не проверить, при ограничении такие файлы не принимаются
+	if limits.MaxVideoDuration > 0 && info.IsVideo() && info.Duration <= 0 {
+		return ValidationError{
+			Field:   "file",
+			Message: fmt.Sprintf("Video duration cannot be determined from the %s header, it is required by the maximum length of %v", info.Format, limits.MaxVideoDuration),
+			Code:    FileErrorDuration,
+		}
+	}
+
+	if limits.MaxVideoDuration > 0 && info.Duration > limits.MaxVideoDuration {
+		return ValidationError{
+			Field:   "file",
+			Message: fmt.Sprintf("Video is %v long, the maximum is %v", info.Duration.Round(time.Second), limits.MaxVideoDuration),
+			Code:    FileErrorDuration,
 		}
 	}
 
@@ -282,10 +280,10 @@ func (v *Validator) ValidateProcessingOptions(options ProcessingOptions) []Valid
 	var errors []ValidationError
 
 	// Проверяем тип блюра
-	if options.BlurType != "" && !v.allowedBlurTypes[options.BlurType] {
+	if options.BlurType != "" && !v.catalog.HasBlurType(options.BlurType) {
 		errors = append(errors, ValidationError{
 			Field:   "blur_type",
-			Message: "Invalid blur type. Allowed values: gaussian, motion, pixelate",
+			Message: fmt.Sprintf("Invalid blur type. Allowed values: %s", strings.Join(v.catalog.BlurTypeIDs(), ", ")),
 		})
 	}
 
@@ -297,13 +295,117 @@ func (v *Validator) ValidateProcessingOptions(options ProcessingOptions) []Valid
 		})
 	}
 
+	// Формат результата выбирается только для изображений
+	if options.OutputFormat != "" && options.OutputFormat != OutputFormatOriginal && options.OutputFormat != OutputFormatJPEG {
+		errors = append(errors, ValidationError{
+			Field:   "output_format",
+			Message: "Invalid output format. Allowed values: original, jpeg",
+		})
+	}
+
 	// Проверяем типы объектов
 	for _, objType := range options.ObjectTypes {
 		objType = strings.ToLower(strings.TrimSpace(objType))
-		if objType != "" && !v.allowedObjects[objType] {
+		if objType != "" && !v.catalog.HasObjectType(objType) {
+			errors = append(errors, ValidationError{
+				Field:   "object_types",
+				Message: fmt.Sprintf("Invalid object type: '%s'. Supported object types are listed at GET /api/capabilities", objType),
+			})
+		}
+	}
+
+	// Области задаются долями кадра и должны целиком помещаться в него
+	if len(options.Regions) > maxProcessingRegions {
+		errors = append(errors, ValidationError{
+			Field:   "regions",
+			Message: fmt.Sprintf("Too many regions (max %d)", maxProcessingRegions),
+		})
+	}
+	for i, region := range options.Regions {
+		if region.X < 0 || region.Y < 0 || region.Width <= 0 || region.Height <= 0 ||
+			region.X+region.Width > 1 || region.Y+region.Height > 1 {
+			errors = append(errors, ValidationError{
+				Field:   "regions",
+				Message: fmt.Sprintf("Region %d must lie within the frame: x, y, width and height are fractions from 0 to 1", i+1),
+			})
+		}
+	}
+
+	return errors
+}
+
+// ValidateProcessingProfileRequest проверяет запрос создания или изменения профиля обработки.
+// Опции проверяются так же, как при загрузке, после подстановки значений по умолчанию
+func (v *Validator) ValidateProcessingProfileRequest(req ProcessingProfileRequest) []ValidationError {
+	var errors []ValidationError
+
+	if !presetNameRegex.MatchString(normalizePresetName(req.Name)) {
+		errors = append(errors, ValidationError{
+			Field:   "name",
+			Message: "Name must be 1-50 characters: lowercase letters, digits, '-' and '_'",
+		})
+	}
+
+	return append(errors, v.ValidateProcessingOptions(req.Options())...)
+}
+
+// ValidateAPIKeyRequest проверяет запрос создания API ключа
+func (v *Validator) ValidateAPIKeyRequest(req CreateAPIKeyRequest) []ValidationError {
+	var errors []ValidationError
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		errors = append(errors, ValidationError{Field: "name", Message: "Name is required"})
+	} else if len(name) > 100 {
+		errors = append(errors, ValidationError{Field: "name", Message: "Name is too long (max 100 characters)"})
+	}
+
+	scopes := normalizeScopes(req.Scopes)
+	if len(scopes) == 0 {
+		errors = append(errors, ValidationError{Field: "scopes", Message: "At least one scope is required"})
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(allowedScopes, scope) {
+			errors = append(errors, ValidationError{
+				Field:   "scopes",
+				Message: fmt.Sprintf("Invalid scope: '%s'. Allowed values: read, upload, delete", scope),
+			})
+		}
+	}
+
+	return errors
+}
+
+// ValidateObjectPresetRequest проверяет запрос создания или изменения набора типов объектов
+func (v *Validator) ValidateObjectPresetRequest(req ObjectPresetRequest) []ValidationError {
+	var errors []ValidationError
+
+	name := normalizePresetName(req.Name)
+	if !presetNameRegex.MatchString(name) {
+		errors = append(errors, ValidationError{
+			Field:   "name",
+			Message: "Name must be 1-50 characters: lowercase letters, digits, '-' and '_'",
+		})
+	} else if builtinPreset(name) != nil {
+		errors = append(errors, ValidationError{
+			Field:   "name",
+			Message: fmt.Sprintf("Name '%s' is reserved for a built-in preset", name),
+		})
+	}
+
+	if len(strings.TrimSpace(req.Label)) > 100 {
+		errors = append(errors, ValidationError{Field: "label", Message: "Label is too long (max 100 characters)"})
+	}
+
+	objectTypes := normalizeObjectTypes(req.ObjectTypes)
+	if len(objectTypes) == 0 {
+		errors = append(errors, ValidationError{Field: "object_types", Message: "At least one object type is required"})
+	}
+	for _, objType := range objectTypes {
+		if !v.catalog.HasObjectType(objType) {
 			errors = append(errors, ValidationError{
 				Field:   "object_types",
-				Message: fmt.Sprintf("Invalid object type: '%s'. Allowed object types can be found in API documentation", objType),
+				Message: fmt.Sprintf("Invalid object type: '%s'. Supported object types are listed at GET /api/capabilities", objType),
 			})
 		}
 	}
@@ -311,6 +413,31 @@ func (v *Validator) ValidateProcessingOptions(options ProcessingOptions) []Valid
 	return errors
 }
 
+// ValidateOrganizationRequest проверяет запрос создания организации
+func (v *Validator) ValidateOrganizationRequest(req CreateOrganizationRequest) []ValidationError {
+	var errors []ValidationError
+
+	name := strings.TrimSpace(req.Name)
+	if len(name) < 2 {
+		errors = append(errors, ValidationError{Field: "name", Message: "Name must be at least 2 characters long"})
+	} else if len(name) > 100 {
+		errors = append(errors, ValidationError{Field: "name", Message: "Name is too long (max 100 characters)"})
+	}
+
+	return errors
+}
+
+// ValidateMemberRole проверяет роль участника организации
+func (v *Validator) ValidateMemberRole(role string) []ValidationError {
+	if isMemberRole(role) {
+		return nil
+	}
+	return []ValidationError{{
+		Field:   "role",
+		Message: fmt.Sprintf("Invalid role: '%s'. Allowed values: %s", role, strings.Join(allowedMemberRoles, ", ")),
+	}}
+}
+
 // ValidateRegistration проверяет данные регистрации
 func (v *Validator) ValidateRegistration(req RegisterRequest) []ValidationError {
 	var errors []ValidationError
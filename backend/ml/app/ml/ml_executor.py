@@ -188,6 +188,7 @@ class MLExecutor:
                 options.object_types,
                 options.intensity,
                 options.blur_type,
+                options.regions,
             )
             result = result.replace('\\', '/')
             self._update_status(filename, FileStatus.COMPLETED, result=result, end_time=time.time())
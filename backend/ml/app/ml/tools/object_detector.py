@@ -7,6 +7,7 @@ from moviepy.editor import VideoFileClip
 
 from app.ml.tools.model import Model
 from app.ml.tools.write_box import BoxProcessor
+from app.schemas.uploadfile import Region
 
 
 class MLObjectDetector:
@@ -63,6 +64,7 @@ class MLObjectDetector:
         blur_type: str,
         min_area: Optional[int] = None,
         min_confidence: Optional[float] = None,
+        regions: Optional[List[Region]] = None,
     ) -> Tuple[List[dict], np.ndarray]:
         """Полный цикл детекции объектов для изображений."""
 
@@ -80,20 +82,46 @@ class MLObjectDetector:
                 boxes_info, min_confidence
             )
 
+        boxes_info.extend(self._region_boxes(image, regions))
+
         result_image = self.box_processor.draw_boxes(
             image, boxes_info, intensity, blur_type
         )
         return boxes_info, result_image
 
+    @staticmethod
+    def _region_boxes(image: np.ndarray, regions: Optional[List[Region]]) -> List[dict]:
+        """Переводит заданные пользователем области из долей кадра в пиксели."""
+        if not regions:
+            return []
+
+        height, width = image.shape[:2]
+        boxes = []
+        for region in regions:
+            x_min = int(region.x * width)
+            y_min = int(region.y * height)
+            x_max = min(width, int(round((region.x + region.width) * width)))
+            y_max = min(height, int(round((region.y + region.height) * height)))
+            if x_max > x_min and y_max > y_min:
+                boxes.append(
+                    {
+                        "coordinates": [x_min, y_min, x_max, y_max],
+                        "confidence": 1.0,
+                        "class_name": "region",
+                    }
+                )
+        return boxes
+
     def process_image(
         self,
         image_path: str,
         object_types: List[str],
         intensity: int,
         blur_type: str,
+        regions: Optional[List[Region]] = None,
     ) -> str:
         boxes_info, result_image = self.detect_objects(
-            image_path, object_types, intensity, blur_type
+            image_path, object_types, intensity, blur_type, regions=regions
         )
         output_path = self._get_output_filename(image_path)
         cv2.imwrite(output_path, result_image)
@@ -105,6 +133,7 @@ class MLObjectDetector:
         object_types: List[str],
         intensity: int,
         blur_type: str,
+        regions: Optional[List[Region]] = None,
     ) -> str:
         cap = cv2.VideoCapture(video_path)
         if not cap.isOpened():
@@ -124,7 +153,7 @@ class MLObjectDetector:
                 if not ret:
                     break
                 _, processed_frame = self.detect_objects(
-                    frame, object_types, intensity, blur_type
+                    frame, object_types, intensity, blur_type, regions=regions
                 )
                 out.write(processed_frame)
         finally:
@@ -165,6 +194,7 @@ class MLObjectDetector:
         object_types: List[str],
         intensity: int,
         blur_type: str,
+        regions: Optional[List[Region]] = None,
     ) -> str:
         """
         Обработка файла.
@@ -174,6 +204,7 @@ class MLObjectDetector:
             object_types: Типы объектов для детекции
             intensity: Интенсивность размытия
             blur_type: Тип размытия
+            regions: Области кадра, размываемые независимо от детекции
             
         Returns:
             Путь к обработанному файлу
@@ -186,9 +217,9 @@ class MLObjectDetector:
         video_extensions = {".mp4", ".avi", ".mov", ".mkv", ".wmv", ".flv"}
 
         if file_ext in image_extensions:
-            return self.process_image(file_path, object_types, intensity, blur_type)
+            return self.process_image(file_path, object_types, intensity, blur_type, regions)
         elif file_ext in video_extensions:
-            return self.process_video(file_path, object_types, intensity, blur_type)
+            return self.process_video(file_path, object_types, intensity, blur_type, regions)
         else:
             raise ValueError(f"Неподдерживаемый формат файла: {file_ext}")
 
@@ -1,10 +1,13 @@
 import asyncio
 import os
 import time
+from typing import get_args
 
-from fastapi import APIRouter, UploadFile, File, Form
+from fastapi import APIRouter, UploadFile, File, Form, HTTPException
 
 from app.schemas.uploadfile import (
+    CapabilitiesResponse,
+    Options,
     ProcessRequest,
     ProcessResponse,
     SuccessResponse,
@@ -27,6 +30,23 @@ except Exception:
     pass
 
 
+@router.get("/capabilities", response_model=CapabilitiesResponse)
+async def capabilities() -> CapabilitiesResponse:
+    """Классы, которые умеют находить загруженные модели, и типы размытия"""
+    object_types = []
+    for model in (detector.face_model, detector.general_model):
+        if model.class_names is None:
+            raise HTTPException(status_code=503, detail="Models are not loaded")
+        for name in model.class_names.values():
+            if name not in object_types:
+                object_types.append(name)
+
+    return CapabilitiesResponse(
+        object_types=object_types,
+        blur_types=list(get_args(Options.__annotations__["blur_type"])),
+    )
+
+
 @router.post("/process", response_model=ProcessResponse)
 async def process_file(request: ProcessRequest) -> ProcessResponse:
     """Обработка файла через очередь воркеров (синхронно для совместимости)"""
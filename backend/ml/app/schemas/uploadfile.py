@@ -3,12 +3,22 @@ from typing import List, Literal, Union
 from pydantic import BaseModel, Field
 
 
+class Region(BaseModel):
+    """Область кадра в долях ширины и высоты, которая размывается целиком."""
+
+    x: float = Field(..., ge=0, le=1)
+    y: float = Field(..., ge=0, le=1)
+    width: float = Field(..., gt=0, le=1)
+    height: float = Field(..., gt=0, le=1)
+
+
 class Options(BaseModel):
     """Параметры обработки файла."""
 
     blur_type: Literal["gaussian", "motion", "pixelate"]
     intensity: int = Field(..., ge=1, le=10)
     object_types: List[str] = Field(default_factory=list)
+    regions: List[Region] = Field(default_factory=list)
 
 
 class ProcessRequest(BaseModel):
@@ -38,3 +48,10 @@ class ErrorResponse(BaseModel):
 
 ProcessResponse = Union[SuccessResponse, ErrorResponse]
 
+
+class CapabilitiesResponse(BaseModel):
+    """Классы объектов загруженных моделей и поддерживаемые типы размытия."""
+
+    object_types: List[str]
+    blur_types: List[str]
+
@@ -251,6 +251,7 @@ export default function HistoryPage() {
     processing: "Обрабатывается",
     completed: "Завершено",
     failed: "Ошибка",
+    quarantined: "В карантине",
   };
 
   useEffect(() => {
@@ -664,7 +665,7 @@ export default function HistoryPage() {
                               <Badge variant="outline" className="border-cyan-400/30 text-cyan-400 text-xs">
                                 {statusMap[file.status] || file.status}
                               </Badge>
-                              {file.status === "failed" && file.error_message && (
+                              {(file.status === "failed" || file.status === "quarantined") && file.error_message && (
                                 <span className="text-red-400 text-xs">{file.error_message}</span>
                               )}
                             </div>
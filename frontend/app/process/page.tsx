@@ -133,6 +133,22 @@ export default function ProcessPage() {
   const [open, setOpen] = useState(false)
   const [progress, setProgress] = useState(0);
   const [isMenuOpen, setIsMenuOpen] = useState(false);
+  const [catalogObjects, setCatalogObjects] = useState<string[]>(YOLO_OBJECTS);
+
+  // Список объектов, которые умеют находить загруженные модели
+  useEffect(() => {
+    fetch(`${API_LINK}/api/capabilities`)
+      .then((res) => (res.ok ? res.json() : null))
+      .then((data) => {
+        const types: { id: string; label: string }[] | undefined = data?.data?.object_types;
+        if (!Array.isArray(types) || types.length === 0) return;
+        types.forEach((type) => {
+          RUS_TO_ENG_MAPPING[type.label.toLowerCase()] = type.id;
+        });
+        setCatalogObjects(types.map((type) => type.label.toLowerCase()));
+      })
+      .catch(() => {});
+  }, []);
 
 
   const objectCategories = {
@@ -171,7 +187,7 @@ export default function ProcessPage() {
   const getFilteredObjects = () => {
     const objects =
       selectedCategory === "all"
-        ? YOLO_OBJECTS
+        ? catalogObjects
         : objectCategories[selectedCategory as keyof typeof objectCategories] || [];
     return objects.filter((obj) => obj.toLowerCase().includes(searchTerm.toLowerCase()));
   };
@@ -179,7 +195,7 @@ export default function ProcessPage() {
   const selectAllInCategory = () => {
     const categoryObjects =
       selectedCategory === "all"
-        ? YOLO_OBJECTS
+        ? catalogObjects
         : objectCategories[selectedCategory as keyof typeof objectCategories] || [];
     setSelectedObjects((prev) => [...new Set([...prev, ...categoryObjects])]);
   };
@@ -187,7 +203,7 @@ export default function ProcessPage() {
   const clearAllInCategory = () => {
     const categoryObjects =
       selectedCategory === "all"
-        ? YOLO_OBJECTS
+        ? catalogObjects
         : objectCategories[selectedCategory as keyof typeof objectCategories] || [];
     setSelectedObjects((prev) => prev.filter((obj) => !categoryObjects.includes(obj)));
   };
@@ -271,8 +287,8 @@ const handleProcess = async () => {
         logout();
         return;
       } else if (res.status === 429 && !isAuthenticated) {
-        alert("Исчерпан лимит в 3 попытки. Попробуйте завтра или войдите в аккаунт.");
-        setFileStatus("❌ Лимит попыток исчерпан");
+        alert(error.message || "Исчерпан бюджет обработки. Попробуйте позже или войдите в аккаунт.");
+        setFileStatus("❌ Бюджет обработки исчерпан");
         return;
       }
       throw new Error(error.message || `Ошибка загрузки: ${res.status}`);
@@ -285,7 +301,7 @@ const handleProcess = async () => {
       throw new Error("Не получен ID файла от сервера");
     }
 
-    const remaining = !isAuthenticated ? res.headers.get("X-RateLimit-Remaining") : null;
+    const remaining = !isAuthenticated ? res.headers.get("X-Budget-Remaining") : null;
     if (remaining !== null) {
       setRateRemaining(parseInt(remaining));
     }
@@ -711,7 +727,7 @@ const pollStatus = async (fileId: string) => {
                   type="file"
                   id="file-upload"
                   className="hidden"
-                  accept="image/jpeg,image/png,image/gif,image/bmp,image/tiff,video/mp4,video/avi,video/mov,video/mkv,video/wmv,video/flv"
+                  accept="image/jpeg,image/png,image/gif,image/bmp,image/tiff,image/heic,image/heif,image/avif,.heic,.heif,.avif,video/mp4,video/avi,video/mov,video/mkv,video/wmv,video/flv"
                   onChange={handleFileSelect}
                 />
                 <label htmlFor="file-upload" className="cursor-pointer">
@@ -729,7 +745,7 @@ const pollStatus = async (fileId: string) => {
               </div>
               {rateRemaining !== null && !isAuthenticated && (
                 <p className="font-manrope text-sm text-white/60 mt-4">
-                  Осталось загрузок сегодня: {rateRemaining}
+                  Осталось единиц обработки сегодня: {rateRemaining}
                 </p>
               )}
             </CardContent>